@@ -0,0 +1,63 @@
+// Package analytics collects visit data for shortened urls.
+package analytics
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/mileusna/useragent"
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+// The device classes a visitor's user agent is parsed into.
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// NewClick builds the click event of the request for the url with the given id.
+func NewClick(r *http.Request, urlID uuid.UUID) store.Click {
+	ua := useragent.Parse(r.UserAgent())
+
+	return store.Click{
+		URLID:     urlID,
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+		Browser:   ua.Name,
+		OS:        ua.OS,
+		Device:    Device(ua),
+		IP:        ClientIP(r),
+		CreatedAt: time.Now(),
+	}
+}
+
+// Device returns the device class of the parsed user agent.
+func Device(ua useragent.UserAgent) string {
+	switch {
+	case ua.Bot:
+		return DeviceBot
+	case ua.Tablet:
+		return DeviceTablet
+	case ua.Mobile:
+		return DeviceMobile
+	case ua.Desktop:
+		return DeviceDesktop
+	}
+	return DeviceUnknown
+}
+
+// ClientIP returns the ip address of the client that sent the request.
+// Behind one of the trusted proxies it relies on middleware.RealIP having rewritten the request's RemoteAddr.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		//RealIP sets RemoteAddr to the bare address from X-Forwarded-For or X-Real-IP.
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,66 @@
+package analytics
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nairobi-gophers/fupisha/encoding"
+)
+
+func TestNewClick(t *testing.T) {
+	tests := []struct {
+		name        string
+		userAgent   string
+		remoteAddr  string
+		wantBrowser string
+		wantOS      string
+		wantDevice  string
+		wantIP      string
+	}{
+		{
+			name:        "desktop browser",
+			userAgent:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36",
+			remoteAddr:  "41.90.64.10:52311",
+			wantBrowser: "Chrome",
+			wantOS:      "Windows",
+			wantDevice:  DeviceDesktop,
+			wantIP:      "41.90.64.10",
+		},
+		{
+			name:        "mobile browser",
+			userAgent:   "Mozilla/5.0 (iPhone; CPU iPhone OS 14_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.1.1 Mobile/15E148 Safari/604.1",
+			remoteAddr:  "[2001:db8::1]:443",
+			wantBrowser: "Safari",
+			wantOS:      "iOS",
+			wantDevice:  DeviceMobile,
+			wantIP:      "2001:db8::1",
+		},
+		{
+			name:        "crawler behind a proxy",
+			userAgent:   "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			remoteAddr:  "66.249.66.1",
+			wantBrowser: "Googlebot",
+			wantDevice:  DeviceBot,
+			wantIP:      "66.249.66.1",
+		},
+	}
+
+	urlID := encoding.GenUniqueID()
+
+	for _, tc := range tests {
+		r := httptest.NewRequest("GET", "/abcdef", nil)
+		r.Header.Set("User-Agent", tc.userAgent)
+		r.Header.Set("Referer", "https://twitter.com/")
+		r.RemoteAddr = tc.remoteAddr
+
+		c := NewClick(r, urlID)
+
+		if c.URLID != urlID || c.Referrer != "https://twitter.com/" || c.UserAgent != tc.userAgent {
+			t.Fatalf("%s: got %+v", tc.name, c)
+		}
+
+		if c.Browser != tc.wantBrowser || c.OS != tc.wantOS || c.Device != tc.wantDevice || c.IP != tc.wantIP {
+			t.Fatalf("%s: got %q %q %q %q want %q %q %q %q", tc.name, c.Browser, c.OS, c.Device, c.IP, tc.wantBrowser, tc.wantOS, tc.wantDevice, tc.wantIP)
+		}
+	}
+}
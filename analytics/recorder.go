@@ -0,0 +1,198 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/sirupsen/logrus"
+)
+
+// The policies for a click recorded while the queue is full.
+const (
+	//OverflowDrop discards the click so the redirect is never slowed down.
+	OverflowDrop = "drop"
+	//OverflowBlock holds the redirect until the queue has room or the request is cancelled.
+	OverflowBlock = "block"
+)
+
+// Recorder defaults used for the zero values of a RecorderConfig.
+const (
+	defaultQueueSize     = 10000
+	defaultBatchSize     = 500
+	defaultFlushInterval = time.Second
+	flushTimeout         = 30 * time.Second
+)
+
+// RecorderConfig declares how clicks are queued and written.
+type RecorderConfig struct {
+	//QueueSize clicks held in memory waiting to be written.
+	QueueSize int
+	//BatchSize clicks written to the store in one go.
+	BatchSize int
+	//FlushInterval longest a partial batch waits before it is written.
+	FlushInterval time.Duration
+	//Overflow what happens to a click recorded while the queue is full. e.g. drop or block
+	Overflow string
+}
+
+// Recorder takes click recording off the redirect path. Clicks are queued in memory and
+// a background worker writes them to the store in batches.
+type Recorder struct {
+	store  store.ClickStore
+	cfg    RecorderConfig
+	logger logrus.FieldLogger
+
+	//mu guards closed, Record holds it for reading while sending so the queue is never closed under it.
+	mu     sync.RWMutex
+	closed bool
+	queue  chan store.Click
+	done   chan struct{}
+
+	dropped uint64
+}
+
+// NewRecorder starts a recorder writing clicks to the given store.
+func NewRecorder(s store.ClickStore, cfg RecorderConfig, logger logrus.FieldLogger) (*Recorder, error) {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+
+	switch cfg.Overflow {
+	case "":
+		cfg.Overflow = OverflowDrop
+	case OverflowDrop, OverflowBlock:
+	default:
+		return nil, fmt.Errorf("analytics: unknown overflow policy: %s", cfg.Overflow)
+	}
+
+	r := &Recorder{
+		store:  s,
+		cfg:    cfg,
+		logger: logger,
+		queue:  make(chan store.Click, cfg.QueueSize),
+		done:   make(chan struct{}),
+	}
+
+	go r.run()
+
+	return r, nil
+}
+
+// Record queues the click for writing. It reports whether the click was queued, a click is
+// dropped when the queue is full under the drop policy, when ctx is done first under the
+// block policy or when the recorder has been closed.
+func (r *Recorder) Record(ctx context.Context, click store.Click) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.closed {
+		atomic.AddUint64(&r.dropped, 1)
+		return false
+	}
+
+	if r.cfg.Overflow == OverflowBlock {
+		select {
+		case r.queue <- click:
+			return true
+		case <-ctx.Done():
+		}
+	} else {
+		select {
+		case r.queue <- click:
+			return true
+		default:
+		}
+	}
+
+	atomic.AddUint64(&r.dropped, 1)
+	return false
+}
+
+// Dropped returns the number of clicks that never made it into the queue.
+func (r *Recorder) Dropped() uint64 {
+	return atomic.LoadUint64(&r.dropped)
+}
+
+// Close stops accepting clicks and waits for everything still queued to be written.
+// It returns ctx's error if ctx is done before the queue is drained.
+func (r *Recorder) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]store.Click, 0, r.cfg.BatchSize)
+
+	for {
+		select {
+		case click, ok := <-r.queue:
+			if !ok {
+				r.flush(batch)
+				return
+			}
+
+			batch = append(batch, click)
+			if len(batch) == r.cfg.BatchSize {
+				r.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				r.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flush writes the batch, falling back to one click at a time when the batch is rejected so
+// that a single bad click, e.g. on a url deleted since the redirect, does not cost the rest.
+func (r *Recorder) flush(batch []store.Click) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	err := r.store.NewClicks(ctx, batch)
+	if err == nil {
+		return
+	}
+
+	r.logger.WithField("clicks", len(batch)).Error(err)
+
+	for _, click := range batch {
+		if _, err := r.store.NewClick(ctx, click); err != nil {
+			r.logger.WithField("url_id", click.URLID).Error(err)
+		}
+	}
+}
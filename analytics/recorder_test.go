@@ -0,0 +1,215 @@
+package analytics
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/nairobi-gophers/fupisha/encoding"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/nairobi-gophers/fupisha/store/memory"
+	"github.com/sirupsen/logrus"
+)
+
+func testLogger() logrus.FieldLogger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func newTestURL(t *testing.T, s *memory.Store) store.URL {
+	ctx := context.Background()
+
+	u, err := s.NewUser(ctx, "test_user@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	url, err := s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://fupisha.io/a", ShortenedURLParam: "abcdef", Dedup: true})
+	if err != nil {
+		t.Fatalf("failed to create url: %s", err)
+	}
+
+	return url
+}
+
+func TestRecorder(t *testing.T) {
+	s := memory.NewStore()
+	url := newTestURL(t, s)
+
+	r, err := NewRecorder(s, RecorderConfig{BatchSize: 64, FlushInterval: time.Hour}, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	const clicks = 1000
+
+	for i := 0; i < clicks; i++ {
+		if !r.Record(ctx, store.Click{URLID: url.ID}) {
+			t.Fatalf("click %d dropped", i)
+		}
+	}
+
+	//the last partial batch is only written because the recorder is closed.
+	if err := r.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.GetClicksByURL(ctx, url.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != clicks {
+		t.Fatalf("got %d clicks want %d", len(got), clicks)
+	}
+
+	if r.Record(ctx, store.Click{URLID: url.ID}) {
+		t.Fatal("want clicks recorded after close dropped")
+	}
+
+	if r.Dropped() != 1 {
+		t.Fatalf("got %d dropped clicks want 1", r.Dropped())
+	}
+}
+
+func TestRecorderFlushInterval(t *testing.T) {
+	s := memory.NewStore()
+	url := newTestURL(t, s)
+
+	r, err := NewRecorder(s, RecorderConfig{FlushInterval: 10 * time.Millisecond}, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close(context.Background())
+
+	ctx := context.Background()
+	r.Record(ctx, store.Click{URLID: url.ID})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := s.GetClicksByURL(ctx, url.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got) == 1 {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("partial batch never flushed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRecorderBadClick(t *testing.T) {
+	s := memory.NewStore()
+	url := newTestURL(t, s)
+
+	r, err := NewRecorder(s, RecorderConfig{}, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	r.Record(ctx, store.Click{URLID: url.ID})
+	r.Record(ctx, store.Click{URLID: encoding.GenUniqueID()})
+	r.Record(ctx, store.Click{URLID: url.ID})
+
+	if err := r.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.GetClicksByURL(ctx, url.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("got %d clicks want 2", len(got))
+	}
+}
+
+// blockingStore holds every write until it is released.
+type blockingStore struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingStore) NewClick(ctx context.Context, click store.Click) (store.Click, error) {
+	return click, nil
+}
+
+func (b *blockingStore) NewClicks(ctx context.Context, clicks []store.Click) error {
+	b.entered <- struct{}{}
+	<-b.release
+	return nil
+}
+
+func (b *blockingStore) GetClicksByURL(ctx context.Context, urlID uuid.UUID) ([]store.Click, error) {
+	return nil, nil
+}
+
+func (b *blockingStore) FindClicks(ctx context.Context, filter store.ClickFilter) ([]store.Click, error) {
+	return nil, nil
+}
+
+func (b *blockingStore) VariantStats(ctx context.Context, urlID uuid.UUID) ([]store.VariantStats, error) {
+	return nil, nil
+}
+
+func TestRecorderOverflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		overflow string
+	}{
+		{name: "drop", overflow: OverflowDrop},
+		{name: "block", overflow: OverflowBlock},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &blockingStore{entered: make(chan struct{}, 1), release: make(chan struct{})}
+
+			r, err := NewRecorder(s, RecorderConfig{QueueSize: 1, BatchSize: 1, Overflow: tc.overflow}, testLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+
+			//the worker picks up the first click and stalls writing it, the second fills the queue.
+			r.Record(ctx, store.Click{})
+			<-s.entered
+			r.Record(ctx, store.Click{})
+
+			ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+			defer cancel()
+
+			if r.Record(ctx, store.Click{}) {
+				t.Fatal("want the click recorded on a full queue dropped")
+			}
+
+			if r.Dropped() != 1 {
+				t.Fatalf("got %d dropped clicks want 1", r.Dropped())
+			}
+
+			close(s.release)
+
+			if err := r.Close(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	if _, err := NewRecorder(&blockingStore{}, RecorderConfig{Overflow: "spill"}, testLogger()); err == nil {
+		t.Fatal("want an error for an unknown overflow policy")
+	}
+}
@@ -1,30 +1,48 @@
 package api
 
 import (
-	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/cors"
 	"github.com/go-chi/render"
+	"github.com/nairobi-gophers/fupisha/analytics"
 	"github.com/nairobi-gophers/fupisha/api/v1/auth"
 	"github.com/nairobi-gophers/fupisha/api/v1/url"
 	"github.com/nairobi-gophers/fupisha/config"
+	"github.com/nairobi-gophers/fupisha/deeplink"
+	"github.com/nairobi-gophers/fupisha/domains"
 	"github.com/nairobi-gophers/fupisha/logging"
+	"github.com/nairobi-gophers/fupisha/params"
+	"github.com/nairobi-gophers/fupisha/policy"
 	"github.com/nairobi-gophers/fupisha/provider"
+	"github.com/nairobi-gophers/fupisha/reserved"
+	"github.com/nairobi-gophers/fupisha/routing"
 	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
 // ApiConfig declares the required api server dependencies.
 type ApiConfig struct {
-	Logger     *logrus.Logger
-	Cfg        *config.Config
-	Store      store.Store
-	Mailer     *provider.Mailer
+	Logger *logrus.Logger
+	Cfg    *config.Config
+	Store  store.Store
+	Mailer *provider.Mailer
+	Clicks *analytics.Recorder
+	//Policy decides which destinations can be shortened, the configured policy is used when it is nil.
+	Policy *policy.Policy
+	//Router chooses where routed short urls send their visitors, the configured router is used when it is nil.
+	Router *routing.Router
+	//Params generates the params of short urls, the configured generator is used when it is nil.
+	Params *params.Generator
+	//Resolver looks up the TXT records verifying custom domains, the system resolver is used when it is nil.
+	Resolver   domains.Resolver
 	EnableCORS bool
 }
 
@@ -34,11 +52,51 @@ func New(apiCfg *ApiConfig) (*chi.Mux, error) {
 	authResource := auth.NewResource(apiCfg.Store, apiCfg.Cfg, apiCfg.Mailer)
 	urlResource := url.NewResource(apiCfg.Store, apiCfg.Cfg)
 
+	logo, err := apiCfg.Cfg.GetQRLogo()
+	if err != nil {
+		return nil, err
+	}
+	urlResource.Logo = logo
+
+	if apiCfg.Policy == nil {
+		if apiCfg.Policy, err = apiCfg.Cfg.GetPolicy(); err != nil {
+			return nil, err
+		}
+	}
+	urlResource.Policy = apiCfg.Policy
+	urlResource.Verifier = domains.NewVerifier(apiCfg.Resolver)
+
+	if apiCfg.Params == nil {
+		apiCfg.Params = apiCfg.Cfg.GetParams()
+	}
+	urlResource.Params = apiCfg.Params
+
+	if apiCfg.Router == nil {
+		if apiCfg.Router, err = apiCfg.Cfg.GetRouter(); err != nil {
+			return nil, err
+		}
+	}
+
+	guard, err := apiCfg.Cfg.GetGuard()
+	if err != nil {
+		return nil, err
+	}
+
+	proxies, err := apiCfg.Cfg.GetTrustedProxies()
+	if err != nil {
+		return nil, err
+	}
+
 	r := chi.NewRouter()
-	r.Use(middleware.Recoverer)
+	r.Use(recoverer)
 	r.Use(middleware.RequestID)
+	//Clients could forge the headers carrying their address, only trusted proxies are believed.
+	if len(proxies) > 0 {
+		r.Use(realIP(proxies))
+	}
 	r.Use(middleware.StripSlashes)
-	r.Use(middleware.Timeout(15 * time.Second))
+	//Exports stream for as long as they take, extending their write deadline as they go.
+	r.Use(timeout(15*time.Second, "/url/export"))
 	r.Use(logging.NewStructuredLogger(apiCfg.Logger))
 	r.Use(render.SetContentType(render.ContentTypeJSON))
 
@@ -51,17 +109,81 @@ func New(apiCfg *ApiConfig) (*chi.Mux, error) {
 	r.Mount("/auth", authResource.Router())
 	r.Mount("/url", urlResource.Router())
 
-	//Redirect shortened urls
-	r.Get("/{urlParam}", func(w http.ResponseWriter, r *http.Request) {
+	//Redirect shortened urls on the short domain the request was sent to, protected ones take their
+	//password posted to the same url.
+	redirect := func(w http.ResponseWriter, r *http.Request) {
 		param := chi.URLParam(r, "urlParam")
-		u, err := apiCfg.Store.GetURLByParam(r.Context(), param)
+
+		domain, err := urlResource.RequestDomain(r)
+		if err != nil {
+			logging.GetLogEntry(r).WithField("host", r.Host).Error(err)
+			render.Render(w, r, url.ErrInternalServerError)
+			return
+		}
+
+		u, err := apiCfg.Store.GetDomainURLByParam(r.Context(), domain.Host, param)
 		if err != nil {
 			logging.GetLogEntry(r).WithField("param", param).Error(err)
-			render.Render(w, r, url.ErrURLNotFound(errors.New("not found")))
+			url.RenderNotFound(w, r, domain)
 			return
 		}
-		http.Redirect(w, r, u.OriginalURL, http.StatusFound)
-	})
+
+		now := time.Now()
+
+		if !u.Started(now) {
+			renderUnavailable(w, r, u, url.ErrURLNotFound(errors.New("not found")))
+			return
+		}
+
+		if u.Expired(now) {
+			renderUnavailable(w, r, u, url.ErrURLGone(url.ErrURLExpired))
+			return
+		}
+
+		if !guard.Unlock(w, r, u) {
+			return
+		}
+
+		destination, variant := apiCfg.Router.Destination(w, r, u, now)
+
+		click := analytics.NewClick(r, u.ID)
+		click.Variant = variant
+
+		if u.MaxClicks != nil {
+			//a capped url counts the click before redirecting, so the last click is never handed out twice.
+			_, err := apiCfg.Store.NewClick(r.Context(), click)
+			if errors.Cause(err) == store.ErrClickLimit {
+				renderUnavailable(w, r, u, url.ErrURLGone(err))
+				return
+			}
+			if err != nil {
+				logging.GetLogEntry(r).WithField("param", param).Error(err)
+			}
+		} else if !apiCfg.Clicks.Record(r.Context(), click) {
+			//the click is written in the background, a full queue should never cost the visitor their redirect.
+			logging.GetLogEntry(r).WithField("param", param).Warn("click dropped")
+		}
+
+		deeplink.Redirect(w, r, u.AppLinks, destination)
+	}
+
+	//Custom domains send the visitors of the domain itself to their root url.
+	r.Get("/", urlResource.HandleDomainRoot)
+
+	r.Get("/{urlParam}", redirect)
+	r.Post("/{urlParam}", redirect)
+	r.Get("/{urlParam}+", urlResource.HandlePreview)
+	r.Get("/{urlParam}/qr", urlResource.HandleParamQR)
+
+	//Let the mobile apps open short links.
+	apps := apiCfg.Cfg.GetApps()
+	r.Get("/.well-known/apple-app-site-association", apps.HandleAppleAppSiteAssociation)
+	r.Get("/apple-app-site-association", apps.HandleAppleAppSiteAssociation)
+	r.Get("/.well-known/assetlinks.json", apps.HandleAssetLinks)
+
+	//Expand short links to where they go without following them.
+	r.Get("/expand", urlResource.HandleExpand)
+	r.Post("/expand", urlResource.HandleExpandBatch)
 
 	r.Get("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintln(w, "User-agent: *\nDisallow: /")
@@ -71,6 +193,14 @@ func New(apiCfg *ApiConfig) (*chi.Mux, error) {
 		w.Write([]byte("pong"))
 	})
 
+	//Nothing can be shortened to a param that one of the routes above already answers to.
+	if err := chi.Walk(r, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		reserved.RegisterRoute(route)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
 	// walkFunc := func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
 	// 	route = strings.Replace(route, "/*/", "/", -1)
 	// 	fmt.Printf("%s %s\n", method, route)
@@ -88,6 +218,77 @@ func New(apiCfg *ApiConfig) (*chi.Mux, error) {
 	return r, nil
 }
 
+// recoverer recovers from panics like middleware.Recoverer but lets http.ErrAbortHandler through, which
+// middleware.Recoverer swallows. The server then cuts the connection of a download failing part way
+// through instead of ending the response as if it were complete.
+func recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		aborted := false
+
+		middleware.Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if rvr := recover(); rvr == http.ErrAbortHandler {
+					aborted = true
+				} else if rvr != nil {
+					panic(rvr)
+				}
+			}()
+
+			next.ServeHTTP(w, r)
+		})).ServeHTTP(w, r)
+
+		if aborted {
+			panic(http.ErrAbortHandler)
+		}
+	})
+}
+
+// timeout cancels the context of requests after d like middleware.Timeout, except the ones to the
+// streamed paths.
+func timeout(d time.Duration, streamed ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		limited := middleware.Timeout(d)(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := strings.TrimSuffix(r.URL.Path, "/")
+			for _, s := range streamed {
+				if path == s {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			limited.ServeHTTP(w, r)
+		})
+	}
+}
+
+// realIP sets the remote address of requests sent by one of the proxies to the client address of their
+// X-Forwarded-For or X-Real-IP header, the requests of anybody else are left as they are.
+func realIP(proxies []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		forwarded := middleware.RealIP(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+
+			if ip := net.ParseIP(host); ip != nil {
+				for _, proxy := range proxies {
+					if proxy.Contains(ip) {
+						forwarded.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func corsConfig() *cors.Cors {
 	return cors.New(cors.Options{
 
@@ -100,3 +301,13 @@ func corsConfig() *cors.Cors {
 		OptionsPassthrough: false,
 	})
 }
+
+// renderUnavailable sends the visitor of a url that is not live to its fallback url, or answers with the error when it has none.
+func renderUnavailable(w http.ResponseWriter, r *http.Request, u store.URL, errResp render.Renderer) {
+	if u.FallbackURL != "" {
+		http.Redirect(w, r, u.FallbackURL, http.StatusFound)
+		return
+	}
+
+	render.Render(w, r, errResp)
+}
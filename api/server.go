@@ -9,14 +9,25 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/nairobi-gophers/fupisha/analytics"
 	"github.com/nairobi-gophers/fupisha/config"
+	"github.com/nairobi-gophers/fupisha/expiry"
 	"github.com/nairobi-gophers/fupisha/logging"
+	"github.com/nairobi-gophers/fupisha/policy"
 	"github.com/nairobi-gophers/fupisha/provider"
+	"github.com/nairobi-gophers/fupisha/routing"
+	"github.com/nairobi-gophers/fupisha/store/cache"
 )
 
 // Server defines our server dependencies
 type Server struct {
 	*http.Server
+	clicks  *analytics.Recorder
+	sweeper *expiry.Sweeper
+	policy  *policy.Policy
+	router  *routing.Router
+	//stopStats stops logging the cache counters.
+	stopStats context.CancelFunc
 }
 
 // NewServer creates and configures an fupisha API Server serving all application routes.
@@ -40,11 +51,29 @@ func NewServer() (*Server, error) {
 		return nil, err
 	}
 
+	clicks, err := cfg.GetRecorder(store, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	destinations, err := cfg.GetPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	router, err := cfg.GetRouter()
+	if err != nil {
+		return nil, err
+	}
+
 	apiCfg := &ApiConfig{
 		Logger:     logger,
 		Store:      store,
 		Cfg:        cfg,
 		Mailer:     mailer,
+		Clicks:     clicks,
+		Policy:     destinations,
+		Router:     router,
 		EnableCORS: false,
 	}
 
@@ -60,7 +89,12 @@ func NewServer() (*Server, error) {
 		Addr:         ":" + cfg.Port,
 		Handler:      api,
 	}
-	return &Server{&srv}, nil
+	stats, stopStats := context.WithCancel(context.Background())
+	if cached, ok := store.(*cache.Store); ok {
+		go cached.LogStats(stats, logger, time.Duration(cfg.Cache.StatsInterval)*time.Second)
+	}
+
+	return &Server{&srv, clicks, cfg.GetSweeper(store, logger), destinations, router, stopStats}, nil
 }
 
 // Start runs ListenAndServe on the http.Server with graceful shutdown.
@@ -74,6 +108,25 @@ func (srv *Server) Start() {
 	}()
 	log.Printf("Listening on %s\n", srv.Addr)
 
+	//SIGHUP reloads the destination policy and the geoip database, e.g. after the blocklist file changed.
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := srv.policy.Reload(); err != nil {
+				log.Println("Could not reload the destination policy:", err)
+			} else {
+				log.Println("Destination policy reloaded.")
+			}
+
+			if err := srv.router.Reload(); err != nil {
+				log.Println("Could not reload the geoip database:", err)
+			} else {
+				log.Println("GeoIP database reloaded.")
+			}
+		}
+	}()
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	sig := <-quit
@@ -84,5 +137,12 @@ func (srv *Server) Start() {
 	if err := srv.Shutdown(context.Background()); err != nil {
 		panic(err)
 	}
+
+	//no handler can queue a click any more, write out whatever is still waiting.
+	if err := srv.clicks.Close(context.Background()); err != nil {
+		panic(err)
+	}
+	srv.sweeper.Close()
+	srv.stopStats()
 	log.Println("Fupisha API server gracefully stopped.")
 }
@@ -0,0 +1,193 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nairobi-gophers/fupisha/api"
+	"github.com/nairobi-gophers/fupisha/config"
+	"github.com/nairobi-gophers/fupisha/logging"
+	"github.com/nairobi-gophers/fupisha/provider"
+	"github.com/nairobi-gophers/fupisha/store/memory"
+)
+
+func TestAppLinks(t *testing.T) {
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.JWT.Secret) == 0 {
+		cfg.JWT.Secret = "c4c0f2c42bde58f4d5f453483b3bed2b2915779cacff15526b2560b00748ec36"
+	}
+
+	if cfg.JWT.ExpireDelta == 0 {
+		cfg.JWT.ExpireDelta = 6
+	}
+
+	cfg.Apps.IOS = "ABCDE12345.io.fupisha.app"
+
+	ctx := context.Background()
+
+	db := memory.NewStore()
+
+	owner, err := db.NewUser(ctx, "owner@fupisha.io", "ih@veaStr0ngpassword")
+	if err != nil {
+		t.Fatalf("could not create test user %q", err)
+	}
+
+	jwtService, err := provider.NewJWTService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwtService.Encode(owner.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logging.NewLogger(cfg)
+	logger.SetOutput(io.Discard)
+
+	recorder, err := cfg.GetRecorder(db, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apiHandler, err := api.New(&api.ApiConfig{
+		Logger: logger,
+		Cfg:    cfg,
+		Store:  db,
+		Clicks: recorder,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Api", "v1")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		apiHandler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		wantBody string
+	}{
+		{
+			name:     "Script instead of a deep link",
+			body:     `{"url":"https://fupisha.io/a","app_links":{"ios":"javascript:alert(1)"}}`,
+			wantBody: "must be a deep link",
+		},
+		{
+			name:     "Deep link without a scheme",
+			body:     `{"url":"https://fupisha.io/a","app_links":{"android":"product/7"}}`,
+			wantBody: "must be a deep link",
+		},
+		{
+			name:     "Store page that is not a url",
+			body:     `{"url":"https://fupisha.io/a","app_links":{"ios_store":"app store"}}`,
+			wantBody: "ios_store: must be a valid URL",
+		},
+		{
+			name:     "Desktop destination refused by the policy",
+			body:     `{"url":"https://fupisha.io/a","app_links":{"desktop":"ftp://go.dev/a"}}`,
+			wantBody: "app_links.desktop",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := do("POST", "/url/shorten", tc.body)
+
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("got status %d want %d, body %q", rr.Code, http.StatusUnprocessableEntity, rr.Body.String())
+			}
+
+			if !strings.Contains(rr.Body.String(), tc.wantBody) {
+				t.Fatalf("got body %q want it to contain %q", rr.Body.String(), tc.wantBody)
+			}
+		})
+	}
+
+	rr := do("POST", "/url/shorten", `{
+		"url":"https://fupisha.io/a",
+		"alias":"app",
+		"app_links":{
+			"ios":" acme://product/7 ",
+			"android":"acme://product/7",
+			"ios_store":"https://apps.apple.com/app/id42"
+		}
+	}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("shortening with app links returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	const iPhone = "Mozilla/5.0 (iPhone; CPU iPhone OS 16_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.5 Mobile/15E148 Safari/604.1"
+	const android = "Mozilla/5.0 (Linux; Android 13; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/115.0.0.0 Mobile Safari/537.36"
+	const windows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/115.0.0.0 Safari/537.36"
+
+	visit := func(ua string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := httptest.NewRequest("GET", "/app", nil)
+		req.Header.Set("User-Agent", ua)
+
+		rr := httptest.NewRecorder()
+		apiHandler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := visit(iPhone); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "https://apps.apple.com/app/id42") {
+		t.Fatalf("visiting from an iPhone returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	if rr := visit(android); rr.Code != http.StatusFound || !strings.HasPrefix(rr.Header().Get("Location"), "intent://product/7#Intent;scheme=acme;") {
+		t.Fatalf("visiting from an Android phone returned %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	if rr := visit(windows); rr.Code != http.StatusFound || rr.Header().Get("Location") != "https://fupisha.io/a" {
+		t.Fatalf("visiting from a desktop returned %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	u, err := db.GetURLByParam(ctx, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rr = do("PATCH", "/url/"+u.ID.String(), `{"app_links":{}}`); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"app_links":{}`) {
+		t.Fatalf("removing the app links returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	if rr := visit(iPhone); rr.Code != http.StatusFound || rr.Header().Get("Location") != "https://fupisha.io/a" {
+		t.Fatalf("visiting from an iPhone without app links returned %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	//the association files are served whatever the api version.
+	for path, want := range map[string]int{
+		"/.well-known/apple-app-site-association": http.StatusOK,
+		"/apple-app-site-association":             http.StatusOK,
+		"/.well-known/assetlinks.json":            http.StatusNotFound,
+	} {
+		rr := httptest.NewRecorder()
+		apiHandler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+
+		if rr.Code != want {
+			t.Fatalf("GET %s returned %d want %d", path, rr.Code, want)
+		}
+	}
+}
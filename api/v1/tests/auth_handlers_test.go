@@ -14,7 +14,7 @@ import (
 	"github.com/nairobi-gophers/fupisha/encoding"
 	"github.com/nairobi-gophers/fupisha/logging"
 	"github.com/nairobi-gophers/fupisha/provider"
-	"github.com/nairobi-gophers/fupisha/store/postgres"
+	"github.com/nairobi-gophers/fupisha/store/memory"
 )
 
 func TestAuth(t *testing.T) {
@@ -23,8 +23,7 @@ func TestAuth(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	store, teardown := postgres.NewTestDatabase(t)
-	t.Cleanup(teardown)
+	store := memory.NewStore()
 
 	mailer, err := provider.NewMailerWithSMTP(cfg, "../../../templates")
 	if err != nil {
@@ -48,14 +47,22 @@ func TestAuth(t *testing.T) {
 	logger := logging.NewLogger(cfg)
 	logger.SetOutput(io.Discard)
 
+	recorder, err := cfg.GetRecorder(store, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	testCfg := &api.ApiConfig{
 		Logger:     logger,
 		Cfg:        cfg,
 		Store:      store,
 		Mailer:     mailer,
+		Clicks:     recorder,
 		EnableCORS: false,
 	}
 
+	t.Cleanup(func() { recorder.Close(ctx) })
+
 	apiHandler, err := api.New(testCfg)
 	if err != nil {
 		t.Fatal(err)
@@ -0,0 +1,245 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nairobi-gophers/fupisha/api"
+	"github.com/nairobi-gophers/fupisha/config"
+	"github.com/nairobi-gophers/fupisha/encoding"
+	"github.com/nairobi-gophers/fupisha/logging"
+	"github.com/nairobi-gophers/fupisha/provider"
+	"github.com/nairobi-gophers/fupisha/store/memory"
+)
+
+type testBulkResponse struct {
+	Created int `json:"created"`
+	Failed  int `json:"failed"`
+	Results []struct {
+		Row    int    `json:"row"`
+		Status string `json:"status"`
+		Link   string `json:"link"`
+		Error  string `json:"error"`
+	} `json:"results"`
+}
+
+func TestBulkShorten(t *testing.T) {
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.JWT.Secret) == 0 {
+		cfg.JWT.Secret = "c4c0f2c42bde58f4d5f453483b3bed2b2915779cacff15526b2560b00748ec36"
+	}
+
+	if cfg.JWT.ExpireDelta == 0 {
+		cfg.JWT.ExpireDelta = 6
+	}
+
+	cfg.Bulk.MaxRows = 5
+	cfg.Bulk.MaxProtectedRows = 2
+
+	ctx := context.Background()
+
+	db := memory.NewStore()
+
+	owner, err := db.NewUser(ctx, "owner@fupisha.io", "ih@veaStr0ngpassword")
+	if err != nil {
+		t.Fatalf("could not create test user %q", err)
+	}
+
+	jwtService, err := provider.NewJWTService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwtService.Encode(owner.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logging.NewLogger(cfg)
+	logger.SetOutput(io.Discard)
+
+	recorder, err := cfg.GetRecorder(db, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { recorder.Close(ctx) })
+
+	apiHandler, err := api.New(&api.ApiConfig{
+		Logger: logger,
+		Cfg:    cfg,
+		Store:  db,
+		Clicks: recorder,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bulk := func(query, contentType string, body io.Reader) (int, testBulkResponse) {
+		t.Helper()
+
+		req, err := http.NewRequest("POST", "/url/bulk"+query, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Api", "v1")
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", contentType)
+
+		rr := httptest.NewRecorder()
+		apiHandler.ServeHTTP(rr, req)
+
+		var resp testBulkResponse
+		if strings.Contains(rr.Body.String(), `"results"`) {
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("could not decode %q: %s", rr.Body.String(), err)
+			}
+		}
+		return rr.Code, resp
+	}
+
+	statuses := func(resp testBulkResponse) []string {
+		var got []string
+		for _, result := range resp.Results {
+			got = append(got, result.Status)
+		}
+		return got
+	}
+
+	links := func() int {
+		t.Helper()
+		urls, err := db.GetURLsByOwner(ctx, owner.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(urls)
+	}
+
+	code, resp := bulk("", "application/json", strings.NewReader(`[
+		{"url":"https://fupisha.io/a"},
+		{"url":"not a url"},
+		{"url":"https://fupisha.io/b","alias":"summit","tags":["Launch"]},
+		{"url":"https://fupisha.io/a"},
+		{"url":"https://fupisha.io/c","alias":"api"}
+	]`))
+
+	if code != http.StatusMultiStatus || resp.Created != 3 || resp.Failed != 2 {
+		t.Fatalf("got %d %+v want three links and two failures", code, resp)
+	}
+
+	if got, want := statuses(resp), []string{"created", "failed", "created", "existing", "failed"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got statuses %v want %v", got, want)
+	}
+
+	if resp.Results[3].Link != resp.Results[0].Link || !strings.HasSuffix(resp.Results[2].Link, "/summit") {
+		t.Fatalf("got %+v want the dedup row to share the first link", resp.Results)
+	}
+
+	if !strings.Contains(resp.Results[1].Error, "url") || resp.Results[4].Error != "alias is not available" {
+		t.Fatalf("got %+v want the failures explained", resp.Results)
+	}
+
+	summit, err := db.GetURLByParam(ctx, "summit")
+	if err != nil || !reflect.DeepEqual([]string(summit.Tags), []string{"launch"}) {
+		t.Fatalf("got %+v, %v want the alias row created with its tags", summit, err)
+	}
+
+	before := links()
+
+	code, resp = bulk("?atomic=true", "application/json", strings.NewReader(`[
+		{"url":"https://fupisha.io/d"},
+		{"url":"https://fupisha.io/e","alias":"summit"}
+	]`))
+
+	if code != http.StatusUnprocessableEntity || !reflect.DeepEqual(statuses(resp), []string{"skipped", "failed"}) || links() != before {
+		t.Fatalf("got %d %+v want the whole batch rolled back", code, resp)
+	}
+
+	code, resp = bulk("?atomic=true", "application/json", strings.NewReader(`[
+		{"url":"https://fupisha.io/d"},
+		{"url":"https://fupisha.io/f","max_clicks":0}
+	]`))
+
+	if code != http.StatusUnprocessableEntity || !reflect.DeepEqual(statuses(resp), []string{"skipped", "failed"}) || links() != before {
+		t.Fatalf("got %d %+v want an invalid row to stop the batch", code, resp)
+	}
+
+	code, resp = bulk("?atomic=true", "application/json", strings.NewReader(`[
+		{"url":"https://fupisha.io/d"},
+		{"url":"https://fupisha.io/d"},
+		{"url":"https://fupisha.io/a"}
+	]`))
+
+	if code != http.StatusCreated || !reflect.DeepEqual(statuses(resp), []string{"created", "existing", "existing"}) || links() != before+1 {
+		t.Fatalf("got %d %+v want the batch created once per url", code, resp)
+	}
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	fw, err := mw.CreateFormFile("file", "links.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte("URL,alias,expires_at,tags\nhttps://fupisha.io/g,csv-alias,2999-01-01T00:00:00Z,\"docs, launch\"\nhttps://fupisha.io/h,,yesterday,\n"))
+	mw.Close()
+
+	code, resp = bulk("", mw.FormDataContentType(), &form)
+
+	if code != http.StatusMultiStatus || !reflect.DeepEqual(statuses(resp), []string{"created", "failed"}) || !strings.Contains(resp.Results[1].Error, "expires_at") {
+		t.Fatalf("got %d %+v want the csv rows shortened", code, resp)
+	}
+
+	fromCSV, err := db.GetURLByParam(ctx, "csv-alias")
+	if err != nil || fromCSV.ExpiresAt == nil || !reflect.DeepEqual([]string(fromCSV.Tags), []string{"docs", "launch"}) {
+		t.Fatalf("got %+v, %v want the csv row created with its expiry and tags", fromCSV, err)
+	}
+
+	if code, _ := bulk("", "text/csv", strings.NewReader("url,color\nhttps://fupisha.io/i,red\n")); code != http.StatusUnprocessableEntity {
+		t.Fatalf("got %d want an unknown csv column rejected", code)
+	}
+
+	if code, _ := bulk("", "application/json", strings.NewReader(`[{},{},{},{},{},{}]`)); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("got %d want a batch over the limit rejected", code)
+	}
+
+	protected := `[{"url":"https://fupisha.io/p1","password":"s3cret"},{"url":"https://fupisha.io/p2","password":"s3cret"},{"url":"https://fupisha.io/p3","password":"s3cret"}]`
+	if code, _ := bulk("", "application/json", strings.NewReader(protected)); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("got %d want a batch over the password protected limit rejected", code)
+	}
+
+	if _, err := db.GetURLByLongStr(ctx, owner.ID, "https://fupisha.io/p1"); err == nil {
+		t.Fatal("want no url created from a rejected batch")
+	}
+
+	//a token of a user that is gone shortens nothing.
+	stranger, err := jwtService.Encode(encoding.GenUniqueID().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("POST", "/url/bulk", strings.NewReader(`[{"url":"https://fupisha.io/stranger"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Api", "v1")
+	req.Header.Set("Authorization", "Bearer "+stranger)
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	apiHandler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError || strings.Contains(rr.Body.String(), `"results"`) {
+		t.Fatalf("got %d %q want the batch refused for an unknown owner", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,288 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nairobi-gophers/fupisha/api"
+	"github.com/nairobi-gophers/fupisha/config"
+	"github.com/nairobi-gophers/fupisha/logging"
+	"github.com/nairobi-gophers/fupisha/provider"
+	"github.com/nairobi-gophers/fupisha/store/memory"
+)
+
+// testResolver answers TXT lookups from its records by name, names it has none for are not found.
+type testResolver map[string][]string
+
+func (res testResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	records, ok := res[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+func TestDomains(t *testing.T) {
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.JWT.Secret) == 0 {
+		cfg.JWT.Secret = "c4c0f2c42bde58f4d5f453483b3bed2b2915779cacff15526b2560b00748ec36"
+	}
+
+	if cfg.JWT.ExpireDelta == 0 {
+		cfg.JWT.ExpireDelta = 6
+	}
+
+	cfg.BaseURL = "https://fupisha.test"
+
+	ctx := context.Background()
+
+	db := memory.NewStore()
+
+	jwtService, err := provider.NewJWTService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := make(map[string]string)
+	for _, email := range []string{"owner@fupisha.io", "other@fupisha.io"} {
+		user, err := db.NewUser(ctx, email, "ih@veaStr0ngpassword")
+		if err != nil {
+			t.Fatalf("could not create test user %q", err)
+		}
+
+		if tokens[email], err = jwtService.Encode(user.ID.String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logger := logging.NewLogger(cfg)
+	logger.SetOutput(io.Discard)
+
+	recorder, err := cfg.GetRecorder(db, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := testResolver{}
+
+	apiHandler, err := api.New(&api.ApiConfig{
+		Logger:   logger,
+		Cfg:      cfg,
+		Store:    db,
+		Clicks:   recorder,
+		Resolver: resolver,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(email, method, url, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Api", "v1")
+		req.Header.Set("Authorization", "Bearer "+tokens[email])
+
+		rr := httptest.NewRecorder()
+		apiHandler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	owner := func(method, url, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		return do("owner@fupisha.io", method, url, body)
+	}
+
+	visit := func(url string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		rr := httptest.NewRecorder()
+		apiHandler.ServeHTTP(rr, httptest.NewRequest("GET", url, nil))
+		return rr
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"Missing host", `{}`, http.StatusUnprocessableEntity, "host: cannot be blank"},
+		{"Host that is not a domain", `{"host":"not a domain"}`, http.StatusUnprocessableEntity, "host: must be a valid domain"},
+		{"Default short domain", `{"host":"fupisha.test"}`, http.StatusUnprocessableEntity, "must not be the default short domain"},
+		{"Root url that is not a url", `{"host":"go.acme.com","root_url":"acme"}`, http.StatusUnprocessableEntity, "root_url: must be a valid URL"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := owner("POST", "/url/domains", tc.body)
+
+			if rr.Code != tc.wantStatus || !strings.Contains(rr.Body.String(), tc.wantBody) {
+				t.Fatalf("got %d %q want %d containing %q", rr.Code, rr.Body.String(), tc.wantStatus, tc.wantBody)
+			}
+		})
+	}
+
+	rr := owner("POST", "/url/domains", `{"host":"Go.Acme.com.","root_url":"https://acme.com","not_found_url":"https://acme.com/404"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("adding a domain returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	var added struct {
+		Host     string `json:"host"`
+		Verified bool   `json:"verified"`
+		Record   struct {
+			Type  string `json:"type"`
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"record"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &added); err != nil {
+		t.Fatal(err)
+	}
+
+	if added.Host != "go.acme.com" || added.Verified || added.Record.Type != "TXT" || added.Record.Name != "_fupisha.go.acme.com" ||
+		!strings.HasPrefix(added.Record.Value, "fupisha-verification=") {
+		t.Fatalf("got added domain %s", rr.Body.String())
+	}
+
+	if rr := owner("POST", "/url/domains", `{"host":"go.acme.com"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("adding a domain twice returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	if rr := do("other@fupisha.io", "GET", "/url/domains/go.acme.com", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("retrieving somebody else's domain returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	//an unverified claim does not keep the host from anybody else, whoever verifies it first takes it.
+	rr = do("other@fupisha.io", "POST", "/url/domains", `{"host":"go.acme.com"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("claiming a host nobody verified returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	var squatted struct {
+		Record struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"record"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &squatted); err != nil {
+		t.Fatal(err)
+	}
+
+	//links can not be shortened on a domain before it is verified.
+	if rr := owner("POST", "/url/shorten", `{"url":"https://acme.com/spring","alias":"launch","domain":"go.acme.com"}`); rr.Code != http.StatusUnprocessableEntity ||
+		!strings.Contains(rr.Body.String(), "must be one of your verified domains") {
+		t.Fatalf("shortening on an unverified domain returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	if rr := owner("POST", "/url/domains/go.acme.com/verify", ""); rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), added.Record.Name) {
+		t.Fatalf("verifying without the record returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	resolver[added.Record.Name] = []string{added.Record.Value, squatted.Record.Value}
+
+	if rr := owner("POST", "/url/domains/go.acme.com/verify", ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"verified":true`) {
+		t.Fatalf("verifying the domain returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	if rr := do("other@fupisha.io", "POST", "/url/domains/go.acme.com/verify", ""); rr.Code != http.StatusConflict {
+		t.Fatalf("verifying a host somebody else verified returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	if rr := do("other@fupisha.io", "POST", "/url/domains", `{"host":"go.acme.com"}`); rr.Code != http.StatusConflict ||
+		!strings.Contains(rr.Body.String(), "verified by somebody else") {
+		t.Fatalf("adding a host somebody else verified returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	//links to a verified custom domain could redirect in circles just like links to the default one.
+	if rr := owner("POST", "/url/shorten", `{"url":"https://GO.acme.com./launch"}`); rr.Code != http.StatusUnprocessableEntity ||
+		!strings.Contains(rr.Body.String(), "must not point back at the short domain go.acme.com") {
+		t.Fatalf("shortening a link to the custom domain returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	//the same slug goes to different places on the default and the custom domain.
+	if rr := owner("POST", "/url/shorten", `{"url":"https://fupisha.io/launch","alias":"launch"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("shortening on the default domain returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	rr = owner("POST", "/url/shorten", `{"url":"https://acme.com/spring","alias":"launch","domain":"go.acme.com"}`)
+	if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), `"link":"https://go.acme.com/launch"`) {
+		t.Fatalf("shortening on the custom domain returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	if rr := owner("POST", "/url/shorten", `{"url":"https://acme.com/summer","alias":"launch","domain":"go.acme.com"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("taking an alias twice on the custom domain returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	if rr := do("other@fupisha.io", "POST", "/url/shorten", `{"url":"https://acme.com/x","domain":"go.acme.com"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("shortening on somebody else's domain returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	for url, want := range map[string]string{
+		"https://fupisha.test/launch": "https://fupisha.io/launch",
+		"https://go.acme.com/launch":  "https://acme.com/spring",
+		"https://go.acme.com/":        "https://acme.com",
+		"https://go.acme.com/missing": "https://acme.com/404",
+	} {
+		if rr := visit(url); rr.Code != http.StatusFound || rr.Header().Get("Location") != want {
+			t.Fatalf("visiting %s returned %d to %q want %q", url, rr.Code, rr.Header().Get("Location"), want)
+		}
+	}
+
+	//hosts that are not a verified domain are the default domain.
+	if rr := visit("https://unknown.example/launch"); rr.Code != http.StatusFound || rr.Header().Get("Location") != "https://fupisha.io/launch" {
+		t.Fatalf("visiting an unknown host returned %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	if rr := visit("https://fupisha.test/"); rr.Code != http.StatusNotFound {
+		t.Fatalf("visiting the default domain itself returned %d", rr.Code)
+	}
+
+	rr = owner("GET", "/expand?url=https://go.acme.com/launch", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"destination":"https://acme.com/spring"`) {
+		t.Fatalf("expanding a link of the custom domain returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	if rr := owner("PATCH", "/url/domains/go.acme.com", `{"not_found_url":""}`); rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), "not_found_url") {
+		t.Fatalf("removing the not found url returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	if rr := visit("https://go.acme.com/missing"); rr.Code != http.StatusNotFound {
+		t.Fatalf("visiting a missing param without a not found url returned %d", rr.Code)
+	}
+
+	rr = owner("GET", "/url/domains", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"host":"go.acme.com"`) {
+		t.Fatalf("listing the domains returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	if rr := owner("DELETE", "/url/domains/go.acme.com", ""); rr.Code != http.StatusConflict {
+		t.Fatalf("deleting a domain with links returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	if rr := owner("POST", "/url/domains", `{"host":"links.example"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("adding a domain returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	if rr := owner("DELETE", "/url/domains/links.example", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("deleting a domain returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	if rr := owner("GET", "/url/domains/links.example", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("retrieving a deleted domain returned %d %q", rr.Code, rr.Body.String())
+	}
+}
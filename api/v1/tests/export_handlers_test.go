@@ -0,0 +1,182 @@
+package tests
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nairobi-gophers/fupisha/api"
+	"github.com/nairobi-gophers/fupisha/config"
+	"github.com/nairobi-gophers/fupisha/logging"
+	"github.com/nairobi-gophers/fupisha/provider"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/nairobi-gophers/fupisha/store/memory"
+)
+
+// failingStore fails every page of urls after the first, cutting an export short part way through.
+type failingStore struct {
+	store.Store
+	pages int32
+}
+
+func (s *failingStore) FindURLs(ctx context.Context, filter store.URLFilter) ([]store.URL, error) {
+	if atomic.AddInt32(&s.pages, 1) > 1 {
+		return nil, errors.New("database went away")
+	}
+	return s.Store.FindURLs(ctx, filter)
+}
+
+func TestExport(t *testing.T) {
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.JWT.Secret) == 0 {
+		cfg.JWT.Secret = "c4c0f2c42bde58f4d5f453483b3bed2b2915779cacff15526b2560b00748ec36"
+	}
+
+	if cfg.JWT.ExpireDelta == 0 {
+		cfg.JWT.ExpireDelta = 6
+	}
+
+	ctx := context.Background()
+
+	db := memory.NewStore()
+
+	owner, err := db.NewUser(ctx, "owner@fupisha.io", "ih@veaStr0ngpassword")
+	if err != nil {
+		t.Fatalf("could not create test user %q", err)
+	}
+
+	other, err := db.NewUser(ctx, "other@fupisha.io", "ih@veaStr0ngpassword")
+	if err != nil {
+		t.Fatalf("could not create test user %q", err)
+	}
+
+	for _, u := range []store.URL{
+		{Owner: owner.ID, OriginalURL: "https://fupisha.io/a", ShortenedURLParam: "linkaa", Tags: store.Tags{"docs"}},
+		{Owner: other.ID, OriginalURL: "https://fupisha.io/b", ShortenedURLParam: "linkbb"},
+	} {
+		if _, err := db.NewURL(ctx, u); err != nil {
+			t.Fatalf("could not insert the %s url", u.ShortenedURLParam)
+		}
+	}
+
+	jwtService, err := provider.NewJWTService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwtService.Encode(owner.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logging.NewLogger(cfg)
+	logger.SetOutput(io.Discard)
+
+	recorder, err := cfg.GetRecorder(db, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { recorder.Close(ctx) })
+
+	apiHandler, err := api.New(&api.ApiConfig{
+		Logger: logger,
+		Cfg:    cfg,
+		Store:  db,
+		Clicks: recorder,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req, err := http.NewRequest("GET", "/url/export"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Api", "v1")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		apiHandler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("")
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/csv") || !strings.Contains(rr.Header().Get("Content-Disposition"), "fupisha-links.csv") {
+		t.Fatalf("got %d %v want a csv download", rr.Code, rr.Header())
+	}
+
+	rows, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 || rows[0][2] != "original_url" || rows[1][2] != "https://fupisha.io/a" {
+		t.Fatalf("got %v want a header and the owner's link only", rows)
+	}
+
+	if rr := get("?format=ndjson&created_after=2000-01-01T00:00:00Z"); rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/x-ndjson" || !strings.Contains(rr.Body.String(), `"tags":["docs"]`) {
+		t.Fatalf("got %d %q want the link as a json line", rr.Code, rr.Body.String())
+	}
+
+	if rr := get("?format=parquet&clicks=true"); rr.Code != http.StatusOK || !strings.HasPrefix(rr.Body.String(), "PAR1") || !strings.Contains(rr.Header().Get("Content-Disposition"), "fupisha-clicks.parquet") {
+		t.Fatalf("got %d %v want a parquet file of clicks", rr.Code, rr.Header())
+	}
+
+	for _, query := range []string{"?format=xml", "?created_before=yesterday"} {
+		if rr := get(query); rr.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("%s: got %d want %d", query, rr.Code, http.StatusUnprocessableEntity)
+		}
+	}
+
+	//an export failing after its first page has gone out is cut off, not ended as if it were complete.
+	for i := 0; i < 600; i++ {
+		if _, err := db.NewURL(ctx, store.URL{Owner: owner.ID, OriginalURL: fmt.Sprintf("https://fupisha.io/many/%d", i), ShortenedURLParam: fmt.Sprintf("many%03d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	failing, err := api.New(&api.ApiConfig{
+		Logger: logger,
+		Cfg:    cfg,
+		Store:  &failingStore{Store: db},
+		Clicks: recorder,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(failing)
+	t.Cleanup(srv.Close)
+
+	req, err := http.NewRequest("GET", srv.URL+"/url/export", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Api", "v1")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || len(body) == 0 || err == nil {
+		t.Fatalf("got %d, %d bytes, %v want the download cut off part way through", resp.StatusCode, len(body), err)
+	}
+}
@@ -0,0 +1,399 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/nairobi-gophers/fupisha/api"
+	"github.com/nairobi-gophers/fupisha/config"
+	"github.com/nairobi-gophers/fupisha/logging"
+	"github.com/nairobi-gophers/fupisha/provider"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/nairobi-gophers/fupisha/store/memory"
+)
+
+type testLink struct {
+	ID        string   `json:"id"`
+	Link      string   `json:"link"`
+	URL       string   `json:"url"`
+	Param     string   `json:"param"`
+	Title     string   `json:"title"`
+	Tags      []string `json:"tags"`
+	ExpiresAt *string  `json:"expires_at"`
+	DeletedAt *string  `json:"deleted_at"`
+}
+
+type testLinkPage struct {
+	Links      []testLink `json:"links"`
+	NextCursor string     `json:"next_cursor"`
+}
+
+func TestLinks(t *testing.T) {
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.JWT.Secret) == 0 {
+		cfg.JWT.Secret = "c4c0f2c42bde58f4d5f453483b3bed2b2915779cacff15526b2560b00748ec36"
+	}
+
+	if cfg.JWT.ExpireDelta == 0 {
+		cfg.JWT.ExpireDelta = 6
+	}
+
+	ctx := context.Background()
+
+	db := memory.NewStore()
+
+	owner, err := db.NewUser(ctx, "owner@fupisha.io", "ih@veaStr0ngpassword")
+	if err != nil {
+		t.Fatalf("could not create test user %q", err)
+	}
+
+	other, err := db.NewUser(ctx, "other@fupisha.io", "ih@veaStr0ngpassword")
+	if err != nil {
+		t.Fatalf("could not create test user %q", err)
+	}
+
+	for _, u := range []store.URL{
+		{Owner: owner.ID, OriginalURL: "https://fupisha.io/a", ShortenedURLParam: "linkaa", Dedup: true},
+		{Owner: owner.ID, OriginalURL: "https://fupisha.io/b", ShortenedURLParam: "linkbb", Dedup: true},
+		{Owner: other.ID, OriginalURL: "https://fupisha.io/c", ShortenedURLParam: "linkcc", Dedup: true},
+	} {
+		if _, err := db.NewURL(ctx, u); err != nil {
+			t.Fatalf("could not insert the %s url", u.ShortenedURLParam)
+		}
+	}
+
+	jwtService, err := provider.NewJWTService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ownerToken, err := jwtService.Encode(owner.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherToken, err := jwtService.Encode(other.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logging.NewLogger(cfg)
+	logger.SetOutput(io.Discard)
+
+	recorder, err := cfg.GetRecorder(db, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { recorder.Close(ctx) })
+
+	apiHandler, err := api.New(&api.ApiConfig{
+		Logger: logger,
+		Cfg:    cfg,
+		Store:  db,
+		Clicks: recorder,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, url, token, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Api", "v1")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		apiHandler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	page := func(query string) testLinkPage {
+		t.Helper()
+
+		rr := do("GET", "/url"+query, ownerToken, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("listing links returned %d %q", rr.Code, rr.Body.String())
+		}
+
+		var resp testLinkPage
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	list := func(query string) []testLink {
+		t.Helper()
+		return page(query).Links
+	}
+
+	links := list("")
+	if len(links) != 2 {
+		t.Fatalf("want the owner's two links, got %+v", links)
+	}
+
+	var id string
+	for _, l := range links {
+		if l.Param == "linkaa" {
+			id = l.ID
+		}
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		token    string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Get a link",
+			method:   "GET",
+			url:      "/url/" + id,
+			token:    ownerToken,
+			wantCode: http.StatusOK,
+			wantBody: `"param":"linkaa"`,
+		},
+		{
+			name:     "Get another user's link",
+			method:   "GET",
+			url:      "/url/" + id,
+			token:    otherToken,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Get a link with an invalid id",
+			method:   "GET",
+			url:      "/url/linkaa",
+			token:    ownerToken,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Update another user's link",
+			method:   "PATCH",
+			url:      "/url/" + id,
+			token:    otherToken,
+			body:     `{"url":"https://fupisha.io/stolen"}`,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Update a link with an invalid url",
+			method:   "PATCH",
+			url:      "/url/" + id,
+			token:    ownerToken,
+			body:     `{"url":"not a url"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `url`,
+		},
+		{
+			name:     "Update a link to an ftp url",
+			method:   "PATCH",
+			url:      "/url/" + id,
+			token:    ownerToken,
+			body:     `{"url":"ftp://fupisha.io/docs"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `scheme \"ftp\" is not allowed`,
+		},
+		{
+			name:     "Update a link to a taken alias",
+			method:   "PATCH",
+			url:      "/url/" + id,
+			token:    ownerToken,
+			body:     `{"alias":"linkcc"}`,
+			wantCode: http.StatusConflict,
+			wantBody: `"suggestions":[`,
+		},
+		{
+			name:     "Update a link to the url of another dedup link",
+			method:   "PATCH",
+			url:      "/url/" + id,
+			token:    ownerToken,
+			body:     `{"url":"https://fupisha.io/b"}`,
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "Update a link to another spelling of another dedup link's url",
+			method:   "PATCH",
+			url:      "/url/" + id,
+			token:    ownerToken,
+			body:     `{"url":"https://Fupisha.io:443/%62"}`,
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "Update a link",
+			method:   "PATCH",
+			url:      "/url/" + id,
+			token:    ownerToken,
+			body:     `{"url":"https://fupisha.io/moved","alias":"moved","expires_at":"2999-01-01T00:00:00Z"}`,
+			wantCode: http.StatusOK,
+			wantBody: `"url":"https://fupisha.io/moved","canonical_url":"https://fupisha.io/moved","param":"moved"`,
+		},
+		{
+			name:     "Describe a link",
+			method:   "PATCH",
+			url:      "/url/" + id,
+			token:    ownerToken,
+			body:     `{"title":"Moved docs","tags":["Docs"," docs ","launch"]}`,
+			wantCode: http.StatusOK,
+			wantBody: `"title":"Moved docs","tags":["docs","launch"]`,
+		},
+		{
+			name:     "Tag a link with an invalid tag",
+			method:   "PATCH",
+			url:      "/url/" + id,
+			token:    ownerToken,
+			body:     `{"tags":["no spaces"]}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `tags`,
+		},
+		{
+			name:     "Resolve an updated link",
+			method:   "GET",
+			url:      "/moved",
+			wantCode: http.StatusFound,
+		},
+		{
+			name:     "Resolve the old alias of an updated link",
+			method:   "GET",
+			url:      "/linkaa",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Remove the expiry of a link",
+			method:   "PATCH",
+			url:      "/url/" + id,
+			token:    ownerToken,
+			body:     `{"expires_at":null}`,
+			wantCode: http.StatusOK,
+			wantBody: `"param":"moved"`,
+		},
+		{
+			name:     "Delete a link",
+			method:   "DELETE",
+			url:      "/url/" + id,
+			token:    ownerToken,
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "Resolve a deleted link",
+			method:   "GET",
+			url:      "/moved",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Update a deleted link",
+			method:   "PATCH",
+			url:      "/url/" + id,
+			token:    ownerToken,
+			body:     `{"url":"https://fupisha.io/again"}`,
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "Restore a deleted link",
+			method:   "POST",
+			url:      "/url/" + id + "/restore",
+			token:    ownerToken,
+			wantCode: http.StatusOK,
+			wantBody: `"param":"moved"`,
+		},
+		{
+			name:     "Resolve a restored link",
+			method:   "GET",
+			url:      "/moved",
+			wantCode: http.StatusFound,
+		},
+	}
+
+	for _, tc := range tests {
+		rr := do(tc.method, tc.url, tc.token, tc.body)
+
+		t.Log(tc.name)
+
+		if tc.wantCode != rr.Code {
+			t.Fatalf("handler returned unexpected status: want status code %d got %d %q", tc.wantCode, rr.Code, rr.Body.String())
+		}
+
+		if !strings.Contains(rr.Body.String(), tc.wantBody) {
+			t.Fatalf("handler returned unexpected body: want response body %q got %q", tc.wantBody, strings.TrimSuffix(rr.Body.String(), "\n"))
+		}
+	}
+
+	for _, l := range list("") {
+		if l.ID == id && (l.Param != "moved" || l.ExpiresAt != nil) {
+			t.Fatalf("want the restored link listed without an expiry, got %+v", l)
+		}
+	}
+
+	if rr := do("DELETE", "/url/"+id, ownerToken, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("deleting a link returned %d", rr.Code)
+	}
+
+	if links := list(""); len(links) != 1 {
+		t.Fatalf("want the deleted link left out, got %+v", links)
+	}
+
+	if links := list("?deleted=true"); len(links) != 1 || links[0].ID != id || links[0].DeletedAt == nil {
+		t.Fatalf("want the deleted link listed on its own, got %+v", links)
+	}
+
+	if rr := do("DELETE", "/url/"+id, ownerToken, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("deleting a deleted link returned %d", rr.Code)
+	}
+
+	if rr := do("POST", "/url/"+id+"/restore", ownerToken, ""); rr.Code != http.StatusOK {
+		t.Fatalf("restoring a link returned %d", rr.Code)
+	}
+
+	for query, want := range map[string][]string{
+		"?tag=docs":                            {"moved"},
+		"?tag=DOCS&tag=launch":                 {"moved"},
+		"?tag=missing":                         {},
+		"?q=moved+docs":                        {"moved"},
+		"?domain=FUPISHA.IO&state=active":      {"linkbb", "moved"},
+		"?state=expired":                       {},
+		"?created_before=2000-01-01T00:00:00Z": {},
+	} {
+		got := []string{}
+		for _, l := range list(query) {
+			got = append(got, l.Param)
+		}
+		sort.Strings(got)
+
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %v want %v", query, got, want)
+		}
+	}
+
+	first := page("?limit=1")
+	if len(first.Links) != 1 || first.NextCursor == "" {
+		t.Fatalf("want a page of one link and a cursor, got %+v", first)
+	}
+
+	second := page("?limit=1&cursor=" + first.NextCursor)
+	if len(second.Links) != 1 || second.Links[0].ID == first.Links[0].ID || second.NextCursor != "" {
+		t.Fatalf("want the other link on the last page, got %+v", second)
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=201", "?cursor=nope", "?state=broken", "?created_after=yesterday", "?tag=no+spaces"} {
+		if rr := do("GET", "/url"+query, ownerToken, ""); rr.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("%s: got %d want %d", query, rr.Code, http.StatusUnprocessableEntity)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nairobi-gophers/fupisha/api"
+	"github.com/nairobi-gophers/fupisha/config"
+	"github.com/nairobi-gophers/fupisha/logging"
+	"github.com/nairobi-gophers/fupisha/params"
+	"github.com/nairobi-gophers/fupisha/provider"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/nairobi-gophers/fupisha/store/memory"
+)
+
+// scriptedParams hands out the params it is given in turn, forcing collisions with taken ones.
+type scriptedParams struct {
+	mu     sync.Mutex
+	params []string
+}
+
+func (s *scriptedParams) add(ps ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.params = append(s.params, ps...)
+}
+
+func (s *scriptedParams) generate(length int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.params) == 0 {
+		return "taken", nil
+	}
+
+	p := s.params[0]
+	s.params = s.params[1:]
+	return p, nil
+}
+
+func TestParamCollisions(t *testing.T) {
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.JWT.Secret) == 0 {
+		cfg.JWT.Secret = "c4c0f2c42bde58f4d5f453483b3bed2b2915779cacff15526b2560b00748ec36"
+	}
+
+	if cfg.JWT.ExpireDelta == 0 {
+		cfg.JWT.ExpireDelta = 6
+	}
+
+	cfg.BaseURL = "https://fupisha.test"
+	cfg.Port = "443"
+
+	ctx := context.Background()
+
+	db := memory.NewStore()
+
+	owner, err := db.NewUser(ctx, "owner@fupisha.io", "ih@veaStr0ngpassword")
+	if err != nil {
+		t.Fatalf("could not create test user %q", err)
+	}
+
+	//somebody else's link already goes by the param generated first.
+	other, err := db.NewUser(ctx, "other@fupisha.io", "ih@veaStr0ngpassword")
+	if err != nil {
+		t.Fatalf("could not create test user %q", err)
+	}
+
+	if _, err := db.NewURL(ctx, store.URL{Owner: other.ID, OriginalURL: "https://fupisha.io/other", ShortenedURLParam: "taken"}); err != nil {
+		t.Fatal(err)
+	}
+
+	jwtService, err := provider.NewJWTService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwtService.Encode(owner.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logging.NewLogger(cfg)
+	logger.SetOutput(io.Discard)
+
+	recorder, err := cfg.GetRecorder(db, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script := &scriptedParams{}
+	generator := params.New(6, script.generate)
+
+	apiHandler, err := api.New(&api.ApiConfig{
+		Logger: logger,
+		Cfg:    cfg,
+		Store:  db,
+		Clicks: recorder,
+		Params: generator,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Api", "v1")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		apiHandler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	//a taken param is retried with a fresh one, reserved words are never handed out.
+	script.add("taken", "ping", "fresh1")
+
+	rr := do("POST", "/url/shorten", `{"url":"https://go.dev/a"}`)
+	if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), "/fresh1") {
+		t.Fatalf("shortening with a taken param returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	//shortening the url again is told apart from a taken param and answers with the existing link.
+	script.add("fresh2")
+
+	rr = do("POST", "/url/shorten", `{"url":"https://go.dev/a"}`)
+	if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), "/fresh1") {
+		t.Fatalf("shortening the same url again returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	if u, err := db.GetURLByParam(ctx, "fresh2"); err == nil {
+		t.Fatalf("got %+v want the dedup link and no new one", u)
+	}
+
+	//the params stop at the bound when every one of them is taken, and grow longer.
+	lengthBefore := generator.Length()
+
+	rr = do("POST", "/url/shorten", `{"url":"https://go.dev/b","dedup":false}`)
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("shortening with only taken params returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	if generator.Length() <= lengthBefore {
+		t.Fatalf("got param length %d after %d collisions in a row want more than %d", generator.Length(), params.MaxAttempts, lengthBefore)
+	}
+
+	//an alias that is taken is still a conflict, it is never swapped for a generated param.
+	if rr := do("POST", "/url/shorten", `{"url":"https://go.dev/c","alias":"taken"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("shortening with a taken alias returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	//bulk rows retry taken params too, atomic batches are sent again with a fresh param.
+	bulk := func(query, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		return do("POST", "/url/bulk"+query, body)
+	}
+
+	script.add("fresh2", "taken", "fresh3")
+
+	rr = bulk("", `[{"url":"https://go.dev/d"},{"url":"https://go.dev/e"}]`)
+	if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), "/fresh2") || !strings.Contains(rr.Body.String(), "/fresh3") {
+		t.Fatalf("bulk shortening with a taken param returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	script.add("taken", "fresh4", "taken", "fresh5")
+
+	rr = bulk("?atomic=true", `[{"url":"https://go.dev/f"},{"url":"https://go.dev/g"}]`)
+	if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), "/fresh4") || !strings.Contains(rr.Body.String(), "/fresh5") {
+		t.Fatalf("atomic bulk shortening with taken params returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	rr = bulk("?atomic=true", `[{"url":"https://go.dev/h"}]`)
+	if rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "could not create the link") {
+		t.Fatalf("atomic bulk shortening with only taken params returned %d %q", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nairobi-gophers/fupisha/api"
+	"github.com/nairobi-gophers/fupisha/config"
+	"github.com/nairobi-gophers/fupisha/logging"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/nairobi-gophers/fupisha/store/memory"
+)
+
+type testExpansion struct {
+	URL         string `json:"url"`
+	Param       string `json:"param"`
+	Destination string `json:"destination"`
+	Title       string `json:"title"`
+	Protected   bool   `json:"protected"`
+	Status      string `json:"status"`
+	Error       string `json:"error"`
+}
+
+func TestPreviewAndExpand(t *testing.T) {
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.JWT.Secret) == 0 {
+		cfg.JWT.Secret = "c4c0f2c42bde58f4d5f453483b3bed2b2915779cacff15526b2560b00748ec36"
+	}
+
+	cfg.BaseURL = "http://fupisha.test"
+	cfg.Port = "8888"
+
+	ctx := context.Background()
+
+	db := memory.NewStore()
+
+	owner, err := db.NewUser(ctx, "owner@fupisha.io", "ih@veaStr0ngpassword")
+	if err != nil {
+		t.Fatalf("could not create test user %q", err)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	for _, u := range []store.URL{
+		{Owner: owner.ID, OriginalURL: "https://fupisha.io/docs", ShortenedURLParam: "docs", Title: "<b>Docs</b>"},
+		{Owner: owner.ID, OriginalURL: "https://fupisha.io/secret", ShortenedURLParam: "secret", Password: "hunter2"},
+		{Owner: owner.ID, OriginalURL: "https://fupisha.io/old", ShortenedURLParam: "old", ExpiresAt: &past},
+		{Owner: owner.ID, OriginalURL: "https://fupisha.io/soon", ShortenedURLParam: "soon", StartsAt: &future},
+	} {
+		if err := u.HashPassword(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.NewURL(ctx, u); err != nil {
+			t.Fatalf("could not insert the %s url", u.ShortenedURLParam)
+		}
+	}
+
+	logger := logging.NewLogger(cfg)
+	logger.SetOutput(io.Discard)
+
+	recorder, err := cfg.GetRecorder(db, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { recorder.Close(ctx) })
+
+	apiHandler, err := api.New(&api.ApiConfig{
+		Logger: logger,
+		Cfg:    cfg,
+		Store:  db,
+		Clicks: recorder,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		apiHandler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for _, tc := range []struct {
+		param    string
+		wantCode int
+		want     []string
+		dontWant []string
+	}{
+		{param: "docs", wantCode: http.StatusOK, want: []string{"https://fupisha.io/docs", "&lt;b&gt;Docs&lt;/b&gt;", "Continue to the link"}},
+		{param: "secret", wantCode: http.StatusOK, want: []string{"password protected"}, dontWant: []string{"https://fupisha.io/secret"}},
+		{param: "old", wantCode: http.StatusOK, want: []string{"has expired"}, dontWant: []string{"Continue to the link"}},
+		{param: "soon", wantCode: http.StatusNotFound, want: []string{"does not exist"}, dontWant: []string{"https://fupisha.io/soon"}},
+		{param: "missing", wantCode: http.StatusNotFound, want: []string{"does not exist"}},
+	} {
+		rr := do("GET", "/"+tc.param+"+", "")
+
+		if rr.Code != tc.wantCode || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") {
+			t.Fatalf("%s+: got %d %q want a %d page", tc.param, rr.Code, rr.Header().Get("Content-Type"), tc.wantCode)
+		}
+
+		for _, want := range tc.want {
+			if !strings.Contains(rr.Body.String(), want) {
+				t.Fatalf("%s+: want the page to contain %q", tc.param, want)
+			}
+		}
+
+		for _, dontWant := range tc.dontWant {
+			if strings.Contains(rr.Body.String(), dontWant) {
+				t.Fatalf("%s+: want the page not to contain %q", tc.param, dontWant)
+			}
+		}
+	}
+
+	rr := do("GET", "/expand?url=http://fupisha.test:8888/docs", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d %q want the link expanded", rr.Code, rr.Body.String())
+	}
+
+	var exp testExpansion
+	if err := json.Unmarshal(rr.Body.Bytes(), &exp); err != nil {
+		t.Fatal(err)
+	}
+
+	if exp.Param != "docs" || exp.Destination != "https://fupisha.io/docs" || exp.Status != "active" || exp.Title != "<b>Docs</b>" {
+		t.Fatalf("got %+v want the docs link", exp)
+	}
+
+	for url, wantCode := range map[string]int{
+		"":                                 http.StatusUnprocessableEntity,
+		"https://bit.ly/docs":              http.StatusUnprocessableEntity,
+		"http://fupisha.test:8888/missing": http.StatusNotFound,
+		"soon":                             http.StatusNotFound,
+	} {
+		if rr := do("GET", "/expand?url="+url, ""); rr.Code != wantCode {
+			t.Fatalf("%q: got %d want %d", url, rr.Code, wantCode)
+		}
+	}
+
+	rr = do("POST", "/expand", `{"urls":["docs","fupisha.test/secret+","http://fupisha.test/old","https://bit.ly/docs","missing"]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d %q want the batch expanded", rr.Code, rr.Body.String())
+	}
+
+	var batch struct {
+		Results []testExpansion `json:"results"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &batch); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(batch.Results) != 5 {
+		t.Fatalf("got %+v want a result per url", batch.Results)
+	}
+
+	if r := batch.Results[1]; r.Param != "secret" || !r.Protected || r.Destination != "" {
+		t.Fatalf("got %+v want the protected link's destination hidden", r)
+	}
+
+	if r := batch.Results[2]; r.Status != "expired" || r.Destination != "https://fupisha.io/old" {
+		t.Fatalf("got %+v want the expired link", r)
+	}
+
+	if batch.Results[3].Error != "not a fupisha short link" || batch.Results[4].Error != "not found" {
+		t.Fatalf("got %+v want the failures explained", batch.Results[3:])
+	}
+
+	if rr := do("POST", "/expand", `{"urls":[]}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got %d want an empty batch rejected", rr.Code)
+	}
+
+	docs, err := db.GetURLByParam(ctx, "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if clicks, err := db.GetClicksByURL(ctx, docs.ID); err != nil || len(clicks) != 0 {
+		t.Fatalf("got %d clicks, %v want previews and expansions left uncounted", len(clicks), err)
+	}
+}
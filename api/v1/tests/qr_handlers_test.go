@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nairobi-gophers/fupisha/api"
+	"github.com/nairobi-gophers/fupisha/config"
+	"github.com/nairobi-gophers/fupisha/logging"
+	"github.com/nairobi-gophers/fupisha/provider"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/nairobi-gophers/fupisha/store/memory"
+)
+
+func TestQR(t *testing.T) {
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.JWT.Secret) == 0 {
+		cfg.JWT.Secret = "c4c0f2c42bde58f4d5f453483b3bed2b2915779cacff15526b2560b00748ec36"
+	}
+
+	if cfg.JWT.ExpireDelta == 0 {
+		cfg.JWT.ExpireDelta = 6
+	}
+
+	logoFile, err := os.Create(filepath.Join(t.TempDir(), "logo.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(logoFile, image.NewRGBA(image.Rect(0, 0, 16, 16))); err != nil {
+		t.Fatal(err)
+	}
+	logoFile.Close()
+
+	cfg.QR.Logo = logoFile.Name()
+	cfg.QR.MaxAge = 3600
+
+	ctx := context.Background()
+
+	db := memory.NewStore()
+
+	owner, err := db.NewUser(ctx, "owner@fupisha.io", "ih@veaStr0ngpassword")
+	if err != nil {
+		t.Fatalf("could not create test user %q", err)
+	}
+
+	u, err := db.NewURL(ctx, store.URL{Owner: owner.ID, OriginalURL: "https://fupisha.io/a", ShortenedURLParam: "linkaa"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwtService, err := provider.NewJWTService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwtService.Encode(owner.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logging.NewLogger(cfg)
+	logger.SetOutput(io.Discard)
+
+	recorder, err := cfg.GetRecorder(db, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { recorder.Close(ctx) })
+
+	apiHandler, err := api.New(&api.ApiConfig{
+		Logger: logger,
+		Cfg:    cfg,
+		Store:  db,
+		Clicks: recorder,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(url string, header http.Header) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k := range header {
+			req.Header.Set(k, header.Get(k))
+		}
+
+		rr := httptest.NewRecorder()
+		apiHandler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	auth := http.Header{"Api": {"v1"}, "Authorization": {"Bearer " + token}}
+
+	rr := get("/url/"+u.ID.String()+"/qr?size=300&level=H&margin=2&fg=1a2b3c&bg=fff", auth)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/png" || rr.Header().Get("Cache-Control") != "private, no-cache" {
+		t.Fatalf("got %d %v want a private png", rr.Code, rr.Header())
+	}
+
+	img, err := png.Decode(rr.Body)
+	if err != nil || img.Bounds().Dx() != 300 {
+		t.Fatalf("got %v, %v want a 300px png", img.Bounds(), err)
+	}
+
+	etag := rr.Header().Get("ETag")
+	if rr := get("/url/"+u.ID.String()+"/qr?size=300&level=H&margin=2&fg=1a2b3c&bg=fff", http.Header{"Api": {"v1"}, "Authorization": {"Bearer " + token}, "If-None-Match": {etag}}); rr.Code != http.StatusNotModified {
+		t.Fatalf("got %d want the cached code still valid", rr.Code)
+	}
+
+	rr = get("/linkaa/qr?format=svg&logo=true", nil)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/svg+xml" || rr.Header().Get("Cache-Control") != "public, max-age=3600" {
+		t.Fatalf("got %d %v want a public svg", rr.Code, rr.Header())
+	}
+
+	if !strings.HasPrefix(rr.Body.String(), "<svg") || !strings.Contains(rr.Body.String(), "data:image/png;base64,") {
+		t.Fatalf("got %q want an svg with the logo", rr.Body.String())
+	}
+
+	if rr := get("/nolink/qr", nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("got %d want an unknown param not found", rr.Code)
+	}
+
+	if rr := get("/url/"+u.ID.String()+"/qr", nil); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("got %d want the link's code kept to its owner", rr.Code)
+	}
+
+	rr = get("/linkaa/qr?format=gif&size=10&level=Z&margin=-1&fg=red", nil)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got %d want invalid options rejected", rr.Code)
+	}
+
+	var resp struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, param := range []string{"format", "size", "level", "margin", "fg"} {
+		if !strings.Contains(resp.Error, param) {
+			t.Fatalf("got %q want %s explained", resp.Error, param)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nairobi-gophers/fupisha/api"
+	"github.com/nairobi-gophers/fupisha/config"
+	"github.com/nairobi-gophers/fupisha/logging"
+	"github.com/nairobi-gophers/fupisha/provider"
+	"github.com/nairobi-gophers/fupisha/routing"
+	"github.com/nairobi-gophers/fupisha/store/memory"
+)
+
+// testLocator places every ip address in the country it is mapped to.
+type testLocator map[string]string
+
+func (l testLocator) Country(ip net.IP) string {
+	return l[ip.String()]
+}
+
+func TestRouting(t *testing.T) {
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.JWT.Secret) == 0 {
+		cfg.JWT.Secret = "c4c0f2c42bde58f4d5f453483b3bed2b2915779cacff15526b2560b00748ec36"
+	}
+
+	if cfg.JWT.ExpireDelta == 0 {
+		cfg.JWT.ExpireDelta = 6
+	}
+
+	ctx := context.Background()
+
+	db := memory.NewStore()
+
+	owner, err := db.NewUser(ctx, "owner@fupisha.io", "ih@veaStr0ngpassword")
+	if err != nil {
+		t.Fatalf("could not create test user %q", err)
+	}
+
+	jwtService, err := provider.NewJWTService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwtService.Encode(owner.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logging.NewLogger(cfg)
+	logger.SetOutput(io.Discard)
+
+	recorder, err := cfg.GetRecorder(db, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { recorder.Close(ctx) })
+
+	cfg.TrustedProxies = "10.0.0.0/8, 127.0.0.1"
+
+	apiHandler, err := api.New(&api.ApiConfig{
+		Logger: logger,
+		Cfg:    cfg,
+		Store:  db,
+		Clicks: recorder,
+		Router: routing.New(testLocator{"41.90.1.1": "KE"}, nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Api", "v1")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		apiHandler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		wantBody string
+	}{
+		{
+			name:     "Rule without a destination",
+			body:     `{"url":"https://fupisha.io/a","routes":{"rules":[{"countries":["KE"]}]}}`,
+			wantBody: "destination: cannot be blank",
+		},
+		{
+			name:     "Rule without conditions",
+			body:     `{"url":"https://fupisha.io/a","routes":{"rules":[{"destination":"https://fupisha.io/b"}]}}`,
+			wantBody: "must set at least one condition",
+		},
+		{
+			name:     "Unknown country code",
+			body:     `{"url":"https://fupisha.io/a","routes":{"rules":[{"destination":"https://fupisha.io/b","countries":["Kenya"]}]}}`,
+			wantBody: "must be a two letter country code",
+		},
+		{
+			name:     "Unknown device",
+			body:     `{"url":"https://fupisha.io/a","routes":{"rules":[{"destination":"https://fupisha.io/b","devices":["fridge"]}]}}`,
+			wantBody: "must be a valid value",
+		},
+		{
+			name:     "Dates in the wrong order",
+			body:     `{"url":"https://fupisha.io/a","routes":{"rules":[{"destination":"https://fupisha.io/b","start_date":"2026-12-02","end_date":"2026-12-01"}]}}`,
+			wantBody: "must not be before start_date",
+		},
+		{
+			name:     "Invalid time of day",
+			body:     `{"url":"https://fupisha.io/a","routes":{"rules":[{"destination":"https://fupisha.io/b","start_time":"25:00"}]}}`,
+			wantBody: "must be a time of day",
+		},
+		{
+			name:     "Unknown time zone",
+			body:     `{"url":"https://fupisha.io/a","routes":{"timezone":"Mars/Olympus","rules":[{"destination":"https://fupisha.io/b","days":["sat"]}]}}`,
+			wantBody: "must be an IANA time zone",
+		},
+		{
+			name:     "Destination refused by the policy",
+			body:     `{"url":"https://fupisha.io/a","routes":{"rules":[{"destination":"ftp://go.dev/file","days":["sat"]}]}}`,
+			wantBody: "routes.rules.0.destination",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := do("POST", "/url/shorten", tc.body)
+
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("got status %d want %d, body %q", rr.Code, http.StatusUnprocessableEntity, rr.Body.String())
+			}
+
+			if !strings.Contains(rr.Body.String(), tc.wantBody) {
+				t.Fatalf("got body %q want it to contain %q", rr.Body.String(), tc.wantBody)
+			}
+		})
+	}
+
+	rr := do("POST", "/url/shorten", `{
+		"url":"https://fupisha.io/a",
+		"alias":"routed",
+		"routes":{"rules":[
+			{"destination":"https://fupisha.io/ke","countries":["ke"]},
+			{"destination":"https://fupisha.io/mobile","devices":["Mobile"]}
+		]}
+	}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("shortening with routes returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	visitVia := func(ip, forwardedFor, ua string) string {
+		t.Helper()
+
+		req := httptest.NewRequest("GET", "/routed", nil)
+		req.RemoteAddr = ip + ":4242"
+		req.Header.Set("User-Agent", ua)
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+
+		rr := httptest.NewRecorder()
+		apiHandler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusFound {
+			t.Fatalf("visiting a routed link returned %d %q", rr.Code, rr.Body.String())
+		}
+		return rr.Header().Get("Location")
+	}
+
+	visit := func(ip, ua string) string {
+		t.Helper()
+		return visitVia(ip, "", ua)
+	}
+
+	const iPhone = "Mozilla/5.0 (iPhone; CPU iPhone OS 16_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.5 Mobile/15E148 Safari/604.1"
+	const windows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/115.0.0.0 Safari/537.36"
+
+	for _, tc := range []struct{ ip, ua, want string }{
+		{"41.90.1.1", iPhone, "https://fupisha.io/ke"},
+		{"81.2.69.1", iPhone, "https://fupisha.io/mobile"},
+		{"81.2.69.1", windows, "https://fupisha.io/a"},
+	} {
+		if got := visit(tc.ip, tc.ua); got != tc.want {
+			t.Fatalf("visitor from %s got %s want %s", tc.ip, got, tc.want)
+		}
+	}
+
+	//visitors are only located by the address a trusted proxy forwards, anybody else could forge it.
+	for _, tc := range []struct{ ip, forwardedFor, want string }{
+		{"10.1.2.3", "41.90.1.1", "https://fupisha.io/ke"},
+		{"127.0.0.1", "41.90.1.1", "https://fupisha.io/ke"},
+		{"81.2.69.1", "41.90.1.1", "https://fupisha.io/a"},
+	} {
+		if got := visitVia(tc.ip, tc.forwardedFor, windows); got != tc.want {
+			t.Fatalf("visitor from %s forwarded for %s got %s want %s", tc.ip, tc.forwardedFor, got, tc.want)
+		}
+	}
+
+	u, err := db.GetURLByParam(ctx, "routed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type testRoutes struct {
+		Rules []struct {
+			Destination string   `json:"destination"`
+			Countries   []string `json:"countries"`
+		} `json:"rules"`
+	}
+
+	patch := func(body string) testRoutes {
+		t.Helper()
+
+		rr := do("PATCH", "/url/"+u.ID.String(), body)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("updating a link returned %d %q", rr.Code, rr.Body.String())
+		}
+
+		var link struct {
+			Routes testRoutes `json:"routes"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &link); err != nil {
+			t.Fatal(err)
+		}
+		return link.Routes
+	}
+
+	//the rules are replaced as a whole, the values of their conditions folded to the case they are matched in.
+	routes := patch(`{"routes":{"rules":[{"destination":"https://fupisha.io/tz","countries":["tz"," ke ","TZ"]}]}}`)
+	if len(routes.Rules) != 1 || strings.Join(routes.Rules[0].Countries, ",") != "TZ,KE" {
+		t.Fatalf("got routes %+v after replacing them", routes)
+	}
+
+	if got := visit("41.90.1.1", iPhone); got != "https://fupisha.io/tz" {
+		t.Fatalf("got %s after replacing the routes", got)
+	}
+
+	if routes := patch(`{"routes":{"rules":[]}}`); len(routes.Rules) != 0 {
+		t.Fatalf("got routes %+v after removing them", routes)
+	}
+
+	if got := visit("41.90.1.1", iPhone); got != "https://fupisha.io/a" {
+		t.Fatalf("got %s after removing the routes", got)
+	}
+}
@@ -8,13 +8,15 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/nairobi-gophers/fupisha/api"
-	"github.com/nairobi-gophers/fupisha/api/v1/url"
 	"github.com/nairobi-gophers/fupisha/config"
 	"github.com/nairobi-gophers/fupisha/logging"
+	"github.com/nairobi-gophers/fupisha/params"
 	"github.com/nairobi-gophers/fupisha/provider"
-	"github.com/nairobi-gophers/fupisha/store/postgres"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/nairobi-gophers/fupisha/store/memory"
 )
 
 func TestUrl(t *testing.T) {
@@ -27,7 +29,7 @@ func TestUrl(t *testing.T) {
 
 	baseURL := fmt.Sprintf("%s:%s", cfg.BaseURL, cfg.Port)
 
-	testParam, err := url.Shorten(testURL, cfg.ParamLength)
+	testParam, err := params.Random(cfg.ParamLength)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -40,24 +42,54 @@ func TestUrl(t *testing.T) {
 
 	ctx := context.Background()
 
-	store, teardown := postgres.NewTestDatabase(t)
-	t.Cleanup(teardown)
+	db := memory.NewStore()
 
 	const (
 		testEmail    = "admin@fupisha.io"
 		testPassword = "ih@veaStr0ngpassword"
 	)
 
-	u, err := store.NewUser(ctx, testEmail, testPassword)
+	u, err := db.NewUser(ctx, testEmail, testPassword)
 	if err != nil {
 		t.Fatalf("could not create test user %q", err)
 	}
 
-	_, err = store.NewURL(ctx, u.ID, testURL, testParam)
+	_, err = db.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: testURL, ShortenedURLParam: testParam, Dedup: true})
 	if err != nil {
 		t.Fatalf("could not insert the short param")
 	}
 
+	//Links that are not live, shortened by someone else so they stay out of the owner's count below.
+	scheduler, err := db.NewUser(ctx, "scheduler@fupisha.io", testPassword)
+	if err != nil {
+		t.Fatalf("could not create test user %q", err)
+	}
+
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+
+	for _, sched := range []store.URL{
+		{ShortenedURLParam: "expired", ExpiresAt: &past, FallbackURL: "https://fupisha.io/over"},
+		{ShortenedURLParam: "ended", ExpiresAt: &past},
+		{ShortenedURLParam: "upcoming", StartsAt: &future},
+		{ShortenedURLParam: "secret", Password: "open sesame"},
+	} {
+		sched.Owner = scheduler.ID
+		sched.OriginalURL = "https://fupisha.io/" + sched.ShortenedURLParam
+		if _, err := db.NewURL(ctx, sched); err != nil {
+			t.Fatalf("could not insert the %s url", sched.ShortenedURLParam)
+		}
+	}
+
+	//a deleted link keeps its param until it is restored, it is never suggested as an alias.
+	deleted, err := db.NewURL(ctx, store.URL{Owner: scheduler.ID, OriginalURL: "https://fupisha.io/deleted", ShortenedURLParam: "summit2026-3"})
+	if err != nil {
+		t.Fatalf("could not insert the deleted url")
+	}
+
+	if err := db.DeleteURL(ctx, deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+
 	testSecret := "c4c0f2c42bde58f4d5f453483b3bed2b2915779cacff15526b2560b00748ec36"
 
 	if len(cfg.JWT.Secret) == 0 {
@@ -81,10 +113,16 @@ func TestUrl(t *testing.T) {
 	logger := logging.NewLogger(cfg)
 	logger.SetOutput(io.Discard)
 
+	recorder, err := cfg.GetRecorder(db, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	testCfg := &api.ApiConfig{
 		Logger:     logger,
 		Cfg:        cfg,
-		Store:      store,
+		Store:      db,
+		Clicks:     recorder,
 		EnableCORS: false,
 	}
 
@@ -100,6 +138,8 @@ func TestUrl(t *testing.T) {
 		body     string
 		wantCode int
 		wantBody string
+		//wantLocation the redirect target, checked when set.
+		wantLocation string
 	}{
 		{
 			name:     "Shorten a valid url",
@@ -117,6 +157,161 @@ func TestUrl(t *testing.T) {
 			wantCode: http.StatusCreated,
 			wantBody: fmt.Sprintf(`{"link":"%s"}`, testLink),
 		},
+		{
+			name:     "Shorten an existing url spelled differently",
+			url:      "/url/shorten",
+			method:   "POST",
+			body:     `{"url":"https://WWW.YouTube.com:443/watch?v=ZO3z966AqbU&t=14s"}`,
+			wantCode: http.StatusCreated,
+			wantBody: fmt.Sprintf(`{"link":"%s"}`, testLink),
+		},
+		{
+			name:     "Shorten an existing url without deduplication",
+			url:      "/url/shorten",
+			method:   "POST",
+			body:     fmt.Sprintf(`{"url":"%s","dedup":false}`, testURL),
+			wantCode: http.StatusCreated,
+			wantBody: `{"link":`,
+		},
+		{
+			name:     "Shorten a url with an alias",
+			url:      "/url/shorten",
+			method:   "POST",
+			body:     `{"url":"https://fupisha.io/summit","alias":"summit2026"}`,
+			wantCode: http.StatusCreated,
+			wantBody: fmt.Sprintf(`{"link":"%ssummit2026"}`, baseURL),
+		},
+		{
+			name:     "Shorten a url with a taken alias",
+			url:      "/url/shorten",
+			method:   "POST",
+			body:     `{"url":"https://fupisha.io/other","alias":"summit2026"}`,
+			wantCode: http.StatusConflict,
+			wantBody: `"suggestions":["summit2026-2","summit2026-4","summit2026-`,
+		},
+		{
+			name:     "Shorten a url with a reserved alias",
+			url:      "/url/shorten",
+			method:   "POST",
+			body:     `{"url":"https://fupisha.io/other","alias":"Ping"}`,
+			wantCode: http.StatusConflict,
+			wantBody: `"error":"alias is not available"`,
+		},
+		{
+			name:     "Shorten a url with an invalid alias",
+			url:      "/url/shorten",
+			method:   "POST",
+			body:     `{"url":"https://fupisha.io/other","alias":"no spaces"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `alias`,
+		},
+		{
+			name:     "Shorten a url with a click limit",
+			url:      "/url/shorten",
+			method:   "POST",
+			body:     `{"url":"https://fupisha.io/once","alias":"once","max_clicks":1}`,
+			wantCode: http.StatusCreated,
+			wantBody: fmt.Sprintf(`{"link":"%sonce"}`, baseURL),
+		},
+		{
+			name:     "Shorten a url with a zero click limit",
+			url:      "/url/shorten",
+			method:   "POST",
+			body:     `{"url":"https://fupisha.io/never","max_clicks":0}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `max_clicks`,
+		},
+		{
+			name:     "Shorten a url expiring in the past",
+			url:      "/url/shorten",
+			method:   "POST",
+			body:     fmt.Sprintf(`{"url":"https://fupisha.io/late","expires_at":%q}`, past.Format(time.RFC3339)),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `expires_at`,
+		},
+		{
+			name:     "Shorten a url expiring before it starts",
+			url:      "/url/shorten",
+			method:   "POST",
+			body:     fmt.Sprintf(`{"url":"https://fupisha.io/late","starts_at":%q,"expires_at":%q}`, future.Add(time.Hour).Format(time.RFC3339), future.Format(time.RFC3339)),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `must be after starts_at`,
+		},
+		{
+			name:     "Shorten a javascript url",
+			url:      "/url/shorten",
+			method:   "POST",
+			body:     `{"url":"javascript:alert(document.cookie)"}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Shorten a url with a data fallback",
+			url:      "/url/shorten",
+			method:   "POST",
+			body:     `{"url":"https://fupisha.io/data","fallback_url":"data:text/html,hi"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `fallback_url`,
+		},
+		{
+			name:     "Shorten a short link",
+			url:      "/url/shorten",
+			method:   "POST",
+			body:     fmt.Sprintf(`{"url":"%sloop"}`, baseURL),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `must not point back at the short domain`,
+		},
+		{
+			name:     "Shorten a url with a short password",
+			url:      "/url/shorten",
+			method:   "POST",
+			body:     `{"url":"https://fupisha.io/secret","password":"abc"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `password`,
+		},
+		{
+			name:     "Resolve a password protected url",
+			url:      baseURL + "secret",
+			method:   "GET",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:         "Resolve a url with a click limit",
+			url:          baseURL + "once",
+			method:       "GET",
+			wantCode:     http.StatusFound,
+			wantLocation: "https://fupisha.io/once",
+		},
+		{
+			name:     "Resolve a url past its click limit",
+			url:      baseURL + "once",
+			method:   "GET",
+			wantCode: http.StatusGone,
+		},
+		{
+			name:         "Resolve an expired url with a fallback",
+			url:          baseURL + "expired",
+			method:       "GET",
+			wantCode:     http.StatusFound,
+			wantLocation: "https://fupisha.io/over",
+		},
+		{
+			name:     "Resolve an expired url",
+			url:      baseURL + "ended",
+			method:   "GET",
+			wantCode: http.StatusGone,
+		},
+		{
+			name:     "Resolve a url before it starts",
+			url:      baseURL + "upcoming",
+			method:   "GET",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Resolve an alias",
+			url:      baseURL + "summit2026",
+			method:   "GET",
+			wantCode: http.StatusFound,
+		},
 		{
 			name:     "Resolve a short url",
 			url:      testLink,
@@ -144,10 +339,153 @@ func TestUrl(t *testing.T) {
 			t.Fatalf("handler returned unexpected status: want status code %d got %d", tc.wantCode, rr.Code)
 		}
 
+		if tc.wantLocation != "" && rr.Header().Get("Location") != tc.wantLocation {
+			t.Fatalf("handler redirected to %q want %q", rr.Header().Get("Location"), tc.wantLocation)
+		}
+
 		if tc.method != "GET" {
-			if !strings.Contains(rr.Body.String(), "link") {
+			if !strings.Contains(rr.Body.String(), tc.wantBody) {
 				t.Fatalf("handler returned unexpected body: want response body %q got %q", tc.wantBody, strings.TrimSuffix(rr.Body.String(), "\n"))
 			}
 		}
 	}
+
+	//The right password unlocks the protected url for as long as the cookie lives.
+	unlock := func(password string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", baseURL+"secret", strings.NewReader("password="+password))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		apiHandler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := unlock("open+barley"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("want a wrong password rejected, got %d", rr.Code)
+	}
+
+	unlocked := unlock("open+sesame")
+	if unlocked.Code != http.StatusFound || unlocked.Header().Get("Location") != "https://fupisha.io/secret" {
+		t.Fatalf("want the right password redirected, got %d %q", unlocked.Code, unlocked.Header().Get("Location"))
+	}
+
+	req, err := http.NewRequest("GET", baseURL+"secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range unlocked.Result().Cookies() {
+		req.AddCookie(c)
+	}
+
+	rr := httptest.NewRecorder()
+	apiHandler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusFound {
+		t.Fatalf("want the unlocked url redirected without a prompt, got %d", rr.Code)
+	}
+
+	owned, err := db.GetURLsByOwner(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(owned) != 4 {
+		t.Fatalf("want the deduplicated url, the one shortened without deduplication and the two aliases, got %d urls", len(owned))
+	}
+
+	//Another user shortening the same url gets a link of their own.
+	other, err := db.NewUser(ctx, "other@fupisha.io", testPassword)
+	if err != nil {
+		t.Fatalf("could not create test user %q", err)
+	}
+
+	otherToken, err := jwtService.Encode(other.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err = http.NewRequest("POST", "/url/shorten", strings.NewReader(fmt.Sprintf(`{"url":"%s"}`, testURL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Api", "v1")
+	req.Header.Set("Authorization", "Bearer "+otherToken)
+
+	rr = httptest.NewRecorder()
+	apiHandler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated || strings.Contains(rr.Body.String(), testLink) {
+		t.Fatalf("want a new link for another user, got %d %q", rr.Code, strings.TrimSuffix(rr.Body.String(), "\n"))
+	}
+
+	owned, err = db.GetURLsByOwner(ctx, other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(owned) != 1 || owned[0].OriginalURL != testURL {
+		t.Fatalf("want the other user to own their link, got %+v", owned)
+	}
+
+	//With the query sorted and the tracking parameters stripped, spellings differing in them share a link.
+	cfg.Canonical.SortQuery = true
+	cfg.Canonical.StripTracking = true
+
+	shorten := func(longURL string) string {
+		t.Helper()
+
+		req, err := http.NewRequest("POST", "/url/shorten", strings.NewReader(fmt.Sprintf(`{"url":"%s"}`, longURL)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Api", "v1")
+		req.Header.Set("Authorization", "Bearer "+otherToken)
+
+		rr := httptest.NewRecorder()
+		apiHandler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("want %s shortened, got %d %q", longURL, rr.Code, strings.TrimSuffix(rr.Body.String(), "\n"))
+		}
+		return rr.Body.String()
+	}
+
+	first := shorten("http://Example.com:80/a/./b?b=1&a=2&utm_source=news")
+	if again := shorten("http://example.com/a/b?a=2&fbclid=abc&b=1"); again != first {
+		t.Fatalf("want both spellings to share a link, got %q and %q", first, again)
+	}
+
+	owned, err = db.GetURLsByOwner(ctx, other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(owned) != 2 || owned[0].OriginalURL != "http://Example.com:80/a/./b?b=1&a=2&utm_source=news" || owned[0].CanonicalURL != "http://example.com/a/b?a=2&b=1" {
+		t.Fatalf("want the original and the canonical url stored, got %+v", owned)
+	}
+
+	cfg.Canonical.SortQuery = false
+	cfg.Canonical.StripTracking = false
+
+	//Resolving the short url should have been recorded as a click once the queue is flushed.
+	if err := recorder.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := db.GetURLByParam(ctx, testParam)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clicks, err := db.GetClicksByURL(ctx, resolved.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(clicks) != 1 || resolved.VisitCount == nil || *resolved.VisitCount != 1 {
+		t.Fatalf("want the redirect recorded as a single click, got %d clicks and visit count %v", len(clicks), resolved.VisitCount)
+	}
 }
@@ -0,0 +1,314 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nairobi-gophers/fupisha/api"
+	"github.com/nairobi-gophers/fupisha/config"
+	"github.com/nairobi-gophers/fupisha/logging"
+	"github.com/nairobi-gophers/fupisha/provider"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/nairobi-gophers/fupisha/store/memory"
+)
+
+func TestUTM(t *testing.T) {
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.JWT.Secret) == 0 {
+		cfg.JWT.Secret = "c4c0f2c42bde58f4d5f453483b3bed2b2915779cacff15526b2560b00748ec36"
+	}
+
+	if cfg.JWT.ExpireDelta == 0 {
+		cfg.JWT.ExpireDelta = 6
+	}
+
+	ctx := context.Background()
+
+	db := memory.NewStore()
+
+	owner, err := db.NewUser(ctx, "owner@fupisha.io", "ih@veaStr0ngpassword")
+	if err != nil {
+		t.Fatalf("could not create test user %q", err)
+	}
+
+	other, err := db.NewUser(ctx, "other@fupisha.io", "ih@veaStr0ngpassword")
+	if err != nil {
+		t.Fatalf("could not create test user %q", err)
+	}
+
+	jwtService, err := provider.NewJWTService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ownerToken, err := jwtService.Encode(owner.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherToken, err := jwtService.Encode(other.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logging.NewLogger(cfg)
+	logger.SetOutput(io.Discard)
+
+	recorder, err := cfg.GetRecorder(db, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { recorder.Close(ctx) })
+
+	apiHandler, err := api.New(&api.ApiConfig{
+		Logger: logger,
+		Cfg:    cfg,
+		Store:  db,
+		Clicks: recorder,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, url, token, contentType, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Api", "v1")
+		req.Header.Set("Authorization", "Bearer "+token)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		rr := httptest.NewRecorder()
+		apiHandler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		token    string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Save a preset",
+			method:   "PUT",
+			url:      "/url/utm/presets/newsletter",
+			token:    ownerToken,
+			body:     `{"utm":{"source":" newsletter ","medium":"email","campaign":"spring"}}`,
+			wantCode: http.StatusOK,
+			wantBody: `"utm":{"source":"newsletter","medium":"email","campaign":"spring","term":"","content":""}`,
+		},
+		{
+			name:     "Save a preset without parameters",
+			method:   "PUT",
+			url:      "/url/utm/presets/empty",
+			token:    ownerToken,
+			body:     `{"utm":{"source":" "}}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "must set at least one parameter",
+		},
+		{
+			name:     "Save a preset with an invalid name",
+			method:   "PUT",
+			url:      "/url/utm/presets/-spring",
+			token:    ownerToken,
+			body:     `{"utm":{"source":"newsletter"}}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "name: must contain only letters",
+		},
+		{
+			name:     "Get another user's preset",
+			method:   "GET",
+			url:      "/url/utm/presets/newsletter",
+			token:    otherToken,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Shorten with another user's preset",
+			method:   "POST",
+			url:      "/url/shorten",
+			token:    otherToken,
+			body:     `{"url":"https://fupisha.io/a","utm_preset":"newsletter"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "no utm preset goes by this name",
+		},
+		{
+			name:     "Shorten with a too long utm parameter",
+			method:   "POST",
+			url:      "/url/shorten",
+			token:    ownerToken,
+			body:     `{"url":"https://fupisha.io/a","utm":{"term":"` + strings.Repeat("a", 256) + `"}}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "term: the length must be no more than 255",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := do(tc.method, tc.url, tc.token, "", tc.body)
+
+			if rr.Code != tc.wantCode {
+				t.Fatalf("got status %d want %d, body %q", rr.Code, tc.wantCode, rr.Body.String())
+			}
+
+			if !strings.Contains(rr.Body.String(), tc.wantBody) {
+				t.Fatalf("got body %q want it to contain %q", rr.Body.String(), tc.wantBody)
+			}
+		})
+	}
+
+	urlOf := func(param string) store.URL {
+		t.Helper()
+
+		u, err := db.GetURLByParam(ctx, param)
+		if err != nil {
+			t.Fatalf("could not retrieve %s: %s", param, err)
+		}
+		return u
+	}
+
+	//the preset tags the url, the utm given override it and replace the parameters already in the url.
+	rr := do("POST", "/url/shorten", ownerToken, "", `{
+		"url":"https://fupisha.io/a?utm_campaign=old&id=7#top",
+		"alias":"spring-a",
+		"utm_preset":"newsletter",
+		"utm":{"medium":"sms","content":"blue button"}
+	}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("shortening with a preset returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	u := urlOf("spring-a")
+	if want := "https://fupisha.io/a?id=7&utm_source=newsletter&utm_medium=sms&utm_campaign=spring&utm_content=blue+button#top"; u.OriginalURL != want {
+		t.Fatalf("got url %s want %s", u.OriginalURL, want)
+	}
+
+	if want := (store.UTM{Source: "newsletter", Medium: "sms", Campaign: "spring", Content: "blue button"}); u.UTM != want {
+		t.Fatalf("got utm %+v want %+v", u.UTM, want)
+	}
+
+	//a link tagged for another campaign is not deduplicated with the untagged one.
+	first := do("POST", "/url/shorten", ownerToken, "", `{"url":"https://fupisha.io/b"}`)
+	tagged := do("POST", "/url/shorten", ownerToken, "", `{"url":"https://fupisha.io/b","utm":{"campaign":"summer"}}`)
+	if first.Code != http.StatusCreated || tagged.Code != http.StatusCreated || first.Body.String() == tagged.Body.String() {
+		t.Fatalf("got %q and %q want two links", first.Body.String(), tagged.Body.String())
+	}
+
+	code, resp := func() (int, testBulkResponse) {
+		rr := do("POST", "/url/bulk", ownerToken, "text/csv",
+			"url,alias,utm_preset,utm_campaign\n"+
+				"https://fupisha.io/c,spring-c,newsletter,\n"+
+				"https://fupisha.io/d,summer-d,,summer\n"+
+				"https://fupisha.io/e,winter-e,winter,\n")
+
+		var resp testBulkResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("could not decode %q: %s", rr.Body.String(), err)
+		}
+		return rr.Code, resp
+	}()
+
+	if code != http.StatusMultiStatus || resp.Created != 2 || resp.Failed != 1 || !strings.Contains(resp.Results[2].Error, "no utm preset goes by this name") {
+		t.Fatalf("got %d %+v want two links and an unknown preset", code, resp)
+	}
+
+	if got := urlOf("spring-c").UTM; got != (store.UTM{Source: "newsletter", Medium: "email", Campaign: "spring"}) {
+		t.Fatalf("got utm %+v of the preset row", got)
+	}
+
+	patch := func(id, body string) (string, store.UTM) {
+		t.Helper()
+
+		rr := do("PATCH", "/url/"+id, ownerToken, "", body)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("updating a link returned %d %q", rr.Code, rr.Body.String())
+		}
+
+		var link struct {
+			URL string `json:"url"`
+			UTM struct {
+				Source   string `json:"source"`
+				Medium   string `json:"medium"`
+				Campaign string `json:"campaign"`
+				Term     string `json:"term"`
+				Content  string `json:"content"`
+			} `json:"utm"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &link); err != nil {
+			t.Fatal(err)
+		}
+		return link.URL, store.UTM(link.UTM)
+	}
+
+	//tagging a link moves it to another campaign.
+	id := urlOf("summer-d").ID.String()
+	if url, utm := patch(id, `{"utm":{"campaign":"spring","source":"ads"}}`); url != "https://fupisha.io/d?utm_source=ads&utm_campaign=spring" || utm != (store.UTM{Source: "ads", Campaign: "spring"}) {
+		t.Fatalf("got %s %+v tagging a link", url, utm)
+	}
+
+	//a new url without utm parameters takes the link out of its campaign.
+	if url, utm := patch(id, `{"url":"https://fupisha.io/d"}`); url != "https://fupisha.io/d" || !utm.IsZero() {
+		t.Fatalf("got %s %+v changing the url of a tagged link", url, utm)
+	}
+
+	rr = do("GET", "/url?campaign=spring", ownerToken, "", "")
+
+	var page testLinkPage
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+
+	var params []string
+	for _, l := range page.Links {
+		params = append(params, l.Param)
+	}
+
+	if want := []string{"spring-c", "spring-a"}; !reflect.DeepEqual(params, want) {
+		t.Fatalf("got links %v of the spring campaign want %v", params, want)
+	}
+
+	if err := db.NewClicks(ctx, []store.Click{{URLID: urlOf("spring-a").ID}, {URLID: urlOf("spring-c").ID}}); err != nil {
+		t.Fatal(err)
+	}
+
+	rr = do("GET", "/url/campaigns", ownerToken, "", "")
+	if want := `{"campaigns":[{"campaign":"spring","links":2,"clicks":2},{"campaign":"summer","links":1,"clicks":0}]}`; rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != want {
+		t.Fatalf("campaign stats returned %d %q want %s", rr.Code, rr.Body.String(), want)
+	}
+
+	rr = do("GET", "/url/utm/presets", ownerToken, "", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"name":"newsletter"`) {
+		t.Fatalf("listing presets returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	if rr = do("DELETE", "/url/utm/presets/newsletter", ownerToken, "", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("deleting a preset returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	if rr = do("GET", "/url/utm/presets/newsletter", ownerToken, "", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("getting a deleted preset returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	//the links tagged with a deleted preset keep their parameters.
+	if got := urlOf("spring-a").UTM.Campaign; got != "spring" {
+		t.Fatalf("got campaign %q after deleting its preset", got)
+	}
+}
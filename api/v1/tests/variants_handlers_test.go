@@ -0,0 +1,224 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nairobi-gophers/fupisha/api"
+	"github.com/nairobi-gophers/fupisha/config"
+	"github.com/nairobi-gophers/fupisha/logging"
+	"github.com/nairobi-gophers/fupisha/provider"
+	"github.com/nairobi-gophers/fupisha/store/memory"
+)
+
+func TestVariants(t *testing.T) {
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.JWT.Secret) == 0 {
+		cfg.JWT.Secret = "c4c0f2c42bde58f4d5f453483b3bed2b2915779cacff15526b2560b00748ec36"
+	}
+
+	if cfg.JWT.ExpireDelta == 0 {
+		cfg.JWT.ExpireDelta = 6
+	}
+
+	ctx := context.Background()
+
+	db := memory.NewStore()
+
+	owner, err := db.NewUser(ctx, "owner@fupisha.io", "ih@veaStr0ngpassword")
+	if err != nil {
+		t.Fatalf("could not create test user %q", err)
+	}
+
+	jwtService, err := provider.NewJWTService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwtService.Encode(owner.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logging.NewLogger(cfg)
+	logger.SetOutput(io.Discard)
+
+	recorder, err := cfg.GetRecorder(db, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apiHandler, err := api.New(&api.ApiConfig{
+		Logger: logger,
+		Cfg:    cfg,
+		Store:  db,
+		Clicks: recorder,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Api", "v1")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		apiHandler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		wantBody string
+	}{
+		{
+			name:     "A single variant",
+			body:     `{"url":"https://fupisha.io/a","variants":[{"name":"a","url":"https://fupisha.io/a","weight":1}]}`,
+			wantBody: "must have between 2 and 10 variants",
+		},
+		{
+			name:     "Variants of the same name",
+			body:     `{"url":"https://fupisha.io/a","variants":[{"name":"a","url":"https://fupisha.io/a","weight":1},{"name":" a ","url":"https://fupisha.io/b","weight":1}]}`,
+			wantBody: "must not name two variants a",
+		},
+		{
+			name:     "Variant without a weight",
+			body:     `{"url":"https://fupisha.io/a","variants":[{"name":"a","url":"https://fupisha.io/a"},{"name":"b","url":"https://fupisha.io/b","weight":1}]}`,
+			wantBody: "weight: cannot be blank",
+		},
+		{
+			name:     "Variant refused by the policy",
+			body:     `{"url":"https://fupisha.io/a","variants":[{"name":"a","url":"https://fupisha.io/a","weight":1},{"name":"b","url":"ftp://go.dev/b","weight":1}]}`,
+			wantBody: "variants.1.url",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := do("POST", "/url/shorten", tc.body)
+
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("got status %d want %d, body %q", rr.Code, http.StatusUnprocessableEntity, rr.Body.String())
+			}
+
+			if !strings.Contains(rr.Body.String(), tc.wantBody) {
+				t.Fatalf("got body %q want it to contain %q", rr.Body.String(), tc.wantBody)
+			}
+		})
+	}
+
+	rr := do("POST", "/url/shorten", `{
+		"url":"https://fupisha.io/a",
+		"alias":"split",
+		"variants":[
+			{"name":"a","url":"https://fupisha.io/a","weight":70},
+			{"name":"b","url":"https://fupisha.io/b","weight":30}
+		]
+	}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("shortening with variants returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	visit := func(ip string, cookies ...*http.Cookie) *http.Response {
+		t.Helper()
+
+		req := httptest.NewRequest("GET", "/split", nil)
+		req.RemoteAddr = ip + ":4242"
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+
+		rr := httptest.NewRecorder()
+		apiHandler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusFound {
+			t.Fatalf("visiting a split link returned %d %q", rr.Code, rr.Body.String())
+		}
+		return rr.Result()
+	}
+
+	served := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		served[visit("10.0."+strconv.Itoa(i/200)+"."+strconv.Itoa(i%200)).Header.Get("Location")]++
+	}
+
+	if a := served["https://fupisha.io/a"]; a < 600 || a > 800 || a+served["https://fupisha.io/b"] != 1000 {
+		t.Fatalf("got %v serving 1000 visitors a 70/30 split", served)
+	}
+
+	//the cookie keeps a returning visitor on their variant whatever their address.
+	first := visit("192.0.2.1")
+	for i := 2; i < 10; i++ {
+		if got := visit("192.0.2."+strconv.Itoa(i), first.Cookies()...); got.Header.Get("Location") != first.Header.Get("Location") {
+			t.Fatalf("got %s then %s for the same visitor", first.Header.Get("Location"), got.Header.Get("Location"))
+		}
+	}
+
+	//every click queued so far is written before the stats are read.
+	if err := recorder.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := db.GetURLByParam(ctx, "split")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr = do("GET", "/url/"+u.ID.String()+"/stats", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("link stats returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	var stats struct {
+		Clicks   int `json:"clicks"`
+		Variants []struct {
+			Name   string `json:"name"`
+			URL    string `json:"url"`
+			Weight int    `json:"weight"`
+			Clicks int    `json:"clicks"`
+		} `json:"variants"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Clicks != 1009 || len(stats.Variants) != 2 || stats.Variants[0].Name != "a" || stats.Variants[0].Weight != 70 ||
+		stats.Variants[0].Clicks+stats.Variants[1].Clicks != 1009 || stats.Variants[0].Clicks < served["https://fupisha.io/a"] {
+		t.Fatalf("got stats %+v after serving %v", stats, served)
+	}
+
+	//the clicks served a removed variant are still counted.
+	rr = do("PATCH", "/url/"+u.ID.String(), `{"variants":[{"name":"a","url":"https://fupisha.io/a","weight":1},{"name":"c","url":"https://fupisha.io/c","weight":1}]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("updating the variants returned %d %q", rr.Code, rr.Body.String())
+	}
+
+	rr = do("GET", "/url/"+u.ID.String()+"/stats", "")
+	if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stats.Variants) != 3 || stats.Variants[1].Name != "c" || stats.Variants[1].Clicks != 0 || stats.Variants[2].Name != "b" || stats.Variants[2].URL != "" || stats.Variants[2].Clicks == 0 {
+		t.Fatalf("got stats %+v after replacing variant b", stats)
+	}
+
+	if rr = do("PATCH", "/url/"+u.ID.String(), `{"variants":[]}`); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"variants":[]`) {
+		t.Fatalf("removing the variants returned %d %q", rr.Code, rr.Body.String())
+	}
+}
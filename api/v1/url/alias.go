@@ -0,0 +1,97 @@
+package url
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/go-chi/render"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/pkg/errors"
+
+	"github.com/nairobi-gophers/fupisha/encoding"
+	"github.com/nairobi-gophers/fupisha/reserved"
+)
+
+// The length bounds of a custom alias.
+const (
+	minAliasLength = 3
+	maxAliasLength = 64
+)
+
+// maxSuggestions is how many available aliases a taken alias is answered with.
+const maxSuggestions = 3
+
+// aliasPattern allows letters, digits, dashes and underscores, starting with a letter or digit.
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+var aliasRules = []validation.Rule{
+	validation.Length(minAliasLength, maxAliasLength),
+	validation.Match(aliasPattern).Error("must contain only letters, digits, dashes and underscores and start with a letter or digit"),
+}
+
+// ErrAliasTaken an alias that is already in use or reserved.
+var ErrAliasTaken = errors.New("alias is not available")
+
+// renderAliasTaken responds with 409 Conflict and a few aliases resembling the taken one that are
+// available on the short domain, the default one when it is blank.
+func (rs Resource) renderAliasTaken(w http.ResponseWriter, r *http.Request, domain, alias string) {
+	suggestions, err := rs.suggestAliases(r.Context(), domain, alias)
+	if err != nil {
+		//the conflict stands without suggestions.
+		log(r).WithField("alias", alias).Error(err)
+	}
+
+	render.Render(w, r, ErrConflict(ErrAliasTaken, suggestions))
+}
+
+// suggestAliases returns up to maxSuggestions available aliases derived from the taken one,
+// numbered ones first e.g. summit2026-2, then ones with a random suffix.
+func (rs Resource) suggestAliases(ctx context.Context, domain, alias string) ([]string, error) {
+	var candidates []string
+	for i := 2; i < 2+maxSuggestions; i++ {
+		candidates = append(candidates, suffixed(alias, strconv.Itoa(i)))
+	}
+
+	for i := 0; i < maxSuggestions; i++ {
+		suffix, err := encoding.GenUniqueParam("abcdefghijklmnopqrstuvwxyz1234567890", 3)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, suffixed(alias, suffix))
+	}
+
+	suggestions := []string{}
+
+	for _, c := range candidates {
+		if len(suggestions) == maxSuggestions {
+			break
+		}
+
+		if reserved.IsReserved(c) {
+			continue
+		}
+
+		//deleted urls keep their param until they are restored.
+		taken, err := rs.Store.ParamTaken(ctx, domain, c)
+		if err != nil {
+			return suggestions, errors.Wrap(err, "checking alias availability")
+		}
+		if !taken {
+			suggestions = append(suggestions, c)
+		}
+	}
+
+	return suggestions, nil
+}
+
+// suffixed appends the suffix to the alias, shortening the alias when both would not fit.
+func suffixed(alias, suffix string) string {
+	if max := maxAliasLength - len(suffix) - 1; len(alias) > max {
+		alias = alias[:max]
+	}
+
+	return fmt.Sprintf("%s-%s", alias, suffix)
+}
@@ -0,0 +1,78 @@
+package url
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/pkg/errors"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+
+	"github.com/nairobi-gophers/fupisha/deeplink"
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+// unsafeSchemes can not open an app, they run or read something in the browser instead.
+var unsafeSchemes = map[string]bool{"javascript": true, "data": true, "file": true, "vbscript": true, "blob": true, "about": true}
+
+// appLinksParams are the app links of a request, each one optional.
+type appLinksParams store.AppLinks
+
+func (p *appLinksParams) trim() {
+	for _, s := range []*string{&p.IOS, &p.Android, &p.IOSStore, &p.AndroidStore, &p.Desktop} {
+		*s = strings.TrimSpace(*s)
+	}
+}
+
+func (p appLinksParams) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.IOS, validation.By(validateAppLink)),
+		validation.Field(&p.Android, validation.By(validateAppLink)),
+		validation.Field(&p.IOSStore, is.URL),
+		validation.Field(&p.AndroidStore, is.URL),
+		validation.Field(&p.Desktop, is.URL),
+	)
+}
+
+// validateAppLink checks the value is a custom scheme deep link or a universal or app link.
+func validateAppLink(value interface{}) error {
+	link, _ := value.(string)
+	if link == "" {
+		return nil
+	}
+
+	if deeplink.IsWebLink(link) {
+		return validation.Validate(link, is.URL)
+	}
+
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme == "" || unsafeSchemes[strings.ToLower(u.Scheme)] {
+		return errors.New("must be a deep link like acme://product/7 or https://acme.com/product/7")
+	}
+
+	return nil
+}
+
+func (p appLinksParams) store() store.AppLinks {
+	return store.AppLinks(p)
+}
+
+// destinations returns the urls of the app links opening in a browser, keyed by their field. The
+// destination policy is for web pages, deep links with a custom scheme are left out.
+func (p appLinksParams) destinations() map[string]string {
+	destinations := map[string]string{
+		"app_links.ios_store":     p.IOSStore,
+		"app_links.android_store": p.AndroidStore,
+		"app_links.desktop":       p.Desktop,
+	}
+
+	if deeplink.IsWebLink(p.IOS) {
+		destinations["app_links.ios"] = p.IOS
+	}
+	if deeplink.IsWebLink(p.Android) {
+		destinations["app_links.android"] = p.Android
+	}
+
+	return destinations
+}
@@ -0,0 +1,578 @@
+package url
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+
+	"github.com/nairobi-gophers/fupisha/params"
+	"github.com/nairobi-gophers/fupisha/reserved"
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+// defaultBulkRows is how many urls a bulk request may shorten unless configured otherwise.
+const defaultBulkRows = 500
+
+// defaultBulkProtectedRows is how many password protected urls a bulk request may shorten unless configured
+// otherwise. Their passwords are hashed one after the other, at around 100ms each the batch stays well
+// within the request timeout.
+const defaultBulkProtectedRows = 20
+
+// maxBulkSize bounds the bytes of a bulk request body.
+const maxBulkSize = 8 << 20
+
+// The outcomes of a row of a bulk request.
+const (
+	//bulkCreated rows got a new link.
+	bulkCreated = "created"
+	//bulkExisting rows got the owner's existing dedup link to the same url.
+	bulkExisting = "existing"
+	//bulkFailed rows got no link, the error tells why.
+	bulkFailed = "failed"
+	//bulkSkipped rows were valid but got no link because another row failed an atomic batch.
+	bulkSkipped = "skipped"
+)
+
+// csvColumns are the header names a bulk csv may use, the fields of a shorten request.
+var csvColumns = map[string]bool{
+	"url": true, "alias": true, "domain": true, "dedup": true, "starts_at": true, "expires_at": true, "max_clicks": true,
+	"fallback_url": true, "password": true, "title": true, "notes": true, "tags": true,
+	"utm_source": true, "utm_medium": true, "utm_campaign": true, "utm_term": true, "utm_content": true, "utm_preset": true,
+}
+
+// ErrBatchTooLarge a bulk request with more rows than allowed.
+var ErrBatchTooLarge = errors.New("too many rows")
+
+// errLinkFailed a row that could not be shortened for reasons of the server.
+var errLinkFailed = errors.New("could not create the link, try again")
+
+// bulkRow is a row of a bulk request, err is set once the row can not be shortened.
+type bulkRow struct {
+	req shortenURLRequest
+	url store.URL
+	err error
+}
+
+// bulkResult is the outcome of one row of a bulk request.
+type bulkResult struct {
+	//Row is the position of the row in the request counting from 1, the csv header left out.
+	Row    int    `json:"row"`
+	Status string `json:"status"`
+	Link   string `json:"link,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type bulkResponse struct {
+	Created int          `json:"created"`
+	Failed  int          `json:"failed"`
+	Results []bulkResult `json:"results"`
+}
+
+// HandleBulkShortenURLs shortens a batch of urls sent either as a JSON array of shorten requests or as
+// a CSV file whose header names the same fields, uploaded in the file field of a multipart form. Rows
+// are shortened one by one and may fail on their own, ?atomic=true shortens all of them or none.
+func (rs Resource) HandleBulkShortenURLs(w http.ResponseWriter, r *http.Request) {
+	userID, err := callerID(r)
+	if err != nil {
+		log(r).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	//Lets validate that userID actually belongs to a real user.
+	if _, err := rs.Store.GetUserByID(r.Context(), userID); err != nil {
+		log(r).WithField("userID", userID).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	maxRows := rs.Config.Bulk.MaxRows
+	if maxRows <= 0 {
+		maxRows = defaultBulkRows
+	}
+
+	maxProtected := rs.Config.Bulk.MaxProtectedRows
+	if maxProtected <= 0 {
+		maxProtected = defaultBulkProtectedRows
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBulkSize)
+
+	rows, err := readBulkRows(r, maxRows)
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		render.Render(w, r, ErrTooLarge(errors.Errorf("a batch holds at most %d bytes", maxBulkSize)))
+		return
+	}
+	if err == ErrBatchTooLarge {
+		render.Render(w, r, ErrTooLarge(errors.Errorf("a batch holds at most %d rows", maxRows)))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	protected := 0
+	for _, row := range rows {
+		if row.req.Password != "" {
+			protected++
+		}
+	}
+	if protected > maxProtected {
+		render.Render(w, r, ErrTooLarge(errors.Errorf("a batch holds at most %d password protected rows", maxProtected)))
+		return
+	}
+
+	results := make([]bulkResult, len(rows))
+
+	//presets holds the utm presets looked up so far by name, rows mostly share theirs.
+	presets := make(map[string]store.UTM)
+	//checked holds the outcome of checking the short domains seen so far by host, nil for the usable ones.
+	checked := make(map[string]error)
+
+	for i := range rows {
+		row := &rows[i]
+		results[i].Row = i + 1
+
+		if row.err == nil {
+			row.err = row.req.Bind(r)
+		}
+
+		if row.err == nil {
+			row.err = rs.checkDestinations(r.Context(), row.req.destinations())
+			if _, invalid := row.err.(validation.Errors); row.err != nil && !invalid {
+				log(r).WithField("userID", userID).Error(row.err)
+				render.Render(w, r, ErrInternalServerError)
+				return
+			}
+		}
+
+		if row.err == nil {
+			preset, ok := presets[row.req.UTMPreset]
+			if !ok {
+				var err error
+				if preset, err = rs.presetUTM(r.Context(), userID, row.req.UTMPreset); err != nil {
+					if _, invalid := err.(validation.Errors); !invalid {
+						log(r).WithField("userID", userID).Error(err)
+						render.Render(w, r, ErrInternalServerError)
+						return
+					}
+					row.err = err
+				} else {
+					presets[row.req.UTMPreset] = preset
+				}
+			}
+
+			row.req.URL = tagURL(row.req.URL, preset.Merge(row.req.UTM.store()))
+		}
+
+		if row.err == nil {
+			err, ok := checked[row.req.Domain]
+			if !ok {
+				if err = rs.checkDomain(r.Context(), userID, row.req.Domain); err != nil {
+					if _, invalid := err.(validation.Errors); !invalid {
+						log(r).WithField("userID", userID).Error(err)
+						render.Render(w, r, ErrInternalServerError)
+						return
+					}
+				}
+				checked[row.req.Domain] = err
+			}
+			row.err = err
+		}
+
+		if row.err == nil && row.req.Alias != "" && reserved.IsReserved(row.req.Alias) {
+			row.err = ErrAliasTaken
+		}
+
+		if row.err == nil {
+			row.url = row.req.newURL(userID)
+			row.url.CanonicalURL, row.err = rs.canonicalize(row.url.OriginalURL)
+		}
+
+		if row.err != nil {
+			fail(&results[i], row.err)
+		}
+	}
+
+	status := http.StatusCreated
+
+	if r.URL.Query().Get("atomic") == "true" {
+		status, err = rs.shortenAll(r.Context(), rows, results)
+	} else {
+		err = rs.shortenEach(r.Context(), rows, results)
+	}
+
+	if err != nil {
+		log(r).WithField("userID", userID).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	resp := bulkResponse{Results: results}
+
+	for _, result := range results {
+		switch result.Status {
+		case bulkCreated, bulkExisting:
+			resp.Created++
+		case bulkFailed:
+			resp.Failed++
+		}
+	}
+
+	if status == http.StatusCreated && resp.Failed > 0 {
+		//some rows got their link, the others failed on their own.
+		status = http.StatusMultiStatus
+	}
+
+	render.Status(r, status)
+	render.Respond(w, r, &resp)
+}
+
+// shortenEach creates the urls of the valid rows one at a time, a row failing leaves the others alone.
+func (rs Resource) shortenEach(ctx context.Context, rows []bulkRow, results []bulkResult) error {
+	for i, row := range rows {
+		if row.err != nil {
+			continue
+		}
+
+		created, err := rs.createURL(ctx, row.url)
+		if err != nil {
+			if err := rs.settle(ctx, row, err, &results[i]); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rs.succeed(&results[i], bulkCreated, created)
+	}
+
+	return nil
+}
+
+// shortenAll creates the urls of every row in a single transaction. Nothing is created when a row is
+// invalid or fails, 422 Unprocessable Entity tells so.
+func (rs Resource) shortenAll(ctx context.Context, rows []bulkRow, results []bulkResult) (int, error) {
+	for _, row := range rows {
+		if row.err != nil {
+			skipValid(results)
+			return http.StatusUnprocessableEntity, nil
+		}
+	}
+
+	var (
+		batch []store.URL
+		//batchRows maps the index of a url in the batch to its row.
+		batchRows []int
+		//firsts maps the canonical url of a dedup row to the first row going there,
+		//the repeats after it share its link.
+		firsts  = make(map[string]int)
+		repeats = make(map[int]int)
+	)
+
+	for i, row := range rows {
+		if row.url.Dedup {
+			existing, err := rs.Store.GetURLByLongStr(ctx, row.url.Owner, row.url.CanonicalURL)
+			if err == nil {
+				rs.succeed(&results[i], bulkExisting, existing)
+				continue
+			}
+			if errors.Cause(err) != sql.ErrNoRows {
+				return 0, err
+			}
+
+			if first, ok := firsts[row.url.CanonicalURL]; ok {
+				repeats[i] = first
+				continue
+			}
+			firsts[row.url.CanonicalURL] = i
+		}
+
+		if row.url.ShortenedURLParam == "" {
+			param, err := rs.Params.Next()
+			if err != nil {
+				return 0, err
+			}
+			rows[i].url.ShortenedURLParam = param
+		}
+
+		batch = append(batch, rows[i].url)
+		batchRows = append(batchRows, i)
+	}
+
+	//taken counts the generated params of each url of the batch that were taken.
+	taken := make(map[int]int)
+
+	for {
+		_, err := rs.Store.NewURLs(ctx, batch)
+		if err == nil {
+			break
+		}
+
+		var batchErr *store.BatchError
+		if !errors.As(err, &batchErr) {
+			return 0, err
+		}
+
+		i := batchRows[batchErr.Index]
+
+		if rows[i].req.Alias == "" && paramTaken(batchErr.Err) {
+			//the batch was rolled back, it is sent again with a fresh param for the url.
+			rs.Params.Taken()
+
+			taken[batchErr.Index]++
+			if taken[batchErr.Index] < params.MaxAttempts {
+				param, err := rs.Params.Next()
+				if err != nil {
+					return 0, err
+				}
+				rows[i].url.ShortenedURLParam = param
+				batch[batchErr.Index].ShortenedURLParam = param
+				continue
+			}
+
+			batchErr.Err = params.ErrExhausted
+		}
+
+		if err := rs.settle(ctx, rows[i], batchErr.Err, &results[i]); err != nil {
+			return 0, err
+		}
+
+		if results[i].Status != bulkFailed {
+			//the dedup link showed up after it was looked for, sending the batch again picks it up.
+			fail(&results[i], errLinkFailed)
+		}
+
+		skipValid(results)
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	for _, i := range batchRows {
+		if rows[i].req.Alias == "" {
+			rs.Params.Free()
+		}
+		rs.succeed(&results[i], bulkCreated, rows[i].url)
+	}
+
+	for i, first := range repeats {
+		rs.succeed(&results[i], bulkExisting, rows[first].url)
+	}
+
+	return http.StatusCreated, nil
+}
+
+// settle records on the result why creating the url of the row failed with err, or the owner's existing
+// dedup link the row gets instead. Errors that are no fault of the row are returned for the request to fail.
+func (rs Resource) settle(ctx context.Context, row bulkRow, err error, result *bulkResult) error {
+	if errors.Cause(err) == params.ErrExhausted {
+		//every generated param tried was taken, the params are longer by the time the row is sent again.
+		fail(result, errLinkFailed)
+		return nil
+	}
+
+	//the domain was deleted since it was checked.
+	if errors.Cause(err) == store.ErrUnverifiedDomain {
+		fail(result, validation.Errors{"domain": errUnverifiedDomain})
+		return nil
+	}
+
+	pqErr, ok := errors.Cause(err).(*pq.Error)
+	if !ok || pqErr.Code != pq.ErrorCode("23505") {
+		return err
+	}
+
+	switch pqErr.Constraint {
+	case store.UniqueURLParam:
+		//somebody else's link already goes by the requested alias.
+		fail(result, ErrAliasTaken)
+	case store.UniqueURLLongStr:
+		existing, err := rs.Store.GetURLByLongStr(ctx, row.url.Owner, row.url.CanonicalURL)
+		if err != nil {
+			return err
+		}
+		rs.succeed(result, bulkExisting, existing)
+	default:
+		return err
+	}
+
+	return nil
+}
+
+func (rs Resource) succeed(result *bulkResult, status string, u store.URL) {
+	result.Status = status
+	result.Link = rs.shortLink(u)
+}
+
+func fail(result *bulkResult, err error) {
+	result.Status = bulkFailed
+	result.Error = err.Error()
+}
+
+// skipValid marks the rows that have not failed as skipped, an atomic batch created none of them.
+func skipValid(results []bulkResult) {
+	for i := range results {
+		if results[i].Status != bulkFailed {
+			results[i].Status = bulkSkipped
+			results[i].Link = ""
+		}
+	}
+}
+
+// readBulkRows reads the rows of a bulk request, a JSON array unless a CSV file is uploaded.
+// A malformed row fails alone, a malformed request fails as a whole.
+func readBulkRows(r *http.Request, maxRows int) ([]bulkRow, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "multipart/form-data":
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, errors.Wrap(err, "reading the csv file")
+		}
+		defer file.Close()
+
+		return readCSVRows(file, maxRows)
+	case "text/csv":
+		return readCSVRows(r.Body, maxRows)
+	}
+
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		return nil, errors.Wrap(err, "reading the json array")
+	}
+
+	if len(raw) > maxRows {
+		return nil, ErrBatchTooLarge
+	}
+
+	rows := make([]bulkRow, len(raw))
+	for i, b := range raw {
+		rows[i].err = json.Unmarshal(b, &rows[i].req)
+	}
+
+	return rows, nil
+}
+
+// readCSVRows reads shorten requests from a csv whose header names the request fields e.g.
+// url,alias,expires_at,tags. Tags are separated by spaces or commas within their field.
+func readCSVRows(f io.Reader, maxRows int) ([]bulkRow, error) {
+	cr := csv.NewReader(f)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading the csv header")
+	}
+
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if !csvColumns[column] {
+			return nil, errors.Errorf("unknown csv column %q", column)
+		}
+		header[i] = column
+	}
+
+	var rows []bulkRow
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "reading the csv")
+		}
+
+		if len(rows) == maxRows {
+			return nil, ErrBatchTooLarge
+		}
+
+		req, err := csvRequest(header, record)
+		rows = append(rows, bulkRow{req: req, err: err})
+	}
+
+	return rows, nil
+}
+
+// csvRequest returns the shorten request of a csv record, blank fields are left out.
+func csvRequest(header, record []string) (shortenURLRequest, error) {
+	var req shortenURLRequest
+
+	errs := validation.Errors{}
+
+	for i, column := range header {
+		value := strings.TrimSpace(record[i])
+		if value == "" {
+			continue
+		}
+
+		switch column {
+		case "url":
+			req.URL = value
+		case "alias":
+			req.Alias = value
+		case "domain":
+			req.Domain = value
+		case "dedup":
+			dedup, err := strconv.ParseBool(value)
+			if err != nil {
+				errs[column] = errors.New("must be true or false")
+			}
+			req.Dedup = &dedup
+		case "starts_at", "expires_at":
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				errs[column] = errRFC3339
+			}
+			if column == "starts_at" {
+				req.StartsAt = &t
+			} else {
+				req.ExpiresAt = &t
+			}
+		case "max_clicks":
+			maxClicks, err := strconv.Atoi(value)
+			if err != nil {
+				errs[column] = errors.New("must be a whole number")
+			}
+			req.MaxClicks = &maxClicks
+		case "fallback_url":
+			req.FallbackURL = value
+		case "password":
+			req.Password = value
+		case "title":
+			req.Title = value
+		case "notes":
+			req.Notes = value
+		case "tags":
+			req.Tags = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+		case "utm_source":
+			req.UTM.Source = value
+		case "utm_medium":
+			req.UTM.Medium = value
+		case "utm_campaign":
+			req.UTM.Campaign = value
+		case "utm_term":
+			req.UTM.Term = value
+		case "utm_content":
+			req.UTM.Content = value
+		case "utm_preset":
+			req.UTMPreset = value
+		}
+	}
+
+	return req, errs.Filter()
+}
@@ -0,0 +1,471 @@
+package url
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/gofrs/uuid"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+
+	"github.com/nairobi-gophers/fupisha/domains"
+	"github.com/nairobi-gophers/fupisha/policy"
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+// ErrUnknownDomain a domain the caller has not added.
+var ErrUnknownDomain = errors.New("no domain of yours goes by this host")
+
+// ErrDomainTaken a domain somebody else has already verified.
+var ErrDomainTaken = errors.New("domain is already verified by somebody else")
+
+// ErrDomainAdded a domain the caller has already added.
+var ErrDomainAdded = errors.New("domain is already added")
+
+// ErrDomainInUse a domain links are still shortened on, deleted ones included as they can be restored.
+var ErrDomainInUse = errors.New("domain still has links")
+
+// errUnverifiedDomain a domain links can not be shortened on.
+var errUnverifiedDomain = errors.New("must be one of your verified domains")
+
+// RequestDomain returns the verified custom domain the request was sent to, the zero domain when it
+// was sent to the default short domain or to a host no verified domain goes by.
+func (rs Resource) RequestDomain(r *http.Request) (store.Domain, error) {
+	host := domains.Host(r)
+	if host == "" || host == rs.defaultHost() {
+		return store.Domain{}, nil
+	}
+
+	domain, err := rs.Store.GetDomainByHost(r.Context(), host)
+	if errors.Cause(err) == sql.ErrNoRows {
+		return store.Domain{}, nil
+	}
+	if err != nil {
+		return store.Domain{}, err
+	}
+
+	return domain, nil
+}
+
+// RenderNotFound sends the visitors of a param the domain has no link for to the not found url of
+// the domain, it responds with 404 Not Found without one.
+func RenderNotFound(w http.ResponseWriter, r *http.Request, domain store.Domain) {
+	if domain.NotFoundURL == "" {
+		render.Render(w, r, ErrURLNotFound(errors.New("url not found")))
+		return
+	}
+
+	http.Redirect(w, r, domain.NotFoundURL, http.StatusFound)
+}
+
+// HandleDomainRoot sends the visitors of a custom domain itself to the root url of the domain, it
+// responds with 404 Not Found on the default short domain or without one.
+func (rs Resource) HandleDomainRoot(w http.ResponseWriter, r *http.Request) {
+	domain, err := rs.RequestDomain(r)
+	if err != nil {
+		log(r).WithField("host", r.Host).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	if domain.RootURL == "" {
+		RenderNotFound(w, r, domain)
+		return
+	}
+
+	http.Redirect(w, r, domain.RootURL, http.StatusFound)
+}
+
+// defaultHost returns the host name of the default short domain.
+func (rs Resource) defaultHost() string {
+	return domains.Normalize(store.Hostname(rs.Config.BaseURL))
+}
+
+// shortLink returns the short url of the url, on its custom domain if it has one. Custom domains are
+// served over the scheme of the default short domain.
+func (rs Resource) shortLink(u store.URL) string {
+	if u.ShortDomain == "" {
+		return rs.baseURL() + u.ShortenedURLParam
+	}
+
+	scheme := "https"
+	if strings.HasPrefix(rs.Config.BaseURL, "http://") {
+		scheme = "http"
+	}
+
+	return scheme + "://" + u.ShortDomain + "/" + u.ShortenedURLParam
+}
+
+// checkLoop rejects a destination on a verified custom domain the way the policy does the default
+// short domain, a short link to a short link could redirect in circles.
+func (rs Resource) checkLoop(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+
+	host := policy.Host(u)
+	if host == "" || host == rs.defaultHost() {
+		return nil
+	}
+
+	if _, err := rs.Store.GetDomainByHost(ctx, host); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	return &policy.Violation{Rule: "loop", Reason: fmt.Sprintf("must not point back at the short domain %s", host)}
+}
+
+// checkDomain checks links can be shortened on the host, the default short domain when it is blank.
+// A host that is not one of the owner's verified domains is an error of the request.
+func (rs Resource) checkDomain(ctx context.Context, owner uuid.UUID, host string) error {
+	if host == "" {
+		return nil
+	}
+
+	domain, err := rs.Store.GetDomainByHost(ctx, host)
+	if errors.Cause(err) == sql.ErrNoRows {
+		return validation.Errors{"domain": errUnverifiedDomain}
+	}
+	if err != nil {
+		return err
+	}
+
+	if domain.Owner != owner {
+		return validation.Errors{"domain": errUnverifiedDomain}
+	}
+
+	return nil
+}
+
+// domainRecord is the DNS record proving a domain is its owner's.
+type domainRecord struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// domainResponse is a custom domain as the domain endpoints return it.
+type domainResponse struct {
+	Host        string       `json:"host"`
+	Verified    bool         `json:"verified"`
+	VerifiedAt  *time.Time   `json:"verified_at,omitempty"`
+	Record      domainRecord `json:"record"`
+	RootURL     string       `json:"root_url,omitempty"`
+	NotFoundURL string       `json:"not_found_url,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+func newDomainResponse(d store.Domain) domainResponse {
+	name, value := domains.Record(d)
+
+	return domainResponse{
+		Host:        d.Host,
+		Verified:    d.Verified(),
+		VerifiedAt:  d.VerifiedAt,
+		Record:      domainRecord{Type: "TXT", Name: name, Value: value},
+		RootURL:     d.RootURL,
+		NotFoundURL: d.NotFoundURL,
+		CreatedAt:   d.CreatedAt,
+		UpdatedAt:   d.UpdatedAt,
+	}
+}
+
+type addDomainRequest struct {
+	Host string `json:"host"`
+	//RootURL visitors of the domain itself are redirected to.
+	RootURL string `json:"root_url"`
+	//NotFoundURL visitors of a param the domain has no link for are redirected to.
+	NotFoundURL string `json:"not_found_url"`
+}
+
+func (body *addDomainRequest) Bind(r *http.Request) error {
+	body.Host = domains.Normalize(body.Host)
+	body.RootURL = strings.TrimSpace(body.RootURL)
+	body.NotFoundURL = strings.TrimSpace(body.NotFoundURL)
+
+	return validation.ValidateStruct(body,
+		validation.Field(&body.Host, validation.Required, is.Domain),
+		validation.Field(&body.RootURL, is.URL),
+		validation.Field(&body.NotFoundURL, is.URL),
+	)
+}
+
+type updateDomainRequest struct {
+	//RootURL and NotFoundURL are left as they are when missing and removed when blank.
+	RootURL     *string `json:"root_url"`
+	NotFoundURL *string `json:"not_found_url"`
+}
+
+func (body *updateDomainRequest) Bind(r *http.Request) error {
+	for _, s := range []*string{body.RootURL, body.NotFoundURL} {
+		if s != nil {
+			*s = strings.TrimSpace(*s)
+		}
+	}
+
+	return validation.ValidateStruct(body,
+		validation.Field(&body.RootURL, is.URL),
+		validation.Field(&body.NotFoundURL, is.URL),
+	)
+}
+
+// destinations returns the urls the domain sends its visitors to, keyed by their field.
+func (body *updateDomainRequest) destinations() map[string]string {
+	destinations := map[string]string{}
+	if body.RootURL != nil {
+		destinations["root_url"] = *body.RootURL
+	}
+	if body.NotFoundURL != nil {
+		destinations["not_found_url"] = *body.NotFoundURL
+	}
+	return destinations
+}
+
+// HandleListDomains returns the caller's custom domains by host.
+func (rs Resource) HandleListDomains(w http.ResponseWriter, r *http.Request) {
+	userID, err := callerID(r)
+	if err != nil {
+		log(r).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	owned, err := rs.Store.GetDomainsByOwner(r.Context(), userID)
+	if err != nil {
+		log(r).WithField("userID", userID).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	resp := struct {
+		Domains []domainResponse `json:"domains"`
+	}{
+		Domains: []domainResponse{},
+	}
+
+	for _, d := range owned {
+		resp.Domains = append(resp.Domains, newDomainResponse(d))
+	}
+
+	render.Respond(w, r, &resp)
+}
+
+// HandleAddDomain adds a custom domain for the caller, links can be shortened on it once the TXT
+// record of the response is published and the domain verified. Anybody may add a host nobody has
+// verified yet, the first to verify it takes it.
+func (rs Resource) HandleAddDomain(w http.ResponseWriter, r *http.Request) {
+	userID, err := callerID(r)
+	if err != nil {
+		log(r).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	body := addDomainRequest{}
+
+	if err := render.Bind(r, &body); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	if body.Host == rs.defaultHost() {
+		render.Render(w, r, ErrInvalidRequest(validation.Errors{"host": errors.New("must not be the default short domain")}))
+		return
+	}
+
+	if err := rs.checkDestinations(r.Context(), map[string]string{"root_url": body.RootURL, "not_found_url": body.NotFoundURL}); err != nil {
+		if _, invalid := err.(validation.Errors); !invalid {
+			log(r).WithField("userID", userID).Error(err)
+			render.Render(w, r, ErrInternalServerError)
+			return
+		}
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	verified, err := rs.Store.GetDomainByHost(r.Context(), body.Host)
+	if err == nil && verified.Owner != userID {
+		render.Render(w, r, ErrConflict(ErrDomainTaken, nil))
+		return
+	}
+	if err != nil && errors.Cause(err) != sql.ErrNoRows {
+		log(r).WithField("userID", userID).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	domain, err := rs.Store.NewDomain(r.Context(), store.Domain{
+		Owner:       userID,
+		Host:        body.Host,
+		RootURL:     body.RootURL,
+		NotFoundURL: body.NotFoundURL,
+	})
+	if err != nil {
+		if pqErr, ok := errors.Cause(err).(*pq.Error); ok && pqErr.Code == pq.ErrorCode("23505") && pqErr.Constraint == store.UniqueDomainOwnerHost {
+			render.Render(w, r, ErrConflict(ErrDomainAdded, nil))
+			return
+		}
+		log(r).WithField("userID", userID).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.Respond(w, r, newDomainResponse(domain))
+}
+
+// HandleGetDomain returns the caller's custom domain of the host of the path.
+func (rs Resource) HandleGetDomain(w http.ResponseWriter, r *http.Request) {
+	domain, ok := rs.ownedDomain(w, r)
+	if !ok {
+		return
+	}
+
+	render.Respond(w, r, newDomainResponse(domain))
+}
+
+// HandleUpdateDomain changes the root or not found url of one of the caller's custom domains.
+func (rs Resource) HandleUpdateDomain(w http.ResponseWriter, r *http.Request) {
+	domain, ok := rs.ownedDomain(w, r)
+	if !ok {
+		return
+	}
+
+	body := updateDomainRequest{}
+
+	if err := render.Bind(r, &body); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	if err := rs.checkDestinations(r.Context(), body.destinations()); err != nil {
+		if _, invalid := err.(validation.Errors); !invalid {
+			log(r).WithField("host", domain.Host).Error(err)
+			render.Render(w, r, ErrInternalServerError)
+			return
+		}
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	if body.RootURL != nil {
+		domain.RootURL = *body.RootURL
+	}
+	if body.NotFoundURL != nil {
+		domain.NotFoundURL = *body.NotFoundURL
+	}
+
+	saved, err := rs.Store.UpdateDomain(r.Context(), domain)
+	if err != nil {
+		log(r).WithField("host", domain.Host).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	render.Respond(w, r, newDomainResponse(saved))
+}
+
+// HandleVerifyDomain looks up the TXT record of one of the caller's custom domains, the domain is
+// verified once the record carries its token and nobody else has verified its host first.
+func (rs Resource) HandleVerifyDomain(w http.ResponseWriter, r *http.Request) {
+	domain, ok := rs.ownedDomain(w, r)
+	if !ok {
+		return
+	}
+
+	if domain.Verified() {
+		render.Respond(w, r, newDomainResponse(domain))
+		return
+	}
+
+	err := rs.Verifier.Verify(r.Context(), domain)
+	if err == domains.ErrRecordNotFound {
+		name, value := domains.Record(domain)
+		render.Render(w, r, ErrInvalidRequest(validation.Errors{
+			"record": errors.Errorf("no TXT record %s holds %s yet, DNS changes can take a while to show", name, value),
+		}))
+		return
+	}
+	if err != nil {
+		log(r).WithField("host", domain.Host).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	domain.VerifiedAt = &now
+
+	saved, err := rs.Store.UpdateDomain(r.Context(), domain)
+	if err != nil {
+		if pqErr, ok := errors.Cause(err).(*pq.Error); ok && pqErr.Code == pq.ErrorCode("23505") && pqErr.Constraint == store.UniqueDomainHost {
+			render.Render(w, r, ErrConflict(ErrDomainTaken, nil))
+			return
+		}
+		log(r).WithField("host", domain.Host).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	render.Respond(w, r, newDomainResponse(saved))
+}
+
+// HandleDeleteDomain removes one of the caller's custom domains as long as none of their links, deleted
+// ones included, is shortened on it. The links would otherwise go to whoever adds the domain next.
+func (rs Resource) HandleDeleteDomain(w http.ResponseWriter, r *http.Request) {
+	domain, ok := rs.ownedDomain(w, r)
+	if !ok {
+		return
+	}
+
+	err := rs.Store.DeleteDomain(r.Context(), domain.ID)
+	if errors.Cause(err) == store.ErrDomainInUse {
+		render.Render(w, r, ErrConflict(ErrDomainInUse, nil))
+		return
+	}
+	if err != nil {
+		log(r).WithField("host", domain.Host).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	render.NoContent(w, r)
+}
+
+// ownedDomain retrieves the caller's custom domain of the host of the path, rendering 404 when they
+// have not added it.
+func (rs Resource) ownedDomain(w http.ResponseWriter, r *http.Request) (store.Domain, bool) {
+	userID, err := callerID(r)
+	if err != nil {
+		log(r).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return store.Domain{}, false
+	}
+
+	domain, err := rs.Store.GetDomain(r.Context(), userID, domains.Normalize(chi.URLParam(r, "host")))
+	if errors.Cause(err) == sql.ErrNoRows {
+		render.Render(w, r, ErrURLNotFound(ErrUnknownDomain))
+		return store.Domain{}, false
+	}
+	if err != nil {
+		log(r).WithField("userID", userID).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return store.Domain{}, false
+	}
+
+	return domain, true
+}
@@ -3,6 +3,7 @@ package url
 import (
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/render"
 )
@@ -16,6 +17,15 @@ var ErrAPIUnsupported = errors.New("unsupported api version")
 //ErrMissingAPIVersion a missing api version header with the version text.
 var ErrMissingAPIVersion = errors.New("missing api version header")
 
+// ErrURLExpired a short url past its expiry.
+var ErrURLExpired = errors.New("url has expired")
+
+// ErrURLDeleted a change to a deleted url, it has to be restored first.
+var ErrURLDeleted = errors.New("url is deleted, restore it first")
+
+// ErrDuplicateURL a deduplicated url going to the same url as another of the owner's.
+var ErrDuplicateURL = errors.New("you already have a link to this url")
+
 // ErrResponse renderer type for handling all sorts of errors.
 type ErrResponse struct {
 	Err            error  `json:"-"`               // low-level runtime error
@@ -23,10 +33,16 @@ type ErrResponse struct {
 	StatusText     string `json:"status"`          // user-level status message
 	AppCode        int64  `json:"code,omitempty"`  // application-specific error code
 	ErrorText      string `json:"error,omitempty"` // application-level error message, for debugging
+
+	Suggestions []string `json:"suggestions,omitempty"` // available alternatives to a conflicting value
+	RetryAfter  int      `json:"-"`                     // seconds the client should wait before retrying
 }
 
 // Render sets the application-specific error code in AppCode.
 func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	if e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(e.RetryAfter))
+	}
 	render.Status(r, e.HTTPStatusCode)
 	return nil
 }
@@ -51,6 +67,27 @@ func ErrInvalidRequest(err error) render.Renderer {
 	}
 }
 
+// ErrTooLarge returns status 413 Request Entity Too Large including error message.
+func ErrTooLarge(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusRequestEntityTooLarge,
+		StatusText:     http.StatusText(http.StatusRequestEntityTooLarge),
+		ErrorText:      err.Error(),
+	}
+}
+
+// ErrConflict returns status 409 Conflict including error message and the available alternatives.
+func ErrConflict(err error, suggestions []string) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusConflict,
+		StatusText:     http.StatusText(http.StatusConflict),
+		ErrorText:      err.Error(),
+		Suggestions:    suggestions,
+	}
+}
+
 //ErrURLNotFound returns status 404 Not Found including error message.
 func ErrURLNotFound(err error) render.Renderer {
 	return &ErrResponse{
@@ -61,6 +98,28 @@ func ErrURLNotFound(err error) render.Renderer {
 	}
 }
 
+// ErrURLGone returns status 410 Gone including error message.
+func ErrURLGone(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusGone,
+		StatusText:     http.StatusText(http.StatusGone),
+		ErrorText:      err.Error(),
+	}
+}
+
+// ErrUnavailable returns status 503 Service Unavailable including error message, the request can be
+// retried after the given seconds.
+func ErrUnavailable(err error, retryAfter int) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusServiceUnavailable,
+		StatusText:     http.StatusText(http.StatusServiceUnavailable),
+		ErrorText:      err.Error(),
+		RetryAfter:     retryAfter,
+	}
+}
+
 // The list of default error types without specific error message.
 var (
 	ErrInternalServerError = &ErrResponse{
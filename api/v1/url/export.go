@@ -0,0 +1,101 @@
+package url
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/pkg/errors"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+
+	"github.com/nairobi-gophers/fupisha/export"
+)
+
+// exportWriteTimeout bounds how long a single write of an export may take, the deadline is pushed out
+// before every write so that exports are not cut off by the write timeout of the server.
+const exportWriteTimeout = 10 * time.Second
+
+// deadlineWriter pushes the write deadline of the response out before every write.
+type deadlineWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func (d deadlineWriter) Write(p []byte) (int, error) {
+	if err := d.rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return 0, err
+	}
+	return d.w.Write(p)
+}
+
+// exportOptions reads what to export from the query string e.g.
+// ?format=parquet&clicks=true&created_after=2026-01-01T00:00:00Z
+func exportOptions(r *http.Request) (export.Options, error) {
+	query := r.URL.Query()
+
+	opts := export.Options{
+		Format: export.Format(query.Get("format")),
+		Clicks: query.Get("clicks") == "true",
+	}
+
+	if opts.Format == "" {
+		opts.Format = export.CSV
+	}
+
+	errs := validation.Errors{}
+
+	switch opts.Format {
+	case export.CSV, export.NDJSON, export.Parquet:
+	default:
+		errs["format"] = errors.New("must be csv, ndjson or parquet")
+	}
+
+	for param, bound := range map[string]**time.Time{"created_after": &opts.From, "created_before": &opts.To} {
+		if s := query.Get(param); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				errs[param] = errRFC3339
+			}
+			*bound = &t
+		}
+	}
+
+	return opts, errs.Filter()
+}
+
+// HandleExportURLs streams the caller's live links, or the clicks on them, as a csv, ndjson or parquet download.
+func (rs Resource) HandleExportURLs(w http.ResponseWriter, r *http.Request) {
+	userID, err := callerID(r)
+	if err != nil {
+		log(r).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	opts, err := exportOptions(r)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	opts.Owner = userID
+
+	name := "links"
+	if opts.Clicks {
+		name = "clicks"
+	}
+
+	w.Header().Set("Content-Type", opts.Format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"fupisha-%s.%s\"", name, opts.Format))
+
+	//the status is sent with the first bytes, a failure part way through can only cut the connection so
+	//that the client sees the download is incomplete.
+	out := deadlineWriter{w: w, rc: http.NewResponseController(w)}
+	if err := export.Export(r.Context(), rs.Store, out, opts); err != nil {
+		log(r).WithField("userID", userID).Error(err)
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -1,8 +1,10 @@
 package url
 
 import (
+	"context"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/go-chi/render"
 	"github.com/go-ozzo/ozzo-validation/is"
@@ -14,18 +16,146 @@ import (
 	validation "github.com/go-ozzo/ozzo-validation"
 
 	"github.com/nairobi-gophers/fupisha/api/v1/auth"
-	"github.com/nairobi-gophers/fupisha/encoding"
+	"github.com/nairobi-gophers/fupisha/canonical"
+	"github.com/nairobi-gophers/fupisha/domains"
 	"github.com/nairobi-gophers/fupisha/logging"
+	"github.com/nairobi-gophers/fupisha/params"
+	"github.com/nairobi-gophers/fupisha/policy"
+	"github.com/nairobi-gophers/fupisha/reserved"
+	"github.com/nairobi-gophers/fupisha/store"
 )
 
 type shortenURLRequest struct {
 	URL string `json:"url"`
+	//Alias is the param the short url should have instead of a generated one e.g. summit2026.
+	Alias string `json:"alias"`
+	//Domain is one of the user's verified custom domains to shorten the url on e.g. go.acme.com,
+	//the default short domain when blank.
+	Domain string `json:"domain"`
+	//Dedup returns the user's existing link to the url instead of creating a new one,
+	//defaults to true unless an alias, a domain, a schedule or a click limit is given.
+	Dedup *bool `json:"dedup"`
+	//StartsAt the link redirects from, it answers 404 before then.
+	StartsAt *time.Time `json:"starts_at"`
+	//ExpiresAt the link stops redirecting and answers 410 Gone.
+	ExpiresAt *time.Time `json:"expires_at"`
+	//MaxClicks the link redirects before it answers 410 Gone.
+	MaxClicks *int `json:"max_clicks"`
+	//FallbackURL visitors are redirected to instead of getting an error while the link is not live.
+	FallbackURL string `json:"fallback_url"`
+	//Password visitors have to enter before they are redirected.
+	Password string `json:"password"`
+	//Title, Notes and Tags describe the link to its owner, the listing searches and filters by them.
+	Title string   `json:"title"`
+	Notes string   `json:"notes"`
+	Tags  []string `json:"tags"`
+	//UTM parameters tag the url for campaign stats, replacing the ones of the same name in its query.
+	UTM utmParams `json:"utm"`
+	//UTMPreset names one of the caller's saved presets to tag the url with, the utm given override it.
+	UTMPreset string `json:"utm_preset"`
+	//Routes send the visitors matching their rules elsewhere than the url, e.g. by country or device.
+	Routes routesParams `json:"routes"`
+	//Variants split the visitors no route matched across several urls by weight, e.g. for an a/b test.
+	Variants variantsParams `json:"variants"`
+	//AppLinks open the link in the mobile apps, e.g. from a campaign.
+	AppLinks appLinksParams `json:"app_links"`
 }
 
 func (body *shortenURLRequest) Bind(r *http.Request) error {
 	body.URL = strings.TrimSpace(body.URL)
+	body.Alias = strings.TrimSpace(body.Alias)
+	body.Domain = domains.Normalize(body.Domain)
+	body.FallbackURL = strings.TrimSpace(body.FallbackURL)
+	body.Title = strings.TrimSpace(body.Title)
+	body.Notes = strings.TrimSpace(body.Notes)
+	body.Tags = normalizeTags(body.Tags)
+	body.UTM.trim()
+	body.UTMPreset = strings.TrimSpace(body.UTMPreset)
+	body.Routes.normalize()
+	body.Variants.trim()
+	body.AppLinks.trim()
 
-	return validation.ValidateStruct(body, validation.Field(&body.URL, validation.Required, is.URL))
+	if body.Dedup == nil {
+		//an existing link would not carry the domain, the schedule, the limit, the password, the campaign, the routes, the variants or the app links asked for.
+		dedup := body.Alias == "" && body.Domain == "" && body.StartsAt == nil && body.ExpiresAt == nil && body.MaxClicks == nil && body.Password == "" &&
+			body.UTM.store().IsZero() && body.UTMPreset == "" && len(body.Routes.Rules) == 0 && len(body.Variants) == 0 &&
+			body.AppLinks.store().IsZero()
+		body.Dedup = &dedup
+	}
+
+	return validation.ValidateStruct(body,
+		validation.Field(&body.URL, validation.Required, is.URL),
+		validation.Field(&body.Alias, aliasRules...),
+		validation.Field(&body.ExpiresAt, validation.By(body.validateExpiry)),
+		validation.Field(&body.MaxClicks, validation.NilOrNotEmpty, validation.Min(1)),
+		validation.Field(&body.FallbackURL, is.URL),
+		//bcrypt ignores everything past 72 bytes.
+		validation.Field(&body.Password, validation.Length(6, 72)),
+		validation.Field(&body.Title, validation.Length(0, maxTitleLength)),
+		validation.Field(&body.Notes, validation.Length(0, maxNotesLength)),
+		validation.Field(&body.Tags, tagRules...),
+		validation.Field(&body.UTM),
+		validation.Field(&body.UTMPreset, presetNameRules...),
+		validation.Field(&body.Routes),
+		validation.Field(&body.Variants),
+		validation.Field(&body.AppLinks),
+	)
+}
+
+// validateExpiry checks the link expires in the future and after it starts.
+func (body *shortenURLRequest) validateExpiry(value interface{}) error {
+	if body.ExpiresAt == nil {
+		return nil
+	}
+
+	if !body.ExpiresAt.After(time.Now()) {
+		return errors.New("must be in the future")
+	}
+
+	if body.StartsAt != nil && !body.ExpiresAt.After(*body.StartsAt) {
+		return errors.New("must be after starts_at")
+	}
+
+	return nil
+}
+
+// destinations returns the urls the link goes to, keyed by their field.
+func (body *shortenURLRequest) destinations() map[string]string {
+	destinations := body.Routes.destinations()
+	for field, url := range body.Variants.destinations() {
+		destinations[field] = url
+	}
+	for field, url := range body.AppLinks.destinations() {
+		destinations[field] = url
+	}
+	destinations["url"] = body.URL
+	destinations["fallback_url"] = body.FallbackURL
+	return destinations
+}
+
+// newURL returns the url the request asks the owner's link to go to on the short domain asked for,
+// under the alias if one is given and without a param otherwise, createURL generates it. The link is
+// filed under the utm parameters found in the query of the url.
+func (body *shortenURLRequest) newURL(owner uuid.UUID) store.URL {
+	return store.URL{
+		Owner:             owner,
+		OriginalURL:       body.URL,
+		ShortenedURLParam: body.Alias,
+		ShortDomain:       body.Domain,
+		Dedup:             *body.Dedup,
+		StartsAt:          body.StartsAt,
+		ExpiresAt:         body.ExpiresAt,
+		MaxClicks:         body.MaxClicks,
+		FallbackURL:       body.FallbackURL,
+		Password:          body.Password,
+		Title:             body.Title,
+		Notes:             body.Notes,
+		Tags:              body.Tags,
+		UTM:               parseUTM(body.URL),
+		Routes:            body.Routes.store(),
+		Variants:          body.Variants.store(),
+		AppLinks:          body.AppLinks.store(),
+	}
 }
 
 // HandleShortenURL shortens the url and returns the shrotened url in the response body
@@ -38,6 +168,16 @@ func (rs Resource) HandleShortenURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := rs.checkDestinations(r.Context(), body.destinations()); err != nil {
+		if _, invalid := err.(validation.Errors); !invalid {
+			log(r).Error(err)
+			render.Render(w, r, ErrInternalServerError)
+			return
+		}
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
 	id, ok := auth.FromContext(r.Context())
 	if !ok {
 		log(r).Error(errors.New("could not extract userID from context"))
@@ -60,34 +200,70 @@ func (rs Resource) HandleShortenURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	baseURL := rs.Config.BaseURL + ":" + rs.Config.Port
-
-	param, err := Shorten(body.URL, rs.Config.ParamLength)
-
-	if !strings.HasSuffix(baseURL, "/") {
-		baseURL += "/"
+	preset, err := rs.presetUTM(r.Context(), userID, body.UTMPreset)
+	if _, ok := err.(validation.Errors); ok {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if err != nil {
+		log(r).WithField("userID", userID).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
 	}
 
-	link := baseURL + param
+	body.URL = tagURL(body.URL, preset.Merge(body.UTM.store()))
 
+	err = rs.checkDomain(r.Context(), userID, body.Domain)
+	if _, ok := err.(validation.Errors); ok {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
 	if err != nil {
-		log(r).WithField("url", body.URL).Error(err)
+		log(r).WithField("userID", userID).Error(err)
 		render.Render(w, r, ErrInternalServerError)
 		return
 	}
 
+	if body.Alias != "" && reserved.IsReserved(body.Alias) {
+		rs.renderAliasTaken(w, r, body.Domain, body.Alias)
+		return
+	}
+
+	url := body.newURL(userID)
+
+	if url.CanonicalURL, err = rs.canonicalize(url.OriginalURL); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
 	type resBody struct {
 		Link string `json:"link"`
 	}
 
 	//Insert the shortened url in the database
-	_, err = rs.Store.NewURL(r.Context(), userID, body.URL, param)
+	created, err := rs.createURL(r.Context(), url)
 	if err != nil {
-		if pqErr, ok := errors.Cause(err).(*pq.Error); ok {
-			//if its a unique key violation, that means we had already shortened the url before.
-			if pqErr.Code == pq.ErrorCode("23505") {
+		//every generated param tried was taken, the params are longer by the time the request is sent again.
+		if errors.Cause(err) == params.ErrExhausted {
+			log(r).WithField("url", body.URL).Warn(err)
+			render.Render(w, r, ErrUnavailable(errLinkFailed, 1))
+			return
+		}
+		//the domain was deleted since it was checked.
+		if errors.Cause(err) == store.ErrUnverifiedDomain {
+			render.Render(w, r, ErrInvalidRequest(validation.Errors{"domain": errUnverifiedDomain}))
+			return
+		}
+		if pqErr, ok := errors.Cause(err).(*pq.Error); ok && pqErr.Code == pq.ErrorCode("23505") {
+			//somebody else's link already goes by the requested alias.
+			if pqErr.Constraint == store.UniqueURLParam {
+				rs.renderAliasTaken(w, r, url.ShortDomain, url.ShortenedURLParam)
+				return
+			}
+			//the user had already shortened the url before.
+			if pqErr.Constraint == store.UniqueURLLongStr {
 				//Let's retrieve the shortened url param.
-				url, err := rs.Store.GetURLByLongStr(r.Context(), body.URL)
+				existing, err := rs.Store.GetURLByLongStr(r.Context(), userID, url.CanonicalURL)
 				if err != nil {
 					log(r).WithField("url", body.URL).Error(err)
 					render.Render(w, r, ErrInternalServerError)
@@ -95,10 +271,8 @@ func (rs Resource) HandleShortenURL(w http.ResponseWriter, r *http.Request) {
 				}
 				//concatenate the short url param with our baseurl e.g
 				//http://localhost:8888/ + okzbUwy = http://localhost:8888/okzbUwy
-				link = baseURL + url.ShortenedURLParam
-
 				resp := resBody{
-					Link: link,
+					Link: rs.shortLink(existing),
 				}
 
 				render.Status(r, http.StatusCreated)
@@ -112,22 +286,68 @@ func (rs Resource) HandleShortenURL(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp := resBody{
-		Link: link,
+		Link: rs.shortLink(created),
 	}
 
 	render.Status(r, http.StatusCreated)
 	render.Respond(w, r, &resp)
 }
 
-// Shorten shortens a long url string
-func Shorten(originalURL string, len int) (string, error) {
+// createURL creates the url under its alias, or under fresh generated params until one is free when it
+// has none. It fails with params.ErrExhausted when every param tried was taken.
+func (rs Resource) createURL(ctx context.Context, u store.URL) (store.URL, error) {
+	if u.ShortenedURLParam != "" {
+		return rs.Store.NewURL(ctx, u)
+	}
 
-	param, err := encoding.GenUniqueParam("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890", len)
-	if err != nil {
-		return "", err
+	var created store.URL
+
+	_, err := rs.Params.Try(func(param string) error {
+		u.ShortenedURLParam = param
+
+		var err error
+		created, err = rs.Store.NewURL(ctx, u)
+		return err
+	}, paramTaken)
+
+	return created, err
+}
+
+// paramTaken reports whether creating a url failed because another url already goes by its param.
+func paramTaken(err error) bool {
+	pqErr, ok := errors.Cause(err).(*pq.Error)
+	return ok && pqErr.Code == pq.ErrorCode("23505") && pqErr.Constraint == store.UniqueURLParam
+}
+
+// checkDestinations runs the destination policy on the urls a link goes to and rejects the ones on a
+// verified custom domain, the violations are keyed by the field of the url. Errors looking the
+// domains up are returned as they are.
+func (rs Resource) checkDestinations(ctx context.Context, destinations map[string]string) error {
+	errs := validation.Errors{}
+	for field, u := range destinations {
+		if u == "" {
+			continue
+		}
+
+		err := rs.Policy.Check(u)
+		if err == nil {
+			err = rs.checkLoop(ctx, u)
+		}
+		if _, violation := err.(*policy.Violation); err != nil && !violation {
+			return err
+		}
+		errs[field] = err
 	}
+	return errs.Filter()
+}
 
-	return param, nil
+// canonicalize returns the canonical form of the url a link goes to, links are deduplicated on it.
+func (rs Resource) canonicalize(rawURL string) (string, error) {
+	canonicalURL, err := canonical.URL(rawURL, rs.Config.GetCanonical())
+	if err != nil {
+		return "", validation.Errors{"url": err}
+	}
+	return canonicalURL, nil
 }
 
 func log(r *http.Request) logrus.FieldLogger {
@@ -0,0 +1,485 @@
+package url
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/gofrs/uuid"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+
+	"github.com/nairobi-gophers/fupisha/api/v1/auth"
+	"github.com/nairobi-gophers/fupisha/reserved"
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+// linkResponse is a url as the link management endpoints return it.
+type linkResponse struct {
+	ID           uuid.UUID      `json:"id"`
+	Link         string         `json:"link"`
+	URL          string         `json:"url"`
+	CanonicalURL string         `json:"canonical_url"`
+	Param        string         `json:"param"`
+	Domain       string         `json:"domain,omitempty"`
+	Dedup        bool           `json:"dedup"`
+	VisitCount   int            `json:"visit_count"`
+	StartsAt     *time.Time     `json:"starts_at,omitempty"`
+	ExpiresAt    *time.Time     `json:"expires_at,omitempty"`
+	MaxClicks    *int           `json:"max_clicks,omitempty"`
+	FallbackURL  string         `json:"fallback_url,omitempty"`
+	Protected    bool           `json:"protected"`
+	Title        string         `json:"title,omitempty"`
+	Notes        string         `json:"notes,omitempty"`
+	Tags         []string       `json:"tags"`
+	UTM          utmParams      `json:"utm"`
+	Routes       routesParams   `json:"routes"`
+	Variants     variantsParams `json:"variants"`
+	AppLinks     appLinksParams `json:"app_links"`
+	ExpiredAt    *time.Time     `json:"expired_at,omitempty"`
+	DeletedAt    *time.Time     `json:"deleted_at,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+}
+
+func (rs Resource) newLinkResponse(u store.URL) linkResponse {
+	resp := linkResponse{
+		ID:           u.ID,
+		Link:         rs.shortLink(u),
+		URL:          u.OriginalURL,
+		CanonicalURL: u.Canonical(),
+		Param:        u.ShortenedURLParam,
+		Domain:       u.ShortDomain,
+		Dedup:        u.Dedup,
+		StartsAt:     u.StartsAt,
+		ExpiresAt:    u.ExpiresAt,
+		MaxClicks:    u.MaxClicks,
+		FallbackURL:  u.FallbackURL,
+		Protected:    u.Protected(),
+		Title:        u.Title,
+		Notes:        u.Notes,
+		Tags:         u.Tags,
+		UTM:          newUTMParams(u.UTM),
+		Routes:       newRoutesParams(u.Routes),
+		Variants:     newVariantsParams(u.Variants),
+		AppLinks:     appLinksParams(u.AppLinks),
+		ExpiredAt:    u.ExpiredAt,
+		DeletedAt:    u.DeletedAt,
+		CreatedAt:    u.CreatedAt,
+		UpdatedAt:    u.UpdatedAt,
+	}
+
+	if u.VisitCount != nil {
+		resp.VisitCount = *u.VisitCount
+	}
+
+	if resp.Tags == nil {
+		resp.Tags = []string{}
+	}
+
+	return resp
+}
+
+// nullable is a patch field that tells a field set to null apart from one left out.
+type nullable[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (n *nullable[T]) UnmarshalJSON(b []byte) error {
+	n.Set = true
+	return json.Unmarshal(b, &n.Value)
+}
+
+type updateURLRequest struct {
+	URL   *string `json:"url"`
+	Alias *string `json:"alias"`
+	//StartsAt, ExpiresAt and MaxClicks are removed from the url when set to null.
+	StartsAt    nullable[time.Time] `json:"starts_at"`
+	ExpiresAt   nullable[time.Time] `json:"expires_at"`
+	MaxClicks   nullable[int]       `json:"max_clicks"`
+	FallbackURL *string             `json:"fallback_url"`
+	Title       *string             `json:"title"`
+	Notes       *string             `json:"notes"`
+	//Tags replace the tags of the url, an empty list removes them all.
+	Tags *[]string `json:"tags"`
+	//UTM tags the url, the new one if url is given too, replacing the parameters of the same name.
+	UTM *utmParams `json:"utm"`
+	//Routes replace the routing rules of the url, empty rules remove them.
+	Routes *routesParams `json:"routes"`
+	//Variants replace the variants of the url, an empty list removes them.
+	Variants *variantsParams `json:"variants"`
+	//AppLinks replace the app links of the url, an empty object removes them.
+	AppLinks *appLinksParams `json:"app_links"`
+}
+
+func (body *updateURLRequest) Bind(r *http.Request) error {
+	for _, s := range []*string{body.URL, body.Alias, body.FallbackURL, body.Title, body.Notes} {
+		if s != nil {
+			*s = strings.TrimSpace(*s)
+		}
+	}
+
+	if body.Tags != nil {
+		tags := normalizeTags(*body.Tags)
+		body.Tags = &tags
+	}
+
+	if body.UTM != nil {
+		body.UTM.trim()
+	}
+
+	if body.Routes != nil {
+		body.Routes.normalize()
+	}
+
+	if body.Variants != nil {
+		body.Variants.trim()
+	}
+
+	if body.AppLinks != nil {
+		body.AppLinks.trim()
+	}
+
+	return validation.ValidateStruct(body,
+		validation.Field(&body.URL, validation.NilOrNotEmpty, is.URL),
+		validation.Field(&body.Alias, append([]validation.Rule{validation.NilOrNotEmpty}, aliasRules...)...),
+		validation.Field(&body.ExpiresAt, validation.By(func(interface{}) error {
+			if body.ExpiresAt.Value != nil && !body.ExpiresAt.Value.After(time.Now()) {
+				return errors.New("must be in the future")
+			}
+			return nil
+		})),
+		validation.Field(&body.MaxClicks, validation.By(func(interface{}) error {
+			if body.MaxClicks.Value != nil && *body.MaxClicks.Value < 1 {
+				return errors.New("must be no less than 1")
+			}
+			return nil
+		})),
+		validation.Field(&body.FallbackURL, is.URL),
+		validation.Field(&body.Title, validation.Length(0, maxTitleLength)),
+		validation.Field(&body.Notes, validation.Length(0, maxNotesLength)),
+		validation.Field(&body.Tags, validation.By(func(interface{}) error {
+			if body.Tags == nil {
+				return nil
+			}
+			return validation.Validate(*body.Tags, tagRules...)
+		})),
+		validation.Field(&body.UTM),
+		validation.Field(&body.Routes),
+		validation.Field(&body.Variants),
+		validation.Field(&body.AppLinks),
+	)
+}
+
+// destinations returns the urls the request changes the link to go to, keyed by their field.
+func (body *updateURLRequest) destinations() map[string]string {
+	destinations := make(map[string]string)
+	if body.URL != nil {
+		destinations["url"] = *body.URL
+	}
+	if body.FallbackURL != nil {
+		destinations["fallback_url"] = *body.FallbackURL
+	}
+	if body.Routes != nil {
+		for field, destination := range body.Routes.destinations() {
+			destinations[field] = destination
+		}
+	}
+	if body.Variants != nil {
+		for field, url := range body.Variants.destinations() {
+			destinations[field] = url
+		}
+	}
+	if body.AppLinks != nil {
+		for field, url := range body.AppLinks.destinations() {
+			destinations[field] = url
+		}
+	}
+	return destinations
+}
+
+// apply returns the url with the fields of the request applied, filed under the utm parameters
+// of its original url.
+func (body *updateURLRequest) apply(u store.URL) store.URL {
+	if body.URL != nil {
+		u.OriginalURL = *body.URL
+	}
+
+	if body.UTM != nil {
+		u.OriginalURL = tagURL(u.OriginalURL, body.UTM.store())
+	}
+
+	u.UTM = parseUTM(u.OriginalURL)
+
+	if body.Alias != nil {
+		u.ShortenedURLParam = *body.Alias
+	}
+
+	if body.StartsAt.Set {
+		u.StartsAt = body.StartsAt.Value
+	}
+
+	if body.ExpiresAt.Set {
+		u.ExpiresAt = body.ExpiresAt.Value
+	}
+
+	if body.MaxClicks.Set {
+		u.MaxClicks = body.MaxClicks.Value
+	}
+
+	if body.FallbackURL != nil {
+		u.FallbackURL = *body.FallbackURL
+	}
+
+	if body.Title != nil {
+		u.Title = *body.Title
+	}
+
+	if body.Notes != nil {
+		u.Notes = *body.Notes
+	}
+
+	if body.Tags != nil {
+		u.Tags = *body.Tags
+	}
+
+	if body.Routes != nil {
+		u.Routes = body.Routes.store()
+	}
+
+	if body.Variants != nil {
+		u.Variants = body.Variants.store()
+	}
+
+	if body.AppLinks != nil {
+		u.AppLinks = body.AppLinks.store()
+	}
+
+	return u
+}
+
+// HandleListURLs returns a page of the caller's links, newest first, narrowed down by the filters of the
+// query string. Deleted links are listed with ?deleted=true instead. The next page is fetched by passing
+// the next_cursor of the response as the cursor, the last page has none.
+func (rs Resource) HandleListURLs(w http.ResponseWriter, r *http.Request) {
+	userID, err := callerID(r)
+	if err != nil {
+		log(r).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	filter, err := listFilter(r)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	filter.Owner = userID
+
+	//one link more than the page holds tells whether there is a next page.
+	limit := filter.Limit
+	filter.Limit++
+
+	urls, err := rs.Store.FindURLs(r.Context(), filter)
+	if err != nil {
+		log(r).WithField("userID", userID).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	resp := struct {
+		Links      []linkResponse `json:"links"`
+		NextCursor string         `json:"next_cursor,omitempty"`
+	}{
+		Links: []linkResponse{},
+	}
+
+	if len(urls) > limit {
+		urls = urls[:limit]
+		resp.NextCursor = encodeCursor(urls[limit-1])
+	}
+
+	for _, u := range urls {
+		resp.Links = append(resp.Links, rs.newLinkResponse(u))
+	}
+
+	render.Respond(w, r, &resp)
+}
+
+// HandleGetURL returns one of the caller's links.
+func (rs Resource) HandleGetURL(w http.ResponseWriter, r *http.Request) {
+	u, ok := rs.ownedURL(w, r)
+	if !ok {
+		return
+	}
+
+	render.Respond(w, r, rs.newLinkResponse(u))
+}
+
+// HandleUpdateURL changes the destination, alias, schedule, description, utm parameters, routes, variants or app links of one of the caller's links.
+func (rs Resource) HandleUpdateURL(w http.ResponseWriter, r *http.Request) {
+	u, ok := rs.ownedURL(w, r)
+	if !ok {
+		return
+	}
+
+	if u.DeletedAt != nil {
+		render.Render(w, r, ErrConflict(ErrURLDeleted, nil))
+		return
+	}
+
+	body := updateURLRequest{}
+
+	if err := render.Bind(r, &body); err != nil {
+		log(r).Error(err)
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	if err := rs.checkDestinations(r.Context(), body.destinations()); err != nil {
+		if _, invalid := err.(validation.Errors); !invalid {
+			log(r).WithField("param", u.ShortenedURLParam).Error(err)
+			render.Render(w, r, ErrInternalServerError)
+			return
+		}
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	updated := body.apply(u)
+
+	if updated.OriginalURL != u.OriginalURL {
+		canonicalURL, err := rs.canonicalize(updated.OriginalURL)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		updated.CanonicalURL = canonicalURL
+	}
+
+	if updated.ShortenedURLParam != u.ShortenedURLParam && reserved.IsReserved(updated.ShortenedURLParam) {
+		rs.renderAliasTaken(w, r, updated.ShortDomain, updated.ShortenedURLParam)
+		return
+	}
+
+	if updated.StartsAt != nil && updated.ExpiresAt != nil && !updated.ExpiresAt.After(*updated.StartsAt) {
+		render.Render(w, r, ErrInvalidRequest(validation.Errors{"expires_at": errors.New("must be after starts_at")}))
+		return
+	}
+
+	saved, err := rs.Store.UpdateURL(r.Context(), updated)
+	if err != nil {
+		if pqErr, ok := errors.Cause(err).(*pq.Error); ok && pqErr.Code == pq.ErrorCode("23505") {
+			//somebody else's link already goes by the requested alias.
+			if pqErr.Constraint == store.UniqueURLParam {
+				rs.renderAliasTaken(w, r, updated.ShortDomain, updated.ShortenedURLParam)
+				return
+			}
+			//another of the caller's dedup links already goes to the same canonical url.
+			render.Render(w, r, ErrConflict(ErrDuplicateURL, nil))
+			return
+		}
+		log(r).WithField("id", u.ID).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	render.Respond(w, r, rs.newLinkResponse(saved))
+}
+
+// HandleDeleteURL soft deletes one of the caller's links, it stops redirecting until it is restored.
+func (rs Resource) HandleDeleteURL(w http.ResponseWriter, r *http.Request) {
+	u, ok := rs.ownedURL(w, r)
+	if !ok {
+		return
+	}
+
+	if u.DeletedAt == nil {
+		if err := rs.Store.DeleteURL(r.Context(), u.ID); err != nil {
+			log(r).WithField("id", u.ID).Error(err)
+			render.Render(w, r, ErrInternalServerError)
+			return
+		}
+	}
+
+	render.NoContent(w, r)
+}
+
+// HandleRestoreURL brings back one of the caller's deleted links.
+func (rs Resource) HandleRestoreURL(w http.ResponseWriter, r *http.Request) {
+	u, ok := rs.ownedURL(w, r)
+	if !ok {
+		return
+	}
+
+	if u.DeletedAt != nil {
+		if err := rs.Store.RestoreURL(r.Context(), u.ID); err != nil {
+			//a dedup link to the same url was created while this one was deleted.
+			if pqErr, ok := errors.Cause(err).(*pq.Error); ok && pqErr.Code == pq.ErrorCode("23505") {
+				render.Render(w, r, ErrConflict(ErrDuplicateURL, nil))
+				return
+			}
+			log(r).WithField("id", u.ID).Error(err)
+			render.Render(w, r, ErrInternalServerError)
+			return
+		}
+	}
+
+	restored, err := rs.Store.GetURLByID(r.Context(), u.ID)
+	if err != nil {
+		log(r).WithField("id", u.ID).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	render.Respond(w, r, rs.newLinkResponse(restored))
+}
+
+// ownedURL retrieves the url of the id path param, rendering 404 Not Found unless it belongs to the caller.
+func (rs Resource) ownedURL(w http.ResponseWriter, r *http.Request) (store.URL, bool) {
+	userID, err := callerID(r)
+	if err != nil {
+		log(r).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return store.URL{}, false
+	}
+
+	id, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		render.Render(w, r, ErrURLNotFound(errors.New("not found")))
+		return store.URL{}, false
+	}
+
+	u, err := rs.Store.GetURLByID(r.Context(), id)
+	if errors.Cause(err) == sql.ErrNoRows || (err == nil && u.Owner != userID) {
+		//other users' links are as good as missing.
+		render.Render(w, r, ErrURLNotFound(errors.New("not found")))
+		return store.URL{}, false
+	}
+	if err != nil {
+		log(r).WithField("id", id).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return store.URL{}, false
+	}
+
+	return u, true
+}
+
+// callerID returns the id of the authenticated user making the request.
+func callerID(r *http.Request) (uuid.UUID, error) {
+	id, ok := auth.FromContext(r.Context())
+	if !ok {
+		return uuid.Nil, errors.New("could not extract userID from context")
+	}
+
+	return uuid.FromString(id)
+}
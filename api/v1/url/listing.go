@@ -0,0 +1,151 @@
+package url
+
+import (
+	"encoding/base64"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+// The page sizes of a link listing.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// The bounds of the tags a link is filed under.
+const (
+	maxTags      = 20
+	maxTagLength = 32
+)
+
+// The longest title, notes and search a link listing accepts, in bytes.
+const (
+	maxTitleLength  = 255
+	maxNotesLength  = 2048
+	maxSearchLength = 256
+)
+
+// errRFC3339 a time that is not written the way the api reads times.
+var errRFC3339 = errors.New("must be an RFC 3339 time e.g. 2026-01-02T15:04:05Z")
+
+// tagPattern allows lowercase letters, digits, dashes and underscores, starting with a letter or digit.
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+var tagRules = []validation.Rule{
+	validation.Length(0, maxTags),
+	validation.Each(
+		validation.Length(1, maxTagLength),
+		validation.Match(tagPattern).Error("must contain only letters, digits, dashes and underscores and start with a letter or digit"),
+	),
+}
+
+// normalizeTags lowercases the tags and drops the blank and repeated ones.
+func normalizeTags(tags []string) []string {
+	var normalized []string
+
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+
+	return normalized
+}
+
+// listFilter reads the filters of a link listing from the query string e.g.
+// ?domain=fupisha.io&tag=docs&state=active&q=pricing&campaign=launch&limit=20&cursor=...
+func listFilter(r *http.Request) (store.URLFilter, error) {
+	query := r.URL.Query()
+
+	filter := store.URLFilter{
+		Deleted:  query.Get("deleted") == "true",
+		Domain:   strings.ToLower(strings.TrimSpace(query.Get("domain"))),
+		Tags:     normalizeTags(query["tag"]),
+		State:    store.URLState(query.Get("state")),
+		Search:   strings.TrimSpace(query.Get("q")),
+		Campaign: strings.TrimSpace(query.Get("campaign")),
+		Limit:    defaultPageSize,
+	}
+
+	errs := validation.Errors{}
+
+	if s := query.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			errs["limit"] = errors.Errorf("must be between 1 and %d", maxPageSize)
+		}
+		filter.Limit = limit
+	}
+
+	if s := query.Get("cursor"); s != "" {
+		cursor, err := decodeCursor(s)
+		if err != nil {
+			errs["cursor"] = errors.New("must be the next_cursor of a previous page")
+		}
+		filter.After = cursor
+	}
+
+	for param, bound := range map[string]**time.Time{"created_after": &filter.CreatedAfter, "created_before": &filter.CreatedBefore} {
+		if s := query.Get(param); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				errs[param] = errRFC3339
+			}
+			*bound = &t
+		}
+	}
+
+	switch filter.State {
+	case "", store.URLActive, store.URLExpired:
+	default:
+		errs["state"] = errors.New("must be active or expired")
+	}
+
+	errs["tag"] = validation.Validate(filter.Tags, tagRules...)
+	errs["q"] = validation.Validate(filter.Search, validation.Length(0, maxSearchLength))
+	errs["campaign"] = validation.Validate(filter.Campaign, validation.Length(0, maxUTMLength))
+
+	return filter, errs.Filter()
+}
+
+// encodeCursor returns the opaque cursor of the page continuing after the url.
+func encodeCursor(u store.URL) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(u.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + u.ID.String()))
+}
+
+// decodeCursor reads back a cursor made by encodeCursor.
+func decodeCursor(s string) (*store.URLCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	createdAt, id, ok := strings.Cut(string(b), "|")
+	if !ok {
+		return nil, errors.New("malformed cursor")
+	}
+
+	cursor := &store.URLCursor{}
+
+	if cursor.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return nil, err
+	}
+
+	if cursor.ID, err = uuid.FromString(id); err != nil {
+		return nil, err
+	}
+
+	return cursor, nil
+}
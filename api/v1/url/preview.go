@@ -0,0 +1,258 @@
+package url
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"html/template"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/pkg/errors"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+
+	"github.com/nairobi-gophers/fupisha/domains"
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+// maxExpandURLs is the most short links a single batch expand resolves.
+const maxExpandURLs = 100
+
+// The statuses an expanded short link can be in.
+const (
+	expandActive  = "active"
+	expandExpired = "expired"
+)
+
+// errNotShortLink a url that is neither a fupisha short link nor a short url param.
+var errNotShortLink = errors.New("not a fupisha short link")
+
+//go:embed preview.html
+var previewHTML string
+
+var previewTmpl = template.Must(template.New("preview").Parse(previewHTML))
+
+// expansion is where a short link goes, as the expand endpoints answer it.
+type expansion struct {
+	URL   string `json:"url"`
+	Param string `json:"param,omitempty"`
+	//Destination is left out for protected links, it is only handed to visitors who know the password.
+	Destination string     `json:"destination,omitempty"`
+	Title       string     `json:"title,omitempty"`
+	Protected   bool       `json:"protected,omitempty"`
+	Status      string     `json:"status,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// shortParam returns the short domain and the param of a fupisha short link e.g. abc123 for
+// http://localhost:8888/abc123 or go.acme.com and abc123 for https://go.acme.com/abc123. A bare param
+// is on the default short domain and a trailing + of a preview link is dropped.
+func (rs Resource) shortParam(ctx context.Context, raw string) (domain, param string, err error) {
+	raw = strings.TrimSpace(raw)
+
+	if !strings.Contains(raw, "/") {
+		if raw = strings.TrimSuffix(raw, "+"); raw == "" {
+			return "", "", errNotShortLink
+		}
+		return "", raw, nil
+	}
+
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+
+	u, err := neturl.Parse(raw)
+	if err != nil {
+		return "", "", errNotShortLink
+	}
+
+	if host := domains.Normalize(u.Host); host != rs.defaultHost() {
+		d, err := rs.Store.GetDomainByHost(ctx, host)
+		if errors.Cause(err) == sql.ErrNoRows || (err == nil && !d.Verified()) {
+			return "", "", errNotShortLink
+		}
+		if err != nil {
+			return "", "", err
+		}
+		domain = d.Host
+	}
+
+	param = strings.TrimSuffix(strings.Trim(u.Path, "/"), "+")
+	if param == "" || strings.Contains(param, "/") {
+		return "", "", errNotShortLink
+	}
+
+	return domain, param, nil
+}
+
+// liveURL retrieves the url the param redirects to on the short domain. Urls that have not started are
+// as good as missing, like they are to the redirect.
+func (rs Resource) liveURL(ctx context.Context, domain, param string) (store.URL, error) {
+	u, err := rs.Store.GetDomainURLByParam(ctx, domain, param)
+	if err != nil {
+		return store.URL{}, err
+	}
+
+	if !u.Started(time.Now()) {
+		return store.URL{}, errors.Wrap(sql.ErrNoRows, "url has not started")
+	}
+
+	return u, nil
+}
+
+// expand resolves the short link without following it, so it is not counted as a click.
+func (rs Resource) expand(ctx context.Context, raw string) (expansion, error) {
+	exp := expansion{URL: raw}
+
+	domain, param, err := rs.shortParam(ctx, raw)
+	if err != nil {
+		return exp, err
+	}
+
+	u, err := rs.liveURL(ctx, domain, param)
+	if err != nil {
+		return exp, err
+	}
+
+	exp.Param = u.ShortenedURLParam
+	exp.Title = u.Title
+	exp.Protected = u.Protected()
+	exp.CreatedAt = &u.CreatedAt
+
+	exp.Status = expandActive
+	if u.Expired(time.Now()) {
+		exp.Status = expandExpired
+	}
+
+	if !exp.Protected {
+		exp.Destination = u.OriginalURL
+	}
+
+	return exp, nil
+}
+
+// HandleExpand resolves the short link in ?url= to where it goes, e.g. ?url=http://localhost:8888/abc123
+func (rs Resource) HandleExpand(w http.ResponseWriter, r *http.Request) {
+	raw := r.URL.Query().Get("url")
+	if raw == "" {
+		render.Render(w, r, ErrInvalidRequest(validation.Errors{"url": errors.New("cannot be blank")}))
+		return
+	}
+
+	exp, err := rs.expand(r.Context(), raw)
+	switch {
+	case err == errNotShortLink:
+		render.Render(w, r, ErrInvalidRequest(validation.Errors{"url": err}))
+	case errors.Cause(err) == sql.ErrNoRows:
+		render.Render(w, r, ErrURLNotFound(errors.New("not found")))
+	case err != nil:
+		log(r).WithField("url", raw).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+	default:
+		render.Respond(w, r, exp)
+	}
+}
+
+// expandRequest is a batch of short links to expand.
+type expandRequest struct {
+	URLs []string `json:"urls"`
+}
+
+// Bind validates the expand request.
+func (body *expandRequest) Bind(r *http.Request) error {
+	return validation.ValidateStruct(body,
+		validation.Field(&body.URLs, validation.Required, validation.Length(1, maxExpandURLs)),
+	)
+}
+
+// HandleExpandBatch resolves every short link of the batch, a link that can not be resolved gets
+// an error in its place instead of failing the batch.
+func (rs Resource) HandleExpandBatch(w http.ResponseWriter, r *http.Request) {
+	body := expandRequest{}
+
+	if err := render.Bind(r, &body); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	resp := struct {
+		Results []expansion `json:"results"`
+	}{
+		Results: make([]expansion, 0, len(body.URLs)),
+	}
+
+	for _, raw := range body.URLs {
+		exp, err := rs.expand(r.Context(), raw)
+		switch {
+		case err == errNotShortLink:
+			exp.Error = err.Error()
+		case errors.Cause(err) == sql.ErrNoRows:
+			exp.Error = "not found"
+		case err != nil:
+			log(r).WithField("url", raw).Error(err)
+			exp.Error = "could not be expanded"
+		}
+
+		resp.Results = append(resp.Results, exp)
+	}
+
+	render.Respond(w, r, resp)
+}
+
+// HandlePreview renders a page telling the visitor of /{urlParam}+ where the short link goes,
+// instead of redirecting them there.
+func (rs Resource) HandlePreview(w http.ResponseWriter, r *http.Request) {
+	param := chi.URLParam(r, "urlParam")
+
+	data := struct {
+		Found       bool
+		Link        string
+		Destination string
+		Title       string
+		Protected   bool
+		Expired     bool
+		CreatedAt   time.Time
+	}{}
+
+	status := http.StatusOK
+
+	domain, err := rs.RequestDomain(r)
+	if err != nil {
+		log(r).WithField("host", r.Host).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	u, err := rs.liveURL(r.Context(), domain.Host, param)
+	switch {
+	case errors.Cause(err) == sql.ErrNoRows:
+		status = http.StatusNotFound
+	case err != nil:
+		log(r).WithField("param", param).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	default:
+		data.Found = true
+		data.Link = rs.shortLink(u)
+		data.Title = u.Title
+		data.Protected = u.Protected()
+		data.Expired = u.Expired(time.Now())
+		data.CreatedAt = u.CreatedAt
+
+		if !data.Protected {
+			data.Destination = u.OriginalURL
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+
+	previewTmpl.Execute(w, data)
+}
@@ -0,0 +1,166 @@
+package url
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image/color"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/pkg/errors"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+
+	"github.com/nairobi-gophers/fupisha/qr"
+)
+
+// defaultQRMaxAge is how many seconds a public qr code is cached for when no max age is configured.
+const defaultQRMaxAge = 24 * 60 * 60
+
+// qrOptions reads how a qr code looks from the query string e.g.
+// ?format=svg&size=512&level=H&margin=2&fg=1a2b3c&bg=fff&logo=true
+func (rs Resource) qrOptions(r *http.Request) (string, qr.Options, error) {
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = "png"
+	}
+
+	opts := qr.Options{Level: qr.Level(query.Get("level"))}
+
+	errs := validation.Errors{}
+
+	if format != "png" && format != "svg" {
+		errs["format"] = errors.New("must be png or svg")
+	}
+
+	if s := query.Get("size"); s != "" {
+		size, err := strconv.Atoi(s)
+		if err != nil || size < qr.MinSize || size > qr.MaxSize {
+			errs["size"] = errors.Errorf("must be between %d and %d", qr.MinSize, qr.MaxSize)
+		}
+		opts.Size = size
+	}
+
+	switch opts.Level {
+	case "", qr.L, qr.M, qr.Q, qr.H:
+	default:
+		errs["level"] = errors.New("must be L, M, Q or H")
+	}
+
+	if s := query.Get("margin"); s != "" {
+		margin, err := strconv.Atoi(s)
+		if err != nil || margin < 0 || margin > qr.MaxMargin {
+			errs["margin"] = errors.Errorf("must be between 0 and %d", qr.MaxMargin)
+		}
+		opts.Margin = &margin
+	}
+
+	for param, c := range map[string]*color.Color{"fg": &opts.Foreground, "bg": &opts.Background} {
+		if s := query.Get(param); s != "" {
+			parsed, err := qr.ParseColor(s)
+			if err != nil {
+				errs[param] = errors.New("must be 3, 6 or 8 hex digits e.g. 1a2b3c")
+			}
+			*c = parsed
+		}
+	}
+
+	if query.Get("logo") == "true" {
+		if rs.Logo == nil {
+			errs["logo"] = errors.New("no logo is configured")
+		}
+		opts.Logo = rs.Logo
+	}
+
+	return format, opts, errs.Filter()
+}
+
+// serveQR renders the qr code of the content the way the query string asks, answering a request
+// for the version the client already has with 304 Not Modified.
+func (rs Resource) serveQR(w http.ResponseWriter, r *http.Request, content, cacheControl string) {
+	format, opts, err := rs.qrOptions(r)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	code, err := qr.New(content, opts)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	var buf bytes.Buffer
+
+	contentType := "image/png"
+	if format == "svg" {
+		contentType = "image/svg+xml"
+		err = code.SVG(&buf)
+	} else {
+		err = code.PNG(&buf)
+	}
+	if err != nil {
+		log(r).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", etag)
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
+
+// HandleURLQR renders the qr code of one of the caller's links. Its alias can change, so clients
+// check back with the etag before using a cached code.
+func (rs Resource) HandleURLQR(w http.ResponseWriter, r *http.Request) {
+	u, ok := rs.ownedURL(w, r)
+	if !ok {
+		return
+	}
+
+	rs.serveQR(w, r, rs.shortLink(u), "private, no-cache")
+}
+
+// HandleParamQR renders the public qr code of the short url param on the short domain of the
+// request, for anyone to print.
+func (rs Resource) HandleParamQR(w http.ResponseWriter, r *http.Request) {
+	param := chi.URLParam(r, "urlParam")
+
+	domain, err := rs.RequestDomain(r)
+	if err != nil {
+		log(r).WithField("host", r.Host).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	u, err := rs.Store.GetDomainURLByParam(r.Context(), domain.Host, param)
+	if err != nil {
+		log(r).WithField("param", param).Error(err)
+		render.Render(w, r, ErrURLNotFound(errors.New("not found")))
+		return
+	}
+
+	maxAge := rs.Config.QR.MaxAge
+	if maxAge <= 0 {
+		maxAge = defaultQRMaxAge
+	}
+
+	rs.serveQR(w, r, rs.shortLink(u), fmt.Sprintf("public, max-age=%d", maxAge))
+}
@@ -5,13 +5,39 @@ import (
 	"github.com/nairobi-gophers/fupisha/api/v1/auth"
 )
 
-//Router provides necessary routes for shortening and resolving fupisha urls.
+//Router provides necessary routes for shortening fupisha urls and managing them.
 func (rs *Resource) Router() *chi.Mux {
 	r := chi.NewRouter()
 	r.Group(func(r chi.Router) {
 		r.Use(auth.Verifier(rs.Config))
 		r.Use(auth.CheckAPI)
 		r.Post("/shorten", rs.HandleShortenURL)
+		r.Post("/bulk", rs.HandleBulkShortenURLs)
+		r.Get("/", rs.HandleListURLs)
+		r.Get("/export", rs.HandleExportURLs)
+		r.Get("/campaigns", rs.HandleCampaignStats)
+		r.Route("/utm/presets", func(r chi.Router) {
+			r.Get("/", rs.HandleListUTMPresets)
+			r.Put("/{name}", rs.HandleSaveUTMPreset)
+			r.Get("/{name}", rs.HandleGetUTMPreset)
+			r.Delete("/{name}", rs.HandleDeleteUTMPreset)
+		})
+		r.Route("/domains", func(r chi.Router) {
+			r.Get("/", rs.HandleListDomains)
+			r.Post("/", rs.HandleAddDomain)
+			r.Get("/{host}", rs.HandleGetDomain)
+			r.Patch("/{host}", rs.HandleUpdateDomain)
+			r.Delete("/{host}", rs.HandleDeleteDomain)
+			r.Post("/{host}/verify", rs.HandleVerifyDomain)
+		})
+		r.Route("/{id}", func(r chi.Router) {
+			r.Get("/", rs.HandleGetURL)
+			r.Patch("/", rs.HandleUpdateURL)
+			r.Delete("/", rs.HandleDeleteURL)
+			r.Post("/restore", rs.HandleRestoreURL)
+			r.Get("/qr", rs.HandleURLQR)
+			r.Get("/stats", rs.HandleURLStats)
+		})
 	})
 
 	return r
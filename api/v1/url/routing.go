@@ -0,0 +1,164 @@
+package url
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/pkg/errors"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+
+	"github.com/nairobi-gophers/fupisha/analytics"
+	"github.com/nairobi-gophers/fupisha/routing"
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+// The most rules a link routes its visitors with and the most values a condition of a rule lists.
+const (
+	maxRoutes      = 20
+	maxRouteValues = 50
+	maxOSLength    = 64
+)
+
+var (
+	countryPattern  = regexp.MustCompile(`^[A-Z]{2}$`)
+	languagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+)
+
+// routeParams is a routing rule of a request, the conditions it leaves empty match every visitor.
+type routeParams store.Route
+
+func (p *routeParams) normalize() {
+	p.Destination = strings.TrimSpace(p.Destination)
+	p.Countries = normalizeValues(p.Countries, strings.ToUpper)
+	p.Devices = normalizeValues(p.Devices, strings.ToLower)
+	p.OS = normalizeValues(p.OS, func(s string) string { return s })
+	p.Languages = normalizeValues(p.Languages, strings.ToLower)
+	p.Days = normalizeValues(p.Days, strings.ToLower)
+
+	for _, s := range []*string{&p.StartDate, &p.EndDate, &p.StartTime, &p.EndTime} {
+		*s = strings.TrimSpace(*s)
+	}
+}
+
+func (p routeParams) Validate() error {
+	err := validation.ValidateStruct(&p,
+		validation.Field(&p.Destination, validation.Required, is.URL),
+		validation.Field(&p.Countries, validation.Length(0, maxRouteValues),
+			validation.Each(validation.Match(countryPattern).Error("must be a two letter country code"))),
+		validation.Field(&p.Devices, validation.Length(0, maxRouteValues),
+			validation.Each(validation.In(analytics.DeviceDesktop, analytics.DeviceMobile, analytics.DeviceTablet, analytics.DeviceBot, analytics.DeviceUnknown))),
+		validation.Field(&p.OS, validation.Length(0, maxRouteValues), validation.Each(validation.Length(1, maxOSLength))),
+		validation.Field(&p.Languages, validation.Length(0, maxRouteValues),
+			validation.Each(validation.Match(languagePattern).Error("must be a language tag like sw or en-GB"))),
+		validation.Field(&p.Days, validation.Each(validation.In(weekdays()...))),
+		validation.Field(&p.StartDate, validation.Date(routing.DateLayout).Error("must be a date like 2026-12-01")),
+		validation.Field(&p.EndDate, validation.Date(routing.DateLayout).Error("must be a date like 2026-12-01"),
+			validation.By(func(interface{}) error {
+				if p.StartDate != "" && p.EndDate != "" && p.EndDate < p.StartDate {
+					return errors.New("must not be before start_date")
+				}
+				return nil
+			})),
+		validation.Field(&p.StartTime, validation.Date(routing.ClockLayout).Error("must be a time of day like 09:30")),
+		validation.Field(&p.EndTime, validation.Date(routing.ClockLayout).Error("must be a time of day like 17:30")),
+	)
+	if err != nil {
+		return err
+	}
+
+	if len(p.Countries)+len(p.Devices)+len(p.OS)+len(p.Languages)+len(p.Days) == 0 &&
+		p.StartDate == "" && p.EndDate == "" && p.StartTime == "" && p.EndTime == "" {
+		//a rule matching everybody would hide the original url and every rule after it.
+		return errors.New("must set at least one condition")
+	}
+
+	return nil
+}
+
+// routesParams are the routing rules of a request, the first rule a visitor matches decides where
+// they are sent.
+type routesParams struct {
+	Timezone string        `json:"timezone,omitempty"`
+	Rules    []routeParams `json:"rules"`
+}
+
+func newRoutesParams(r store.Routes) routesParams {
+	p := routesParams{Timezone: r.Timezone, Rules: []routeParams{}}
+	for _, rule := range r.Rules {
+		p.Rules = append(p.Rules, routeParams(rule))
+	}
+	return p
+}
+
+func (p *routesParams) normalize() {
+	p.Timezone = strings.TrimSpace(p.Timezone)
+	for i := range p.Rules {
+		p.Rules[i].normalize()
+	}
+}
+
+func (p routesParams) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Timezone, validation.By(func(interface{}) error {
+			if p.Timezone == "" {
+				return nil
+			}
+			//Local is the zone of whichever machine happens to serve the link.
+			if _, err := time.LoadLocation(p.Timezone); err != nil || p.Timezone == "Local" {
+				return errors.New("must be an IANA time zone like Africa/Nairobi")
+			}
+			return nil
+		})),
+		validation.Field(&p.Rules, validation.Length(0, maxRoutes)),
+	)
+}
+
+func (p routesParams) store() store.Routes {
+	if len(p.Rules) == 0 {
+		return store.Routes{}
+	}
+
+	routes := store.Routes{Timezone: p.Timezone}
+	for _, rule := range p.Rules {
+		routes.Rules = append(routes.Rules, store.Route(rule))
+	}
+	return routes
+}
+
+// destinations returns the destinations of the rules, keyed by their field.
+func (p routesParams) destinations() map[string]string {
+	destinations := make(map[string]string, len(p.Rules))
+	for i, rule := range p.Rules {
+		destinations["routes.rules."+strconv.Itoa(i)+".destination"] = rule.Destination
+	}
+	return destinations
+}
+
+// weekdays returns the days rules can name, as values of the In rule.
+func weekdays() []interface{} {
+	days := make([]interface{}, len(routing.Weekdays))
+	for i, day := range routing.Weekdays {
+		days[i] = day
+	}
+	return days
+}
+
+// normalizeValues trims and folds the values of a condition, dropping the blank and repeated ones.
+func normalizeValues(values []string, fold func(string) string) []string {
+	var normalized []string
+
+	seen := make(map[string]bool)
+	for _, v := range values {
+		v = fold(strings.TrimSpace(v))
+		if v != "" && !seen[v] {
+			seen[v] = true
+			normalized = append(normalized, v)
+		}
+	}
+
+	return normalized
+}
@@ -1,7 +1,13 @@
 package url
 
 import (
+	"image"
+	"strings"
+
 	"github.com/nairobi-gophers/fupisha/config"
+	"github.com/nairobi-gophers/fupisha/domains"
+	"github.com/nairobi-gophers/fupisha/params"
+	"github.com/nairobi-gophers/fupisha/policy"
 	"github.com/nairobi-gophers/fupisha/store"
 )
 
@@ -9,6 +15,14 @@ import (
 type Resource struct {
 	Store  store.Store
 	Config *config.Config
+	//Logo qr codes carry in their middle when asked to, nil if none is configured.
+	Logo image.Image
+	//Policy decides which destinations links can go to.
+	Policy *policy.Policy
+	//Params generates the params of links shortened without an alias.
+	Params *params.Generator
+	//Verifier checks the TXT records of the custom domains users add.
+	Verifier *domains.Verifier
 }
 
 // NewResource returns a configures url resource.
@@ -18,3 +32,13 @@ func NewResource(store store.Store, cfg *config.Config) *Resource {
 		Config: cfg,
 	}
 }
+
+// baseURL returns the prefix of every short url e.g. http://localhost:8888/
+func (rs Resource) baseURL() string {
+	baseURL := rs.Config.BaseURL + ":" + rs.Config.Port
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+
+	return baseURL
+}
@@ -0,0 +1,342 @@
+package url
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+// maxUTMLength is the longest utm parameter a link is tagged with, in bytes.
+const maxUTMLength = 255
+
+// The length bounds of the name of a utm preset.
+const (
+	minPresetNameLength = 1
+	maxPresetNameLength = 64
+)
+
+var presetNameRules = []validation.Rule{
+	validation.Length(minPresetNameLength, maxPresetNameLength),
+	validation.Match(aliasPattern).Error("must contain only letters, digits, dashes and underscores and start with a letter or digit"),
+}
+
+// ErrUnknownPreset a utm preset the caller has not saved.
+var ErrUnknownPreset = errors.New("no utm preset goes by this name")
+
+// utmParams are the utm parameters of a request, each one tags the url with the utm_ query parameter
+// of its name.
+type utmParams struct {
+	Source   string `json:"source"`
+	Medium   string `json:"medium"`
+	Campaign string `json:"campaign"`
+	Term     string `json:"term"`
+	Content  string `json:"content"`
+}
+
+func newUTMParams(u store.UTM) utmParams {
+	return utmParams{Source: u.Source, Medium: u.Medium, Campaign: u.Campaign, Term: u.Term, Content: u.Content}
+}
+
+func (p *utmParams) trim() {
+	for _, s := range []*string{&p.Source, &p.Medium, &p.Campaign, &p.Term, &p.Content} {
+		*s = strings.TrimSpace(*s)
+	}
+}
+
+func (p utmParams) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Source, validation.Length(0, maxUTMLength)),
+		validation.Field(&p.Medium, validation.Length(0, maxUTMLength)),
+		validation.Field(&p.Campaign, validation.Length(0, maxUTMLength)),
+		validation.Field(&p.Term, validation.Length(0, maxUTMLength)),
+		validation.Field(&p.Content, validation.Length(0, maxUTMLength)),
+	)
+}
+
+func (p utmParams) store() store.UTM {
+	return store.UTM{Source: p.Source, Medium: p.Medium, Campaign: p.Campaign, Term: p.Term, Content: p.Content}
+}
+
+// utmFields pairs the utm query parameters with the fields of u holding them, in the order urls are
+// tagged with them.
+func utmFields(u *store.UTM) []struct {
+	name  string
+	value *string
+} {
+	return []struct {
+		name  string
+		value *string
+	}{
+		{"utm_source", &u.Source},
+		{"utm_medium", &u.Medium},
+		{"utm_campaign", &u.Campaign},
+		{"utm_term", &u.Term},
+		{"utm_content", &u.Content},
+	}
+}
+
+// tagURL sets the utm parameters of u in the query of the url, replacing the ones of the same name
+// already there. The other parameters, their order and the fragment are left as they were.
+func tagURL(rawURL string, u store.UTM) string {
+	if u.IsZero() {
+		return rawURL
+	}
+
+	rest, fragment := rawURL, ""
+	if i := strings.IndexByte(rest, '#'); i >= 0 {
+		rest, fragment = rest[:i], rest[i:]
+	}
+
+	base, query := rest, ""
+	if i := strings.IndexByte(rest, '?'); i >= 0 {
+		base, query = rest[:i], rest[i+1:]
+	}
+
+	replaced := make(map[string]bool)
+	var tags []string
+	for _, f := range utmFields(&u) {
+		if *f.value != "" {
+			replaced[f.name] = true
+			tags = append(tags, f.name+"="+url.QueryEscape(*f.value))
+		}
+	}
+
+	var pairs []string
+	for _, pair := range strings.Split(query, "&") {
+		if pair == "" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+
+		if !replaced[name] {
+			pairs = append(pairs, pair)
+		}
+	}
+
+	return base + "?" + strings.Join(append(pairs, tags...), "&") + fragment
+}
+
+// parseUTM returns the utm parameters in the query of the url, the first of each name counts.
+func parseUTM(rawURL string) store.UTM {
+	var u store.UTM
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return u
+	}
+
+	query := parsed.Query()
+	for _, f := range utmFields(&u) {
+		*f.value = query.Get(f.name)
+	}
+
+	return u
+}
+
+// presetUTM returns the utm parameters of the owner's preset of the given name, none if the name is
+// blank. A preset the owner has not saved is an error of the request.
+func (rs Resource) presetUTM(ctx context.Context, owner uuid.UUID, name string) (store.UTM, error) {
+	if name == "" {
+		return store.UTM{}, nil
+	}
+
+	preset, err := rs.Store.GetUTMPreset(ctx, owner, name)
+	if errors.Cause(err) == sql.ErrNoRows {
+		return store.UTM{}, validation.Errors{"utm_preset": ErrUnknownPreset}
+	}
+	if err != nil {
+		return store.UTM{}, err
+	}
+
+	return preset.UTM, nil
+}
+
+// presetResponse is a utm preset as the preset endpoints return it.
+type presetResponse struct {
+	Name      string    `json:"name"`
+	UTM       utmParams `json:"utm"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newPresetResponse(p store.UTMPreset) presetResponse {
+	return presetResponse{Name: p.Name, UTM: newUTMParams(p.UTM), CreatedAt: p.CreatedAt, UpdatedAt: p.UpdatedAt}
+}
+
+type savePresetRequest struct {
+	UTM utmParams `json:"utm"`
+}
+
+func (body *savePresetRequest) Bind(r *http.Request) error {
+	body.UTM.trim()
+
+	return validation.ValidateStruct(body,
+		validation.Field(&body.UTM, validation.By(func(interface{}) error {
+			if body.UTM.store().IsZero() {
+				return errors.New("must set at least one parameter")
+			}
+			return nil
+		})),
+	)
+}
+
+// HandleListUTMPresets returns the caller's utm presets by name.
+func (rs Resource) HandleListUTMPresets(w http.ResponseWriter, r *http.Request) {
+	userID, err := callerID(r)
+	if err != nil {
+		log(r).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	presets, err := rs.Store.GetUTMPresets(r.Context(), userID)
+	if err != nil {
+		log(r).WithField("userID", userID).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	resp := struct {
+		Presets []presetResponse `json:"presets"`
+	}{
+		Presets: []presetResponse{},
+	}
+
+	for _, p := range presets {
+		resp.Presets = append(resp.Presets, newPresetResponse(p))
+	}
+
+	render.Respond(w, r, &resp)
+}
+
+// HandleSaveUTMPreset saves the utm parameters of the request under the name of the path, replacing
+// the caller's preset of that name if there is one.
+func (rs Resource) HandleSaveUTMPreset(w http.ResponseWriter, r *http.Request) {
+	userID, err := callerID(r)
+	if err != nil {
+		log(r).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	if err := validation.Validate(name, presetNameRules...); err != nil {
+		render.Render(w, r, ErrInvalidRequest(validation.Errors{"name": err}))
+		return
+	}
+
+	body := savePresetRequest{}
+
+	if err := render.Bind(r, &body); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	saved, err := rs.Store.SaveUTMPreset(r.Context(), store.UTMPreset{Owner: userID, Name: name, UTM: body.UTM.store()})
+	if err != nil {
+		log(r).WithField("userID", userID).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	render.Respond(w, r, newPresetResponse(saved))
+}
+
+// HandleGetUTMPreset returns the caller's utm preset of the name of the path.
+func (rs Resource) HandleGetUTMPreset(w http.ResponseWriter, r *http.Request) {
+	userID, err := callerID(r)
+	if err != nil {
+		log(r).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	preset, err := rs.Store.GetUTMPreset(r.Context(), userID, chi.URLParam(r, "name"))
+	if errors.Cause(err) == sql.ErrNoRows {
+		render.Render(w, r, ErrURLNotFound(ErrUnknownPreset))
+		return
+	}
+	if err != nil {
+		log(r).WithField("userID", userID).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	render.Respond(w, r, newPresetResponse(preset))
+}
+
+// HandleDeleteUTMPreset removes the caller's utm preset of the name of the path, the links tagged
+// with it keep their parameters.
+func (rs Resource) HandleDeleteUTMPreset(w http.ResponseWriter, r *http.Request) {
+	userID, err := callerID(r)
+	if err != nil {
+		log(r).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	err = rs.Store.DeleteUTMPreset(r.Context(), userID, chi.URLParam(r, "name"))
+	if errors.Cause(err) == sql.ErrNoRows {
+		render.Render(w, r, ErrURLNotFound(ErrUnknownPreset))
+		return
+	}
+	if err != nil {
+		log(r).WithField("userID", userID).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	render.NoContent(w, r)
+}
+
+// campaignResponse is the number of the caller's live links tagged with a campaign and the clicks on them.
+type campaignResponse struct {
+	Campaign string `json:"campaign"`
+	Links    int    `json:"links"`
+	Clicks   int    `json:"clicks"`
+}
+
+// HandleCampaignStats returns the caller's utm campaigns, most clicked first.
+func (rs Resource) HandleCampaignStats(w http.ResponseWriter, r *http.Request) {
+	userID, err := callerID(r)
+	if err != nil {
+		log(r).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	stats, err := rs.Store.CampaignStats(r.Context(), userID)
+	if err != nil {
+		log(r).WithField("userID", userID).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	resp := struct {
+		Campaigns []campaignResponse `json:"campaigns"`
+	}{
+		Campaigns: []campaignResponse{},
+	}
+
+	for _, s := range stats {
+		resp.Campaigns = append(resp.Campaigns, campaignResponse{Campaign: s.Campaign, Links: s.Links, Clicks: s.Clicks})
+	}
+
+	render.Respond(w, r, &resp)
+}
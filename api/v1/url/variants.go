@@ -0,0 +1,147 @@
+package url
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/render"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/pkg/errors"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+// The bounds of the variants of an a/b split link.
+const (
+	minVariants          = 2
+	maxVariants          = 10
+	maxVariantNameLength = 32
+	maxVariantWeight     = 1000
+)
+
+// variantParams is a variant of a request, visitors are served it with a chance of its weight over
+// the weights of all variants e.g. 70 and 30.
+type variantParams store.Variant
+
+func (p *variantParams) trim() {
+	p.Name = strings.TrimSpace(p.Name)
+	p.URL = strings.TrimSpace(p.URL)
+}
+
+func (p variantParams) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Name, validation.Required, validation.Length(1, maxVariantNameLength),
+			validation.Match(aliasPattern).Error("must contain only letters, digits, dashes and underscores and start with a letter or digit")),
+		validation.Field(&p.URL, validation.Required, is.URL),
+		validation.Field(&p.Weight, validation.Required, validation.Min(1), validation.Max(maxVariantWeight)),
+	)
+}
+
+// variantsParams are the variants of a request, none to send every visitor to the url.
+type variantsParams []variantParams
+
+func newVariantsParams(v store.Variants) variantsParams {
+	p := variantsParams{}
+	for _, variant := range v {
+		p = append(p, variantParams(variant))
+	}
+	return p
+}
+
+func (p variantsParams) trim() {
+	for i := range p {
+		p[i].trim()
+	}
+}
+
+func (p variantsParams) Validate() error {
+	if len(p) == 0 {
+		return nil
+	}
+
+	if len(p) < minVariants || len(p) > maxVariants {
+		return errors.Errorf("must have between %d and %d variants", minVariants, maxVariants)
+	}
+
+	seen := make(map[string]bool)
+	for _, v := range p {
+		if seen[v.Name] {
+			return errors.Errorf("must not name two variants %s", v.Name)
+		}
+		seen[v.Name] = true
+	}
+
+	return validation.Validate([]variantParams(p))
+}
+
+func (p variantsParams) store() store.Variants {
+	var variants store.Variants
+	for _, v := range p {
+		variants = append(variants, store.Variant(v))
+	}
+	return variants
+}
+
+// destinations returns the urls of the variants, keyed by their field.
+func (p variantsParams) destinations() map[string]string {
+	destinations := make(map[string]string, len(p))
+	for i, v := range p {
+		destinations["variants."+strconv.Itoa(i)+".url"] = v.URL
+	}
+	return destinations
+}
+
+// variantStatsResponse is a variant of a link and the clicks served it.
+type variantStatsResponse struct {
+	Name   string `json:"name"`
+	URL    string `json:"url,omitempty"`
+	Weight int    `json:"weight"`
+	Clicks int    `json:"clicks"`
+}
+
+// HandleURLStats returns the clicks on one of the caller's links and the clicks served each of its
+// variants, the variants it no longer has last.
+func (rs Resource) HandleURLStats(w http.ResponseWriter, r *http.Request) {
+	u, ok := rs.ownedURL(w, r)
+	if !ok {
+		return
+	}
+
+	stats, err := rs.Store.VariantStats(r.Context(), u.ID)
+	if err != nil {
+		log(r).WithField("id", u.ID).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	clicks := make(map[string]int, len(stats))
+	for _, s := range stats {
+		clicks[s.Variant] = s.Clicks
+	}
+
+	resp := struct {
+		Clicks   int                    `json:"clicks"`
+		Variants []variantStatsResponse `json:"variants"`
+	}{
+		Variants: []variantStatsResponse{},
+	}
+
+	if u.VisitCount != nil {
+		resp.Clicks = *u.VisitCount
+	}
+
+	for _, v := range u.Variants {
+		resp.Variants = append(resp.Variants, variantStatsResponse{Name: v.Name, URL: v.URL, Weight: v.Weight, Clicks: clicks[v.Name]})
+	}
+
+	for _, s := range stats {
+		if _, ok := u.Variants.Find(s.Variant); !ok {
+			resp.Variants = append(resp.Variants, variantStatsResponse{Name: s.Variant, Clicks: s.Clicks})
+		}
+	}
+
+	render.Respond(w, r, &resp)
+}
@@ -0,0 +1,252 @@
+// Package canonical rewrites urls into a canonical form, so that urls spelled differently but
+// leading to the same place e.g. HTTP://Example.com:80/a?b=1&a=2 and http://example.com/a?a=2&b=1
+// can be told to be the same.
+package canonical
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// Options chooses the rewrites that may change what the server of the url answers.
+type Options struct {
+	//SortQuery sorts the query parameters by name, repeated parameters keep their order.
+	SortQuery bool
+	//StripTracking drops the parameters only tracking where visitors came from, utm_*, fbclid and gclid.
+	StripTracking bool
+}
+
+// defaultPorts are dropped from urls of their scheme.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// hosts maps internationalized hosts to their punycode form. Unlike idna.Lookup it allows the
+// underscores found in real world hosts.
+var hosts = idna.New(idna.MapForLookup(), idna.StrictDomainName(false))
+
+// URL returns the canonical form of the url. The scheme and host are lowercased, internationalized
+// hosts are converted to punycode and default ports dropped. Escapes are uppercased, or decoded when
+// they escape a character that needs none, and the dot segments of the path are resolved.
+func URL(rawURL string, opts Options) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	//only urls with a host have a path to normalize, e.g. mailto:someone@example.com does not.
+	if u.Opaque != "" || u.Host == "" {
+		return u.String(), nil
+	}
+
+	host, err := canonicalHost(u)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+
+	b.WriteString(u.Scheme)
+	b.WriteString("://")
+
+	if u.User != nil {
+		b.WriteString(u.User.String())
+		b.WriteByte('@')
+	}
+
+	b.WriteString(host)
+
+	path := removeDotSegments(normalizeEscapes(u.EscapedPath()))
+	if path == "" {
+		path = "/"
+	}
+	b.WriteString(path)
+
+	if query := canonicalQuery(u.RawQuery, opts); query != "" {
+		b.WriteByte('?')
+		b.WriteString(query)
+	}
+
+	if u.Fragment != "" {
+		b.WriteByte('#')
+		b.WriteString(normalizeEscapes(u.EscapedFragment()))
+	}
+
+	return b.String(), nil
+}
+
+// canonicalHost returns the lowercase punycode host of the url with its port, unless it is the
+// default port of the scheme. The dot a fully qualified name can end in is dropped, example.com. and
+// example.com are the same host.
+func canonicalHost(u *url.URL) (string, error) {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+
+	if !isASCII(host) {
+		var err error
+		if host, err = hosts.ToASCII(host); err != nil {
+			return "", err
+		}
+	}
+
+	if port := u.Port(); port != "" && port != defaultPorts[u.Scheme] {
+		return net.JoinHostPort(host, port), nil
+	}
+
+	if strings.Contains(host, ":") {
+		//an ipv6 address.
+		return "[" + host + "]", nil
+	}
+
+	return host, nil
+}
+
+// canonicalQuery drops the empty and, if asked to, the tracking parameters of the query and sorts
+// the others if asked to.
+func canonicalQuery(rawQuery string, opts Options) string {
+	type param struct {
+		name, pair string
+	}
+
+	var params []param
+
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+
+		pair = normalizeEscapes(pair)
+
+		name := pair
+		if i := strings.IndexByte(pair, '='); i >= 0 {
+			name = pair[:i]
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+
+		if opts.StripTracking && isTracking(name) {
+			continue
+		}
+
+		params = append(params, param{name: name, pair: pair})
+	}
+
+	if opts.SortQuery {
+		sort.SliceStable(params, func(i, j int) bool { return params[i].name < params[j].name })
+	}
+
+	pairs := make([]string, len(params))
+	for i, p := range params {
+		pairs[i] = p.pair
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// isTracking reports whether the query parameter only tracks where visitors came from.
+func isTracking(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "utm_") || name == "fbclid" || name == "gclid"
+}
+
+// normalizeEscapes uppercases the hex digits of the escapes in s and decodes the escapes of the
+// letters, digits and -._~ which never need escaping.
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	const hex = "0123456789ABCDEF"
+
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+		i += 2
+	}
+
+	return b.String()
+}
+
+// removeDotSegments resolves the . and .. segments of the path as RFC 3986 section 5.2.4 does.
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+
+	var out []string
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		last := i == len(segments)-1
+
+		switch segment {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			//the leading empty segment of an absolute path is never removed.
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, segment)
+		}
+	}
+
+	return strings.Join(out, "/")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,100 @@
+package fupisha
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nairobi-gophers/fupisha/config"
+	"github.com/nairobi-gophers/fupisha/export"
+)
+
+// exportCmd streams a user's links, or the clicks on them, out of the configured store.
+func exportCmd() {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	email := fs.String("user", "", "email of the user whose links are exported")
+	format := fs.String("format", string(export.CSV), "csv, ndjson or parquet")
+	clicks := fs.Bool("clicks", false, "export the clicks on the links instead of the links")
+	after := fs.String("created-after", "", "only export links or clicks created at or after this RFC 3339 time")
+	before := fs.String("created-before", "", "only export links or clicks created before this RFC 3339 time")
+	out := fs.String("o", "", "file to write the export to, stdout by default")
+	fs.Parse(flag.Args()[1:])
+
+	if *email == "" {
+		fmt.Fprintln(os.Stderr, "the -user whose links are exported is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	opts := export.Options{
+		Format: export.Format(*format),
+		Clicks: *clicks,
+	}
+
+	switch opts.Format {
+	case export.CSV, export.NDJSON, export.Parquet:
+	default:
+		fmt.Fprintln(os.Stderr, export.ErrFormat)
+		os.Exit(1)
+	}
+
+	for flagValue, bound := range map[*string]**time.Time{after: &opts.From, before: &opts.To} {
+		if *flagValue == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, *flagValue)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid time %q, want an RFC 3339 time e.g. 2026-01-02T15:04:05Z\n", *flagValue)
+			os.Exit(1)
+		}
+		*bound = &t
+	}
+
+	cfg, err := config.New()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	s, err := cfg.GetStore()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+
+	user, err := s.GetUserByEmail(ctx, *email)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not find the user %s: %s\n", *email, err)
+		os.Exit(1)
+	}
+
+	opts.Owner = user.ID
+
+	f := os.Stdout
+	if *out != "" {
+		if f, err = os.Create(*out); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	w := bufio.NewWriter(f)
+
+	err = export.Export(ctx, s, w, opts)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
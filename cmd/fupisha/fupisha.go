@@ -13,16 +13,12 @@ func InitCmd() {
 	flag.Usage = help
 	flag.Parse()
 
-	api, err := api.NewServer()
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-
 	cmds := map[string]func(){
-		"start": api.Start,
-		"key":   config.GenKey,
-		"help":  help,
+		"start":   start,
+		"migrate": migrateCmd,
+		"export":  exportCmd,
+		"key":     config.GenKey,
+		"help":    help,
 	}
 
 	if cmdFunc, ok := cmds[flag.Arg(0)]; ok {
@@ -33,10 +29,24 @@ func InitCmd() {
 	}
 }
 
+func start() {
+	api, err := api.NewServer()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	api.Start()
+}
+
 func help() {
 	fmt.Fprintln(os.Stderr, `
 	Usage: 
-	  fupisha start		- start the server
-	  fupisha key		- generate a random 32-byte hex-encoded key         
+	  fupisha start			- start the server
+	  fupisha migrate up		- apply all pending schema migrations
+	  fupisha migrate down [n]	- revert the last n schema migrations, 1 by default
+	  fupisha migrate status	- list the schema migrations and whether they are applied
+	  fupisha export -user email	- stream a user's links as csv, ndjson or parquet, see fupisha export -h
+	  fupisha key			- generate a random 32-byte hex-encoded key         
 	 `)
 }
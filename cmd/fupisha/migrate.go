@@ -0,0 +1,88 @@
+package fupisha
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nairobi-gophers/fupisha/config"
+	"github.com/nairobi-gophers/fupisha/store/migrate"
+)
+
+// migrateCmd runs the migrate up|down|status subcommands against the configured store.
+func migrateCmd() {
+	cfg, err := config.New()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	m, err := cfg.GetMigrator()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+
+	switch flag.Arg(1) {
+	case "up":
+		applied, err := m.Up(ctx)
+		printMigrations("applied", applied)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	case "down":
+		steps := 1
+		if n := flag.Arg(2); n != "" {
+			steps, err = strconv.Atoi(n)
+			if err != nil || steps < 1 {
+				fmt.Printf("invalid number of migrations to revert: %s\n", n)
+				os.Exit(1)
+			}
+		}
+
+		reverted, err := m.Down(ctx, steps)
+		printMigrations("reverted", reverted)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	case "status":
+		status, err := m.Status(ctx)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tDESCRIPTION\tAPPLIED AT")
+		for _, s := range status {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Description, appliedAt)
+		}
+		w.Flush()
+	default:
+		help()
+		os.Exit(1)
+	}
+}
+
+func printMigrations(action string, migrations []migrate.Migration) {
+	if len(migrations) == 0 {
+		fmt.Printf("no migrations %s\n", action)
+		return
+	}
+
+	for _, mg := range migrations {
+		fmt.Printf("%s %d %s\n", action, mg.Version, mg.Description)
+	}
+}
@@ -2,13 +2,31 @@ package config
 
 import (
 	"fmt"
+	"image"
 	"log"
+	"net"
 	"strings"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
+	"github.com/nairobi-gophers/fupisha/analytics"
+	"github.com/nairobi-gophers/fupisha/canonical"
+	"github.com/nairobi-gophers/fupisha/deeplink"
 	"github.com/nairobi-gophers/fupisha/encoding"
+	"github.com/nairobi-gophers/fupisha/expiry"
+	"github.com/nairobi-gophers/fupisha/params"
+	"github.com/nairobi-gophers/fupisha/policy"
+	"github.com/nairobi-gophers/fupisha/protect"
+	"github.com/nairobi-gophers/fupisha/qr"
+	"github.com/nairobi-gophers/fupisha/routing"
 	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/nairobi-gophers/fupisha/store/cache"
+	"github.com/nairobi-gophers/fupisha/store/memory"
+	"github.com/nairobi-gophers/fupisha/store/migrate"
+	"github.com/nairobi-gophers/fupisha/store/mysql"
 	"github.com/nairobi-gophers/fupisha/store/postgres"
+	"github.com/nairobi-gophers/fupisha/store/sqlite"
+	"github.com/sirupsen/logrus"
 )
 
 // Config is a fupisha configuration struct
@@ -21,10 +39,14 @@ type Config struct {
 	TextLogging bool `envconfig:"FUPISHA_TEXT_LOGGING"`
 	//LogLevel category of the log.
 	LogLevel string `envconfig:"FUPISHA_LOG_LEVEL"`
-	//ParamLength length of the shorten url param (https://base_url/{param}) e.g https://fupisha.io/kKIoqRF
+	//ParamLength length of the shorten url param (https://base_url/{param}) e.g https://fupisha.io/kKIoqRF,
+	//generated params grow longer once the params of their length run out.
 	ParamLength int `envconfig:"FUPISHA_PARAM_LENGTH"`
 	//Port is the port on which the api server will bind to once started e.g 3333
 	Port string `envconfig:"FUPISHA_HTTP_PORT"`
+	//TrustedProxies comma separated addresses or CIDR ranges of the proxies in front of the api server, the
+	//client address is only taken from the X-Forwarded-For and X-Real-IP headers they send. e.g. 10.0.0.0/8,127.0.0.1
+	TrustedProxies string `envconfig:"FUPISHA_TRUSTED_PROXIES"`
 	//JWT json web token payload
 	JWT struct {
 		//Secret secret jwt signing key.
@@ -47,9 +69,90 @@ type Config struct {
 		//FromAddress email sender's email address
 		FromAddress string `envconfig:"FUPISHA_SMTP_FROM_ADDRESS"`
 	}
+	//Clicks asynchronous click recording configuration fields.
+	Clicks struct {
+		//QueueSize clicks held in memory waiting to be written. e.g. 10000
+		QueueSize int `envconfig:"FUPISHA_CLICKS_QUEUE_SIZE"`
+		//BatchSize clicks written to the store in one go. e.g. 500
+		BatchSize int `envconfig:"FUPISHA_CLICKS_BATCH_SIZE"`
+		//FlushInterval milliseconds a partial batch waits before it is written.
+		FlushInterval int `envconfig:"FUPISHA_CLICKS_FLUSH_INTERVAL"`
+		//Overflow what happens to a click when the queue is full. e.g. drop or block
+		Overflow string `envconfig:"FUPISHA_CLICKS_OVERFLOW"`
+	}
+	//Expiry background expiry sweep configuration fields.
+	Expiry struct {
+		//SweepInterval seconds between sweeps marking expired and exhausted short urls. e.g. 60
+		SweepInterval int `envconfig:"FUPISHA_EXPIRY_SWEEP_INTERVAL"`
+	}
+	//Bulk bulk shortening configuration fields.
+	Bulk struct {
+		//MaxRows most urls a single bulk request may shorten. e.g. 500
+		MaxRows int `envconfig:"FUPISHA_BULK_MAX_ROWS"`
+		//MaxProtectedRows most password protected urls a single bulk request may shorten, every password is hashed
+		//with bcrypt while the request waits. e.g. 20
+		MaxProtectedRows int `envconfig:"FUPISHA_BULK_MAX_PROTECTED_ROWS"`
+	}
+	//QR short url qr code configuration fields.
+	QR struct {
+		//Logo path of a PNG, JPEG or GIF image qr codes can carry in their middle. e.g. /etc/fupisha/logo.png
+		Logo string `envconfig:"FUPISHA_QR_LOGO"`
+		//MaxAge seconds clients may cache the public qr code of a short url. e.g. 86400
+		MaxAge int `envconfig:"FUPISHA_QR_MAX_AGE"`
+	}
+	//Policy destination policy configuration fields.
+	Policy struct {
+		//Schemes comma separated schemes destinations may use. e.g. http,https
+		Schemes string `envconfig:"FUPISHA_POLICY_SCHEMES"`
+		//Blocklist path of the file of blocked domains, reloaded on SIGHUP. e.g. /etc/fupisha/blocklist.txt
+		Blocklist string `envconfig:"FUPISHA_POLICY_BLOCKLIST"`
+		//ShortDomains comma separated domains serving short urls besides the base url's. e.g. fpsh.io,go.fupisha.io
+		ShortDomains string `envconfig:"FUPISHA_POLICY_SHORT_DOMAINS"`
+	}
+	//Routing conditional routing configuration fields.
+	Routing struct {
+		//GeoIP path of the MaxMind country database visitors are located with, reloaded on SIGHUP. e.g. /etc/fupisha/GeoLite2-Country.mmdb
+		GeoIP string `envconfig:"FUPISHA_ROUTING_GEOIP"`
+		//Timezone IANA time zone the days and times of routes naming none are read in, UTC by default. e.g. Africa/Nairobi
+		Timezone string `envconfig:"FUPISHA_ROUTING_TIMEZONE"`
+	}
+	//Apps mobile apps the short domain is associated with, so that short urls open in them.
+	Apps struct {
+		//IOS comma separated app ids of the iOS apps, team id and bundle id. e.g. ABCDE12345.io.fupisha.app
+		IOS string `envconfig:"FUPISHA_APPS_IOS"`
+		//AndroidPackage package name of the Android app. e.g. io.fupisha.app
+		AndroidPackage string `envconfig:"FUPISHA_APPS_ANDROID_PACKAGE"`
+		//AndroidFingerprints comma separated SHA-256 fingerprints of the Android app's signing certificates.
+		AndroidFingerprints string `envconfig:"FUPISHA_APPS_ANDROID_FINGERPRINTS"`
+	}
+	//Canonical url canonicalization configuration fields, links are deduplicated on the canonical form of their url.
+	Canonical struct {
+		//SortQuery sorts the query parameters of the canonical url, which parameter comes first rarely matters. e.g. true
+		SortQuery bool `envconfig:"FUPISHA_CANONICAL_SORT_QUERY"`
+		//StripTracking drops the utm_*, fbclid and gclid query parameters from the canonical url. e.g. true
+		StripTracking bool `envconfig:"FUPISHA_CANONICAL_STRIP_TRACKING"`
+	}
+	//Protect password protected short url configuration fields.
+	Protect struct {
+		//CookieTTL minutes a protected short url stays unlocked in the browser that unlocked it. e.g. 30
+		CookieTTL int `envconfig:"FUPISHA_PROTECT_COOKIE_TTL"`
+		//MaxAttempts failed password attempts a short url allows per window. e.g. 5
+		MaxAttempts int `envconfig:"FUPISHA_PROTECT_MAX_ATTEMPTS"`
+		//Window minutes failed password attempts are counted over. e.g. 15
+		Window int `envconfig:"FUPISHA_PROTECT_WINDOW"`
+	}
+	//Cache in-process short url cache configuration fields.
+	Cache struct {
+		//Size most short urls held in memory, zero disables the cache. e.g. 10000
+		Size int `envconfig:"FUPISHA_CACHE_SIZE"`
+		//TTL seconds a short url is served from memory before it is read again.
+		TTL int `envconfig:"FUPISHA_CACHE_TTL"`
+		//StatsInterval seconds between log entries of the cache hits and misses, 300 by default. e.g. 60
+		StatsInterval int `envconfig:"FUPISHA_CACHE_STATS_INTERVAL"`
+	}
 	//Store fupisha storage configuration object.
 	Store struct {
-		//Type the type of database. e.g. mongo
+		//Type the type of database. e.g. postgresql, mysql, sqlite or memory
 		Type string `envconfig:"FUPISHA_STORE_TYPE"`
 		//PostgreSQL postgresql database connection parameters.
 		PostgreSQL struct {
@@ -66,6 +169,13 @@ type Config struct {
 			//SSLRootCert requires if SSLMode is enabled.
 			SSLRootCert string `envconfig:"FUPISHA_STORE_POSTGRESQL_SSLROOTCERT"`
 		}
+		//SQLite embedded sqlite database parameters.
+		SQLite struct {
+			//Path sqlite database file path. e.g. /var/lib/fupisha/fupisha.db
+			Path string `envconfig:"FUPISHA_STORE_SQLITE_PATH"`
+			//BusyTimeout milliseconds a write waits on a locked database before failing.
+			BusyTimeout int `envconfig:"FUPISHA_STORE_SQLITE_BUSY_TIMEOUT"`
+		}
 		//Mongo mongo database connection parameters.
 		Mongo struct {
 			//Address mongo host and port. e.g localhost:27017
@@ -91,21 +201,212 @@ type Config struct {
 	}
 }
 
-// GetStore returns a connection to the relevant database as specified on the config
+// GetStore returns a connection to the relevant database as specified on the config,
+// behind the short url cache when one is configured.
 func (cfg *Config) GetStore() (store.Store, error) {
+	s, err := cfg.getStore()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Cache.Size <= 0 {
+		return s, nil
+	}
+
+	return cache.NewStore(s, &cache.Config{
+		Size: cfg.Cache.Size,
+		TTL:  time.Duration(cfg.Cache.TTL) * time.Second,
+	}), nil
+}
+
+func (cfg *Config) getStore() (store.Store, error) {
+	switch cfg.Store.Type {
+	case "postgresql":
+		return postgres.NewStore(cfg.postgresConfig())
+	case "mysql":
+		return mysql.NewStore(cfg.mysqlConfig())
+	case "sqlite":
+		return sqlite.NewStore(cfg.sqliteConfig())
+	case "memory":
+		//state lives as long as the process does, handy for local runs and tests.
+		return memory.NewStore(), nil
+	}
+	return nil, fmt.Errorf("config: unknown store type: %s", cfg.Store.Type)
+}
+
+// GetMigrator returns a schema migrator for the database specified on the config
+func (cfg *Config) GetMigrator() (*migrate.Migrator, error) {
 	switch cfg.Store.Type {
 	case "postgresql":
+		return postgres.NewMigrator(cfg.postgresConfig())
+	case "mysql":
+		return mysql.NewMigrator(cfg.mysqlConfig())
+	case "sqlite":
+		return sqlite.NewMigrator(cfg.sqliteConfig())
+	case "memory":
+		return nil, fmt.Errorf("config: store type %s has no schema to migrate", cfg.Store.Type)
+	}
+	return nil, fmt.Errorf("config: unknown store type: %s", cfg.Store.Type)
+}
 
-		dbCfg := &postgres.Config{
-			Host:     cfg.Store.PostgreSQL.Address,
-			User:     cfg.Store.PostgreSQL.Username,
-			Password: cfg.Store.PostgreSQL.Password,
-			Name:     cfg.Store.PostgreSQL.Database,
+// GetRecorder returns a click recorder writing to the given store as specified on the config
+func (cfg *Config) GetRecorder(clicks store.ClickStore, logger logrus.FieldLogger) (*analytics.Recorder, error) {
+	return analytics.NewRecorder(clicks, analytics.RecorderConfig{
+		QueueSize:     cfg.Clicks.QueueSize,
+		BatchSize:     cfg.Clicks.BatchSize,
+		FlushInterval: time.Duration(cfg.Clicks.FlushInterval) * time.Millisecond,
+		Overflow:      cfg.Clicks.Overflow,
+	}, logger)
+}
+
+// GetSweeper starts an expiry sweeper over the given store as specified on the config
+func (cfg *Config) GetSweeper(urls store.URLStore, logger logrus.FieldLogger) *expiry.Sweeper {
+	return expiry.NewSweeper(urls, time.Duration(cfg.Expiry.SweepInterval)*time.Second, logger)
+}
+
+// GetGuard returns the password guard of protected short urls as specified on the config,
+// its unlock cookies are signed with the jwt secret.
+func (cfg *Config) GetGuard() (*protect.Guard, error) {
+	return protect.NewGuard(protect.Config{
+		Secret:      []byte(cfg.JWT.Secret),
+		CookieTTL:   time.Duration(cfg.Protect.CookieTTL) * time.Minute,
+		MaxAttempts: cfg.Protect.MaxAttempts,
+		Window:      time.Duration(cfg.Protect.Window) * time.Minute,
+	})
+}
+
+// GetTrustedProxies returns the networks of the configured trusted proxies, a bare address is a network
+// of its own. None are trusted by default.
+func (cfg *Config) GetTrustedProxies() ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, proxy := range splitList(cfg.TrustedProxies) {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("config: trusted proxy %q is not an address or CIDR range", proxy)
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
 		}
 
-		return postgres.NewStore(dbCfg)
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("config: trusted proxy %q is not an address or CIDR range", proxy)
+		}
+		proxies = append(proxies, network)
+	}
+
+	return proxies, nil
+}
+
+// GetPolicy returns the destination policy allowing the configured schemes, http and https by default,
+// blocking the domains of the blocklist and refusing links back at the short domains.
+func (cfg *Config) GetPolicy() (*policy.Policy, error) {
+	schemes := splitList(cfg.Policy.Schemes)
+	if len(schemes) == 0 {
+		schemes = []string{"http", "https"}
+	}
+
+	rules := []policy.Rule{policy.Schemes(schemes...)}
+
+	if cfg.Policy.Blocklist != "" {
+		blocklist, err := policy.LoadBlocklist(cfg.Policy.Blocklist)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, blocklist)
+	}
+
+	domains := append(splitList(cfg.Policy.ShortDomains), store.Hostname(cfg.BaseURL))
+	rules = append(rules, policy.NoLoop(domains...))
+
+	return policy.New(rules...), nil
+}
+
+// GetRouter returns the router choosing the destinations of routed short urls, locating visitors with
+// the configured GeoIP database. Without a database no route matches on countries.
+func (cfg *Config) GetRouter() (*routing.Router, error) {
+	location, err := time.LoadLocation(cfg.Routing.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("config: routing timezone: %w", err)
+	}
+
+	if cfg.Routing.GeoIP == "" {
+		return routing.New(nil, location), nil
+	}
+
+	geoip, err := routing.OpenGeoIP(cfg.Routing.GeoIP)
+	if err != nil {
+		return nil, err
+	}
+
+	return routing.New(geoip, location), nil
+}
+
+// GetParams returns the generator of short url params, starting at the configured param length.
+func (cfg *Config) GetParams() *params.Generator {
+	return params.New(cfg.ParamLength, nil)
+}
+
+// GetApps returns the mobile apps the short domain is associated with.
+func (cfg *Config) GetApps() deeplink.Apps {
+	return deeplink.Apps{
+		IOS:                 splitList(cfg.Apps.IOS),
+		AndroidPackage:      strings.TrimSpace(cfg.Apps.AndroidPackage),
+		AndroidFingerprints: splitList(cfg.Apps.AndroidFingerprints),
+	}
+}
+
+// GetCanonical returns the options urls are canonicalized with.
+func (cfg *Config) GetCanonical() canonical.Options {
+	return canonical.Options{
+		SortQuery:     cfg.Canonical.SortQuery,
+		StripTracking: cfg.Canonical.StripTracking,
+	}
+}
+
+// splitList splits a comma separated list, dropping blank items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// GetQRLogo returns the configured qr code logo, nil if there is none.
+func (cfg *Config) GetQRLogo() (image.Image, error) {
+	if cfg.QR.Logo == "" {
+		return nil, nil
+	}
+	return qr.LoadLogo(cfg.QR.Logo)
+}
+
+func (cfg *Config) postgresConfig() *postgres.Config {
+	return &postgres.Config{
+		Host:     cfg.Store.PostgreSQL.Address,
+		User:     cfg.Store.PostgreSQL.Username,
+		Password: cfg.Store.PostgreSQL.Password,
+		Name:     cfg.Store.PostgreSQL.Database,
+	}
+}
+
+func (cfg *Config) mysqlConfig() *mysql.Config {
+	return &mysql.Config{
+		Host:     cfg.Store.MySQL.Address,
+		User:     cfg.Store.MySQL.Username,
+		Password: cfg.Store.MySQL.Password,
+		Name:     cfg.Store.MySQL.Database,
+	}
+}
+
+func (cfg *Config) sqliteConfig() *sqlite.Config {
+	return &sqlite.Config{
+		Path:        cfg.Store.SQLite.Path,
+		BusyTimeout: time.Duration(cfg.Store.SQLite.BusyTimeout) * time.Millisecond,
 	}
-	return nil, fmt.Errorf("config: unknown store type: %s", cfg.Store.Type)
 }
 
 // New returns an initialized config object ready for use
@@ -0,0 +1,105 @@
+package deeplink
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// excludedPaths are the paths of the short domain that are not short links, the apps leave them to
+// the browser.
+var excludedPaths = []string{"/url/*", "/auth/*", "/expand"}
+
+// Apps are the mobile apps the short domain is associated with, iOS and Android open its links in
+// them once they verified the association.
+type Apps struct {
+	//IOS are the app ids of the iOS apps, their team id and bundle id e.g. ABCDE12345.io.fupisha.app.
+	IOS []string
+	//AndroidPackage is the package name of the Android app e.g. io.fupisha.app.
+	AndroidPackage string
+	//AndroidFingerprints are the SHA-256 fingerprints of the certificates the Android app is signed with.
+	AndroidFingerprints []string
+}
+
+// HandleAppleAppSiteAssociation serves the apple-app-site-association file of the iOS apps, 404 Not
+// Found if there are none.
+func (a Apps) HandleAppleAppSiteAssociation(w http.ResponseWriter, r *http.Request) {
+	if len(a.IOS) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	type component struct {
+		Path    string `json:"/"`
+		Exclude bool   `json:"exclude,omitempty"`
+	}
+
+	//paths are read by iOS 12 and older, components by the later versions.
+	type detail struct {
+		AppID      string      `json:"appID"`
+		AppIDs     []string    `json:"appIDs"`
+		Paths      []string    `json:"paths"`
+		Components []component `json:"components"`
+	}
+
+	var paths []string
+	var components []component
+	for _, p := range excludedPaths {
+		paths = append(paths, "NOT "+p)
+		components = append(components, component{Path: p, Exclude: true})
+	}
+	paths = append(paths, "*")
+	components = append(components, component{Path: "*"})
+
+	var details []detail
+	for _, id := range a.IOS {
+		details = append(details, detail{AppID: id, AppIDs: []string{id}, Paths: paths, Components: components})
+	}
+
+	type applinks struct {
+		Apps    []string `json:"apps"`
+		Details []detail `json:"details"`
+	}
+
+	writeJSON(w, struct {
+		Applinks applinks `json:"applinks"`
+	}{applinks{Apps: []string{}, Details: details}})
+}
+
+// HandleAssetLinks serves the assetlinks.json digital asset links of the Android app, 404 Not Found
+// if there is none.
+func (a Apps) HandleAssetLinks(w http.ResponseWriter, r *http.Request) {
+	if a.AndroidPackage == "" || len(a.AndroidFingerprints) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	type target struct {
+		Namespace    string   `json:"namespace"`
+		PackageName  string   `json:"package_name"`
+		Fingerprints []string `json:"sha256_cert_fingerprints"`
+	}
+
+	type statement struct {
+		Relation []string `json:"relation"`
+		Target   target   `json:"target"`
+	}
+
+	writeJSON(w, []statement{{
+		Relation: []string{"delegate_permission/common.handle_all_urls"},
+		Target:   target{Namespace: "android_app", PackageName: a.AndroidPackage, Fingerprints: a.AndroidFingerprints},
+	}})
+}
+
+// writeJSON writes the association file, both platforms fetch it without following redirects and
+// want it as application/json.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(b)
+}
@@ -0,0 +1,125 @@
+// Package deeplink opens short urls in their mobile apps. Visitors on iOS and Android are sent to the
+// deep link of their platform, falling back to the app's store page or the url when the app is not
+// installed, and desktop visitors to the desktop destination. It also serves the site association
+// files that let the apps open the links of the short domain.
+package deeplink
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mileusna/useragent"
+	"github.com/nairobi-gophers/fupisha/analytics"
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+// The platforms visitors are told apart by.
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+	PlatformDesktop = "desktop"
+	PlatformOther   = "other"
+)
+
+//go:embed open.html
+var openHTML string
+
+var openTmpl = template.Must(template.New("open").Parse(openHTML))
+
+// Platform returns the platform of the visitor of the request by its user agent.
+func Platform(r *http.Request) string {
+	ua := useragent.Parse(r.UserAgent())
+
+	switch {
+	case ua.IsIOS():
+		return PlatformIOS
+	case ua.IsAndroid():
+		return PlatformAndroid
+	case analytics.Device(ua) == analytics.DeviceDesktop:
+		return PlatformDesktop
+	}
+	return PlatformOther
+}
+
+// Redirect sends the visitor of the request to the app link of their platform, the destination if
+// the url has none.
+//
+// Universal and app links are plain redirects, the app opens them if it is installed and the browser
+// otherwise. A custom scheme on Android goes through an intent url, which falls back by itself, and on
+// iOS through a page trying the app before falling back.
+func Redirect(w http.ResponseWriter, r *http.Request, links store.AppLinks, destination string) {
+	switch Platform(r) {
+	case PlatformIOS:
+		if links.IOS != "" {
+			open(w, r, links.IOS, fallback(links.IOSStore, destination), false)
+			return
+		}
+	case PlatformAndroid:
+		if links.Android != "" {
+			open(w, r, links.Android, fallback(links.AndroidStore, destination), true)
+			return
+		}
+	case PlatformDesktop:
+		if links.Desktop != "" {
+			destination = links.Desktop
+		}
+	}
+
+	http.Redirect(w, r, destination, http.StatusFound)
+}
+
+// open sends the visitor to the app link, or to the fallback when the app is not installed.
+func open(w http.ResponseWriter, r *http.Request, app, fallbackURL string, android bool) {
+	if IsWebLink(app) {
+		http.Redirect(w, r, app, http.StatusFound)
+		return
+	}
+
+	if android {
+		http.Redirect(w, r, IntentURL(app, fallbackURL), http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	openTmpl.Execute(w, struct{ App, Fallback template.URL }{template.URL(app), template.URL(fallbackURL)})
+}
+
+// IsWebLink reports whether the app link is a universal or app link, an http or https url the app
+// claims, rather than a custom scheme.
+func IsWebLink(link string) bool {
+	u, err := url.Parse(link)
+	return err == nil && (strings.EqualFold(u.Scheme, "https") || strings.EqualFold(u.Scheme, "http"))
+}
+
+// IntentURL returns the Android intent url opening the custom scheme link, Chrome sends visitors
+// without an app handling the scheme to the fallback url, e.g.
+// intent://product/7#Intent;scheme=acme;S.browser_fallback_url=https%3A%2F%2Facme.com;end for acme://product/7.
+func IntentURL(link, fallbackURL string) string {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme == "" {
+		return link
+	}
+
+	scheme := u.Scheme
+	u.Scheme, u.Fragment = "", ""
+
+	intent := "intent:" + u.String() + "#Intent;scheme=" + scheme + ";"
+	if fallbackURL != "" {
+		intent += "S.browser_fallback_url=" + url.QueryEscape(fallbackURL) + ";"
+	}
+
+	return intent + "end"
+}
+
+// fallback returns the app's store page if there is one, the destination otherwise.
+func fallback(storeURL, destination string) string {
+	if storeURL != "" {
+		return storeURL
+	}
+	return destination
+}
@@ -0,0 +1,168 @@
+package deeplink
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+const (
+	iPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 16_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.5 Mobile/15E148 Safari/604.1"
+	android = "Mozilla/5.0 (Linux; Android 13; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/115.0.0.0 Mobile Safari/537.36"
+	windows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/115.0.0.0 Safari/537.36"
+	bot     = "curl/8.1.2"
+)
+
+func TestRedirect(t *testing.T) {
+	custom := store.AppLinks{
+		IOS:          "acme://product/7",
+		Android:      "acme://product/7",
+		IOSStore:     "https://apps.apple.com/app/id42",
+		AndroidStore: "https://play.google.com/store/apps/details?id=com.acme",
+		Desktop:      "https://acme.com/desktop",
+	}
+	web := store.AppLinks{IOS: "https://acme.com/product/7", Android: "https://acme.com/product/7"}
+
+	tests := []struct {
+		name         string
+		ua           string
+		links        store.AppLinks
+		wantStatus   int
+		wantLocation string
+	}{
+		{"iOS without app links", iPhone, store.AppLinks{}, http.StatusFound, "https://fupisha.io/a"},
+		{"iOS universal link", iPhone, web, http.StatusFound, "https://acme.com/product/7"},
+		{"iOS custom scheme", iPhone, custom, http.StatusOK, ""},
+		{"Android app link", android, web, http.StatusFound, "https://acme.com/product/7"},
+		{"Android custom scheme", android, custom, http.StatusFound, "intent://product/7#Intent;scheme=acme;S.browser_fallback_url=https%3A%2F%2Fplay.google.com%2Fstore%2Fapps%2Fdetails%3Fid%3Dcom.acme;end"},
+		{"Desktop", windows, custom, http.StatusFound, "https://acme.com/desktop"},
+		{"Desktop without a desktop link", windows, web, http.StatusFound, "https://fupisha.io/a"},
+		{"Other platform", bot, custom, http.StatusFound, "https://fupisha.io/a"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/a", nil)
+			r.Header.Set("User-Agent", tc.ua)
+
+			rr := httptest.NewRecorder()
+			Redirect(rr, r, tc.links, "https://fupisha.io/a")
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("got status %d want %d", rr.Code, tc.wantStatus)
+			}
+
+			if got := rr.Header().Get("Location"); got != tc.wantLocation {
+				t.Fatalf("got location %q want %q", got, tc.wantLocation)
+			}
+		})
+	}
+
+	//the page trying the app on iOS falls back to the App Store.
+	r := httptest.NewRequest("GET", "/a", nil)
+	r.Header.Set("User-Agent", iPhone)
+
+	rr := httptest.NewRecorder()
+	Redirect(rr, r, custom, "https://fupisha.io/a")
+
+	if body := rr.Body.String(); !strings.Contains(body, `href="acme://product/7"`) || !strings.Contains(body, `href="https://apps.apple.com/app/id42"`) {
+		t.Fatalf("got page %q", body)
+	}
+
+	if rr.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("got Cache-Control %q on the page trying the app", rr.Header().Get("Cache-Control"))
+	}
+}
+
+func TestIntentURL(t *testing.T) {
+	tests := []struct {
+		link     string
+		fallback string
+		want     string
+	}{
+		{"acme://product/7?ref=sms", "", "intent://product/7?ref=sms#Intent;scheme=acme;end"},
+		{"acme://product/7#top", "https://acme.com/?a=1&b=2", "intent://product/7#Intent;scheme=acme;S.browser_fallback_url=https%3A%2F%2Facme.com%2F%3Fa%3D1%26b%3D2;end"},
+		{"acme:open", "", "intent:open#Intent;scheme=acme;end"},
+	}
+
+	for _, tc := range tests {
+		if got := IntentURL(tc.link, tc.fallback); got != tc.want {
+			t.Errorf("IntentURL(%q, %q) got %q want %q", tc.link, tc.fallback, got, tc.want)
+		}
+	}
+}
+
+func TestApps(t *testing.T) {
+	serve := func(h http.HandlerFunc) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h(rr, httptest.NewRequest("GET", "/", nil))
+		return rr
+	}
+
+	var none Apps
+	if rr := serve(none.HandleAppleAppSiteAssociation); rr.Code != http.StatusNotFound {
+		t.Fatalf("got status %d serving the apple-app-site-association file without apps", rr.Code)
+	}
+	if rr := serve(none.HandleAssetLinks); rr.Code != http.StatusNotFound {
+		t.Fatalf("got status %d serving assetlinks.json without apps", rr.Code)
+	}
+
+	apps := Apps{
+		IOS:                 []string{"ABCDE12345.io.fupisha.app"},
+		AndroidPackage:      "io.fupisha.app",
+		AndroidFingerprints: []string{"14:6D:E9:83:C5:73:06:50:D8:EE:B9:95:2F:34:FC:64:16:A0:83:42:E6:1D:BE:A8:8A:04:96:B2:3F:CF:44:E5"},
+	}
+
+	rr := serve(apps.HandleAppleAppSiteAssociation)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("got status %d and Content-Type %q serving the apple-app-site-association file", rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	var aasa struct {
+		Applinks struct {
+			Details []struct {
+				AppID      string   `json:"appID"`
+				Paths      []string `json:"paths"`
+				Components []struct {
+					Path    string `json:"/"`
+					Exclude bool   `json:"exclude"`
+				} `json:"components"`
+			} `json:"details"`
+		} `json:"applinks"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &aasa); err != nil {
+		t.Fatal(err)
+	}
+
+	details := aasa.Applinks.Details
+	if len(details) != 1 || details[0].AppID != apps.IOS[0] || details[0].Paths[0] != "NOT /url/*" || details[0].Paths[len(details[0].Paths)-1] != "*" ||
+		!details[0].Components[0].Exclude || details[0].Components[len(details[0].Components)-1].Exclude {
+		t.Fatalf("got apple-app-site-association %s", rr.Body.String())
+	}
+
+	rr = serve(apps.HandleAssetLinks)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d serving assetlinks.json", rr.Code)
+	}
+
+	var statements []struct {
+		Relation []string `json:"relation"`
+		Target   struct {
+			Namespace    string   `json:"namespace"`
+			PackageName  string   `json:"package_name"`
+			Fingerprints []string `json:"sha256_cert_fingerprints"`
+		} `json:"target"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &statements); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(statements) != 1 || statements[0].Relation[0] != "delegate_permission/common.handle_all_urls" ||
+		statements[0].Target.PackageName != apps.AndroidPackage || statements[0].Target.Fingerprints[0] != apps.AndroidFingerprints[0] {
+		t.Fatalf("got assetlinks.json %s", rr.Body.String())
+	}
+}
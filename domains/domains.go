@@ -0,0 +1,90 @@
+// Package domains lets users shorten links on their own domains e.g. go.acme.com. A user proves they
+// control a domain by publishing a TXT record carrying its token, fupisha then serves the links of
+// the domain to the requests for it.
+package domains
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+// The TXT record proving a domain is its owner's is published under recordPrefix + the domain and
+// holds valuePrefix + the token of the domain.
+const (
+	recordPrefix = "_fupisha."
+	valuePrefix  = "fupisha-verification="
+)
+
+// ErrRecordNotFound is returned verifying a domain without a TXT record carrying its token.
+var ErrRecordNotFound = errors.New("verification record not found")
+
+// Resolver looks up the TXT records of a domain name, *net.Resolver is one.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Verifier checks that the owners of domains control them.
+type Verifier struct {
+	resolver Resolver
+}
+
+// NewVerifier returns a verifier looking records up with the resolver, the system's when it is nil.
+func NewVerifier(resolver Resolver) *Verifier {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	return &Verifier{resolver: resolver}
+}
+
+// Verify looks up the TXT record of the domain, it returns ErrRecordNotFound when no record carries
+// the token of the domain.
+func (v *Verifier) Verify(ctx context.Context, domain store.Domain) error {
+	name, value := Record(domain)
+
+	records, err := v.resolver.LookupTXT(ctx, name)
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return ErrRecordNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("domains: looking up %s: %w", name, err)
+	}
+
+	for _, r := range records {
+		if strings.TrimSpace(r) == value {
+			return nil
+		}
+	}
+
+	return ErrRecordNotFound
+}
+
+// Record returns the name and value of the TXT record proving the domain is its owner's, e.g.
+// _fupisha.go.acme.com and fupisha-verification=<token>.
+func Record(domain store.Domain) (name, value string) {
+	return recordPrefix + domain.Host, valuePrefix + domain.Token.String()
+}
+
+// Normalize returns the lowercase host name without its port or the dot a fully qualified name can end in.
+func Normalize(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.TrimSuffix(host, ".")
+}
+
+// Host returns the normalized host name the request was sent to.
+func Host(r *http.Request) string {
+	return Normalize(r.Host)
+}
@@ -0,0 +1,74 @@
+package domains
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+// fakeResolver answers lookups from its records by name, names it has none for are not found.
+type fakeResolver map[string][]string
+
+func (f fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if name == "_fupisha.broken.example" {
+		return nil, &net.DNSError{Err: "server misbehaving", Name: name, IsTemporary: true}
+	}
+
+	records, ok := f[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+
+	return records, nil
+}
+
+func TestVerify(t *testing.T) {
+	token := uuid.Must(uuid.NewV4())
+	value := "fupisha-verification=" + token.String()
+
+	v := NewVerifier(fakeResolver{
+		"_fupisha.go.acme.com":   {"v=spf1 -all", " " + value + " "},
+		"_fupisha.stale.example": {"fupisha-verification=" + uuid.Must(uuid.NewV4()).String()},
+	})
+
+	tests := []struct {
+		host    string
+		wantErr error
+	}{
+		{"go.acme.com", nil},
+		{"stale.example", ErrRecordNotFound},
+		{"missing.example", ErrRecordNotFound},
+	}
+
+	for _, tc := range tests {
+		err := v.Verify(context.Background(), store.Domain{Host: tc.host, Token: token})
+		if err != tc.wantErr {
+			t.Errorf("verifying %s got %v want %v", tc.host, err, tc.wantErr)
+		}
+	}
+
+	err := v.Verify(context.Background(), store.Domain{Host: "broken.example", Token: token})
+	if err == nil || errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("verifying through a failing resolver got %v", err)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"Go.Acme.com":      "go.acme.com",
+		" go.acme.com. ":   "go.acme.com",
+		"go.acme.com:8888": "go.acme.com",
+		"localhost":        "localhost",
+	}
+
+	for host, want := range tests {
+		if got := Normalize(host); got != want {
+			t.Errorf("Normalize(%q) got %q want %q", host, got, want)
+		}
+	}
+}
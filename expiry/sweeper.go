@@ -0,0 +1,88 @@
+// Package expiry marks short urls that expired or ran out of clicks in the background,
+// so they no longer have to be checked one redirect at a time.
+package expiry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultInterval is how often urls are swept when no interval is given.
+const DefaultInterval = time.Minute
+
+// Sweeper periodically marks the urls that expired or ran out of clicks.
+type Sweeper struct {
+	store    store.URLStore
+	interval time.Duration
+	logger   logrus.FieldLogger
+
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewSweeper starts a sweeper marking expired urls in the given store every interval.
+func NewSweeper(s store.URLStore, interval time.Duration, logger logrus.FieldLogger) *Sweeper {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	sw := &Sweeper{
+		store:    s,
+		interval: interval,
+		logger:   logger,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go sw.run()
+
+	return sw
+}
+
+// Sweep marks the urls that expired or ran out of clicks by now and returns how many it marked.
+func (sw *Sweeper) Sweep(ctx context.Context) (int64, error) {
+	return sw.store.ExpireURLs(ctx, time.Now())
+}
+
+// Close stops the sweeper and waits for a sweep in progress to finish.
+func (sw *Sweeper) Close() {
+	sw.once.Do(func() { close(sw.stop) })
+	<-sw.done
+}
+
+func (sw *Sweeper) run() {
+	defer close(sw.done)
+
+	ticker := time.NewTicker(sw.interval)
+	defer ticker.Stop()
+
+	for {
+		sw.sweep()
+
+		select {
+		case <-ticker.C:
+		case <-sw.stop:
+			return
+		}
+	}
+}
+
+func (sw *Sweeper) sweep() {
+	ctx, cancel := context.WithTimeout(context.Background(), sw.interval)
+	defer cancel()
+
+	n, err := sw.Sweep(ctx)
+	if err != nil {
+		sw.logger.WithError(err).Error("sweeping expired urls")
+		return
+	}
+
+	if n > 0 {
+		sw.logger.WithField("count", n).Info("expired urls")
+	}
+}
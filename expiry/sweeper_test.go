@@ -0,0 +1,58 @@
+package expiry
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/nairobi-gophers/fupisha/store/memory"
+	"github.com/sirupsen/logrus"
+)
+
+func TestSweeper(t *testing.T) {
+	s := memory.NewStore()
+
+	ctx := context.Background()
+
+	u, err := s.NewUser(ctx, "test_user@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	expiresAt := time.Now().Add(50 * time.Millisecond)
+	url, err := s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://fupisha.io/a", ShortenedURLParam: "abcdef", ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatalf("failed to create url: %s", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	sw := NewSweeper(s, 10*time.Millisecond, logger)
+	defer sw.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := s.GetURLByID(ctx, url.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.ExpiredAt != nil {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("expired url never swept")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	sw.Close()
+
+	if n, err := sw.Sweep(ctx); err != nil || n != 0 {
+		t.Fatalf("got %d, %v want nothing left to sweep", n, err)
+	}
+}
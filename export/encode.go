@@ -0,0 +1,376 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	goparquet "github.com/fraugster/parquet-go"
+	"github.com/fraugster/parquet-go/parquet"
+	"github.com/fraugster/parquet-go/parquetschema"
+
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+// kind is the type of the values of a column.
+type kind int
+
+const (
+	kindString kind = iota
+	kindInt
+	kindBool
+	kindTime
+	kindStrings
+)
+
+// column is a field of the exported records, named after the db tag of the store field it holds.
+type column struct {
+	name string
+	kind kind
+	//optional columns hold nil for a field the record does not have.
+	optional bool
+}
+
+// record holds a value per column, a string, int64, bool, time.Time, []string or nil.
+type record []interface{}
+
+// urlColumns are the fields of store.URL an export holds, the password hash is left out.
+var urlColumns = []column{
+	{name: "id", kind: kindString},
+	{name: "owner", kind: kindString},
+	{name: "original_url", kind: kindString},
+	{name: "canonical_url", kind: kindString},
+	{name: "short_url_param", kind: kindString},
+	{name: "short_domain", kind: kindString},
+	{name: "visit_count", kind: kindInt, optional: true},
+	{name: "created_at", kind: kindTime},
+	{name: "updated_at", kind: kindTime},
+	{name: "dedup", kind: kindBool},
+	{name: "starts_at", kind: kindTime, optional: true},
+	{name: "expires_at", kind: kindTime, optional: true},
+	{name: "max_clicks", kind: kindInt, optional: true},
+	{name: "fallback_url", kind: kindString},
+	{name: "expired_at", kind: kindTime, optional: true},
+	{name: "deleted_at", kind: kindTime, optional: true},
+	{name: "title", kind: kindString},
+	{name: "notes", kind: kindString},
+	{name: "tags", kind: kindStrings},
+	{name: "domain", kind: kindString},
+	{name: "utm_source", kind: kindString},
+	{name: "utm_medium", kind: kindString},
+	{name: "utm_campaign", kind: kindString},
+	{name: "utm_term", kind: kindString},
+	{name: "utm_content", kind: kindString},
+	{name: "routes", kind: kindString},
+	{name: "variants", kind: kindString},
+	{name: "app_links", kind: kindString},
+}
+
+func urlRecord(u store.URL) record {
+	return record{
+		u.ID.String(),
+		u.Owner.String(),
+		u.OriginalURL,
+		u.Canonical(),
+		u.ShortenedURLParam,
+		u.ShortDomain,
+		optInt(u.VisitCount),
+		u.CreatedAt,
+		u.UpdatedAt,
+		u.Dedup,
+		optTime(u.StartsAt),
+		optTime(u.ExpiresAt),
+		optInt(u.MaxClicks),
+		u.FallbackURL,
+		optTime(u.ExpiredAt),
+		optTime(u.DeletedAt),
+		u.Title,
+		u.Notes,
+		[]string(u.Tags),
+		u.Domain,
+		u.UTM.Source,
+		u.UTM.Medium,
+		u.UTM.Campaign,
+		u.UTM.Term,
+		u.UTM.Content,
+		jsonString(!u.Routes.IsZero(), u.Routes),
+		jsonString(len(u.Variants) > 0, u.Variants),
+		jsonString(!u.AppLinks.IsZero(), u.AppLinks),
+	}
+}
+
+// jsonString returns the value as JSON if it is set, e.g. the routes of a url, empty otherwise.
+func jsonString(set bool, v interface{}) string {
+	if !set {
+		return ""
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+
+	return string(b)
+}
+
+// clickColumns are the fields of store.Click an export holds.
+var clickColumns = []column{
+	{name: "id", kind: kindString},
+	{name: "url_id", kind: kindString},
+	{name: "referrer", kind: kindString},
+	{name: "user_agent", kind: kindString},
+	{name: "browser", kind: kindString},
+	{name: "os", kind: kindString},
+	{name: "device", kind: kindString},
+	{name: "ip", kind: kindString},
+	{name: "variant", kind: kindString},
+	{name: "created_at", kind: kindTime},
+}
+
+func clickRecord(c store.Click) record {
+	return record{
+		c.ID.String(),
+		c.URLID.String(),
+		c.Referrer,
+		c.UserAgent,
+		c.Browser,
+		c.OS,
+		c.Device,
+		c.IP,
+		c.Variant,
+		c.CreatedAt,
+	}
+}
+
+func optInt(n *int) interface{} {
+	if n == nil {
+		return nil
+	}
+	return int64(*n)
+}
+
+func optTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
+
+// encoder writes records in a file format, close finishes the file.
+type encoder interface {
+	encode(rec record) error
+	close() error
+}
+
+func newEncoder(f Format, w io.Writer, columns []column) (encoder, error) {
+	switch f {
+	case CSV:
+		return newCSVEncoder(w, columns)
+	case NDJSON:
+		return &ndjsonEncoder{w: w, columns: columns}, nil
+	case Parquet:
+		return newParquetEncoder(w, columns)
+	}
+	return nil, ErrFormat
+}
+
+// csvEncoder writes a header of the column names and a row per record, tags are joined with commas.
+type csvEncoder struct {
+	w   *csv.Writer
+	row []string
+}
+
+func newCSVEncoder(w io.Writer, columns []column) (*csvEncoder, error) {
+	enc := &csvEncoder{w: csv.NewWriter(w), row: make([]string, len(columns))}
+
+	for i, c := range columns {
+		enc.row[i] = c.name
+	}
+
+	if err := enc.w.Write(enc.row); err != nil {
+		return nil, err
+	}
+
+	return enc, nil
+}
+
+func (enc *csvEncoder) encode(rec record) error {
+	for i, v := range rec {
+		switch v := v.(type) {
+		case nil:
+			enc.row[i] = ""
+		case string:
+			enc.row[i] = v
+		case int64:
+			enc.row[i] = strconv.FormatInt(v, 10)
+		case bool:
+			enc.row[i] = strconv.FormatBool(v)
+		case time.Time:
+			enc.row[i] = v.UTC().Format(time.RFC3339Nano)
+		case []string:
+			enc.row[i] = strings.Join(v, ",")
+		}
+	}
+
+	//flushing per row keeps the csv writer from holding on to more than a row.
+	if err := enc.w.Write(enc.row); err != nil {
+		return err
+	}
+	enc.w.Flush()
+	return enc.w.Error()
+}
+
+func (enc *csvEncoder) close() error {
+	enc.w.Flush()
+	return enc.w.Error()
+}
+
+// ndjsonEncoder writes a JSON object per line with the fields in column order, tags are always an array.
+type ndjsonEncoder struct {
+	w       io.Writer
+	columns []column
+	buf     bytes.Buffer
+}
+
+func (enc *ndjsonEncoder) encode(rec record) error {
+	enc.buf.Reset()
+	enc.buf.WriteByte('{')
+
+	for i, v := range rec {
+		if i > 0 {
+			enc.buf.WriteByte(',')
+		}
+
+		switch v := v.(type) {
+		case time.Time:
+			rec[i] = v.UTC()
+		case []string:
+			if v == nil {
+				rec[i] = []string{}
+			}
+		}
+
+		name, _ := json.Marshal(enc.columns[i].name)
+		value, err := json.Marshal(rec[i])
+		if err != nil {
+			return err
+		}
+
+		enc.buf.Write(name)
+		enc.buf.WriteByte(':')
+		enc.buf.Write(value)
+	}
+
+	enc.buf.WriteString("}\n")
+
+	_, err := enc.w.Write(enc.buf.Bytes())
+	return err
+}
+
+func (enc *ndjsonEncoder) close() error {
+	return nil
+}
+
+// rowGroupSize is roughly how many bytes of records a parquet row group buffers before it is written out.
+const rowGroupSize = 8 << 20
+
+// parquetEncoder writes the records a row group at a time, times are UTC timestamps in microseconds
+// and tags a list of strings.
+type parquetEncoder struct {
+	out     io.Writer
+	w       *goparquet.FileWriter
+	columns []column
+	rows    int
+}
+
+func newParquetEncoder(w io.Writer, columns []column) (*parquetEncoder, error) {
+	sd, err := parquetschema.ParseSchemaDefinition(parquetSchema(columns))
+	if err != nil {
+		return nil, err
+	}
+
+	return &parquetEncoder{
+		out: w,
+		w: goparquet.NewFileWriter(w,
+			goparquet.WithSchemaDefinition(sd),
+			goparquet.WithCompressionCodec(parquet.CompressionCodec_SNAPPY),
+			goparquet.WithMaxRowGroupSize(rowGroupSize),
+			goparquet.WithCreator("fupisha"),
+		),
+		columns: columns,
+	}, nil
+}
+
+// parquetSchema returns the schema definition of the columns.
+func parquetSchema(columns []column) string {
+	var b strings.Builder
+
+	b.WriteString("message export {\n")
+	for _, c := range columns {
+		repetition := "required"
+		if c.optional {
+			repetition = "optional"
+		}
+
+		switch c.kind {
+		case kindString:
+			fmt.Fprintf(&b, "%s binary %s (STRING);\n", repetition, c.name)
+		case kindInt:
+			fmt.Fprintf(&b, "%s int64 %s;\n", repetition, c.name)
+		case kindBool:
+			fmt.Fprintf(&b, "%s boolean %s;\n", repetition, c.name)
+		case kindTime:
+			fmt.Fprintf(&b, "%s int64 %s (TIMESTAMP(MICROS, true));\n", repetition, c.name)
+		case kindStrings:
+			fmt.Fprintf(&b, "%s group %s (LIST) {\nrepeated group list {\nrequired binary element (STRING);\n}\n}\n", repetition, c.name)
+		}
+	}
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+func (enc *parquetEncoder) encode(rec record) error {
+	data := make(map[string]interface{}, len(rec))
+
+	for i, v := range rec {
+		name := enc.columns[i].name
+
+		switch v := v.(type) {
+		case nil:
+		case string:
+			data[name] = []byte(v)
+		case time.Time:
+			data[name] = v.UnixMicro()
+		case []string:
+			list := make([]map[string]interface{}, len(v))
+			for j, s := range v {
+				list[j] = map[string]interface{}{"element": []byte(s)}
+			}
+			data[name] = map[string]interface{}{"list": list}
+		default:
+			data[name] = v
+		}
+	}
+
+	enc.rows++
+
+	return enc.w.AddData(data)
+}
+
+func (enc *parquetEncoder) close() error {
+	//the file writer only writes the leading magic number with the first row group, an empty
+	//export would otherwise not be a valid parquet file.
+	if enc.rows == 0 {
+		if _, err := io.WriteString(enc.out, "PAR1"); err != nil {
+			return err
+		}
+	}
+
+	return enc.w.Close()
+}
@@ -0,0 +1,165 @@
+// Package export streams an owner's urls, or the clicks on them, out of the store as CSV,
+// NDJSON or Parquet, a page of urls or clicks at a time.
+package export
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+// Format is the file format an export is written in.
+type Format string
+
+// The formats an export can be written in.
+const (
+	CSV     Format = "csv"
+	NDJSON  Format = "ndjson"
+	Parquet Format = "parquet"
+)
+
+// ErrFormat an export format other than csv, ndjson or parquet.
+var ErrFormat = errors.New("export: format must be csv, ndjson or parquet")
+
+// ContentType returns the media type of the format.
+func (f Format) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case NDJSON:
+		return "application/x-ndjson"
+	case Parquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "application/octet-stream"
+}
+
+// pageSize is how many urls or clicks are read from the store at a time.
+const pageSize = 500
+
+// Options select what an export holds.
+type Options struct {
+	Owner  uuid.UUID
+	Format Format
+	//Clicks exports the raw click events on the owner's urls instead of the urls themselves.
+	Clicks bool
+	//From and To bound the creation time of the exported urls or clicks, inclusive and exclusive respectively.
+	From *time.Time
+	To   *time.Time
+}
+
+// Export writes the owner's live urls, or the clicks on them, to w newest url first. Only a page of
+// urls and a page of clicks are held in memory at a time.
+func Export(ctx context.Context, s store.Store, w io.Writer, opts Options) error {
+	if opts.Clicks {
+		return exportClicks(ctx, s, w, opts)
+	}
+	return exportURLs(ctx, s, w, opts)
+}
+
+func exportURLs(ctx context.Context, s store.Store, w io.Writer, opts Options) error {
+	enc, err := newEncoder(opts.Format, w, urlColumns)
+	if err != nil {
+		return err
+	}
+
+	filter := store.URLFilter{
+		Owner:         opts.Owner,
+		CreatedAfter:  opts.From,
+		CreatedBefore: opts.To,
+	}
+
+	err = eachURL(ctx, s, filter, func(u store.URL) error {
+		return enc.encode(urlRecord(u))
+	})
+	if err != nil {
+		return err
+	}
+
+	return enc.close()
+}
+
+func exportClicks(ctx context.Context, s store.Store, w io.Writer, opts Options) error {
+	enc, err := newEncoder(opts.Format, w, clickColumns)
+	if err != nil {
+		return err
+	}
+
+	//a url only gets clicks once it exists, urls created after the range can not have any in it.
+	filter := store.URLFilter{
+		Owner:         opts.Owner,
+		CreatedBefore: opts.To,
+	}
+
+	err = eachURL(ctx, s, filter, func(u store.URL) error {
+		clicks := store.ClickFilter{
+			URLID:         u.ID,
+			CreatedAfter:  opts.From,
+			CreatedBefore: opts.To,
+		}
+
+		return eachClick(ctx, s, clicks, func(c store.Click) error {
+			return enc.encode(clickRecord(c))
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return enc.close()
+}
+
+// eachURL calls fn with every url matching the filter, reading them a page at a time.
+func eachURL(ctx context.Context, s store.URLStore, filter store.URLFilter, fn func(store.URL) error) error {
+	filter.Limit = pageSize
+
+	for {
+		urls, err := s.FindURLs(ctx, filter)
+		if err != nil {
+			return errors.Wrap(err, "export: urls")
+		}
+
+		for _, u := range urls {
+			if err := fn(u); err != nil {
+				return err
+			}
+		}
+
+		if len(urls) < pageSize {
+			return nil
+		}
+
+		last := urls[len(urls)-1]
+		filter.After = &store.URLCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+}
+
+// eachClick calls fn with every click matching the filter, reading them a page at a time.
+func eachClick(ctx context.Context, s store.ClickStore, filter store.ClickFilter, fn func(store.Click) error) error {
+	filter.Limit = pageSize
+
+	for {
+		clicks, err := s.FindClicks(ctx, filter)
+		if err != nil {
+			return errors.Wrapf(err, "export: clicks of url %s", filter.URLID)
+		}
+
+		for _, c := range clicks {
+			if err := fn(c); err != nil {
+				return err
+			}
+		}
+
+		if len(clicks) < pageSize {
+			return nil
+		}
+
+		last := clicks[len(clicks)-1]
+		filter.After = &store.ClickCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+}
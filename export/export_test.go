@@ -0,0 +1,201 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	goparquet "github.com/fraugster/parquet-go"
+
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/nairobi-gophers/fupisha/store/memory"
+)
+
+func TestColumns(t *testing.T) {
+	for _, tc := range []struct {
+		model   interface{}
+		columns []column
+		skip    string
+	}{
+		{model: store.URL{}, columns: urlColumns, skip: "password"},
+		{model: store.Click{}, columns: clickColumns},
+	} {
+		var want []string
+		for _, name := range dbFields(reflect.TypeOf(tc.model)) {
+			if name != tc.skip {
+				want = append(want, name)
+			}
+		}
+
+		var got []string
+		for _, c := range tc.columns {
+			got = append(got, c.name)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%T: got columns %v want the db fields %v", tc.model, got, want)
+		}
+	}
+}
+
+// dbFields returns the db tags of the fields of typ, the fields of embedded structs included as sqlx
+// maps them.
+func dbFields(typ reflect.Type) []string {
+	var names []string
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			names = append(names, dbFields(field.Type)...)
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("db"), ",")
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestExport(t *testing.T) {
+	s := memory.NewStore()
+
+	ctx := context.Background()
+
+	owner, err := s.NewUser(ctx, "owner@fupisha.io", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	other, err := s.NewUser(ctx, "other@fupisha.io", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	if _, err := s.NewURL(ctx, store.URL{Owner: other.ID, OriginalURL: "https://fupisha.io/other", ShortenedURLParam: "other"}); err != nil {
+		t.Fatal(err)
+	}
+
+	//one url more than a page makes the export read a second page.
+	var urls []store.URL
+	for i := 0; i <= pageSize; i++ {
+		u, err := s.NewURL(ctx, store.URL{
+			Owner:             owner.ID,
+			OriginalURL:       fmt.Sprintf("https://fupisha.io/%d", i),
+			ShortenedURLParam: fmt.Sprintf("link%d", i),
+			Title:             "Link, \"quoted\"",
+			Tags:              store.Tags{"docs", "launch"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		urls = append(urls, u)
+	}
+
+	for _, createdAt := range []time.Time{time.Now().Add(-time.Hour), time.Now()} {
+		if _, err := s.NewClick(ctx, store.Click{URLID: urls[0].ID, Browser: "Firefox", Device: "desktop", CreatedAt: createdAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	export := func(opts Options) *bytes.Buffer {
+		t.Helper()
+
+		opts.Owner = owner.ID
+
+		var buf bytes.Buffer
+		if err := Export(ctx, s, &buf, opts); err != nil {
+			t.Fatalf("%+v: %s", opts, err)
+		}
+		return &buf
+	}
+
+	rows, err := csv.NewReader(export(Options{Format: CSV})).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != pageSize+2 || rows[0][0] != "id" || rows[0][18] != "tags" {
+		t.Fatalf("got %d csv rows starting %v want a header and every url", len(rows), rows[0])
+	}
+
+	if last := rows[len(rows)-1]; last[4] != "link0" || last[16] != `Link, "quoted"` || last[18] != "docs,launch" || last[6] != "2" {
+		t.Fatalf("got %v want the oldest url last", last)
+	}
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(export(Options{Format: NDJSON, Clicks: true}))
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("%q: %s", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) != 2 || lines[0]["url_id"] != urls[0].ID.String() || lines[0]["browser"] != "Firefox" {
+		t.Fatalf("got %v want the two clicks", lines)
+	}
+
+	since := time.Now().Add(-time.Minute)
+	if buf := export(Options{Format: NDJSON, Clicks: true, From: &since}); strings.Count(buf.String(), "\n") != 1 {
+		t.Fatalf("got %q want only the recent click", buf)
+	}
+
+	if buf := export(Options{Format: CSV, To: &since}); buf.String() != strings.Join(rows[0], ",")+"\n" {
+		t.Fatalf("got %q want only the header", buf)
+	}
+
+	buf := export(Options{Format: Parquet})
+
+	fr, err := goparquet.NewFileReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fr.NumRows() != int64(pageSize+1) {
+		t.Fatalf("got %d parquet rows want %d", fr.NumRows(), pageSize+1)
+	}
+
+	row, err := fr.NextRow()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newest, err := s.GetURLByParam(ctx, rows[1][4])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(row["id"].([]byte)) != newest.ID.String() || row["created_at"] != newest.CreatedAt.UnixMicro() || row["expires_at"] != nil {
+		t.Fatalf("got %v want the newest url first like the csv", row)
+	}
+
+	tags := row["tags"].(map[string]interface{})["list"].([]map[string]interface{})
+	if len(tags) != 2 || string(tags[1]["element"].([]byte)) != "launch" {
+		t.Fatalf("got tags %v want docs and launch", tags)
+	}
+
+	//one click more than a page makes the export read a second page of the url's clicks.
+	var clicks []store.Click
+	for i := 0; i <= pageSize; i++ {
+		clicks = append(clicks, store.Click{URLID: urls[1].ID, Browser: "Chrome", CreatedAt: since.Add(-time.Duration(i) * time.Second)})
+	}
+
+	if err := s.NewClicks(ctx, clicks); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf := export(Options{Format: NDJSON, Clicks: true}); strings.Count(buf.String(), "\n") != pageSize+3 {
+		t.Fatalf("got %d clicks want %d", strings.Count(buf.String(), "\n"), pageSize+3)
+	}
+
+	if err := Export(ctx, s, &bytes.Buffer{}, Options{Owner: owner.ID, Format: "xml"}); err != ErrFormat {
+		t.Fatalf("got %v want %v", err, ErrFormat)
+	}
+}
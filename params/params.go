@@ -0,0 +1,144 @@
+// Package params generates the short url params of links. A generated param can collide with one
+// that is already taken, links retry with fresh params and the params grow longer once collisions
+// show the params of their length running out.
+package params
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/nairobi-gophers/fupisha/encoding"
+	"github.com/nairobi-gophers/fupisha/reserved"
+)
+
+// Alphabet is what generated params are made of.
+const Alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890"
+
+// DefaultLength is the length of generated params unless configured otherwise.
+const DefaultLength = 6
+
+// MaxAttempts bounds how many generated params a link tries before giving up.
+const MaxAttempts = 10
+
+// MaxLength bounds how long params grow, the param columns hold 255 characters.
+const MaxLength = 64
+
+// The length of params grows by one after growAfter collisions in a row, or once at least
+// minSample params of the current length were tried and one in fillRatio of them was taken.
+const (
+	growAfter = 3
+	minSample = 20
+	fillRatio = 4
+)
+
+// ErrExhausted is returned when every param a link tried was taken.
+var ErrExhausted = errors.New("params: every generated param tried is taken")
+
+// Func returns a random param of the given length.
+type Func func(length int) (string, error)
+
+// Random returns a random param of the given length made of the Alphabet.
+func Random(length int) (string, error) {
+	return encoding.GenUniqueParam(Alphabet, length)
+}
+
+// Generator generates params of a length growing with the collisions it is told about. It is safe
+// for concurrent use.
+type Generator struct {
+	generate Func
+
+	mu     sync.Mutex
+	length int
+	//tried and taken count the params of the current length since it was set, run the
+	//collisions since a param was last free.
+	tried, taken, run int
+}
+
+// New returns a generator of params of the given length, DefaultLength if it is not positive, made
+// with generate, Random if it is nil.
+func New(length int, generate Func) *Generator {
+	if length <= 0 {
+		length = DefaultLength
+	}
+	if generate == nil {
+		generate = Random
+	}
+
+	return &Generator{generate: generate, length: length}
+}
+
+// Length returns the length of the params generated next.
+func (g *Generator) Length() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.length
+}
+
+// Next returns a fresh param, reserved words are skipped.
+func (g *Generator) Next() (string, error) {
+	for {
+		param, err := g.generate(g.Length())
+		if err != nil {
+			return "", err
+		}
+
+		if !reserved.IsReserved(param) {
+			return param, nil
+		}
+	}
+}
+
+// Taken records that a generated param collided with one already taken.
+func (g *Generator) Taken() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.tried++
+	g.taken++
+	g.run++
+	g.grow()
+}
+
+// Free records that a generated param was not taken.
+func (g *Generator) Free() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.tried++
+	g.run = 0
+	g.grow()
+}
+
+// grow makes the params longer once the collisions show the params of their length running out.
+func (g *Generator) grow() {
+	if g.length < MaxLength && (g.run >= growAfter || (g.tried >= minSample && g.taken*fillRatio >= g.tried)) {
+		g.length++
+		g.tried, g.taken, g.run = 0, 0, 0
+	}
+}
+
+// Try calls create with fresh params until one is not taken, taken tells the errors of create for a
+// taken param apart. It returns the param create last got and its error, ErrExhausted once
+// MaxAttempts params were taken.
+func (g *Generator) Try(create func(param string) error, taken func(error) bool) (string, error) {
+	for attempt := 0; attempt < MaxAttempts; attempt++ {
+		param, err := g.Next()
+		if err != nil {
+			return "", err
+		}
+
+		err = create(param)
+		if err != nil && taken(err) {
+			g.Taken()
+			continue
+		}
+
+		if err == nil {
+			g.Free()
+		}
+		return param, err
+	}
+
+	return "", ErrExhausted
+}
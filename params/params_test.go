@@ -0,0 +1,101 @@
+package params
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// script returns a generator answering with the given params in turn, then with params of z's.
+func script(ps ...string) Func {
+	return func(length int) (string, error) {
+		if len(ps) == 0 {
+			return strings.Repeat("z", length), nil
+		}
+		p := ps[0]
+		ps = ps[1:]
+		return p, nil
+	}
+}
+
+func TestTry(t *testing.T) {
+	taken := map[string]bool{"abc": true, "def": true}
+	errTaken := errors.New("taken")
+
+	create := func(param string) error {
+		if taken[param] {
+			return errTaken
+		}
+		return nil
+	}
+	isTaken := func(err error) bool { return err == errTaken }
+
+	g := New(3, script("abc", "url", "def", "ghi"))
+
+	//reserved words are skipped without counting as collisions.
+	param, err := g.Try(create, isTaken)
+	if err != nil || param != "ghi" {
+		t.Fatalf("got %q, %v want ghi", param, err)
+	}
+
+	if g.Length() != 3 {
+		t.Fatalf("got length %d after two collisions want 3", g.Length())
+	}
+
+	//other errors are returned as they are.
+	errDown := errors.New("down")
+	if _, err := New(3, nil).Try(func(string) error { return errDown }, isTaken); err != errDown {
+		t.Fatalf("got %v want %v", err, errDown)
+	}
+
+	g = New(3, func(int) (string, error) { return "abc", nil })
+	if _, err := g.Try(create, isTaken); err != ErrExhausted {
+		t.Fatalf("got %v trying only taken params want %v", err, ErrExhausted)
+	}
+
+	if want := 3 + MaxAttempts/growAfter; g.Length() != want {
+		t.Fatalf("got length %d after %d collisions in a row want %d", g.Length(), MaxAttempts, want)
+	}
+}
+
+func TestGrowth(t *testing.T) {
+	g := New(0, nil)
+	if g.Length() != DefaultLength {
+		t.Fatalf("got length %d want the default %d", g.Length(), DefaultLength)
+	}
+
+	//one param in three taken fills the keyspace past one in fillRatio.
+	for i := 0; i < minSample; i++ {
+		if i%3 == 0 {
+			g.Taken()
+		} else {
+			g.Free()
+		}
+	}
+
+	if g.Length() != DefaultLength+1 {
+		t.Fatalf("got length %d once a third of the params were taken want %d", g.Length(), DefaultLength+1)
+	}
+
+	//a few collisions among many free params leave the length alone.
+	for i := 0; i < 10*minSample; i++ {
+		if i%10 == 0 {
+			g.Taken()
+		} else {
+			g.Free()
+		}
+	}
+
+	if g.Length() != DefaultLength+1 {
+		t.Fatalf("got length %d with one param in ten taken want %d", g.Length(), DefaultLength+1)
+	}
+
+	g = New(MaxLength, nil)
+	for i := 0; i < growAfter; i++ {
+		g.Taken()
+	}
+
+	if g.Length() != MaxLength {
+		t.Fatalf("got length %d want at most %d", g.Length(), MaxLength)
+	}
+}
@@ -0,0 +1,126 @@
+package policy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Blocklist rejects destinations on blocked domains. It is read from a file with an entry per line:
+//
+//	# comments and blank lines are skipped
+//	bad.example          blocks the domain itself
+//	*.bad.example        blocks every subdomain of bad.example, and bad.example itself
+//	/^ads[0-9]*\./       blocks the domains the regular expression matches
+type Blocklist struct {
+	path string
+
+	mu       sync.RWMutex
+	exact    map[string]bool
+	suffixes []string
+	patterns []*regexp.Regexp
+}
+
+// LoadBlocklist reads the blocklist at path.
+func LoadBlocklist(path string) (*Blocklist, error) {
+	b := &Blocklist{path: path}
+
+	if err := b.Reload(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Reload reads the blocklist file again, the list stays as it was when the file can not be read.
+func (b *Blocklist) Reload() error {
+	f, err := os.Open(b.path)
+	if err != nil {
+		return fmt.Errorf("policy: blocklist: %w", err)
+	}
+	defer f.Close()
+
+	exact, suffixes, patterns, err := parseBlocklist(f)
+	if err != nil {
+		return fmt.Errorf("policy: blocklist %s: %w", b.path, err)
+	}
+
+	b.mu.Lock()
+	b.exact, b.suffixes, b.patterns = exact, suffixes, patterns
+	b.mu.Unlock()
+
+	return nil
+}
+
+func parseBlocklist(r io.Reader) (map[string]bool, []string, []*regexp.Regexp, error) {
+	exact := make(map[string]bool)
+	var suffixes []string
+	var patterns []*regexp.Regexp
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case entry == "" || strings.HasPrefix(entry, "#"):
+		case len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/"):
+			re, err := regexp.Compile(entry[1 : len(entry)-1])
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			patterns = append(patterns, re)
+		case strings.HasPrefix(entry, "*."):
+			suffixes = append(suffixes, normalizeHost(entry[2:]))
+		default:
+			exact[normalizeHost(entry)] = true
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return exact, suffixes, patterns, nil
+}
+
+// Check rejects the url when its domain is blocked.
+func (b *Blocklist) Check(u *url.URL) error {
+	h := Host(u)
+
+	if b.Blocked(h) {
+		return &Violation{Rule: "blocklist", Reason: fmt.Sprintf("domain %s is blocked", h)}
+	}
+
+	return nil
+}
+
+// Blocked reports whether the domain is on the blocklist.
+func (b *Blocklist) Blocked(domain string) bool {
+	domain = normalizeHost(domain)
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.exact[domain] {
+		return true
+	}
+
+	for _, suffix := range b.suffixes {
+		if domain == suffix || strings.HasSuffix(domain, "."+suffix) {
+			return true
+		}
+	}
+
+	for _, re := range b.patterns {
+		if re.MatchString(domain) {
+			return true
+		}
+	}
+
+	return false
+}
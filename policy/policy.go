@@ -0,0 +1,142 @@
+// Package policy decides which destinations fupisha shortens. A policy runs a set of rules on
+// every destination, e.g. allowing only http and https urls, blocking known bad domains and
+// refusing links back at fupisha's own short domains.
+package policy
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// hosts maps internationalized hosts to their punycode form, allowing the underscores found in real
+// world hosts.
+var hosts = idna.New(idna.MapForLookup(), idna.StrictDomainName(false))
+
+// Rule rejects the destinations it does not allow with a *Violation.
+type Rule interface {
+	Check(u *url.URL) error
+}
+
+// RuleFunc lets an ordinary function be used as a rule.
+type RuleFunc func(u *url.URL) error
+
+// Check calls f(u).
+func (f RuleFunc) Check(u *url.URL) error {
+	return f(u)
+}
+
+// Reloader is a rule that reads its configuration from somewhere it can read it again from.
+type Reloader interface {
+	Reload() error
+}
+
+// Violation is the reason a destination is rejected.
+type Violation struct {
+	//Rule names the rule that rejected the destination e.g. scheme, blocklist or loop.
+	Rule   string
+	Reason string
+}
+
+func (v *Violation) Error() string {
+	return v.Reason
+}
+
+// Policy runs its rules on destinations in order, the first rule rejecting one decides.
+type Policy struct {
+	rules []Rule
+}
+
+// New returns a policy made of the rules.
+func New(rules ...Rule) *Policy {
+	return &Policy{rules: rules}
+}
+
+// Check parses the destination and runs the rules on it.
+func (p *Policy) Check(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return &Violation{Rule: "url", Reason: "must be a valid url"}
+	}
+
+	for _, rule := range p.rules {
+		if err := rule.Check(u); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reload reloads every rule that can be reloaded. A rule that fails to reload keeps what it had.
+func (p *Policy) Reload() error {
+	for _, rule := range p.rules {
+		if r, ok := rule.(Reloader); ok {
+			if err := r.Reload(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Schemes allows destinations using one of the schemes only, e.g. http and https, which keeps
+// javascript:, data: and file: urls out.
+func Schemes(schemes ...string) Rule {
+	allowed := make(map[string]bool, len(schemes))
+	for _, s := range schemes {
+		allowed[strings.ToLower(strings.TrimSpace(s))] = true
+	}
+
+	return RuleFunc(func(u *url.URL) error {
+		scheme := strings.ToLower(u.Scheme)
+		if !allowed[scheme] {
+			return &Violation{Rule: "scheme", Reason: fmt.Sprintf("scheme %q is not allowed, use one of %s", scheme, strings.Join(schemes, ", "))}
+		}
+
+		if Host(u) == "" {
+			return &Violation{Rule: "scheme", Reason: "must have a host"}
+		}
+
+		return nil
+	})
+}
+
+// NoLoop rejects destinations on one of fupisha's own short domains, a short link to a short link
+// could redirect in circles.
+func NoLoop(domains ...string) Rule {
+	own := make(map[string]bool, len(domains))
+	for _, d := range domains {
+		if d = normalizeHost(d); d != "" {
+			own[d] = true
+		}
+	}
+
+	return RuleFunc(func(u *url.URL) error {
+		if own[Host(u)] {
+			return &Violation{Rule: "loop", Reason: fmt.Sprintf("must not point back at the short domain %s", Host(u))}
+		}
+		return nil
+	})
+}
+
+// Host returns the normalized host of the url, without its port.
+func Host(u *url.URL) string {
+	return normalizeHost(u.Hostname())
+}
+
+// normalizeHost lowercases the host, converts an internationalized one to punycode the way the
+// canonical form of urls does, and drops the dot a fully qualified name can end in. bücher.example and
+// xn--bcher-kva.example are the same host to every rule.
+func normalizeHost(h string) string {
+	h = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(h)), ".")
+
+	if ascii, err := hosts.ToASCII(h); err == nil {
+		h = ascii
+	}
+
+	return h
+}
@@ -0,0 +1,105 @@
+package policy
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte("# known bad\nbad.example\n*.phish.example\n/^ads[0-9]+\\./\nxn--bcher-kva.example\n*.zürich.example\n\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	blocklist, err := LoadBlocklist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(Schemes("http", "https"), blocklist, NoLoop("fupisha.io", "FPSH.IO."))
+
+	for raw, want := range map[string]string{
+		"https://go.dev/blog":               "",
+		"HTTP://Go.Dev":                     "",
+		"https://good.bad.example":          "",
+		"javascript:alert(1)":               "scheme",
+		"data:text/html,hi":                 "scheme",
+		"file:///etc/passwd":                "scheme",
+		"ftp://go.dev":                      "scheme",
+		"https:///no-host":                  "scheme",
+		"https://BAD.example./x":            "blocklist",
+		"https://phish.example":             "blocklist",
+		"https://login.phish.example":       "blocklist",
+		"https://ads42.tracker.example":     "blocklist",
+		"http://bücher.example/":            "blocklist",
+		"http://BÜCHER.example./a":          "blocklist",
+		"http://xn--bcher-kva.example":      "blocklist",
+		"https://www.xn--zrich-kva.example": "blocklist",
+		"https://www.zürich.example":        "blocklist",
+		"https://fupisha.io/abc":            "loop",
+		"https://fpsh.io:443/abc":           "loop",
+		"https://user@fupisha.io/abc":       "loop",
+		"https://fupisha.io@go.dev/abc":     "",
+		"https://docs.fupisha.io/landing":   "",
+	} {
+		err := p.Check(raw)
+
+		var v *Violation
+		switch {
+		case want == "" && err != nil:
+			t.Fatalf("%s: got %v want it allowed", raw, err)
+		case want != "" && (!errors.As(err, &v) || v.Rule != want):
+			t.Fatalf("%s: got %v want a %s violation", raw, err, want)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("go.dev\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Check("https://go.dev") == nil || p.Check("https://bad.example") != nil {
+		t.Fatal("want the reloaded blocklist to replace the old one")
+	}
+
+	if err := os.WriteFile(path, []byte("/[/\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Reload(); err == nil {
+		t.Fatal("want an invalid pattern to fail the reload")
+	}
+
+	if p.Check("https://go.dev") == nil {
+		t.Fatal("want a failed reload to keep the blocklist")
+	}
+
+	if _, err := LoadBlocklist(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Fatal("want a missing blocklist to fail")
+	}
+}
+
+func TestRuleFunc(t *testing.T) {
+	onlyDocs := RuleFunc(func(u *url.URL) error {
+		if u.Path != "/docs" {
+			return &Violation{Rule: "docs", Reason: "must link to the docs"}
+		}
+		return nil
+	})
+
+	p := New(onlyDocs)
+
+	if err := p.Check("https://go.dev/docs"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Check("https://go.dev/blog"); err == nil || err.Error() != "must link to the docs" {
+		t.Fatalf("got %v want the custom rule to reject it", err)
+	}
+}
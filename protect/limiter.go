@@ -0,0 +1,68 @@
+package protect
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// limiter counts the failed password attempts of every url over a fixed window.
+type limiter struct {
+	max    int
+	window time.Duration
+	now    func() time.Time
+
+	mu       sync.Mutex
+	failures map[uuid.UUID]*attempts
+}
+
+type attempts struct {
+	count int
+	reset time.Time
+}
+
+func newLimiter(max int, window time.Duration, now func() time.Time) *limiter {
+	return &limiter{
+		max:      max,
+		window:   window,
+		now:      now,
+		failures: make(map[uuid.UUID]*attempts),
+	}
+}
+
+// wait returns how long the url rejects attempts for, zero if it accepts them.
+func (l *limiter) wait(id uuid.UUID) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.failures[id]
+	if !ok || a.count < l.max {
+		return 0
+	}
+
+	return a.reset.Sub(l.now())
+}
+
+// fail counts a failed attempt on the url.
+func (l *limiter) fail(id uuid.UUID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	a, ok := l.failures[id]
+	if ok && now.Before(a.reset) {
+		a.count++
+		return
+	}
+
+	//windows that are over count nothing, drop them before starting a new one.
+	for k, a := range l.failures {
+		if !now.Before(a.reset) {
+			delete(l.failures, k)
+		}
+	}
+
+	l.failures[id] = &attempts{count: 1, reset: now.Add(l.window)}
+}
@@ -0,0 +1,167 @@
+// Package protect guards password protected short urls. Visitors are challenged for the
+// password and a correct one is remembered in a short-lived signed cookie.
+package protect
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+// Guard defaults used for the zero values of a Config.
+const (
+	defaultCookieTTL   = 30 * time.Minute
+	defaultMaxAttempts = 5
+	defaultWindow      = 15 * time.Minute
+)
+
+// maxFormSize bounds the challenge form a visitor can post.
+const maxFormSize = 4 << 10
+
+// cookiePrefix is followed by the short url param in the name of its unlock cookie.
+const cookiePrefix = "fupisha_unlock_"
+
+//go:embed challenge.html
+var challengeHTML string
+
+var challengeTmpl = template.Must(template.New("challenge").Parse(challengeHTML))
+
+// Config declares how protected urls are unlocked.
+type Config struct {
+	//Secret key signing the unlock cookies, at least 32 bytes.
+	Secret []byte
+	//CookieTTL how long a url stays unlocked in the browser that unlocked it.
+	CookieTTL time.Duration
+	//MaxAttempts failed password attempts a url allows per window.
+	MaxAttempts int
+	//Window period failed password attempts are counted over.
+	Window time.Duration
+}
+
+// Guard challenges the visitors of protected urls for their password.
+type Guard struct {
+	cfg     Config
+	limiter *limiter
+	now     func() time.Time
+}
+
+// NewGuard returns a guard signing its cookies with the configured secret.
+func NewGuard(cfg Config) (*Guard, error) {
+	if len(cfg.Secret) < 32 {
+		return nil, errors.New("protect: secret too short")
+	}
+
+	if cfg.CookieTTL <= 0 {
+		cfg.CookieTTL = defaultCookieTTL
+	}
+
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+
+	if cfg.Window <= 0 {
+		cfg.Window = defaultWindow
+	}
+
+	g := &Guard{cfg: cfg, now: time.Now}
+	g.limiter = newLimiter(cfg.MaxAttempts, cfg.Window, func() time.Time { return g.now() })
+
+	return g, nil
+}
+
+// Unlock reports whether the visitor may follow the url. Public urls and urls unlocked earlier
+// in the same browser pass right away, otherwise the visitor is answered with the password
+// challenge and Unlock reports false. A correct password posted to the challenge unlocks the url.
+func (g *Guard) Unlock(w http.ResponseWriter, r *http.Request, u store.URL) bool {
+	if !u.Protected() || g.unlocked(r, u) {
+		return true
+	}
+
+	if r.Method != http.MethodPost {
+		g.challenge(w, http.StatusOK, "")
+		return false
+	}
+
+	if wait := g.limiter.wait(u.ID); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Round(time.Second)/time.Second)))
+		g.challenge(w, http.StatusTooManyRequests, "Too many wrong passwords, try again later.")
+		return false
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormSize)
+
+	if !u.ComparePassword(r.PostFormValue("password")) {
+		g.limiter.fail(u.ID)
+		g.challenge(w, http.StatusUnauthorized, "Wrong password.")
+		return false
+	}
+
+	expires := g.now().Add(g.cfg.CookieTTL)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookiePrefix + u.ShortenedURLParam,
+		Value:    g.sign(u, expires),
+		Path:     "/" + u.ShortenedURLParam,
+		Expires:  expires,
+		MaxAge:   int(g.cfg.CookieTTL / time.Second),
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return true
+}
+
+// unlocked reports whether the request carries a valid unlock cookie for the url.
+func (g *Guard) unlocked(r *http.Request, u store.URL) bool {
+	c, err := r.Cookie(cookiePrefix + u.ShortenedURLParam)
+	if err != nil {
+		return false
+	}
+
+	exp, _, ok := strings.Cut(c.Value, ".")
+	if !ok {
+		return false
+	}
+
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	expires := time.Unix(unix, 0)
+	if !g.now().Before(expires) {
+		return false
+	}
+
+	return hmac.Equal([]byte(c.Value), []byte(g.sign(u, expires)))
+}
+
+// sign returns the unlock cookie value for the url, valid until expires. The signature covers the
+// password hash so changing the password locks out every browser that unlocked the old one.
+func (g *Guard) sign(u store.URL, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+
+	mac := hmac.New(sha256.New, g.cfg.Secret)
+	mac.Write([]byte(u.ID.String() + "|" + u.Password + "|" + exp))
+
+	return exp + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// challenge renders the password form with the given status and error message.
+func (g *Guard) challenge(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	challengeTmpl.Execute(w, struct{ Error string }{message})
+}
@@ -0,0 +1,131 @@
+package protect
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nairobi-gophers/fupisha/encoding"
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+const testSecret = "c4c0f2c42bde58f4d5f453483b3bed2b2915779cacff15526b2560b00748ec36"
+
+func newTestURL(t *testing.T, password string) store.URL {
+	u := store.URL{ID: encoding.GenUniqueID(), ShortenedURLParam: "abcdef", Password: password}
+	if err := u.HashPassword(); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func post(password string) *http.Request {
+	r := httptest.NewRequest("POST", "/abcdef", strings.NewReader(url.Values{"password": {password}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestGuard(t *testing.T) {
+	g, err := NewGuard(Config{Secret: []byte(testSecret), CookieTTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	g.now = func() time.Time { return now }
+
+	if !g.Unlock(httptest.NewRecorder(), httptest.NewRequest("GET", "/abcdef", nil), store.URL{ShortenedURLParam: "abcdef"}) {
+		t.Fatal("want public urls unlocked")
+	}
+
+	u := newTestURL(t, "open sesame")
+
+	rr := httptest.NewRecorder()
+	if g.Unlock(rr, httptest.NewRequest("GET", "/abcdef", nil), u) {
+		t.Fatal("want protected urls challenged")
+	}
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `name="password"`) {
+		t.Fatalf("got %d %q want the challenge form", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	if g.Unlock(rr, post("open barley"), u) || rr.Code != http.StatusUnauthorized {
+		t.Fatalf("got %d want a wrong password rejected", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	if !g.Unlock(rr, post("open sesame"), u) {
+		t.Fatal("want the right password to unlock the url")
+	}
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Path != "/abcdef" || !cookies[0].HttpOnly {
+		t.Fatalf("got cookies %+v want a single unlock cookie scoped to the url", cookies)
+	}
+
+	refresh := func(u store.URL) bool {
+		r := httptest.NewRequest("GET", "/abcdef", nil)
+		r.AddCookie(cookies[0])
+		return g.Unlock(httptest.NewRecorder(), r, u)
+	}
+
+	if !refresh(u) {
+		t.Fatal("want the cookie to keep the url unlocked")
+	}
+
+	tampered := *cookies[0]
+	tampered.Value = strings.Replace(tampered.Value, ".", "0.", 1)
+	r := httptest.NewRequest("GET", "/abcdef", nil)
+	r.AddCookie(&tampered)
+	if g.Unlock(httptest.NewRecorder(), r, u) {
+		t.Fatal("want a tampered cookie rejected")
+	}
+
+	if refresh(newTestURL(t, "open barley")) {
+		t.Fatal("want the cookie rejected once the password changes")
+	}
+
+	now = now.Add(time.Minute)
+	if refresh(u) {
+		t.Fatal("want the cookie rejected once it expires")
+	}
+}
+
+func TestGuardRateLimit(t *testing.T) {
+	g, err := NewGuard(Config{Secret: []byte(testSecret), MaxAttempts: 2, Window: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	g.now = func() time.Time { return now }
+
+	u := newTestURL(t, "open sesame")
+	other := newTestURL(t, "open sesame")
+
+	for i := 0; i < 2; i++ {
+		g.Unlock(httptest.NewRecorder(), post("open barley"), u)
+	}
+
+	rr := httptest.NewRecorder()
+	if g.Unlock(rr, post("open sesame"), u) || rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "60" {
+		t.Fatalf("got %d retry after %q want the url locked after too many failures", rr.Code, rr.Header().Get("Retry-After"))
+	}
+
+	if !g.Unlock(httptest.NewRecorder(), post("open sesame"), other) {
+		t.Fatal("want failures on one url to leave the others alone")
+	}
+
+	now = now.Add(time.Minute)
+	if !g.Unlock(httptest.NewRecorder(), post("open sesame"), u) {
+		t.Fatal("want the url unlocked again once the window is over")
+	}
+
+	if _, err := NewGuard(Config{Secret: []byte("short")}); err == nil {
+		t.Fatal("want an error for a short secret")
+	}
+}
@@ -0,0 +1,304 @@
+// Package qr renders QR codes as PNG or SVG images, with a chosen size, error correction level,
+// margin and colours and an optional logo in the middle.
+package qr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Level is how much of a code can be damaged, or covered, and still be read.
+type Level string
+
+// The error correction levels, recovering roughly 7%, 15%, 25% and 30% of the code respectively.
+const (
+	L Level = "L"
+	M Level = "M"
+	Q Level = "Q"
+	H Level = "H"
+)
+
+var recoveryLevels = map[Level]qrcode.RecoveryLevel{
+	L: qrcode.Low,
+	M: qrcode.Medium,
+	Q: qrcode.High,
+	H: qrcode.Highest,
+}
+
+// The bounds and defaults of the options, sizes are in pixels and margins in modules.
+const (
+	DefaultSize   = 256
+	MinSize       = 64
+	MaxSize       = 2048
+	DefaultMargin = 4
+	MaxMargin     = 16
+)
+
+// logoShare is the share of the code's width a logo may cover.
+const logoShare = 5
+
+var (
+	// ErrLevel an error correction level other than L, M, Q or H.
+	ErrLevel = errors.New("qr: level must be L, M, Q or H")
+	// ErrSize a size outside of MinSize and MaxSize.
+	ErrSize = fmt.Errorf("qr: size must be between %d and %d", MinSize, MaxSize)
+	// ErrMargin a margin outside of 0 and MaxMargin.
+	ErrMargin = fmt.Errorf("qr: margin must be between 0 and %d", MaxMargin)
+	// ErrTooSmall a size too small to give every module of the code a pixel.
+	ErrTooSmall = errors.New("qr: size too small for the content")
+	// ErrColor a colour that is not written as hex e.g. 1a2b3c, 1a2b3cff or abc.
+	ErrColor = errors.New("qr: colour must be 3, 6 or 8 hex digits e.g. 1a2b3c")
+)
+
+// Options decide how a code looks, their zero values take the defaults.
+type Options struct {
+	//Size of the image in pixels, the width and height of the square.
+	Size int
+	//Level of error correction, a code with a logo gets at least Q.
+	Level Level
+	//Margin is the quiet zone around the code in modules, nil for the default.
+	Margin *int
+	//Foreground and Background colours of the dark and light modules, black on white by default.
+	Foreground color.Color
+	Background color.Color
+	//Logo drawn in the middle of the code.
+	Logo image.Image
+}
+
+// Code is a QR code ready to be rendered.
+type Code struct {
+	modules [][]bool
+	opts    Options
+	margin  int
+}
+
+// New encodes the content into a code rendered the way the options say.
+func New(content string, opts Options) (*Code, error) {
+	if opts.Size == 0 {
+		opts.Size = DefaultSize
+	}
+	if opts.Size < MinSize || opts.Size > MaxSize {
+		return nil, ErrSize
+	}
+
+	if opts.Level == "" {
+		opts.Level = M
+	}
+	if _, ok := recoveryLevels[opts.Level]; !ok {
+		return nil, ErrLevel
+	}
+	//the logo hides modules the error correction has to make up for.
+	if opts.Logo != nil && (opts.Level == L || opts.Level == M) {
+		opts.Level = Q
+	}
+
+	margin := DefaultMargin
+	if opts.Margin != nil {
+		margin = *opts.Margin
+	}
+	if margin < 0 || margin > MaxMargin {
+		return nil, ErrMargin
+	}
+
+	if opts.Foreground == nil {
+		opts.Foreground = color.Black
+	}
+	if opts.Background == nil {
+		opts.Background = color.White
+	}
+
+	q, err := qrcode.New(content, recoveryLevels[opts.Level])
+	if err != nil {
+		return nil, err
+	}
+	q.DisableBorder = true
+
+	c := &Code{modules: q.Bitmap(), opts: opts, margin: margin}
+
+	if opts.Size < c.width() {
+		return nil, ErrTooSmall
+	}
+
+	return c, nil
+}
+
+// width is the width of the code in modules, margins included.
+func (c *Code) width() int {
+	return len(c.modules) + 2*c.margin
+}
+
+// logoBox returns where the logo goes in modules, offset from the top left of the symbol.
+func (c *Code) logoBox() (offset, width int) {
+	n := len(c.modules)
+	width = n / logoShare
+	//an odd box sits centred on the odd width of every QR symbol.
+	if width%2 == 0 {
+		width--
+	}
+	return (n - width) / 2, width
+}
+
+// PNG writes the code as a PNG image of exactly the configured size.
+func (c *Code) PNG(w io.Writer) error {
+	size := c.opts.Size
+	scale := size / c.width()
+	//the pixels the modules do not divide evenly are spread around the margin.
+	origin := (size - scale*len(c.modules)) / 2
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c.opts.Background), image.Point{}, draw.Src)
+
+	fg := image.NewUniform(c.opts.Foreground)
+	for y, row := range c.modules {
+		for x, dark := range row {
+			if dark {
+				r := image.Rect(origin+x*scale, origin+y*scale, origin+(x+1)*scale, origin+(y+1)*scale)
+				draw.Draw(img, r, fg, image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	if c.opts.Logo != nil {
+		offset, width := c.logoBox()
+		box := image.Rect(origin+offset*scale, origin+offset*scale, origin+(offset+width)*scale, origin+(offset+width)*scale)
+		draw.Draw(img, box, image.NewUniform(c.opts.Background), image.Point{}, draw.Src)
+		drawScaled(img, box.Inset(scale/2), c.opts.Logo)
+	}
+
+	return png.Encode(w, img)
+}
+
+// drawScaled draws src over the rectangle of dst, scaled to fit it with nearest neighbour sampling.
+func drawScaled(dst draw.Image, r image.Rectangle, src image.Image) {
+	sb := src.Bounds()
+	if sb.Empty() || r.Empty() {
+		return
+	}
+
+	//keep the aspect ratio of the logo and centre it in the rectangle.
+	w, h := r.Dx(), r.Dy()
+	if sb.Dx()*h > sb.Dy()*w {
+		h = sb.Dy() * w / sb.Dx()
+	} else {
+		w = sb.Dx() * h / sb.Dy()
+	}
+	r = image.Rect(0, 0, w, h).Add(r.Min).Add(image.Pt((r.Dx()-w)/2, (r.Dy()-h)/2))
+
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			scaled.Set(x, y, src.At(sb.Min.X+x*sb.Dx()/w, sb.Min.Y+y*sb.Dy()/h))
+		}
+	}
+
+	draw.Draw(dst, r, scaled, image.Point{}, draw.Over)
+}
+
+// SVG writes the code as an SVG image with the configured size, the modules are drawn in a single path.
+func (c *Code) SVG(w io.Writer) error {
+	var b bytes.Buffer
+
+	width := c.width()
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, c.opts.Size, c.opts.Size, width, width)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d"%s/>`, width, width, svgFill(c.opts.Background))
+
+	b.WriteString(`<path d="`)
+	for y, row := range c.modules {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+
+			//a run of dark modules is a single rectangle.
+			run := 1
+			for x+run < len(row) && row[x+run] {
+				run++
+			}
+			fmt.Fprintf(&b, "M%d %dh%dv1h-%dz", c.margin+x, c.margin+y, run, run)
+			x += run - 1
+		}
+	}
+	fmt.Fprintf(&b, `"%s/>`, svgFill(c.opts.Foreground))
+
+	if c.opts.Logo != nil {
+		var logo bytes.Buffer
+		if err := png.Encode(&logo, c.opts.Logo); err != nil {
+			return err
+		}
+
+		offset, size := c.logoBox()
+		offset += c.margin
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d"%s/>`, offset, offset, size, size, svgFill(c.opts.Background))
+		fmt.Fprintf(&b, `<image x="%g" y="%g" width="%d" height="%d" href="data:image/png;base64,%s"/>`,
+			float64(offset)+0.5, float64(offset)+0.5, size-1, size-1, base64.StdEncoding.EncodeToString(logo.Bytes()))
+	}
+
+	b.WriteString("</svg>\n")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// svgFill returns the fill attributes of the colour.
+func svgFill(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+
+	fill := fmt.Sprintf(` fill="#%02x%02x%02x"`, n.R, n.G, n.B)
+	if n.A != 0xff {
+		fill += fmt.Sprintf(` fill-opacity="%s"`, strconv.FormatFloat(float64(n.A)/0xff, 'f', 3, 64))
+	}
+
+	return fill
+}
+
+// ParseColor reads a colour written as hex with an optional leading #, e.g. 1a2b3c, #abc or 1a2b3c80 with alpha.
+func ParseColor(s string) (color.Color, error) {
+	s = strings.TrimPrefix(s, "#")
+
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+	if len(s) != 8 {
+		return nil, ErrColor
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return nil, ErrColor
+	}
+
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// LoadLogo reads a PNG, JPEG or GIF logo from the file at path.
+func LoadLogo(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("qr: logo %s: %w", path, err)
+	}
+
+	return img, nil
+}
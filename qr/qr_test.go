@@ -0,0 +1,164 @@
+package qr
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestPNG(t *testing.T) {
+	margin := 2
+	fg := color.NRGBA{R: 0x1a, G: 0x2b, B: 0x3c, A: 0xff}
+
+	c, err := New("https://fupisha.io/summit", Options{Size: 300, Level: H, Margin: &margin, Foreground: fg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.PNG(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b := img.Bounds(); b.Dx() != 300 || b.Dy() != 300 {
+		t.Fatalf("got a %v image want 300x300", b)
+	}
+
+	scale := 300 / c.width()
+	origin := (300 - scale*len(c.modules)) / 2
+
+	//the middle pixel of every module has the colour of the module.
+	for y, row := range c.modules {
+		for x, dark := range row {
+			want := color.Color(color.White)
+			if dark {
+				want = fg
+			}
+
+			got := img.At(origin+x*scale+scale/2, origin+y*scale+scale/2)
+			if !sameColor(got, want) {
+				t.Fatalf("module %d,%d: got %v want %v", x, y, got, want)
+			}
+		}
+	}
+
+	if !sameColor(img.At(origin-1, origin-1), color.White) {
+		t.Fatal("want the margin drawn in the background colour")
+	}
+}
+
+func TestLogo(t *testing.T) {
+	logo := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	red := color.NRGBA{R: 0xff, A: 0xff}
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			logo.Set(x, y, red)
+		}
+	}
+
+	c, err := New("https://fupisha.io/summit", Options{Size: 512, Level: L, Logo: logo})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.opts.Level != Q {
+		t.Fatalf("got level %s want a logo to raise it to Q", c.opts.Level)
+	}
+
+	var buf bytes.Buffer
+	if err := c.PNG(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := img.At(256, 256); !sameColor(got, red) {
+		t.Fatalf("got %v in the middle want the logo", got)
+	}
+
+	buf.Reset()
+	if err := c.SVG(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), `href="data:image/png;base64,`) {
+		t.Fatalf("got %q want the logo embedded", buf.String())
+	}
+}
+
+func TestSVG(t *testing.T) {
+	margin := 0
+	c, err := New("fupisha", Options{Size: 128, Margin: &margin, Background: color.NRGBA{A: 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.SVG(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	svg := buf.String()
+	for _, want := range []string{
+		`width="128" height="128" viewBox="0 0 21 21"`,
+		`fill="#000000" fill-opacity="0.000"`,
+		`<path d="M0 0h7v1h-7z`,
+	} {
+		if !strings.Contains(svg, want) {
+			t.Fatalf("got %q want it to contain %q", svg, want)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	big := MaxMargin + 1
+
+	for _, tc := range []struct {
+		opts Options
+		want error
+	}{
+		{Options{Size: MinSize - 1}, ErrSize},
+		{Options{Size: MaxSize + 1}, ErrSize},
+		{Options{Level: "X"}, ErrLevel},
+		{Options{Margin: &big}, ErrMargin},
+		{Options{Size: MinSize, Level: H}, ErrTooSmall},
+	} {
+		if _, err := New(strings.Repeat("https://fupisha.io/", 10), tc.opts); err != tc.want {
+			t.Fatalf("%+v: got %v want %v", tc.opts, err, tc.want)
+		}
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	for s, want := range map[string]color.NRGBA{
+		"1a2b3c":   {R: 0x1a, G: 0x2b, B: 0x3c, A: 0xff},
+		"#abc":     {R: 0xaa, G: 0xbb, B: 0xcc, A: 0xff},
+		"1a2b3c80": {R: 0x1a, G: 0x2b, B: 0x3c, A: 0x80},
+	} {
+		got, err := ParseColor(s)
+		if err != nil || got != want {
+			t.Fatalf("%s: got %v, %v want %v", s, got, err, want)
+		}
+	}
+
+	for _, s := range []string{"", "red", "12345", "gggggg"} {
+		if _, err := ParseColor(s); err != ErrColor {
+			t.Fatalf("%s: got %v want %v", s, err, ErrColor)
+		}
+	}
+}
+
+func sameColor(a, b color.Color) bool {
+	return color.NRGBAModel.Convert(a) == color.NRGBAModel.Convert(b)
+}
@@ -0,0 +1,86 @@
+// Package reserved keeps the words that can never be used as a short url param because
+// fupisha serves something else under them, e.g. /auth or /ping.
+package reserved
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// defaults are reserved before any route is registered, including paths fupisha is likely to serve later.
+var defaults = []string{
+	"admin",
+	"api",
+	"auth",
+	"expand",
+	"favicon.ico",
+	"health",
+	"metrics",
+	"ping",
+	"robots.txt",
+	"static",
+	"url",
+	"v1",
+	".well-known",
+}
+
+var (
+	mu    sync.RWMutex
+	words = make(map[string]struct{})
+)
+
+func init() {
+	Register(defaults...)
+}
+
+// Register reserves the given words. Words are matched case insensitively.
+func Register(ws ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, w := range ws {
+		w = strings.ToLower(strings.Trim(w, "/"))
+		if w != "" {
+			words[w] = struct{}{}
+		}
+	}
+}
+
+// RegisterRoute reserves the first segment of a route pattern, e.g. auth for /auth/*/login.
+// Patterns starting with a url param such as /{urlParam} reserve nothing.
+func RegisterRoute(pattern string) {
+	segment := strings.TrimPrefix(pattern, "/")
+	if i := strings.Index(segment, "/"); i >= 0 {
+		segment = segment[:i]
+	}
+
+	if segment == "" || strings.ContainsAny(segment, "{*") {
+		return
+	}
+
+	Register(segment)
+}
+
+// IsReserved reports whether the word is reserved.
+func IsReserved(w string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	_, ok := words[strings.ToLower(w)]
+	return ok
+}
+
+// Words returns every reserved word in alphabetical order.
+func Words() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	ws := make([]string, 0, len(words))
+	for w := range words {
+		ws = append(ws, w)
+	}
+	sort.Strings(ws)
+
+	return ws
+}
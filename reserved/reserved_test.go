@@ -0,0 +1,43 @@
+package reserved
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReserved(t *testing.T) {
+	RegisterRoute("/docs/*/intro")
+	RegisterRoute("/{urlParam}")
+	RegisterRoute("/*")
+	Register("/Status/")
+
+	tests := []struct {
+		word string
+		want bool
+	}{
+		{word: "auth", want: true},
+		{word: "ROBOTS.TXT", want: true},
+		{word: "docs", want: true},
+		{word: "status", want: true},
+		{word: "{urlParam}", want: false},
+		{word: "summit2026", want: false},
+		{word: "", want: false},
+	}
+
+	for _, tc := range tests {
+		if got := IsReserved(tc.word); got != tc.want {
+			t.Errorf("IsReserved(%q) = %t want %t", tc.word, got, tc.want)
+		}
+	}
+
+	words := Words()
+	for i := 1; i < len(words); i++ {
+		if words[i-1] >= words[i] {
+			t.Fatalf("got unsorted words %v", words)
+		}
+	}
+
+	if !reflect.DeepEqual(words[:2], []string{".well-known", "admin"}) {
+		t.Fatalf("got %v", words[:2])
+	}
+}
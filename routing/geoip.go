@@ -0,0 +1,74 @@
+package routing
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Locator finds the country of an ip address.
+type Locator interface {
+	//Country returns the ISO 3166-1 alpha-2 code of the country of the ip address, empty if it is unknown.
+	Country(ip net.IP) string
+}
+
+// GeoIP locates ip addresses in a local MaxMind country database, e.g. GeoLite2-Country.mmdb.
+type GeoIP struct {
+	path string
+
+	mu sync.RWMutex
+	db *maxminddb.Reader
+}
+
+// OpenGeoIP reads the country database at path.
+func OpenGeoIP(path string) (*GeoIP, error) {
+	g := &GeoIP{path: path}
+
+	if err := g.Reload(); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// Reload reads the database file again, e.g. after its weekly update. The database stays as it was
+// when the file can not be read.
+func (g *GeoIP) Reload() error {
+	b, err := os.ReadFile(g.path)
+	if err != nil {
+		return fmt.Errorf("routing: geoip: %w", err)
+	}
+
+	db, err := maxminddb.FromBytes(b)
+	if err != nil {
+		return fmt.Errorf("routing: geoip %s: %w", g.path, err)
+	}
+
+	g.mu.Lock()
+	g.db = db
+	g.mu.Unlock()
+
+	return nil
+}
+
+// Country returns the ISO code of the country the database places the ip address in.
+func (g *GeoIP) Country(ip net.IP) string {
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+
+	g.mu.RLock()
+	db := g.db
+	g.mu.RUnlock()
+
+	if ip == nil || db.Lookup(ip, &record) != nil {
+		return ""
+	}
+
+	return record.Country.ISOCode
+}
@@ -0,0 +1,252 @@
+// Package routing chooses where a short url sends each visitor. The routes of a url are an ordered
+// list of rules, each naming a destination and the visitors it is for by their country, device,
+// operating system, language and the day and time of their visit. The first matching rule wins, the
+// visitors matching none are split across the weighted variants of the url when it runs an a/b test
+// and sent to its original url otherwise.
+package routing
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mileusna/useragent"
+	"github.com/nairobi-gophers/fupisha/analytics"
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+// The layouts of the dates and times of day rules are bounded by.
+const (
+	DateLayout  = "2006-01-02"
+	ClockLayout = "15:04"
+)
+
+// Weekdays are the days rules apply on, as the rules name them.
+var Weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Router evaluates the routes of urls for their visitors.
+type Router struct {
+	locator  Locator
+	location *time.Location
+
+	//zones caches the locations of the time zones the routes name, loading one reads the disk.
+	zones sync.Map
+}
+
+// New returns a router locating visitors with the locator and reading the times of the routes in the
+// location, unless they name their own time zone. Without a locator no country matches, without a
+// location times are read in UTC.
+func New(locator Locator, location *time.Location) *Router {
+	if location == nil {
+		location = time.UTC
+	}
+
+	return &Router{locator: locator, location: location}
+}
+
+// Reload reads the locator's database again when it has one, e.g. a GeoIP database after its update.
+func (rt *Router) Reload() error {
+	if r, ok := rt.locator.(interface{ Reload() error }); ok {
+		return r.Reload()
+	}
+
+	return nil
+}
+
+// Destination returns where the url sends the visitor of the request at now: the destination of the
+// first of its rules the visitor matches, otherwise the variant they are served if the url splits its
+// visitors, otherwise its original url. The variant is empty unless one was served.
+func (rt *Router) Destination(w http.ResponseWriter, r *http.Request, u store.URL, now time.Time) (destination, variant string) {
+	if !u.Routes.IsZero() {
+		v := &visitor{r: r, locator: rt.locator}
+		now = now.In(rt.zone(u.Routes.Timezone))
+
+		for _, rule := range u.Routes.Rules {
+			if v.matches(rule, now) {
+				return rule.Destination, ""
+			}
+		}
+	}
+
+	if served, ok := Pick(w, r, u); ok {
+		return served.URL, served.Name
+	}
+
+	return u.OriginalURL, ""
+}
+
+// zone returns the location of the named time zone, the router's location if there is no such zone.
+func (rt *Router) zone(name string) *time.Location {
+	if name == "" {
+		return rt.location
+	}
+
+	if loc, ok := rt.zones.Load(name); ok {
+		return loc.(*time.Location)
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return rt.location
+	}
+
+	rt.zones.Store(name, loc)
+	return loc
+}
+
+// visitor holds what the rules ask about the visitor, each worked out once and only when a rule asks.
+type visitor struct {
+	r       *http.Request
+	locator Locator
+
+	country  *string
+	ua       *useragent.UserAgent
+	language *string
+}
+
+// matches reports whether the visitor meets every condition of the rule at now, the cheap conditions
+// are checked first.
+func (v *visitor) matches(rule store.Route, now time.Time) bool {
+	if len(rule.Days) > 0 && !contains(rule.Days, Weekdays[now.Weekday()]) {
+		return false
+	}
+
+	if !within(now.Format(DateLayout), rule.StartDate, rule.EndDate, false) {
+		return false
+	}
+
+	if !within(now.Format(ClockLayout), rule.StartTime, rule.EndTime, true) {
+		return false
+	}
+
+	if len(rule.Languages) > 0 && !matchLanguage(rule.Languages, v.preferredLanguage()) {
+		return false
+	}
+
+	if len(rule.Devices) > 0 && !contains(rule.Devices, analytics.Device(v.userAgent())) {
+		return false
+	}
+
+	if len(rule.OS) > 0 && !contains(rule.OS, v.userAgent().OS) {
+		return false
+	}
+
+	if len(rule.Countries) > 0 && !contains(rule.Countries, v.countryCode()) {
+		return false
+	}
+
+	return true
+}
+
+func (v *visitor) userAgent() useragent.UserAgent {
+	if v.ua == nil {
+		ua := useragent.Parse(v.r.UserAgent())
+		v.ua = &ua
+	}
+	return *v.ua
+}
+
+func (v *visitor) countryCode() string {
+	if v.country == nil {
+		var country string
+		if v.locator != nil {
+			country = v.locator.Country(net.ParseIP(analytics.ClientIP(v.r)))
+		}
+		v.country = &country
+	}
+	return *v.country
+}
+
+func (v *visitor) preferredLanguage() string {
+	if v.language == nil {
+		language := PreferredLanguage(v.r.Header.Get("Accept-Language"))
+		v.language = &language
+	}
+	return *v.language
+}
+
+// PreferredLanguage returns the lowercase language tag the Accept-Language header weighs the most,
+// the first one on a tie, e.g. en-gb for "fr;q=0.8, en-GB". It is empty when no language is acceptable.
+func PreferredLanguage(header string) string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			var err error
+			if q, err = strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+				continue
+			}
+		}
+
+		if q > 0 {
+			tags = append(tags, weighted{tag: tag, q: q})
+		}
+	}
+
+	if len(tags) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	return tags[0].tag
+}
+
+// matchLanguage reports whether the language is one of the tags, a tag without a region matching
+// every region of its language e.g. en matches en-gb.
+func matchLanguage(tags []string, language string) bool {
+	if language == "" {
+		return false
+	}
+
+	for _, tag := range tags {
+		tag = strings.ToLower(tag)
+		if language == tag || strings.HasPrefix(language, tag+"-") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// within reports whether value falls between start and end, both optional. Dates include the end,
+// times of day exclude it and wrap past midnight when the end comes before the start.
+func within(value, start, end string, clock bool) bool {
+	switch {
+	case start == "" && end == "":
+		return true
+	case clock && start != "" && end != "" && end < start:
+		return value >= start || value < end
+	case start != "" && value < start:
+		return false
+	case end != "" && (value > end || clock && value == end):
+		return false
+	}
+
+	return true
+}
+
+// contains reports whether value is one of the values, ignoring case.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
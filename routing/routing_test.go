@@ -0,0 +1,166 @@
+package routing
+
+import (
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+const (
+	iPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 16_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.5 Mobile/15E148 Safari/604.1"
+	android = "Mozilla/5.0 (Linux; Android 13; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/115.0.0.0 Mobile Safari/537.36"
+	windows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/115.0.0.0 Safari/537.36"
+)
+
+// locator places every ip address in the country it is mapped to.
+type locator map[string]string
+
+func (l locator) Country(ip net.IP) string {
+	return l[ip.String()]
+}
+
+func TestDestination(t *testing.T) {
+	nairobi, err := time.LoadLocation("Africa/Nairobi")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt := New(locator{"41.90.1.1": "KE", "81.2.69.1": "GB"}, nairobi)
+
+	u := store.URL{
+		OriginalURL: "https://fupisha.io/default",
+		Routes: store.Routes{Rules: []store.Route{
+			{Destination: "https://fupisha.io/night", StartTime: "22:00", EndTime: "06:00"},
+			{Destination: "https://fupisha.io/ke-ios", Countries: []string{"ke"}, OS: []string{"ios"}},
+			{Destination: "https://fupisha.io/ke", Countries: []string{"KE"}},
+			{Destination: "https://fupisha.io/sw", Languages: []string{"sw"}},
+			{Destination: "https://fupisha.io/mobile", Devices: []string{"mobile"}, Days: []string{"sat", "sun"}},
+			{Destination: "https://fupisha.io/sale", StartDate: "2026-11-27", EndDate: "2026-11-30"},
+		}},
+	}
+
+	//Friday 2026-11-20 at noon in Nairobi.
+	friday := time.Date(2026, 11, 20, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		ip       string
+		ua       string
+		language string
+		now      time.Time
+		want     string
+	}{
+		{"No rule matches", "81.2.69.1", windows, "en", friday, "https://fupisha.io/default"},
+		{"Country and os", "41.90.1.1", iPhone, "", friday, "https://fupisha.io/ke-ios"},
+		{"Country", "41.90.1.1", android, "", friday, "https://fupisha.io/ke"},
+		{"Language with a region", "81.2.69.1", windows, "en;q=0.5, sw-KE", friday, "https://fupisha.io/sw"},
+		{"Less preferred language", "81.2.69.1", windows, "en, sw;q=0.5", friday, "https://fupisha.io/default"},
+		{"Device on a weekday", "81.2.69.1", android, "", friday, "https://fupisha.io/default"},
+		{"Device on a weekend", "81.2.69.1", android, "", friday.AddDate(0, 0, 1), "https://fupisha.io/mobile"},
+		{"First day of the sale", "81.2.69.1", windows, "", friday.AddDate(0, 0, 7), "https://fupisha.io/sale"},
+		{"Last day of the sale", "81.2.69.1", windows, "", friday.AddDate(0, 0, 10), "https://fupisha.io/sale"},
+		{"After the sale", "81.2.69.1", windows, "", friday.AddDate(0, 0, 11), "https://fupisha.io/default"},
+		{"Before midnight", "41.90.1.1", iPhone, "", time.Date(2026, 11, 20, 19, 0, 0, 0, time.UTC), "https://fupisha.io/night"},
+		{"After midnight", "41.90.1.1", iPhone, "", time.Date(2026, 11, 20, 2, 59, 0, 0, time.UTC), "https://fupisha.io/night"},
+		{"End of the night", "41.90.1.1", iPhone, "", time.Date(2026, 11, 20, 3, 0, 0, 0, time.UTC), "https://fupisha.io/ke-ios"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/abc", nil)
+			r.RemoteAddr = tc.ip + ":4242"
+			r.Header.Set("User-Agent", tc.ua)
+			if tc.language != "" {
+				r.Header.Set("Accept-Language", tc.language)
+			}
+
+			if got, _ := rt.Destination(httptest.NewRecorder(), r, u, tc.now); got != tc.want {
+				t.Fatalf("got %s want %s", got, tc.want)
+			}
+		})
+	}
+
+	//the time zone of the routes overrides the router's.
+	u.Routes.Timezone = "Europe/London"
+	r := httptest.NewRequest("GET", "/abc", nil)
+	if got, _ := rt.Destination(httptest.NewRecorder(), r, u, time.Date(2026, 11, 20, 21, 0, 0, 0, time.UTC)); got != "https://fupisha.io/default" {
+		t.Fatalf("got %s at 21:00 in London", got)
+	}
+
+	//without a locator no country matches.
+	r.RemoteAddr = "41.90.1.1:4242"
+	if got, _ := New(nil, nil).Destination(httptest.NewRecorder(), r, u, friday); got != "https://fupisha.io/default" {
+		t.Fatalf("got %s without a locator", got)
+	}
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                          "",
+		"*":                         "",
+		"sw":                        "sw",
+		"fr;q=0.8, en-GB":           "en-gb",
+		"fr;q=0.8, de;q=0.8":        "fr",
+		"en;q=0, sw;q=0.1":          "sw",
+		"en;q=zero, *;q=0.5, sw-KE": "sw-ke",
+	} {
+		if got := PreferredLanguage(header); got != want {
+			t.Fatalf("%q: got %q want %q", header, got, want)
+		}
+	}
+}
+
+func TestGeoIP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+
+	b, err := os.ReadFile("testdata/country.mmdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := OpenGeoIP(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for ip, want := range map[string]string{
+		"41.90.3.4":   "KE",
+		"81.2.69.160": "GB",
+		"2001:db8::1": "US",
+		"192.0.2.1":   "",
+	} {
+		if got := g.Country(net.ParseIP(ip)); got != want {
+			t.Fatalf("%s: got %q want %q", ip, got, want)
+		}
+	}
+
+	if got := g.Country(nil); got != "" {
+		t.Fatalf("got %q for no ip address", got)
+	}
+
+	//a broken update keeps the database read before.
+	if err := os.WriteFile(path, []byte("not a database"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.Reload(); err == nil {
+		t.Fatal("reloading a broken database succeeded")
+	}
+
+	if got := g.Country(net.ParseIP("41.90.3.4")); got != "KE" {
+		t.Fatalf("got %q after a failed reload", got)
+	}
+
+	if _, err := OpenGeoIP(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Fatal("opening a missing database succeeded")
+	}
+}
@@ -0,0 +1,84 @@
+package routing
+
+import (
+	"hash/fnv"
+	"net/http"
+	"time"
+
+	"github.com/nairobi-gophers/fupisha/analytics"
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+// variantCookiePrefix is followed by the short url param in the name of the cookie keeping the variant
+// a visitor was served.
+const variantCookiePrefix = "fupisha_variant_"
+
+// variantCookieTTL is how long a browser keeps the variant it was served, longer than most experiments run.
+const variantCookieTTL = 90 * 24 * time.Hour
+
+// Pick returns the variant of the url served to the visitor of the request, the one they were served
+// before while the url still has it. Other visitors are split by a hash of their ip address and user
+// agent, which keeps them on their variant when they refuse cookies too.
+func Pick(w http.ResponseWriter, r *http.Request, u store.URL) (store.Variant, bool) {
+	if len(u.Variants) == 0 {
+		return store.Variant{}, false
+	}
+
+	if c, err := r.Cookie(variantCookiePrefix + u.ShortenedURLParam); err == nil {
+		if variant, ok := u.Variants.Find(c.Value); ok {
+			return variant, true
+		}
+	}
+
+	variant := weighted(u.Variants, visitorHash(r, u))
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     variantCookiePrefix + u.ShortenedURLParam,
+		Value:    variant.Name,
+		Path:     "/" + u.ShortenedURLParam,
+		MaxAge:   int(variantCookieTTL / time.Second),
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return variant, true
+}
+
+// visitorHash hashes the visitor of the request for the url, the url is part of it so that the
+// variants of different urls are drawn independently.
+func visitorHash(r *http.Request, u store.URL) uint64 {
+	h := fnv.New64a()
+	h.Write(u.ID.Bytes())
+	h.Write([]byte(analytics.ClientIP(r)))
+	h.Write([]byte{0})
+	h.Write([]byte(r.UserAgent()))
+	return h.Sum64()
+}
+
+// weighted returns the variant the point falls on when the variants are laid out by weight.
+func weighted(variants store.Variants, point uint64) store.Variant {
+	var total uint64
+	for _, v := range variants {
+		if v.Weight > 0 {
+			total += uint64(v.Weight)
+		}
+	}
+
+	if total == 0 {
+		return variants[point%uint64(len(variants))]
+	}
+
+	point %= total
+	for _, v := range variants {
+		if v.Weight <= 0 {
+			continue
+		}
+		if point < uint64(v.Weight) {
+			return v
+		}
+		point -= uint64(v.Weight)
+	}
+
+	return variants[len(variants)-1]
+}
@@ -0,0 +1,94 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+func TestPick(t *testing.T) {
+	u := store.URL{
+		ID:                uuid.Must(uuid.NewV4()),
+		OriginalURL:       "https://fupisha.io/a",
+		ShortenedURLParam: "abcdef",
+		Variants: store.Variants{
+			{Name: "a", URL: "https://fupisha.io/a", Weight: 70},
+			{Name: "b", URL: "https://fupisha.io/b", Weight: 30},
+		},
+	}
+
+	visitor := func(i int) *http.Request {
+		r := httptest.NewRequest("GET", "/abcdef", nil)
+		r.RemoteAddr = "10.0." + strconv.Itoa(i/250) + "." + strconv.Itoa(i%250) + ":4242"
+		r.Header.Set("User-Agent", windows)
+		return r
+	}
+
+	//the visitors are split close to the weights.
+	served := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		variant, ok := Pick(httptest.NewRecorder(), visitor(i), u)
+		if !ok {
+			t.Fatal("got no variant of a split url")
+		}
+		served[variant.Name]++
+	}
+
+	if served["a"] < 6700 || served["a"] > 7300 || served["a"]+served["b"] != 10000 {
+		t.Fatalf("got %v serving 10000 visitors a 70/30 split", served)
+	}
+
+	//a visitor without a cookie gets the same variant on every visit and a cookie keeping it.
+	rr := httptest.NewRecorder()
+	first, _ := Pick(rr, visitor(42), u)
+	again, _ := Pick(httptest.NewRecorder(), visitor(42), u)
+	if first != again {
+		t.Fatalf("got %s then %s for the same visitor", first.Name, again.Name)
+	}
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != variantCookiePrefix+"abcdef" || cookies[0].Value != first.Name || cookies[0].Path != "/abcdef" {
+		t.Fatalf("got cookies %v serving %s", cookies, first.Name)
+	}
+
+	//the cookie keeps the variant when the visitor's address changes.
+	other := "a"
+	if first.Name == "a" {
+		other = "b"
+	}
+
+	r := visitor(42)
+	r.AddCookie(&http.Cookie{Name: variantCookiePrefix + "abcdef", Value: other})
+	rr = httptest.NewRecorder()
+	if variant, _ := Pick(rr, r, u); variant.Name != other || len(rr.Result().Cookies()) != 0 {
+		t.Fatalf("got %s and cookies %v for a visitor served %s before", variant.Name, rr.Result().Cookies(), other)
+	}
+
+	//a variant the url no longer has is drawn again.
+	r = visitor(42)
+	r.AddCookie(&http.Cookie{Name: variantCookiePrefix + "abcdef", Value: "removed"})
+	if variant, _ := Pick(httptest.NewRecorder(), r, u); variant != first {
+		t.Fatalf("got %s for a visitor served a removed variant", variant.Name)
+	}
+
+	//routes come before the split.
+	u.Routes = store.Routes{Rules: []store.Route{{Destination: "https://fupisha.io/c", Days: Weekdays}}}
+	if destination, variant := New(nil, nil).Destination(httptest.NewRecorder(), visitor(42), u, time.Now()); destination != "https://fupisha.io/c" || variant != "" {
+		t.Fatalf("got %s %q for a routed visitor", destination, variant)
+	}
+
+	u.Routes = store.Routes{}
+	if destination, variant := New(nil, nil).Destination(httptest.NewRecorder(), visitor(42), u, time.Now()); destination != first.URL || variant != first.Name {
+		t.Fatalf("got %s %q want %s %s", destination, variant, first.URL, first.Name)
+	}
+
+	u.Variants = nil
+	if _, ok := Pick(httptest.NewRecorder(), visitor(42), u); ok {
+		t.Fatal("got a variant of a url without variants")
+	}
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// AppLinks open a url in its mobile apps, the visitors of other platforms or without the app go to
+// the fallbacks.
+type AppLinks struct {
+	//IOS and Android are the deep links opening the apps, a custom scheme e.g. acme://product/7 or
+	//a universal or app link e.g. https://acme.com/product/7.
+	IOS     string `json:"ios,omitempty"`
+	Android string `json:"android,omitempty"`
+	//IOSStore and AndroidStore are where visitors without the app go, e.g. its App Store or Play Store page.
+	IOSStore     string `json:"ios_store,omitempty"`
+	AndroidStore string `json:"android_store,omitempty"`
+	//Desktop is where desktop visitors go instead of the url.
+	Desktop string `json:"desktop,omitempty"`
+}
+
+// IsZero reports whether no app link is set.
+func (a AppLinks) IsZero() bool {
+	return a == AppLinks{}
+}
+
+// Value implements the driver.Valuer interface.
+func (a AppLinks) Value() (driver.Value, error) {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (a *AppLinks) Scan(src interface{}) error {
+	var b []byte
+
+	switch v := src.(type) {
+	case nil:
+		*a = AppLinks{}
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("store: cannot scan %T into app links", src)
+	}
+
+	var links AppLinks
+	if err := json.Unmarshal(b, &links); err != nil {
+		return err
+	}
+
+	*a = links
+
+	return nil
+}
@@ -0,0 +1,218 @@
+// Package cache provides an in-process cache in front of a fupisha store so that resolving
+// a short url does not have to hit the database on every redirect.
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+// compilation check for store.Store concrete implementation.
+var _ store.Store = (*Store)(nil)
+
+// Config declares the cache size and freshness.
+type Config struct {
+	//Size most urls held in memory.
+	Size int
+	//TTL longest a url is served from memory before it is read again, zero keeps it until evicted.
+	TTL time.Duration
+}
+
+// loadTimeout bounds a database read shared by concurrent misses, it does not end with the request that started it.
+const loadTimeout = 5 * time.Second
+
+// DefaultStatsInterval is how often LogStats logs the counters unless told otherwise.
+const DefaultStatsInterval = 5 * time.Minute
+
+// Stats are the cache counters since the store was created.
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+	Size   int
+}
+
+// Store caches url lookups by param and passes everything else through to the wrapped store.
+// The cached visit count of a url may lag behind the database by up to the TTL.
+type Store struct {
+	store.Store
+
+	mu  sync.Mutex
+	lru *lru
+	//epoch changes on every invalidation so a lookup started before it never caches what it read.
+	epoch uint64
+
+	group  singleflight.Group
+	hits   uint64
+	misses uint64
+
+	now func() time.Time
+}
+
+// NewStore wraps s with a cache of the given configuration.
+func NewStore(s store.Store, cfg *Config) *Store {
+	return &Store{
+		Store: s,
+		lru:   newLRU(cfg.Size, cfg.TTL),
+		now:   time.Now,
+	}
+}
+
+// GetURLByParam retrieves the short url by its given param on the default short domain, from memory
+// when possible.
+func (s *Store) GetURLByParam(ctx context.Context, param string) (store.URL, error) {
+	return s.GetDomainURLByParam(ctx, "", param)
+}
+
+// GetDomainURLByParam retrieves the short url by its given param on the given short domain, from memory
+// when possible. Concurrent misses for the same param share a single database read, a caller that gives
+// up waiting on it does not cancel it for the others.
+func (s *Store) GetDomainURLByParam(ctx context.Context, domain, param string) (store.URL, error) {
+	key := cacheKey(domain, param)
+
+	s.mu.Lock()
+	url, ok := s.lru.get(key, s.now())
+	epoch := s.epoch
+	s.mu.Unlock()
+
+	if ok {
+		atomic.AddUint64(&s.hits, 1)
+		return url, nil
+	}
+
+	atomic.AddUint64(&s.misses, 1)
+
+	ch := s.group.DoChan(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+
+		url, err := s.Store.GetDomainURLByParam(ctx, domain, param)
+		if err != nil {
+			return store.URL{}, err
+		}
+
+		s.mu.Lock()
+		if s.epoch == epoch {
+			s.lru.add(key, url, s.now())
+		}
+		s.mu.Unlock()
+
+		return url, nil
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return store.URL{}, res.Err
+		}
+		return res.Val.(store.URL), nil
+	case <-ctx.Done():
+		return store.URL{}, ctx.Err()
+	}
+}
+
+// Invalidate drops the url cached under param on the default short domain.
+func (s *Store) Invalidate(param string) {
+	s.InvalidateDomain("", param)
+}
+
+// InvalidateDomain drops the url cached under param on the given short domain, it must be called
+// whenever a url is changed or deleted.
+func (s *Store) InvalidateDomain(domain, param string) {
+	key := cacheKey(domain, param)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.epoch++
+	s.lru.remove(key)
+	//a lookup already in flight read the url before the change, make the next one read it again.
+	s.group.Forget(key)
+}
+
+// cacheKey is what a url is cached under, params are only unique per short domain. Neither a host
+// nor a param holds a slash.
+func cacheKey(domain, param string) string {
+	return domain + "/" + param
+}
+
+// UpdateURL updates the url and drops it from the cache under its old and new param.
+func (s *Store) UpdateURL(ctx context.Context, url store.URL) (store.URL, error) {
+	old, err := s.Store.GetURLByID(ctx, url.ID)
+	if err != nil {
+		return store.URL{}, err
+	}
+
+	updated, err := s.Store.UpdateURL(ctx, url)
+	s.InvalidateDomain(old.ShortDomain, old.ShortenedURLParam)
+	s.InvalidateDomain(old.ShortDomain, url.ShortenedURLParam)
+
+	return updated, err
+}
+
+// DeleteURL deletes the url and drops it from the cache.
+func (s *Store) DeleteURL(ctx context.Context, id uuid.UUID) error {
+	return s.invalidateByID(ctx, id, s.Store.DeleteURL)
+}
+
+// RestoreURL restores the url and drops it from the cache.
+func (s *Store) RestoreURL(ctx context.Context, id uuid.UUID) error {
+	return s.invalidateByID(ctx, id, s.Store.RestoreURL)
+}
+
+// invalidateByID runs the change on the url and invalidates its param afterwards.
+func (s *Store) invalidateByID(ctx context.Context, id uuid.UUID, change func(context.Context, uuid.UUID) error) error {
+	url, err := s.Store.GetURLByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = change(ctx, id)
+	s.InvalidateDomain(url.ShortDomain, url.ShortenedURLParam)
+
+	return err
+}
+
+// Stats returns the hit and miss counters and the number of cached urls.
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	size := s.lru.len()
+	s.mu.Unlock()
+
+	return Stats{
+		Hits:   atomic.LoadUint64(&s.hits),
+		Misses: atomic.LoadUint64(&s.misses),
+		Size:   size,
+	}
+}
+
+// LogStats logs the counters every interval, DefaultStatsInterval if it is not positive, until ctx is
+// done. The hit rate tells whether the cache is worth its size.
+func (s *Store) LogStats(ctx context.Context, logger logrus.FieldLogger, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultStatsInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			stats := s.Stats()
+			logger.WithFields(logrus.Fields{
+				"hits":   stats.Hits,
+				"misses": stats.Misses,
+				"size":   stats.Size,
+			}).Info("short url cache stats")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/nairobi-gophers/fupisha/store/memory"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+// countingStore counts the param lookups that reach the database.
+type countingStore struct {
+	store.Store
+	lookups int64
+	//gate when set holds every lookup until it is closed.
+	gate chan struct{}
+}
+
+func (c *countingStore) GetDomainURLByParam(ctx context.Context, domain, param string) (store.URL, error) {
+	atomic.AddInt64(&c.lookups, 1)
+	if c.gate != nil {
+		<-c.gate
+	}
+	//the memory store does not look at the context, a database would fail the lookup.
+	if err := ctx.Err(); err != nil {
+		return store.URL{}, err
+	}
+	return c.Store.GetDomainURLByParam(ctx, domain, param)
+}
+
+func newTestStore(t *testing.T, cfg *Config, params ...string) (*Store, *countingStore) {
+	ctx := context.Background()
+
+	m := memory.NewStore()
+
+	u, err := m.NewUser(ctx, "test_user@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	for _, param := range params {
+		if _, err := m.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://fupisha.io/" + param, ShortenedURLParam: param, Dedup: true}); err != nil {
+			t.Fatalf("failed to create url: %s", err)
+		}
+	}
+
+	db := &countingStore{Store: m}
+
+	return NewStore(db, cfg), db
+}
+
+func TestStore(t *testing.T) {
+	s, db := newTestStore(t, &Config{Size: 2, TTL: time.Minute}, "aaaaaa", "bbbbbb", "cccccc")
+
+	ctx := context.Background()
+
+	lookup := func(param string) {
+		t.Helper()
+		url, err := s.GetURLByParam(ctx, param)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if url.ShortenedURLParam != param {
+			t.Fatalf("got param %s want %s", url.ShortenedURLParam, param)
+		}
+	}
+
+	lookup("aaaaaa")
+	lookup("aaaaaa")
+	lookup("bbbbbb")
+
+	if got := s.Stats(); got != (Stats{Hits: 1, Misses: 2, Size: 2}) {
+		t.Fatalf("got %+v", got)
+	}
+
+	//aaaaaa was used more recently than bbbbbb, so bbbbbb makes room for cccccc.
+	lookup("aaaaaa")
+	lookup("cccccc")
+	lookup("aaaaaa")
+	lookup("bbbbbb")
+
+	if db.lookups != 4 {
+		t.Fatalf("got %d database lookups want 4", db.lookups)
+	}
+
+	s.Invalidate("bbbbbb")
+	lookup("bbbbbb")
+
+	if db.lookups != 5 {
+		t.Fatalf("got %d database lookups after invalidation want 5", db.lookups)
+	}
+
+	if _, err := s.GetURLByParam(ctx, "zzzzzz"); err == nil {
+		t.Fatal("want an error for a missing param")
+	}
+
+	if s.Stats().Size != 2 {
+		t.Fatal("want missing params left out of the cache")
+	}
+}
+
+func TestLogStats(t *testing.T) {
+	s, _ := newTestStore(t, &Config{Size: 2, TTL: time.Minute}, "aaaaaa")
+
+	if _, err := s.GetURLByParam(context.Background(), "aaaaaa"); err != nil {
+		t.Fatal(err)
+	}
+
+	logger, hook := logtest.NewNullLogger()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.LogStats(ctx, logger, time.Millisecond)
+		close(done)
+	}()
+
+	for deadline := time.Now().Add(time.Second); hook.LastEntry() == nil; {
+		if time.Now().After(deadline) {
+			t.Fatal("want the counters logged")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	entry := hook.LastEntry()
+	if entry.Level != logrus.InfoLevel || entry.Data["misses"] != uint64(1) || entry.Data["size"] != 1 {
+		t.Fatalf("got %s %v want the counters", entry.Message, entry.Data)
+	}
+}
+
+func TestStoreTTL(t *testing.T) {
+	s, db := newTestStore(t, &Config{Size: 10, TTL: time.Minute}, "aaaaaa")
+
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	ctx := context.Background()
+
+	for _, advance := range []time.Duration{0, 59 * time.Second, time.Second} {
+		now = now.Add(advance)
+		if _, err := s.GetURLByParam(ctx, "aaaaaa"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if db.lookups != 2 {
+		t.Fatalf("got %d database lookups want 2", db.lookups)
+	}
+}
+
+func TestStoreCoalescesMisses(t *testing.T) {
+	s, db := newTestStore(t, &Config{Size: 10}, "aaaaaa")
+	db.gate = make(chan struct{})
+
+	ctx := context.Background()
+
+	const callers = 16
+
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.GetURLByParam(ctx, "aaaaaa")
+			errs <- err
+		}()
+	}
+
+	//let every caller miss before the single lookup returns.
+	for atomic.LoadUint64(&s.misses) < callers {
+		time.Sleep(time.Millisecond)
+	}
+	close(db.gate)
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if db.lookups != 1 {
+		t.Fatalf("got %d database lookups want 1", db.lookups)
+	}
+}
+
+func TestStoreSharedLookupOutlivesCaller(t *testing.T) {
+	s, db := newTestStore(t, &Config{Size: 10}, "aaaaaa")
+	db.gate = make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	first := make(chan error, 1)
+	go func() {
+		_, err := s.GetURLByParam(ctx, "aaaaaa")
+		first <- err
+	}()
+
+	for atomic.LoadInt64(&db.lookups) < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	second := make(chan error, 1)
+	go func() {
+		_, err := s.GetURLByParam(context.Background(), "aaaaaa")
+		second <- err
+	}()
+
+	for atomic.LoadUint64(&s.misses) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	//the caller that started the lookup gives up, the other one still gets the url.
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Fatalf("got %v want %v for the caller that gave up", err, context.Canceled)
+	}
+
+	close(db.gate)
+	if err := <-second; err != nil {
+		t.Fatalf("got %v want the url for the caller still waiting", err)
+	}
+
+	if db.lookups != 1 {
+		t.Fatalf("got %d database lookups want 1", db.lookups)
+	}
+}
+
+func TestStoreInvalidatesChanges(t *testing.T) {
+	s, db := newTestStore(t, &Config{Size: 10}, "aaaaaa")
+
+	ctx := context.Background()
+
+	url, err := s.GetURLByParam(ctx, "aaaaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url.OriginalURL = "https://fupisha.io/changed"
+	if _, err := s.UpdateURL(ctx, url); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.GetURLByParam(ctx, "aaaaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.OriginalURL != url.OriginalURL {
+		t.Fatalf("got %s want the updated url", got.OriginalURL)
+	}
+
+	if err := s.DeleteURL(ctx, url.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetURLByParam(ctx, "aaaaaa"); err == nil {
+		t.Fatal("want a deleted url gone from the cache")
+	}
+
+	if db.lookups != 3 {
+		t.Fatalf("got %d database lookups want 3", db.lookups)
+	}
+}
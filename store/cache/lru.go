@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"container/list"
+	"time"
+
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+// entry is a cached url and the time it stops being served.
+type entry struct {
+	param   string
+	url     store.URL
+	expires time.Time
+}
+
+// lru is a size bounded, least recently used set of urls keyed by their param.
+// It is not safe for concurrent use.
+type lru struct {
+	size  int
+	ttl   time.Duration
+	order *list.List
+	items map[string]*list.Element
+}
+
+func newLRU(size int, ttl time.Duration) *lru {
+	return &lru{
+		size:  size,
+		ttl:   ttl,
+		order: list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+// get returns the url cached under param if it has not expired.
+func (c *lru) get(param string, now time.Time) (store.URL, bool) {
+	el, ok := c.items[param]
+	if !ok {
+		return store.URL{}, false
+	}
+
+	e := el.Value.(*entry)
+	if c.ttl > 0 && !now.Before(e.expires) {
+		c.remove(param)
+		return store.URL{}, false
+	}
+
+	c.order.MoveToFront(el)
+
+	return e.url, true
+}
+
+// add caches url under param, evicting the least recently used url when full.
+func (c *lru) add(param string, url store.URL, now time.Time) {
+	if el, ok := c.items[param]; ok {
+		e := el.Value.(*entry)
+		e.url = url
+		e.expires = now.Add(c.ttl)
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[param] = c.order.PushFront(&entry{param: param, url: url, expires: now.Add(c.ttl)})
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry).param)
+	}
+}
+
+// remove drops the url cached under param.
+func (c *lru) remove(param string) {
+	if el, ok := c.items[param]; ok {
+		c.order.Remove(el)
+		delete(c.items, param)
+	}
+}
+
+func (c *lru) len() int {
+	return c.order.Len()
+}
@@ -0,0 +1,41 @@
+package store
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Click is a single visit to a shortened url.
+type Click struct {
+	ID        uuid.UUID `db:"id"`
+	URLID     uuid.UUID `db:"url_id"`
+	Referrer  string    `db:"referrer"`
+	UserAgent string    `db:"user_agent"`
+	Browser   string    `db:"browser"`
+	OS        string    `db:"os"`
+	//Device is the visitor's device class i.e. desktop, mobile, tablet or bot.
+	Device string `db:"device"`
+	IP     string `db:"ip"`
+	//Variant names the variant of an a/b split url the visitor was served, empty if there was none.
+	Variant   string    `db:"variant"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// ClickCursor is the position of the last click of a page, the next page starts after it.
+type ClickCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// ClickFilter selects the clicks of a url FindClicks returns, the zero value of a field does not filter.
+type ClickFilter struct {
+	URLID uuid.UUID
+	//CreatedAfter and CreatedBefore bound the click time, inclusive and exclusive respectively.
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	//After continues the listing past the given click.
+	After *ClickCursor
+	//Limit most clicks returned, zero returns them all.
+	Limit int
+}
@@ -0,0 +1,32 @@
+package store
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Domain is a custom short domain of a user e.g. go.acme.com, the links shortened on it redirect
+// from it instead of from fupisha's own short domain.
+type Domain struct {
+	ID    uuid.UUID `db:"id"`
+	Owner uuid.UUID `db:"owner"`
+	//Host is the lowercase host name of the domain, unique across users.
+	Host string `db:"host"`
+	//Token is what the TXT record proving the owner controls the domain has to carry.
+	Token uuid.UUID `db:"token"`
+	//VerifiedAt is set once the TXT record was found, nil while the domain is unverified.
+	VerifiedAt *time.Time `db:"verified_at"`
+	//RootURL visitors of the domain itself are sent to, empty to answer 404.
+	RootURL string `db:"root_url"`
+	//NotFoundURL visitors of a param the domain has no link for are sent to, empty to answer 404.
+	NotFoundURL string    `db:"not_found_url"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
+// Verified reports whether the owner proved they control the domain, links are only shortened
+// on and redirected from verified domains.
+func (d Domain) Verified() bool {
+	return d.VerifiedAt != nil
+}
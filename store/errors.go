@@ -0,0 +1,68 @@
+package store
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+// ErrClickLimit is returned recording a click on a url that has used up its max clicks.
+var ErrClickLimit = errors.New("url has reached its click limit")
+
+// ErrDomainInUse is returned deleting a domain that urls of its owner, deleted ones included, are shortened on.
+var ErrDomainInUse = errors.New("domain still has urls")
+
+// ErrUnverifiedDomain is returned creating a url on a short domain that is not one of its owner's verified domains.
+var ErrUnverifiedDomain = errors.New("short domain is not verified by the url's owner")
+
+// BatchError is returned by a batch write that was rolled back, it names the item that failed it.
+type BatchError struct {
+	//Index of the failed item in the batch.
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return "batch item " + strconv.Itoa(e.Index) + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error of the failed item.
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// The constraint names postgresql reports for the fupisha schema. Every other
+// backend reports its constraint violations under these same names so that
+// handlers can not tell the backends apart.
+const (
+	UniqueUserEmail       = "users_email_key"
+	UniqueURLLongStr      = "urls_owner_canonical_url_key"
+	UniqueURLParam        = "urls_short_url_param_idx"
+	ForeignURLOwner       = "urls_owner_fkey"
+	ForeignClickURL       = "clicks_url_id_fkey"
+	ForeignUTMPresetOwner = "utm_presets_owner_fkey"
+	UniqueDomainHost      = "domains_host_key"
+	UniqueDomainOwnerHost = "domains_owner_host_key"
+	ForeignDomainOwner    = "domains_owner_fkey"
+)
+
+// UniqueViolation returns the same error postgresql returns when a write violates the given unique constraint.
+func UniqueViolation(constraint string) error {
+	return &pq.Error{
+		Severity:   "ERROR",
+		Code:       pq.ErrorCode("23505"),
+		Message:    `duplicate key value violates unique constraint "` + constraint + `"`,
+		Constraint: constraint,
+	}
+}
+
+// ForeignKeyViolation returns the same error postgresql returns when a write violates the given foreign key constraint.
+func ForeignKeyViolation(constraint string) error {
+	return &pq.Error{
+		Severity:   "ERROR",
+		Code:       pq.ErrorCode("23503"),
+		Message:    `insert or update violates foreign key constraint "` + constraint + `"`,
+		Constraint: constraint,
+	}
+}
@@ -0,0 +1,167 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/nairobi-gophers/fupisha/encoding"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/pkg/errors"
+)
+
+type clickStore struct {
+	db *database
+}
+
+// NewClick records a url visit and increments the url's visit count.
+func (c *clickStore) NewClick(ctx context.Context, click store.Click) (store.Click, error) {
+	click.ID = encoding.GenUniqueID()
+	if click.CreatedAt.IsZero() {
+		click.CreatedAt = time.Now()
+	}
+	click.CreatedAt = click.CreatedAt.UTC().Round(time.Microsecond)
+
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	url, ok := c.db.urls[click.URLID]
+	if !ok {
+		return store.Click{}, errors.Wrap(store.ForeignKeyViolation(store.ForeignClickURL), "inserting new click")
+	}
+
+	//never mutate the count in place, earlier copies of the url handed to callers share the pointer.
+	count := 1
+	if url.VisitCount != nil {
+		count += *url.VisitCount
+	}
+
+	if url.MaxClicks != nil && count > *url.MaxClicks {
+		return store.Click{}, errors.Wrap(store.ErrClickLimit, "inserting new click")
+	}
+
+	url.VisitCount = &count
+
+	c.db.urls[url.ID] = url
+	c.db.clicks[url.ID] = append(c.db.clicks[url.ID], click)
+
+	return click, nil
+}
+
+// GetClicksByURL retrieves the clicks of the url with the given id, oldest first.
+func (c *clickStore) GetClicksByURL(ctx context.Context, urlID uuid.UUID) ([]store.Click, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	clicks := make([]store.Click, len(c.db.clicks[urlID]))
+	copy(clicks, c.db.clicks[urlID])
+
+	return clicks, nil
+}
+
+// FindClicks retrieves a page of the url's clicks matching the filter, oldest first.
+func (c *clickStore) FindClicks(ctx context.Context, filter store.ClickFilter) ([]store.Click, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	clicks := []store.Click{}
+	for _, click := range c.db.clicks[filter.URLID] {
+		if filter.CreatedAfter != nil && click.CreatedAt.Before(*filter.CreatedAfter) {
+			continue
+		}
+
+		if filter.CreatedBefore != nil && !click.CreatedAt.Before(*filter.CreatedBefore) {
+			continue
+		}
+
+		if after := filter.After; after != nil {
+			if click.CreatedAt.Before(after.CreatedAt) || (click.CreatedAt.Equal(after.CreatedAt) && click.ID.String() <= after.ID.String()) {
+				continue
+			}
+		}
+
+		clicks = append(clicks, click)
+	}
+
+	//oldest first like the sql stores, clicks are not always recorded in the order they happened.
+	sort.Slice(clicks, func(i, j int) bool {
+		if !clicks[i].CreatedAt.Equal(clicks[j].CreatedAt) {
+			return clicks[i].CreatedAt.Before(clicks[j].CreatedAt)
+		}
+		return clicks[i].ID.String() < clicks[j].ID.String()
+	})
+
+	if filter.Limit > 0 && len(clicks) > filter.Limit {
+		clicks = clicks[:filter.Limit]
+	}
+
+	return clicks, nil
+}
+
+// VariantStats counts the clicks on the url per variant served, most clicked first. Clicks served no variant are left out.
+func (c *clickStore) VariantStats(ctx context.Context, urlID uuid.UUID) ([]store.VariantStats, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, click := range c.db.clicks[urlID] {
+		if click.Variant != "" {
+			counts[click.Variant]++
+		}
+	}
+
+	stats := []store.VariantStats{}
+	for variant, clicks := range counts {
+		stats = append(stats, store.VariantStats{Variant: variant, Clicks: clicks})
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Clicks != stats[j].Clicks {
+			return stats[i].Clicks > stats[j].Clicks
+		}
+		return stats[i].Variant < stats[j].Variant
+	})
+
+	return stats, nil
+}
+
+// NewClicks records a batch of url visits and increments the visit counts of their urls.
+// Either every click is recorded or none is.
+func (c *clickStore) NewClicks(ctx context.Context, clicks []store.Click) error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	visits := make(map[uuid.UUID]int)
+
+	for _, click := range clicks {
+		if _, ok := c.db.urls[click.URLID]; !ok {
+			return errors.Wrap(store.ForeignKeyViolation(store.ForeignClickURL), "inserting clicks")
+		}
+		visits[click.URLID]++
+	}
+
+	for _, click := range clicks {
+		click.ID = encoding.GenUniqueID()
+		if click.CreatedAt.IsZero() {
+			click.CreatedAt = time.Now()
+		}
+		click.CreatedAt = click.CreatedAt.UTC().Round(time.Microsecond)
+
+		c.db.clicks[click.URLID] = append(c.db.clicks[click.URLID], click)
+	}
+
+	for id, n := range visits {
+		url := c.db.urls[id]
+
+		count := n
+		if url.VisitCount != nil {
+			count += *url.VisitCount
+		}
+		url.VisitCount = &count
+
+		c.db.urls[id] = url
+	}
+
+	return nil
+}
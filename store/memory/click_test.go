@@ -0,0 +1,298 @@
+package memory
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/lib/pq"
+	"github.com/nairobi-gophers/fupisha/encoding"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/pkg/errors"
+)
+
+func TestClick(t *testing.T) {
+	s := NewStore()
+
+	ctx := context.Background()
+
+	u, err := s.NewUser(ctx, "test_user@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	url, err := s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://fupisha.io/a", ShortenedURLParam: "abcdef", Dedup: true})
+	if err != nil {
+		t.Fatalf("failed to create url: %s", err)
+	}
+
+	want := []store.Click{
+		{
+			URLID:     url.ID,
+			Referrer:  "https://twitter.com/",
+			UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 14_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.1.1 Mobile/15E148 Safari/604.1",
+			Browser:   "Safari",
+			OS:        "iOS",
+			Device:    "mobile",
+			IP:        "41.90.64.10",
+			CreatedAt: time.Now().Add(-time.Minute),
+		},
+		{
+			URLID:     url.ID,
+			UserAgent: "curl/7.68.0",
+			Device:    "bot",
+			IP:        "2001:db8::1",
+		},
+	}
+
+	for i, c := range want {
+		click, err := s.NewClick(ctx, c)
+		if err != nil {
+			t.Fatalf("failed to create click: %s", err)
+		}
+		want[i] = click
+	}
+
+	got, err := s.GetClicksByURL(ctx, url.ID)
+	if err != nil {
+		t.Fatalf("failed to retrieve clicks: %s", err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d clicks want %d", len(got), len(want))
+	}
+
+	for i := range want {
+		if got[i].ID != want[i].ID || got[i].Browser != want[i].Browser || got[i].IP != want[i].IP || !got[i].CreatedAt.Equal(want[i].CreatedAt) {
+			t.Fatalf("got %+v\n want %+v\n", got[i], want[i])
+		}
+	}
+
+	url, err = s.GetURLByID(ctx, url.ID)
+	if err != nil {
+		t.Fatalf("failed to retrieve url: %s", err)
+	}
+
+	if url.VisitCount == nil || *url.VisitCount != len(want) {
+		t.Fatalf("got visit count %v want %d", url.VisitCount, len(want))
+	}
+
+	_, err = s.NewClick(ctx, store.Click{URLID: encoding.GenUniqueID()})
+	pqErr, ok := errors.Cause(err).(*pq.Error)
+	if !ok || pqErr.Code != pq.ErrorCode("23503") {
+		t.Fatalf("got %v want a foreign key violation", err)
+	}
+}
+
+func TestClicks(t *testing.T) {
+	s := NewStore()
+
+	ctx := context.Background()
+
+	u, err := s.NewUser(ctx, "test_user@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	a, err := s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://fupisha.io/a", ShortenedURLParam: "abcdef", Dedup: true})
+	if err != nil {
+		t.Fatalf("failed to create url: %s", err)
+	}
+
+	b, err := s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://fupisha.io/b", ShortenedURLParam: "ghijkl", Dedup: true})
+	if err != nil {
+		t.Fatalf("failed to create url: %s", err)
+	}
+
+	//enough clicks to span more than one multi-row insert.
+	var clicks []store.Click
+	for i := 0; i < 1200; i++ {
+		id := a.ID
+		if i%3 == 0 {
+			id = b.ID
+		}
+		clicks = append(clicks, store.Click{URLID: id, UserAgent: "curl/7.68.0", Device: "bot", IP: "127.0.0.1"})
+	}
+
+	if err := s.NewClicks(ctx, clicks); err != nil {
+		t.Fatalf("failed to create clicks: %s", err)
+	}
+
+	for id, want := range map[uuid.UUID]int{a.ID: 800, b.ID: 400} {
+		got, err := s.GetClicksByURL(ctx, id)
+		if err != nil {
+			t.Fatalf("failed to retrieve clicks: %s", err)
+		}
+
+		if len(got) != want {
+			t.Fatalf("got %d clicks want %d", len(got), want)
+		}
+
+		url, err := s.GetURLByID(ctx, id)
+		if err != nil {
+			t.Fatalf("failed to retrieve url: %s", err)
+		}
+
+		if url.VisitCount == nil || *url.VisitCount != want {
+			t.Fatalf("got visit count %v want %d", url.VisitCount, want)
+		}
+	}
+
+	//a click on a missing url rolls back the whole batch.
+	err = s.NewClicks(ctx, []store.Click{{URLID: a.ID}, {URLID: encoding.GenUniqueID()}})
+	pqErr, ok := errors.Cause(err).(*pq.Error)
+	if !ok || pqErr.Code != pq.ErrorCode("23503") {
+		t.Fatalf("got %v want a foreign key violation", err)
+	}
+
+	got, err := s.GetClicksByURL(ctx, a.ID)
+	if err != nil {
+		t.Fatalf("failed to retrieve clicks: %s", err)
+	}
+
+	if len(got) != 800 {
+		t.Fatalf("got %d clicks want 800 after a failed batch", len(got))
+	}
+}
+
+func TestVariantStats(t *testing.T) {
+	s := NewStore()
+
+	ctx := context.Background()
+
+	u, err := s.NewUser(ctx, "test_user@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	variants := store.Variants{
+		{Name: "a", URL: "https://fupisha.io/a", Weight: 70},
+		{Name: "b", URL: "https://fupisha.io/b", Weight: 30},
+	}
+
+	url, err := s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://fupisha.io/a", ShortenedURLParam: "abcdef", Variants: variants})
+	if err != nil {
+		t.Fatalf("failed to create url: %s", err)
+	}
+
+	got, err := s.GetURLByParam(ctx, "abcdef")
+	if err != nil {
+		t.Fatalf("failed to retrieve url: %s", err)
+	}
+
+	if !reflect.DeepEqual(got.Variants, variants) {
+		t.Fatalf("got variants %+v want %+v", got.Variants, variants)
+	}
+
+	if _, err := s.NewClick(ctx, store.Click{URLID: url.ID, Variant: "b"}); err != nil {
+		t.Fatalf("failed to record click: %s", err)
+	}
+
+	if err := s.NewClicks(ctx, []store.Click{{URLID: url.ID, Variant: "a"}, {URLID: url.ID, Variant: "b"}, {URLID: url.ID}}); err != nil {
+		t.Fatalf("failed to record clicks: %s", err)
+	}
+
+	stats, err := s.VariantStats(ctx, url.ID)
+	if err != nil {
+		t.Fatalf("failed to count clicks per variant: %s", err)
+	}
+
+	if want := []store.VariantStats{{Variant: "b", Clicks: 2}, {Variant: "a", Clicks: 1}}; !reflect.DeepEqual(stats, want) {
+		t.Fatalf("got %+v want %+v", stats, want)
+	}
+
+	url.Variants = nil
+	if _, err := s.UpdateURL(ctx, url); err != nil {
+		t.Fatalf("failed to update url: %s", err)
+	}
+
+	if got, err = s.GetURLByParam(ctx, "abcdef"); err != nil || got.Variants != nil {
+		t.Fatalf("got variants %+v, %v after removing them", got.Variants, err)
+	}
+}
+
+func TestFindClicks(t *testing.T) {
+	s := NewStore()
+
+	ctx := context.Background()
+
+	u, err := s.NewUser(ctx, "test_user@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	url, err := s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://fupisha.io/a", ShortenedURLParam: "abcdef", Dedup: true})
+	if err != nil {
+		t.Fatalf("failed to create url: %s", err)
+	}
+
+	//recorded out of order, with two clicks sharing a time so that pages have to break the tie by id.
+	base := time.Now().Add(-time.Hour).UTC().Round(time.Second)
+	minutes := []int{3, 0, 4, 1, 1, 2}
+
+	var clicks []store.Click
+	for _, m := range minutes {
+		clicks = append(clicks, store.Click{URLID: url.ID, IP: "127.0.0.1", CreatedAt: base.Add(time.Duration(m) * time.Minute)})
+	}
+
+	if err := s.NewClicks(ctx, clicks); err != nil {
+		t.Fatalf("failed to create clicks: %s", err)
+	}
+
+	filter := store.ClickFilter{URLID: url.ID, Limit: 2}
+
+	var got []store.Click
+	for {
+		page, err := s.FindClicks(ctx, filter)
+		if err != nil {
+			t.Fatalf("failed to find clicks: %s", err)
+		}
+
+		got = append(got, page...)
+
+		if len(page) < filter.Limit {
+			break
+		}
+
+		last := page[len(page)-1]
+		filter.After = &store.ClickCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	if len(got) != len(minutes) {
+		t.Fatalf("got %d clicks want %d", len(got), len(minutes))
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	for i, c := range got {
+		if seen[c.ID] {
+			t.Fatalf("got click %s twice", c.ID)
+		}
+		seen[c.ID] = true
+
+		if i > 0 && c.CreatedAt.Before(got[i-1].CreatedAt) {
+			t.Fatalf("got click at %s after one at %s want oldest first", c.CreatedAt, got[i-1].CreatedAt)
+		}
+	}
+
+	from, to := base.Add(time.Minute), base.Add(3*time.Minute)
+
+	got, err = s.FindClicks(ctx, store.ClickFilter{URLID: url.ID, CreatedAfter: &from, CreatedBefore: &to})
+	if err != nil {
+		t.Fatalf("failed to find clicks: %s", err)
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("got %d clicks want 3 within the range", len(got))
+	}
+
+	got, err = s.FindClicks(ctx, store.ClickFilter{URLID: encoding.GenUniqueID()})
+	if err != nil {
+		t.Fatalf("failed to find clicks: %s", err)
+	}
+
+	if got == nil || len(got) != 0 {
+		t.Fatalf("got %v want no clicks", got)
+	}
+}
@@ -0,0 +1,165 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/nairobi-gophers/fupisha/encoding"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/pkg/errors"
+)
+
+type domainStore struct {
+	db *database
+}
+
+// NewDomain adds the owner's domain unverified, generating its id, token and timestamps.
+func (d *domainStore) NewDomain(ctx context.Context, domain store.Domain) (store.Domain, error) {
+	now := time.Now().UTC().Round(time.Microsecond)
+
+	domain.ID = encoding.GenUniqueID()
+	domain.Token = encoding.GenUniqueID()
+	domain.VerifiedAt = nil
+	domain.CreatedAt = now
+	domain.UpdatedAt = now
+
+	d.db.mu.Lock()
+	defer d.db.mu.Unlock()
+
+	if _, ok := d.db.users[domain.Owner]; !ok {
+		return store.Domain{}, errors.Wrap(store.ForeignKeyViolation(store.ForeignDomainOwner), "inserting new domain")
+	}
+
+	if _, ok := d.ownerDomain(domain.Owner, domain.Host); ok {
+		return store.Domain{}, errors.Wrap(store.UniqueViolation(store.UniqueDomainOwnerHost), "inserting new domain")
+	}
+
+	d.db.domains[domain.ID] = domain
+
+	return domain, nil
+}
+
+// GetDomainByID retrieves the domain by its id.
+func (d *domainStore) GetDomainByID(ctx context.Context, id uuid.UUID) (store.Domain, error) {
+	d.db.mu.RLock()
+	defer d.db.mu.RUnlock()
+
+	domain, ok := d.db.domains[id]
+	if !ok {
+		return store.Domain{}, errors.Wrap(sql.ErrNoRows, "retrieving domain by id")
+	}
+
+	return domain, nil
+}
+
+// GetDomainByHost retrieves the verified domain of the given host.
+func (d *domainStore) GetDomainByHost(ctx context.Context, host string) (store.Domain, error) {
+	d.db.mu.RLock()
+	defer d.db.mu.RUnlock()
+
+	id, ok := d.db.verifiedHosts[host]
+	if !ok {
+		return store.Domain{}, errors.Wrap(sql.ErrNoRows, "retrieving domain by host")
+	}
+
+	return d.db.domains[id], nil
+}
+
+// GetDomain retrieves the owner's domain of the given host, verified or not.
+func (d *domainStore) GetDomain(ctx context.Context, owner uuid.UUID, host string) (store.Domain, error) {
+	d.db.mu.RLock()
+	defer d.db.mu.RUnlock()
+
+	domain, ok := d.ownerDomain(owner, host)
+	if !ok {
+		return store.Domain{}, errors.Wrap(sql.ErrNoRows, "retrieving owner's domain")
+	}
+
+	return domain, nil
+}
+
+// ownerDomain looks the owner's domain of the given host up, the caller must hold the lock.
+func (d *domainStore) ownerDomain(owner uuid.UUID, host string) (store.Domain, bool) {
+	for _, domain := range d.db.domains {
+		if domain.Owner == owner && domain.Host == host {
+			return domain, true
+		}
+	}
+
+	return store.Domain{}, false
+}
+
+// GetDomainsByOwner retrieves every domain of the owner by host.
+func (d *domainStore) GetDomainsByOwner(ctx context.Context, owner uuid.UUID) ([]store.Domain, error) {
+	d.db.mu.RLock()
+	defer d.db.mu.RUnlock()
+
+	domains := []store.Domain{}
+	for _, domain := range d.db.domains {
+		if domain.Owner == owner {
+			domains = append(domains, domain)
+		}
+	}
+
+	sort.Slice(domains, func(i, j int) bool { return domains[i].Host < domains[j].Host })
+
+	return domains, nil
+}
+
+// UpdateDomain saves the verified at, root url and not found url of the given domain.
+func (d *domainStore) UpdateDomain(ctx context.Context, domain store.Domain) (store.Domain, error) {
+	d.db.mu.Lock()
+	defer d.db.mu.Unlock()
+
+	updated, ok := d.db.domains[domain.ID]
+	if !ok {
+		return store.Domain{}, errors.Wrap(sql.ErrNoRows, "updating domain")
+	}
+
+	updated.VerifiedAt = roundTime(domain.VerifiedAt)
+	updated.RootURL = domain.RootURL
+	updated.NotFoundURL = domain.NotFoundURL
+	updated.UpdatedAt = time.Now().UTC().Round(time.Microsecond)
+
+	//a host is only unique among verified domains.
+	id, ok := d.db.verifiedHosts[updated.Host]
+	if updated.Verified() && ok && id != updated.ID {
+		return store.Domain{}, errors.Wrap(store.UniqueViolation(store.UniqueDomainHost), "updating domain")
+	}
+
+	d.db.domains[domain.ID] = updated
+	if updated.Verified() {
+		d.db.verifiedHosts[updated.Host] = updated.ID
+	} else if id == updated.ID {
+		delete(d.db.verifiedHosts, updated.Host)
+	}
+
+	return updated, nil
+}
+
+// DeleteDomain removes the domain unless urls of its owner are shortened on it.
+func (d *domainStore) DeleteDomain(ctx context.Context, id uuid.UUID) error {
+	d.db.mu.Lock()
+	defer d.db.mu.Unlock()
+
+	domain, ok := d.db.domains[id]
+	if !ok {
+		return errors.Wrap(sql.ErrNoRows, "deleting domain")
+	}
+
+	for _, url := range d.db.urls {
+		if url.Owner == domain.Owner && url.ShortDomain == domain.Host {
+			return errors.Wrap(store.ErrDomainInUse, "deleting domain")
+		}
+	}
+
+	delete(d.db.domains, id)
+	if d.db.verifiedHosts[domain.Host] == id {
+		delete(d.db.verifiedHosts, domain.Host)
+	}
+
+	return nil
+}
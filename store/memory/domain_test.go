@@ -0,0 +1,151 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/lib/pq"
+	"github.com/nairobi-gophers/fupisha/encoding"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/pkg/errors"
+)
+
+func TestDomain(t *testing.T) {
+	s := NewStore()
+
+	ctx := context.Background()
+
+	u, err := s.NewUser(ctx, "test_user@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	acme, err := s.NewDomain(ctx, store.Domain{Owner: u.ID, Host: "go.acme.com", RootURL: "https://acme.com"})
+	if err != nil {
+		t.Fatalf("failed to create domain: %s", err)
+	}
+
+	if acme.ID == uuid.Nil || acme.Token == uuid.Nil || acme.Verified() {
+		t.Fatalf("got new domain %+v want an id, a token and no verification", acme)
+	}
+
+	links, err := s.NewDomain(ctx, store.Domain{Owner: u.ID, Host: "links.example"})
+	if err != nil {
+		t.Fatalf("failed to create domain: %s", err)
+	}
+
+	_, err = s.NewDomain(ctx, store.Domain{Owner: u.ID, Host: "go.acme.com"})
+	if pqErr, ok := errors.Cause(err).(*pq.Error); !ok || pqErr.Code != pq.ErrorCode("23505") || pqErr.Constraint != store.UniqueDomainOwnerHost {
+		t.Fatalf("got %v adding a domain twice want a unique violation of %s", err, store.UniqueDomainOwnerHost)
+	}
+
+	//somebody else may claim the host as long as nobody has verified it.
+	other, err := s.NewUser(ctx, "other_user@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	claim, err := s.NewDomain(ctx, store.Domain{Owner: other.ID, Host: "go.acme.com"})
+	if err != nil {
+		t.Fatalf("failed to claim an unverified host: %s", err)
+	}
+
+	if _, err := s.GetDomainByHost(ctx, "go.acme.com"); errors.Cause(err) != sql.ErrNoRows {
+		t.Fatalf("got %v retrieving an unverified host want %v", err, sql.ErrNoRows)
+	}
+
+	if got, err := s.GetDomain(ctx, other.ID, "go.acme.com"); err != nil || got.ID != claim.ID {
+		t.Fatalf("got %+v, %v retrieving the other owner's claim want %+v", got, err, claim)
+	}
+
+	verifiedAt := time.Now()
+	acme.VerifiedAt = &verifiedAt
+	acme.NotFoundURL = "https://acme.com/404"
+
+	if _, err := s.UpdateDomain(ctx, acme); err != nil {
+		t.Fatalf("failed to update domain: %s", err)
+	}
+
+	claim.VerifiedAt = &verifiedAt
+	_, err = s.UpdateDomain(ctx, claim)
+	if pqErr, ok := errors.Cause(err).(*pq.Error); !ok || pqErr.Code != pq.ErrorCode("23505") || pqErr.Constraint != store.UniqueDomainHost {
+		t.Fatalf("got %v verifying a verified host twice want a unique violation of %s", err, store.UniqueDomainHost)
+	}
+
+	got, err := s.GetDomainByHost(ctx, "go.acme.com")
+	if err != nil {
+		t.Fatalf("failed to retrieve domain: %s", err)
+	}
+
+	if got.ID != acme.ID || got.Token != acme.Token || !got.Verified() || got.RootURL != "https://acme.com" || got.NotFoundURL != "https://acme.com/404" {
+		t.Fatalf("got %+v want %+v", got, acme)
+	}
+
+	owned, err := s.GetDomainsByOwner(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("failed to retrieve domains: %s", err)
+	}
+
+	var hosts []string
+	for _, d := range owned {
+		hosts = append(hosts, d.Host)
+	}
+
+	if want := []string{"go.acme.com", "links.example"}; !reflect.DeepEqual(hosts, want) {
+		t.Fatalf("got domains %v want %v", hosts, want)
+	}
+
+	//the same param can be taken once per short domain.
+	for _, domain := range []string{"", "go.acme.com"} {
+		if _, err := s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://acme.com/" + domain, ShortenedURLParam: "launch", ShortDomain: domain}); err != nil {
+			t.Fatalf("failed to create url on %q: %s", domain, err)
+		}
+	}
+
+	_, err = s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://acme.com/again", ShortenedURLParam: "launch", ShortDomain: "go.acme.com"})
+	if pqErr, ok := errors.Cause(err).(*pq.Error); !ok || pqErr.Code != pq.ErrorCode("23505") || pqErr.Constraint != store.UniqueURLParam {
+		t.Fatalf("got %v taking a param twice on a domain want a unique violation of %s", err, store.UniqueURLParam)
+	}
+
+	if scoped, err := s.GetDomainURLByParam(ctx, "go.acme.com", "launch"); err != nil || scoped.OriginalURL != "https://acme.com/go.acme.com" {
+		t.Fatalf("got %+v, %v retrieving the url of the custom domain", scoped, err)
+	}
+
+	if def, err := s.GetURLByParam(ctx, "launch"); err != nil || def.OriginalURL != "https://acme.com/" {
+		t.Fatalf("got %+v, %v retrieving the url of the default domain", def, err)
+	}
+
+	//urls only go on their owner's verified domains.
+	for owner, domain := range map[uuid.UUID]string{u.ID: "links.example", other.ID: "go.acme.com"} {
+		_, err = s.NewURL(ctx, store.URL{Owner: owner, OriginalURL: "https://acme.com/stray", ShortenedURLParam: "stray", ShortDomain: domain})
+		if errors.Cause(err) != store.ErrUnverifiedDomain {
+			t.Fatalf("got %v creating a url on %q want %v", err, domain, store.ErrUnverifiedDomain)
+		}
+	}
+
+	if err := s.DeleteDomain(ctx, acme.ID); errors.Cause(err) != store.ErrDomainInUse {
+		t.Fatalf("got %v deleting a domain with urls want %v", err, store.ErrDomainInUse)
+	}
+
+	if err := s.DeleteDomain(ctx, links.ID); err != nil {
+		t.Fatalf("failed to delete domain: %s", err)
+	}
+
+	if _, err := s.GetDomainByID(ctx, links.ID); errors.Cause(err) != sql.ErrNoRows {
+		t.Fatalf("got %v retrieving a deleted domain want %v", err, sql.ErrNoRows)
+	}
+
+	if err := s.DeleteDomain(ctx, links.ID); errors.Cause(err) != sql.ErrNoRows {
+		t.Fatalf("got %v deleting a deleted domain want %v", err, sql.ErrNoRows)
+	}
+
+	_, err = s.NewDomain(ctx, store.Domain{Owner: encoding.GenUniqueID(), Host: "stranger.example"})
+	pqErr, ok := errors.Cause(err).(*pq.Error)
+	if !ok || pqErr.Code != pq.ErrorCode("23503") {
+		t.Fatalf("got %v want a foreign key violation", err)
+	}
+}
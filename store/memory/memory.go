@@ -0,0 +1,87 @@
+// Package memory provides an in-memory implementation of the fupisha store.
+// It holds all state in process memory and is meant for local runs and tests.
+package memory
+
+import (
+	"sync"
+
+	"github.com/gofrs/uuid"
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+// compilation check for store.Store concrete implementation.
+var _ store.Store = (*Store)(nil)
+
+// Store is an in-memory implementation of our store interface
+type Store struct {
+	*userStore
+	*urlStore
+	*clickStore
+	*utmStore
+	*domainStore
+}
+
+// NewStore creates and returns an empty in-memory store ready for use.
+func NewStore() *Store {
+	db := &database{
+		users:         make(map[uuid.UUID]store.User),
+		usersByEmail:  make(map[string]uuid.UUID),
+		usersByToken:  make(map[uuid.UUID]uuid.UUID),
+		urls:          make(map[uuid.UUID]store.URL),
+		urlsByParam:   make(map[paramKey]uuid.UUID),
+		urlsByLong:    make(map[longKey]uuid.UUID),
+		clicks:        make(map[uuid.UUID][]store.Click),
+		presets:       make(map[presetKey]store.UTMPreset),
+		domains:       make(map[uuid.UUID]store.Domain),
+		verifiedHosts: make(map[string]uuid.UUID),
+	}
+
+	return &Store{
+		&userStore{db: db},
+		&urlStore{db: db},
+		&clickStore{db: db},
+		&utmStore{db: db},
+		&domainStore{db: db},
+	}
+}
+
+// database holds the tables and indexes shared by the user and url stores.
+// Every access must hold mu.
+type database struct {
+	mu sync.RWMutex
+
+	users        map[uuid.UUID]store.User
+	usersByEmail map[string]uuid.UUID
+	usersByToken map[uuid.UUID]uuid.UUID
+
+	urls        map[uuid.UUID]store.URL
+	urlsByParam map[paramKey]uuid.UUID
+	//urlsByLong indexes the dedup urls only, other urls may share an owner and canonical url.
+	urlsByLong map[longKey]uuid.UUID
+
+	//clicks are kept per url in the order they were recorded.
+	clicks map[uuid.UUID][]store.Click
+
+	presets map[presetKey]store.UTMPreset
+
+	domains       map[uuid.UUID]store.Domain
+	verifiedHosts map[string]uuid.UUID
+}
+
+// paramKey identifies a url by its param, the param is only unique per short domain.
+type paramKey struct {
+	domain string
+	param  string
+}
+
+// longKey identifies a dedup url, the canonical url is only unique per owner.
+type longKey struct {
+	owner        uuid.UUID
+	canonicalURL string
+}
+
+// presetKey identifies a utm preset, its name is only unique per owner.
+type presetKey struct {
+	owner uuid.UUID
+	name  string
+}
@@ -0,0 +1,469 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/nairobi-gophers/fupisha/encoding"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/pkg/errors"
+)
+
+type urlStore struct {
+	db *database
+}
+
+// NewURL creates a new url record.
+func (u *urlStore) NewURL(ctx context.Context, url store.URL) (store.URL, error) {
+	if err := prepareURL(&url); err != nil {
+		return store.URL{}, err
+	}
+
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	if err := u.insert(url); err != nil {
+		return store.URL{}, errors.Wrap(err, "inserting new url")
+	}
+
+	return url, nil
+}
+
+// NewURLs creates the url records all at once, a url that can not be created leaves the store as it was.
+func (u *urlStore) NewURLs(ctx context.Context, urls []store.URL) ([]store.URL, error) {
+	created := make([]store.URL, len(urls))
+
+	for i, url := range urls {
+		if err := prepareURL(&url); err != nil {
+			return nil, &store.BatchError{Index: i, Err: err}
+		}
+		created[i] = url
+	}
+
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	for i, url := range created {
+		if err := u.insert(url); err != nil {
+			for _, inserted := range created[:i] {
+				u.remove(inserted)
+			}
+			return nil, &store.BatchError{Index: i, Err: errors.Wrap(err, "inserting new url")}
+		}
+	}
+
+	return created, nil
+}
+
+// prepareURL generates the id and timestamps of a new url and hashes its password.
+func prepareURL(url *store.URL) error {
+	now := time.Now().UTC().Round(time.Microsecond)
+
+	url.ID = encoding.GenUniqueID()
+	url.VisitCount = nil
+	url.ExpiredAt = nil
+	url.DeletedAt = nil
+	url.StartsAt = roundTime(url.StartsAt)
+	url.ExpiresAt = roundTime(url.ExpiresAt)
+	url.CreatedAt = now
+	url.UpdatedAt = now
+	url.Domain = store.Hostname(url.OriginalURL)
+	url.CanonicalURL = url.Canonical()
+
+	return url.HashPassword()
+}
+
+// insert adds the url and its indexes after checking the constraints it must not violate.
+// The caller must hold the write lock.
+func (u *urlStore) insert(url store.URL) error {
+	key := longKey{owner: url.Owner, canonicalURL: url.CanonicalURL}
+
+	if _, ok := u.db.users[url.Owner]; !ok {
+		return store.ForeignKeyViolation(store.ForeignURLOwner)
+	}
+
+	if _, ok := u.db.urlsByLong[key]; ok && url.Dedup {
+		return store.UniqueViolation(store.UniqueURLLongStr)
+	}
+
+	if _, ok := u.db.urlsByParam[paramKey{domain: url.ShortDomain, param: url.ShortenedURLParam}]; ok {
+		return store.UniqueViolation(store.UniqueURLParam)
+	}
+
+	if url.ShortDomain != "" {
+		id, ok := u.db.verifiedHosts[url.ShortDomain]
+		if !ok || u.db.domains[id].Owner != url.Owner {
+			return store.ErrUnverifiedDomain
+		}
+	}
+
+	u.db.urls[url.ID] = url
+	u.db.urlsByParam[paramKey{domain: url.ShortDomain, param: url.ShortenedURLParam}] = url.ID
+	if url.Dedup {
+		u.db.urlsByLong[key] = url.ID
+	}
+
+	return nil
+}
+
+// remove takes back a url added by insert. The caller must hold the write lock.
+func (u *urlStore) remove(url store.URL) {
+	delete(u.db.urls, url.ID)
+	delete(u.db.urlsByParam, paramKey{domain: url.ShortDomain, param: url.ShortenedURLParam})
+	if url.Dedup {
+		delete(u.db.urlsByLong, longKey{owner: url.Owner, canonicalURL: url.CanonicalURL})
+	}
+}
+
+// GetURLByID retrieves the short url by its given id.
+func (u *urlStore) GetURLByID(ctx context.Context, id uuid.UUID) (store.URL, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	url, ok := u.db.urls[id]
+	if !ok {
+		return store.URL{}, errors.Wrap(sql.ErrNoRows, "retrieving url by id")
+	}
+
+	return url, nil
+}
+
+// GetURLByParam retrieves the short url by its given param on the default short domain.
+func (u *urlStore) GetURLByParam(ctx context.Context, param string) (store.URL, error) {
+	return u.GetDomainURLByParam(ctx, "", param)
+}
+
+// GetDomainURLByParam retrieves the short url by its given param on the given short domain.
+func (u *urlStore) GetDomainURLByParam(ctx context.Context, domain, param string) (store.URL, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	id, ok := u.db.urlsByParam[paramKey{domain: domain, param: param}]
+	if !ok || u.db.urls[id].DeletedAt != nil {
+		return store.URL{}, errors.Wrap(sql.ErrNoRows, "retrieving url by param")
+	}
+
+	return u.db.urls[id], nil
+}
+
+// ParamTaken reports whether a url, deleted or not, goes by the param on the given short domain.
+func (u *urlStore) ParamTaken(ctx context.Context, domain, param string) (bool, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	_, ok := u.db.urlsByParam[paramKey{domain: domain, param: param}]
+	return ok, nil
+}
+
+// GetURLByLongStr retrieves the owner's dedup short url of the given canonical url.
+func (u *urlStore) GetURLByLongStr(ctx context.Context, owner uuid.UUID, canonicalURL string) (store.URL, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	id, ok := u.db.urlsByLong[longKey{owner: owner, canonicalURL: canonicalURL}]
+	if !ok {
+		return store.URL{}, errors.Wrap(sql.ErrNoRows, "retrieving short url param by long url")
+	}
+
+	return u.db.urls[id], nil
+}
+
+// GetURLsByOwner retrieves every url of the owner, newest first.
+func (u *urlStore) GetURLsByOwner(ctx context.Context, owner uuid.UUID) ([]store.URL, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	urls := []store.URL{}
+	for _, url := range u.db.urls {
+		if url.Owner == owner {
+			urls = append(urls, url)
+		}
+	}
+
+	sortNewestFirst(urls)
+
+	return urls, nil
+}
+
+// FindURLs retrieves a page of the owner's urls matching the filter, newest first.
+func (u *urlStore) FindURLs(ctx context.Context, filter store.URLFilter) ([]store.URL, error) {
+	now := time.Now()
+	terms := store.SearchTerms(filter.Search)
+
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	urls := []store.URL{}
+	for _, url := range u.db.urls {
+		if url.Owner == filter.Owner && matches(url, filter, terms, now) {
+			urls = append(urls, url)
+		}
+	}
+
+	sortNewestFirst(urls)
+
+	if filter.Limit > 0 && len(urls) > filter.Limit {
+		urls = urls[:filter.Limit]
+	}
+
+	return urls, nil
+}
+
+// matches reports whether the url passes every field of the filter but its owner and limit.
+func matches(url store.URL, filter store.URLFilter, terms []string, now time.Time) bool {
+	if (url.DeletedAt != nil) != filter.Deleted {
+		return false
+	}
+
+	if filter.CreatedAfter != nil && url.CreatedAt.Before(*filter.CreatedAfter) {
+		return false
+	}
+
+	if filter.CreatedBefore != nil && !url.CreatedAt.Before(*filter.CreatedBefore) {
+		return false
+	}
+
+	if filter.Domain != "" && url.Domain != filter.Domain && !strings.HasSuffix(url.Domain, "."+filter.Domain) {
+		return false
+	}
+
+	if filter.Campaign != "" && url.UTM.Campaign != filter.Campaign {
+		return false
+	}
+
+	for _, tag := range filter.Tags {
+		if !hasTag(url.Tags, tag) {
+			return false
+		}
+	}
+
+	switch filter.State {
+	case store.URLActive:
+		if !url.Started(now) || url.Expired(now) {
+			return false
+		}
+	case store.URLExpired:
+		if !url.Expired(now) {
+			return false
+		}
+	}
+
+	//words match by prefix like the postgresql search, which splits the document into words the same way.
+	words := store.SearchTerms(strings.Join([]string{url.OriginalURL, url.ShortenedURLParam, url.Title, url.Notes}, " "))
+	for _, term := range terms {
+		if !hasPrefix(words, term) {
+			return false
+		}
+	}
+
+	if after := filter.After; after != nil {
+		if url.CreatedAt.After(after.CreatedAt) || (url.CreatedAt.Equal(after.CreatedAt) && url.ID.String() >= after.ID.String()) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasPrefix reports whether one of words starts with prefix.
+func hasPrefix(words []string, prefix string) bool {
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTag reports whether tag is one of tags.
+func hasTag(tags store.Tags, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// sortNewestFirst orders urls by creation time and id, both descending, like the sql stores do.
+func sortNewestFirst(urls []store.URL) {
+	sort.Slice(urls, func(i, j int) bool {
+		if !urls[i].CreatedAt.Equal(urls[j].CreatedAt) {
+			return urls[i].CreatedAt.After(urls[j].CreatedAt)
+		}
+		return urls[i].ID.String() > urls[j].ID.String()
+	})
+}
+
+// CampaignStats counts the owner's live urls per utm campaign and the clicks on them, most clicked first.
+func (u *urlStore) CampaignStats(ctx context.Context, owner uuid.UUID) ([]store.CampaignStats, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	byCampaign := make(map[string]*store.CampaignStats)
+	for _, url := range u.db.urls {
+		if url.Owner != owner || url.DeletedAt != nil || url.UTM.Campaign == "" {
+			continue
+		}
+
+		s, ok := byCampaign[url.UTM.Campaign]
+		if !ok {
+			s = &store.CampaignStats{Campaign: url.UTM.Campaign}
+			byCampaign[url.UTM.Campaign] = s
+		}
+
+		s.Links++
+		if url.VisitCount != nil {
+			s.Clicks += *url.VisitCount
+		}
+	}
+
+	stats := []store.CampaignStats{}
+	for _, s := range byCampaign {
+		stats = append(stats, *s)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Clicks != stats[j].Clicks {
+			return stats[i].Clicks > stats[j].Clicks
+		}
+		return stats[i].Campaign < stats[j].Campaign
+	})
+
+	return stats, nil
+}
+
+// UpdateURL saves the original and canonical url, param, schedule, description, utm parameters, routes, variants and app links of the given url and clears its expired at.
+func (u *urlStore) UpdateURL(ctx context.Context, url store.URL) (store.URL, error) {
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	old, ok := u.db.urls[url.ID]
+	if !ok {
+		return store.URL{}, errors.Wrap(sql.ErrNoRows, "updating url")
+	}
+
+	oldKey := longKey{owner: old.Owner, canonicalURL: old.CanonicalURL}
+	newKey := longKey{owner: old.Owner, canonicalURL: url.Canonical()}
+
+	if id, ok := u.db.urlsByLong[newKey]; ok && id != old.ID && old.Dedup && old.DeletedAt == nil {
+		return store.URL{}, errors.Wrap(store.UniqueViolation(store.UniqueURLLongStr), "updating url")
+	}
+
+	if id, ok := u.db.urlsByParam[paramKey{domain: old.ShortDomain, param: url.ShortenedURLParam}]; ok && id != old.ID {
+		return store.URL{}, errors.Wrap(store.UniqueViolation(store.UniqueURLParam), "updating url")
+	}
+
+	updated := old
+	updated.OriginalURL = url.OriginalURL
+	updated.CanonicalURL = url.Canonical()
+	updated.ShortenedURLParam = url.ShortenedURLParam
+	updated.StartsAt = roundTime(url.StartsAt)
+	updated.ExpiresAt = roundTime(url.ExpiresAt)
+	updated.MaxClicks = url.MaxClicks
+	updated.FallbackURL = url.FallbackURL
+	updated.Title = url.Title
+	updated.Notes = url.Notes
+	updated.Tags = url.Tags
+	updated.Domain = store.Hostname(url.OriginalURL)
+	updated.UTM = url.UTM
+	updated.Routes = url.Routes
+	updated.Variants = url.Variants
+	updated.AppLinks = url.AppLinks
+	updated.ExpiredAt = nil
+	updated.UpdatedAt = time.Now().UTC().Round(time.Microsecond)
+
+	u.db.urls[old.ID] = updated
+
+	delete(u.db.urlsByParam, paramKey{domain: old.ShortDomain, param: old.ShortenedURLParam})
+	u.db.urlsByParam[paramKey{domain: old.ShortDomain, param: updated.ShortenedURLParam}] = old.ID
+
+	if old.Dedup && old.DeletedAt == nil {
+		delete(u.db.urlsByLong, oldKey)
+		u.db.urlsByLong[newKey] = old.ID
+	}
+
+	return updated, nil
+}
+
+// DeleteURL soft deletes the url, it stops redirecting but keeps its param until it is restored.
+func (u *urlStore) DeleteURL(ctx context.Context, id uuid.UUID) error {
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	url, ok := u.db.urls[id]
+	if !ok || url.DeletedAt != nil {
+		return errors.Wrap(sql.ErrNoRows, "deleting url")
+	}
+
+	now := time.Now().UTC().Round(time.Microsecond)
+	url.DeletedAt = &now
+	u.db.urls[id] = url
+
+	//a deleted dedup url makes way for a new one to the same canonical url.
+	if url.Dedup {
+		delete(u.db.urlsByLong, longKey{owner: url.Owner, canonicalURL: url.CanonicalURL})
+	}
+
+	return nil
+}
+
+// RestoreURL brings back a deleted url.
+func (u *urlStore) RestoreURL(ctx context.Context, id uuid.UUID) error {
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	url, ok := u.db.urls[id]
+	if !ok || url.DeletedAt == nil {
+		return errors.Wrap(sql.ErrNoRows, "restoring url")
+	}
+
+	key := longKey{owner: url.Owner, canonicalURL: url.CanonicalURL}
+
+	if _, ok := u.db.urlsByLong[key]; ok && url.Dedup {
+		return errors.Wrap(store.UniqueViolation(store.UniqueURLLongStr), "restoring url")
+	}
+
+	url.DeletedAt = nil
+	u.db.urls[id] = url
+
+	if url.Dedup {
+		u.db.urlsByLong[key] = id
+	}
+
+	return nil
+}
+
+// ExpireURLs marks the urls that expired or ran out of clicks by now and returns how many it marked.
+func (u *urlStore) ExpireURLs(ctx context.Context, now time.Time) (int64, error) {
+	now = now.UTC().Round(time.Microsecond)
+
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	var n int64
+	for id, url := range u.db.urls {
+		if url.ExpiredAt == nil && url.Expired(now) {
+			expiredAt := now
+			url.ExpiredAt = &expiredAt
+			u.db.urls[id] = url
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// roundTime returns a copy of t in UTC rounded to the microsecond the sql stores keep.
+func roundTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	rounded := t.UTC().Round(time.Microsecond)
+	return &rounded
+}
@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/nairobi-gophers/fupisha/encoding"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/pkg/errors"
+)
+
+type userStore struct {
+	db *database
+}
+
+// NewUser creates a new user record.
+func (s userStore) NewUser(ctx context.Context, email, password string) (store.User, error) {
+
+	var now time.Time = time.Now()
+
+	user := store.User{
+		ID:                  encoding.GenUniqueID(),
+		Email:               email,
+		Password:            password,
+		VerificationToken:   encoding.GenUniqueID(),
+		VerificationExpires: now.Add(time.Minute * 15).UTC().Round(time.Microsecond), //expires 15 mins later
+		CreatedAt:           now.UTC().Round(time.Microsecond),
+		UpdatedAt:           now.UTC().Round(time.Microsecond),
+	}
+
+	if err := user.HashPassword(); err != nil {
+		return store.User{}, err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.usersByEmail[user.Email]; ok {
+		return store.User{}, errors.Wrap(store.UniqueViolation(store.UniqueUserEmail), "inserting new user")
+	}
+
+	s.db.users[user.ID] = user
+	s.db.usersByEmail[user.Email] = user.ID
+	s.db.usersByToken[user.VerificationToken] = user.ID
+
+	return user, nil
+}
+
+// GetUserByID finds a user by id
+func (s userStore) GetUserByID(ctx context.Context, id uuid.UUID) (store.User, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	user, ok := s.db.users[id]
+	if !ok {
+		return store.User{}, errors.New("not found")
+	}
+
+	return user, nil
+}
+
+// GetUserByEmail retrieves an existing user with the given email.
+func (s userStore) GetUserByEmail(ctx context.Context, email string) (store.User, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	id, ok := s.db.usersByEmail[email]
+	if !ok {
+		return store.User{}, errors.Wrap(sql.ErrNoRows, "retrieving user by email")
+	}
+
+	return s.db.users[id], nil
+}
+
+// GetUserByVerificationToken retrieves user whose verification token matches the given token string.
+func (s userStore) GetUserByVerificationToken(ctx context.Context, token uuid.UUID) (store.User, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	id, ok := s.db.usersByToken[token]
+	if !ok {
+		return store.User{}, errors.Wrap(sql.ErrNoRows, "retrievng user by verification token")
+	}
+
+	return s.db.users[id], nil
+}
+
+// SetUserAPIKey sets the api key for the given user id.
+func (s userStore) SetUserAPIKey(ctx context.Context, id, key uuid.UUID) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	user, ok := s.db.users[id]
+	if !ok {
+		//postgresql silently updates zero rows, so do we.
+		return nil
+	}
+
+	user.APIKey = &key
+	s.db.users[id] = user
+
+	return nil
+}
+
+// SetUserVerified updates the verified value for the user with the given user id.
+func (s userStore) SetUserVerified(ctx context.Context, id uuid.UUID) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	user, ok := s.db.users[id]
+	if !ok {
+		return nil
+	}
+
+	user.Verified = true
+	s.db.users[id] = user
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/pkg/errors"
+)
+
+type utmStore struct {
+	db *database
+}
+
+// SaveUTMPreset creates the owner's preset, or replaces the parameters of the one of the same name.
+func (u *utmStore) SaveUTMPreset(ctx context.Context, preset store.UTMPreset) (store.UTMPreset, error) {
+	now := time.Now().UTC().Round(time.Microsecond)
+	key := presetKey{owner: preset.Owner, name: preset.Name}
+
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	if _, ok := u.db.users[preset.Owner]; !ok {
+		return store.UTMPreset{}, errors.Wrap(store.ForeignKeyViolation(store.ForeignUTMPresetOwner), "saving utm preset")
+	}
+
+	preset.CreatedAt = now
+	if old, ok := u.db.presets[key]; ok {
+		preset.CreatedAt = old.CreatedAt
+	}
+	preset.UpdatedAt = now
+
+	u.db.presets[key] = preset
+
+	return preset, nil
+}
+
+// GetUTMPreset retrieves the owner's preset of the given name.
+func (u *utmStore) GetUTMPreset(ctx context.Context, owner uuid.UUID, name string) (store.UTMPreset, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	preset, ok := u.db.presets[presetKey{owner: owner, name: name}]
+	if !ok {
+		return store.UTMPreset{}, errors.Wrap(sql.ErrNoRows, "retrieving utm preset")
+	}
+
+	return preset, nil
+}
+
+// GetUTMPresets retrieves every preset of the owner by name.
+func (u *utmStore) GetUTMPresets(ctx context.Context, owner uuid.UUID) ([]store.UTMPreset, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	presets := []store.UTMPreset{}
+	for key, preset := range u.db.presets {
+		if key.owner == owner {
+			presets = append(presets, preset)
+		}
+	}
+
+	sort.Slice(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+
+	return presets, nil
+}
+
+// DeleteUTMPreset removes the owner's preset of the given name.
+func (u *utmStore) DeleteUTMPreset(ctx context.Context, owner uuid.UUID, name string) error {
+	key := presetKey{owner: owner, name: name}
+
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	if _, ok := u.db.presets[key]; !ok {
+		return errors.Wrap(sql.ErrNoRows, "deleting utm preset")
+	}
+
+	delete(u.db.presets, key)
+
+	return nil
+}
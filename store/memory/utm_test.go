@@ -0,0 +1,158 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/nairobi-gophers/fupisha/encoding"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/pkg/errors"
+)
+
+func TestUTMPreset(t *testing.T) {
+	s := NewStore()
+
+	ctx := context.Background()
+
+	u, err := s.NewUser(ctx, "test_user@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	launch, err := s.SaveUTMPreset(ctx, store.UTMPreset{Owner: u.ID, Name: "launch", UTM: store.UTM{Source: "newsletter", Medium: "email", Campaign: "launch"}})
+	if err != nil {
+		t.Fatalf("failed to save preset: %s", err)
+	}
+
+	if _, err := s.SaveUTMPreset(ctx, store.UTMPreset{Owner: u.ID, Name: "ads", UTM: store.UTM{Source: "google", Medium: "cpc"}}); err != nil {
+		t.Fatalf("failed to save preset: %s", err)
+	}
+
+	//saving a preset of the same name replaces its parameters.
+	saved, err := s.SaveUTMPreset(ctx, store.UTMPreset{Owner: u.ID, Name: "launch", UTM: store.UTM{Source: "twitter", Campaign: "launch"}})
+	if err != nil {
+		t.Fatalf("failed to save preset: %s", err)
+	}
+
+	got, err := s.GetUTMPreset(ctx, u.ID, "launch")
+	if err != nil {
+		t.Fatalf("failed to retrieve preset: %s", err)
+	}
+
+	if want := (store.UTM{Source: "twitter", Campaign: "launch"}); got.UTM != want || !got.CreatedAt.Equal(launch.CreatedAt) || !got.UpdatedAt.Equal(saved.UpdatedAt) {
+		t.Fatalf("got %+v want %+v created at %s", got, want, launch.CreatedAt)
+	}
+
+	presets, err := s.GetUTMPresets(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("failed to retrieve presets: %s", err)
+	}
+
+	var names []string
+	for _, p := range presets {
+		names = append(names, p.Name)
+	}
+
+	if want := []string{"ads", "launch"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got presets %v want %v", names, want)
+	}
+
+	if err := s.DeleteUTMPreset(ctx, u.ID, "ads"); err != nil {
+		t.Fatalf("failed to delete preset: %s", err)
+	}
+
+	if _, err := s.GetUTMPreset(ctx, u.ID, "ads"); errors.Cause(err) != sql.ErrNoRows {
+		t.Fatalf("got %v retrieving a deleted preset want %v", err, sql.ErrNoRows)
+	}
+
+	if err := s.DeleteUTMPreset(ctx, u.ID, "ads"); errors.Cause(err) != sql.ErrNoRows {
+		t.Fatalf("got %v deleting a deleted preset want %v", err, sql.ErrNoRows)
+	}
+
+	_, err = s.SaveUTMPreset(ctx, store.UTMPreset{Owner: encoding.GenUniqueID(), Name: "launch"})
+	pqErr, ok := errors.Cause(err).(*pq.Error)
+	if !ok || pqErr.Code != pq.ErrorCode("23503") {
+		t.Fatalf("got %v want a foreign key violation", err)
+	}
+}
+
+func TestCampaignStats(t *testing.T) {
+	s := NewStore()
+
+	ctx := context.Background()
+
+	u, err := s.NewUser(ctx, "test_user@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	var urls []store.URL
+	for i, utm := range []store.UTM{
+		{Source: "newsletter", Campaign: "launch"},
+		{Source: "twitter", Campaign: "launch"},
+		{Source: "google", Medium: "cpc", Campaign: "ads"},
+		{},
+	} {
+		url, err := s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://fupisha.io/a", ShortenedURLParam: "abcde" + string(rune('a'+i)), UTM: utm})
+		if err != nil {
+			t.Fatalf("failed to create url: %s", err)
+		}
+		urls = append(urls, url)
+	}
+
+	if urls[2].UTM != (store.UTM{Source: "google", Medium: "cpc", Campaign: "ads"}) {
+		t.Fatalf("got utm %+v", urls[2].UTM)
+	}
+
+	var clicks []store.Click
+	for _, i := range []int{0, 2, 2, 2, 3} {
+		clicks = append(clicks, store.Click{URLID: urls[i].ID})
+	}
+
+	if err := s.NewClicks(ctx, clicks); err != nil {
+		t.Fatalf("failed to create clicks: %s", err)
+	}
+
+	stats, err := s.CampaignStats(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("failed to count campaigns: %s", err)
+	}
+
+	want := []store.CampaignStats{{Campaign: "ads", Links: 1, Clicks: 3}, {Campaign: "launch", Links: 2, Clicks: 1}}
+	if !reflect.DeepEqual(stats, want) {
+		t.Fatalf("got %+v want %+v", stats, want)
+	}
+
+	found, err := s.FindURLs(ctx, store.URLFilter{Owner: u.ID, Campaign: "launch"})
+	if err != nil {
+		t.Fatalf("failed to find urls: %s", err)
+	}
+
+	if len(found) != 2 || found[0].ID != urls[1].ID || found[1].ID != urls[0].ID {
+		t.Fatalf("got %d urls of the launch campaign want 2", len(found))
+	}
+
+	//moving a url to another campaign and deleting one moves their clicks out of the campaign.
+	url := urls[0]
+	url.UTM.Campaign = "ads"
+	if url, err = s.UpdateURL(ctx, url); err != nil || url.UTM.Campaign != "ads" {
+		t.Fatalf("got campaign %q, %v updating url", url.UTM.Campaign, err)
+	}
+
+	if err := s.DeleteURL(ctx, urls[2].ID); err != nil {
+		t.Fatalf("failed to delete url: %s", err)
+	}
+
+	stats, err = s.CampaignStats(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("failed to count campaigns: %s", err)
+	}
+
+	want = []store.CampaignStats{{Campaign: "ads", Links: 1, Clicks: 1}, {Campaign: "launch", Links: 1, Clicks: 0}}
+	if !reflect.DeepEqual(stats, want) {
+		t.Fatalf("got %+v want %+v", stats, want)
+	}
+}
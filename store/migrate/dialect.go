@@ -0,0 +1,122 @@
+package migrate
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Dialect provides the database specific parts of the migrator.
+type Dialect interface {
+	//createTable returns the statement creating the schema_migrations table if it does not exist.
+	createTable() string
+	//hasTable returns the query counting the schema_migrations tables of the database, 0 or 1.
+	hasTable() string
+	//lock blocks until conn holds the database wide migration lock.
+	lock(ctx context.Context, conn *sqlx.Conn) error
+	//unlock releases the migration lock held by conn.
+	unlock(ctx context.Context, conn *sqlx.Conn) error
+}
+
+// The dialects of the supported sql store backends.
+var (
+	Postgres Dialect = postgres{}
+	MySQL    Dialect = mysql{}
+	SQLite   Dialect = sqlite{}
+)
+
+// lockName identifies the migration lock, it must never change between releases.
+const lockName = "fupisha_schema_migrations"
+
+// lockTimeout is how long a migrator waits for another one to finish.
+const lockTimeout = 5 * time.Minute
+
+type postgres struct{}
+
+func (postgres) createTable() string {
+	return `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL
+	)`
+}
+
+func (postgres) hasTable() string {
+	return `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema=current_schema() AND table_name='schema_migrations'`
+}
+
+func (postgres) lock(ctx context.Context, conn *sqlx.Conn) error {
+	ctx, cancel := context.WithTimeout(ctx, lockTimeout)
+	defer cancel()
+
+	_, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock(hashtext($1))`, lockName)
+	return err
+}
+
+func (postgres) unlock(ctx context.Context, conn *sqlx.Conn) error {
+	_, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock(hashtext($1))`, lockName)
+	return err
+}
+
+type mysql struct{}
+
+func (mysql) createTable() string {
+	return `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at DATETIME(6) NOT NULL
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`
+}
+
+func (mysql) hasTable() string {
+	return `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema=DATABASE() AND table_name='schema_migrations'`
+}
+
+func (mysql) lock(ctx context.Context, conn *sqlx.Conn) error {
+	var ok *int
+	if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?)`, lockName, int(lockTimeout.Seconds())).Scan(&ok); err != nil {
+		return err
+	}
+	if ok == nil || *ok != 1 {
+		return errors.New("timed out waiting for the migration lock")
+	}
+	return nil
+}
+
+func (mysql) unlock(ctx context.Context, conn *sqlx.Conn) error {
+	_, err := conn.ExecContext(ctx, `SELECT RELEASE_LOCK(?)`, lockName)
+	return err
+}
+
+// sqlite has no advisory locks. Migrations run in immediate transactions instead,
+// which take the database write lock and so serialise concurrent migrators.
+//
+// Foreign keys are not enforced while migrating, sqlite can only change most constraints by
+// rebuilding a table and dropping the old one would otherwise cascade to the rows referencing it.
+// See https://www.sqlite.org/lang_altertable.html#otheralter
+type sqlite struct{}
+
+func (sqlite) createTable() string {
+	return `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`
+}
+
+func (sqlite) hasTable() string {
+	return `SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='schema_migrations'`
+}
+
+func (sqlite) lock(ctx context.Context, conn *sqlx.Conn) error {
+	//the pragma is a no-op inside a transaction, it has to be set before the migrations begin theirs.
+	_, err := conn.ExecContext(ctx, `PRAGMA foreign_keys=OFF`)
+	return err
+}
+
+func (sqlite) unlock(ctx context.Context, conn *sqlx.Conn) error {
+	_, err := conn.ExecContext(ctx, `PRAGMA foreign_keys=ON`)
+	return err
+}
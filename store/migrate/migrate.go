@@ -0,0 +1,261 @@
+// Package migrate applies ordered, versioned schema migrations to the sql store backends.
+// Applied versions are recorded in a schema_migrations table and a database wide lock
+// makes it safe for several fupisha instances to migrate the same database at once.
+package migrate
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Migration is a single versioned change to a store's schema.
+type Migration struct {
+	//Version orders the migrations, it must be unique and should never change once released.
+	Version int64
+	//Description is a short human readable summary e.g. create users table.
+	Description string
+	//Up applies the change.
+	Up string
+	//Down reverts the change, it may be left empty when there is nothing to revert.
+	Down string
+}
+
+// Status reports whether a migration has been applied.
+type Status struct {
+	Version     int64
+	Description string
+	//AppliedAt is nil if the migration is still pending.
+	AppliedAt *time.Time
+}
+
+// Migrator applies migrations to a database.
+type Migrator struct {
+	db         *sqlx.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+// New returns a migrator for the given database, dialect and migrations.
+// The migrations are applied in ascending version order regardless of the order they are given in.
+func New(db *sqlx.DB, dialect Dialect, migrations []Migration) *Migrator {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	return &Migrator{
+		db:         db,
+		dialect:    dialect,
+		migrations: sorted,
+	}
+}
+
+// Up applies all the pending migrations and returns the ones it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+
+	err := m.locked(ctx, func(conn *sqlx.Conn) error {
+		for _, mg := range m.migrations {
+			ok, err := m.apply(ctx, conn, mg)
+			if err != nil {
+				return errors.Wrapf(err, "applying migration %d (%s)", mg.Version, mg.Description)
+			}
+			if ok {
+				applied = append(applied, mg)
+			}
+		}
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts the given number of most recently applied migrations and returns the ones it reverted.
+// A steps value less than one reverts every applied migration.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+
+	err := m.locked(ctx, func(conn *sqlx.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if steps > 0 && len(reverted) == steps {
+				break
+			}
+
+			mg := m.migrations[i]
+			if _, ok := versions[mg.Version]; !ok {
+				continue
+			}
+
+			if err := m.revert(ctx, conn, mg); err != nil {
+				return errors.Wrapf(err, "reverting migration %d (%s)", mg.Version, mg.Description)
+			}
+			reverted = append(reverted, mg)
+		}
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Status reports every known migration in version order together with when it was applied. It only
+// reads the database, every migration is pending while the schema_migrations table is missing.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "acquiring connection")
+	}
+	defer conn.Close()
+
+	var tables int
+	if err := conn.GetContext(ctx, &tables, m.dialect.hasTable()); err != nil {
+		return nil, errors.Wrap(err, "looking up schema_migrations table")
+	}
+
+	versions := map[int64]time.Time{}
+	if tables > 0 {
+		if versions, err = appliedVersions(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+
+	status := make([]Status, 0, len(m.migrations))
+	for _, mg := range m.migrations {
+		s := Status{Version: mg.Version, Description: mg.Description}
+		if at, ok := versions[mg.Version]; ok {
+			at := at
+			s.AppliedAt = &at
+		}
+		status = append(status, s)
+	}
+
+	return status, nil
+}
+
+// Pending returns the migrations that have not been applied yet.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for i, s := range status {
+		if s.AppliedAt == nil {
+			pending = append(pending, m.migrations[i])
+		}
+	}
+
+	return pending, nil
+}
+
+// locked runs fn on a single connection holding the migration lock.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	//session level locks belong to a connection, so everything has to run on the one that took the lock.
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return errors.Wrap(err, "acquiring connection")
+	}
+	defer conn.Close()
+
+	if err := m.dialect.lock(ctx, conn); err != nil {
+		return errors.Wrap(err, "acquiring migration lock")
+	}
+	defer m.dialect.unlock(context.Background(), conn)
+
+	if _, err := conn.ExecContext(ctx, m.dialect.createTable()); err != nil {
+		return errors.Wrap(err, "creating schema_migrations table")
+	}
+
+	return fn(conn)
+}
+
+// apply runs the migration unless it was already applied, reporting whether it did.
+func (m *Migrator) apply(ctx context.Context, conn *sqlx.Conn, mg Migration) (bool, error) {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	//checked inside the transaction since sqlite has no lock to serialise concurrent migrators.
+	var n int
+	if err := tx.GetContext(ctx, &n, tx.Rebind(`SELECT COUNT(*) FROM schema_migrations WHERE version=?`), mg.Version); err != nil {
+		return false, err
+	}
+	if n > 0 {
+		return false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, mg.Up); err != nil {
+		return false, err
+	}
+
+	const q = `INSERT INTO schema_migrations (version,description,applied_at) VALUES (?,?,?)`
+	if _, err := tx.ExecContext(ctx, tx.Rebind(q), mg.Version, mg.Description, time.Now().UTC().Round(time.Microsecond)); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// revert runs the migration's down statement and forgets it was applied.
+func (m *Migrator) revert(ctx context.Context, conn *sqlx.Conn, mg Migration) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if mg.Down != "" {
+		if _, err := tx.ExecContext(ctx, mg.Down); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, tx.Rebind(`DELETE FROM schema_migrations WHERE version=?`), mg.Version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// appliedVersions returns the applied migration versions and when each was applied.
+func appliedVersions(ctx context.Context, conn *sqlx.Conn) (map[int64]time.Time, error) {
+	var rows []struct {
+		Version   int64     `db:"version"`
+		AppliedAt time.Time `db:"applied_at"`
+	}
+
+	if err := conn.SelectContext(ctx, &rows, `SELECT version,applied_at FROM schema_migrations`); err != nil {
+		return nil, errors.Wrap(err, "retrieving applied migrations")
+	}
+
+	versions := make(map[int64]time.Time, len(rows))
+	for _, r := range rows {
+		versions[r.Version] = r.AppliedAt
+	}
+
+	return versions, nil
+}
+
+// Check returns an error if the database schema has pending migrations.
+func (m *Migrator) Check(ctx context.Context) error {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) > 0 {
+		return errors.Errorf("database schema is %d migration(s) behind, run `fupisha migrate up` first", len(pending))
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package migrate
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+var testMigrations = []Migration{
+	{
+		Version:     2,
+		Description: "create urls table",
+		Up:          `CREATE TABLE urls (id TEXT PRIMARY KEY, owner TEXT REFERENCES users(id));`,
+		Down:        `DROP TABLE urls;`,
+	},
+	{
+		Version:     1,
+		Description: "create users table",
+		Up:          `CREATE TABLE users (id TEXT PRIMARY KEY);`,
+		Down:        `DROP TABLE users;`,
+	},
+	{
+		Version:     3,
+		Description: "index url owners",
+		Up:          `CREATE INDEX urls_owner_idx ON urls(owner);`,
+	},
+}
+
+func openTestDatabase(t *testing.T, path string) *sqlx.DB {
+	db, err := sqlx.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+
+	db := openTestDatabase(t, filepath.Join(t.TempDir(), "fupisha.db"))
+	m := New(db, SQLite, testMigrations)
+
+	if err := m.Check(ctx); err == nil {
+		t.Fatal("want an error for a database with pending migrations")
+	}
+
+	//checking a fresh database leaves it untouched.
+	var fresh int
+	if err := db.Get(&fresh, `SELECT COUNT(*) FROM sqlite_master WHERE type='table'`); err != nil || fresh != 0 {
+		t.Fatalf("got %d tables, %v after checking a fresh database want none", fresh, err)
+	}
+
+	if pending, err := m.Pending(ctx); err != nil || len(pending) != 3 {
+		t.Fatalf("got %d pending migrations, %v on a fresh database want 3", len(pending), err)
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(applied) != 3 {
+		t.Fatalf("got %d applied migrations want 3", len(applied))
+	}
+
+	for i, mg := range applied {
+		if mg.Version != int64(i+1) {
+			t.Fatalf("got version %d at position %d want %d", mg.Version, i, i+1)
+		}
+	}
+
+	if err := m.Check(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err = m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(applied) != 0 {
+		t.Fatalf("got %d applied migrations want 0", len(applied))
+	}
+
+	reverted, err := m.Down(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reverted) != 2 || reverted[0].Version != 3 || reverted[1].Version != 2 {
+		t.Fatalf("got %+v want versions 3 and 2 reverted", reverted)
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range status {
+		if applied := s.AppliedAt != nil; applied != (s.Version == 1) {
+			t.Fatalf("version %d: got applied %t", s.Version, applied)
+		}
+	}
+
+	var tables int
+	if err := db.Get(&tables, `SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='urls'`); err != nil {
+		t.Fatal(err)
+	}
+
+	if tables != 0 {
+		t.Fatal("want the urls table dropped")
+	}
+
+	if _, err := m.Down(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 3 {
+		t.Fatalf("got %d pending migrations want 3", len(pending))
+	}
+}
+
+func TestMigratorConcurrentUp(t *testing.T) {
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "fupisha.db")
+
+	const instances = 4
+
+	var wg sync.WaitGroup
+	counts := make(chan int, instances)
+	errs := make(chan error, instances)
+
+	for i := 0; i < instances; i++ {
+		//every instance has its own connection pool, just like separate fupisha processes.
+		m := New(openTestDatabase(t, path), SQLite, testMigrations)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			applied, err := m.Up(ctx)
+			errs <- err
+			counts <- len(applied)
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	close(counts)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var total int
+	for n := range counts {
+		total += n
+	}
+
+	if total != len(testMigrations) {
+		t.Fatalf("got %d migrations applied across instances want %d", total, len(testMigrations))
+	}
+}
@@ -0,0 +1,89 @@
+package mysql
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"github.com/pkg/errors"
+)
+
+type testConfig struct {
+	Host     string
+	User     string
+	Password string
+	Database string
+	Port     int
+}
+
+type MySQLContainer struct {
+	pool      *dockertest.Pool
+	resource  *dockertest.Resource
+	imagename string
+	opts      testConfig
+}
+
+func NewMySQLContainer(pool *dockertest.Pool) *MySQLContainer {
+	opts := testConfig{
+		Host:     "localhost",
+		User:     "testcontainer",
+		Password: "Aa123456.",
+		Database: "testcontainer",
+		Port:     3306,
+	}
+
+	return &MySQLContainer{pool: pool, opts: opts, imagename: "mysql-testcontainer"}
+}
+
+func (container *MySQLContainer) Create(t *testing.T) {
+
+	if isRunning(container.pool, container.imagename) {
+		t.Fatal(errors.New("container already exists and is running"))
+	}
+
+	dockerOpts := dockertest.RunOptions{
+		Repository: "mysql",
+		Tag:        "8",
+		Env: []string{
+			"MYSQL_RANDOM_ROOT_PASSWORD=yes",
+			"MYSQL_USER=" + container.opts.User,
+			"MYSQL_PASSWORD=" + container.opts.Password,
+			"MYSQL_DATABASE=" + container.opts.Database,
+		},
+		ExposedPorts: []string{strconv.Itoa(container.opts.Port)},
+		PortBindings: map[docker.Port][]docker.PortBinding{
+			docker.Port(strconv.Itoa(container.opts.Port)): {{HostIP: "0.0.0.0", HostPort: strconv.Itoa(container.opts.Port)}},
+		},
+		Name: container.imagename,
+	}
+
+	resource, err := container.pool.RunWithOptions(&dockerOpts, func(config *docker.HostConfig) {
+		// set AutoRemove to true so that stopped container goes away by itself
+		config.AutoRemove = true
+		config.RestartPolicy = docker.RestartPolicy{
+			Name: "no",
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	container.resource = resource
+}
+
+func isRunning(pool *dockertest.Pool, imagename string) bool {
+	dockerContainers, _ := pool.Client.ListContainers(docker.ListContainersOptions{
+		All: true,
+	})
+
+	for _, dockerContainer := range dockerContainers {
+		for _, name := range dockerContainer.Names {
+			if strings.Contains(name, imagename) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+// Package mysql provides a mysql implementation of the fupisha store.
+package mysql
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/nairobi-gophers/fupisha/store/migrate"
+	"github.com/pkg/errors"
+)
+
+// compilation check for store.Store concrete implementation.
+var _ store.Store = (*Store)(nil)
+
+// NewStore creates and returns an initialized mysql store for use as our state backend.
+func NewStore(cfg *Config) (*Store, error) {
+	db, err := connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s := Store{
+		&userStore{db: db},
+		&urlStore{db: db},
+		&clickStore{db: db},
+		&utmStore{db: db},
+		&domainStore{db: db},
+	}
+
+	//the schema is only ever changed by fupisha migrate, refuse to run against an outdated one.
+	if err := newMigrator(db).Check(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// NewMigrator connects to the database and returns a migrator for its schema.
+func NewMigrator(cfg *Config) (*migrate.Migrator, error) {
+	db, err := connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMigrator(db), nil
+}
+
+func newMigrator(db *sqlx.DB) *migrate.Migrator {
+	return migrate.New(db, migrate.MySQL, migrations)
+}
+
+// connects to a mysql store and returns an initialized mysql store object.
+// address: localhost:3306
+func connect(cfg *Config) (*sqlx.DB, error) {
+	dsn := mysql.NewConfig()
+	dsn.Net = "tcp"
+	dsn.Addr = cfg.Host
+	dsn.User = cfg.User
+	dsn.Passwd = cfg.Password
+	dsn.DBName = cfg.Name
+	//scan DATETIME columns into time.Time values in utc.
+	dsn.ParseTime = true
+	dsn.Loc = time.UTC
+	dsn.Timeout = 10 * time.Second
+	//migrations may hold more than one statement.
+	dsn.MultiStatements = true
+	dsn.Params = map[string]string{
+		"charset": "utf8mb4",
+	}
+
+	db, err := sqlx.Open("mysql", dsn.FormatDSN())
+	if err != nil {
+		return nil, errors.Wrap(err, "connecting to database")
+	}
+
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*1)
+	defer cancel()
+
+	if err := statusCheck(ctx, db); err != nil {
+		return nil, errors.Wrap(err, "connect: connection never ready")
+	}
+
+	return db, nil
+}
+
+type Config struct {
+	//Host e.g. localhost:3306
+	Host string
+	//Password is the database user's password
+	Password string
+	//User is the database username
+	User string
+	//Name is the database name
+	Name string
+	//MaxIdleConns is the maximum number of conns in the idle conn pool
+	MaxIdleConns int
+	//MaxOpenConns is the maximum number of open conns to the database.
+	MaxOpenConns int
+}
+
+// Store is a mysql implementation of our store interface
+type Store struct {
+	*userStore
+	*urlStore
+	*clickStore
+	*utmStore
+	*domainStore
+}
+
+func statusCheck(ctx context.Context, db *sqlx.DB) error {
+	var pingError error
+	for attempts := 1; ; attempts++ {
+		pingError = db.Ping()
+		if pingError == nil {
+			break
+		}
+		time.Sleep(time.Duration(attempts) * 100 * time.Millisecond)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	const q = `SELECT true`
+	var tmp bool
+	return db.QueryRowContext(ctx, q).Scan(&tmp)
+}
+
+// mysql server error numbers, see https://dev.mysql.com/doc/mysql-errors/8.0/en/server-error-reference.html
+const (
+	errDupEntry         = 1062 // ER_DUP_ENTRY
+	errNoReferencedRow2 = 1452 // ER_NO_REFERENCED_ROW_2
+)
+
+// translate turns mysql constraint violations into the errors the postgresql store returns,
+// any other error is returned untouched.
+func translate(err error) error {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	if !ok {
+		return err
+	}
+
+	switch mysqlErr.Number {
+	case errDupEntry:
+		//e.g. Duplicate entry 'a@b.c' for key 'users.users_email_key', older servers leave out the table name.
+		msg := mysqlErr.Message
+		if i := strings.LastIndex(msg, "for key '"); i >= 0 {
+			key := strings.TrimSuffix(msg[i+len("for key '"):], "'")
+			if j := strings.LastIndex(key, "."); j >= 0 {
+				key = key[j+1:]
+			}
+			return store.UniqueViolation(key)
+		}
+		return store.UniqueViolation("")
+	case errNoReferencedRow2:
+		//e.g. Cannot add or update a child row: a foreign key constraint fails (`fupisha`.`urls`, CONSTRAINT `urls_owner_fkey` ...
+		msg := mysqlErr.Message
+		if i := strings.Index(msg, "CONSTRAINT `"); i >= 0 {
+			constraint := msg[i+len("CONSTRAINT `"):]
+			if j := strings.Index(constraint, "`"); j >= 0 {
+				return store.ForeignKeyViolation(constraint[:j])
+			}
+		}
+		return store.ForeignKeyViolation("")
+	}
+
+	return err
+}
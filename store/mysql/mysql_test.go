@@ -0,0 +1,54 @@
+package mysql
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/nairobi-gophers/fupisha/store"
+)
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantCode       pq.ErrorCode
+		wantConstraint string
+	}{
+		{
+			name:           "duplicate entry on mysql 8",
+			err:            &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a@b.c' for key 'users.users_email_key'"},
+			wantCode:       "23505",
+			wantConstraint: store.UniqueUserEmail,
+		},
+		{
+			name:           "duplicate entry on mysql 5.7",
+			err:            &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'abcdef' for key 'urls_short_url_param_idx'"},
+			wantCode:       "23505",
+			wantConstraint: store.UniqueURLParam,
+		},
+		{
+			name:           "missing owner",
+			err:            &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails (`fupisha`.`urls`, CONSTRAINT `urls_owner_fkey` FOREIGN KEY (`owner`) REFERENCES `users` (`id`) ON DELETE CASCADE)"},
+			wantCode:       "23503",
+			wantConstraint: store.ForeignURLOwner,
+		},
+	}
+
+	for _, tc := range tests {
+		pqErr, ok := translate(tc.err).(*pq.Error)
+		if !ok {
+			t.Fatalf("%s: want a *pq.Error", tc.name)
+		}
+
+		if pqErr.Code != tc.wantCode || pqErr.Constraint != tc.wantConstraint {
+			t.Fatalf("%s: got %s %q want %s %q", tc.name, pqErr.Code, pqErr.Constraint, tc.wantCode, tc.wantConstraint)
+		}
+	}
+
+	other := errors.New("connection refused")
+	if got := translate(other); got != other {
+		t.Fatalf("got %v want %v", got, other)
+	}
+}
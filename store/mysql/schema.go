@@ -0,0 +1,332 @@
+package mysql
+
+import "github.com/nairobi-gophers/fupisha/store/migrate"
+
+// migrations is the ordered list of schema changes, released migrations must never be edited.
+// Append new ones with the next version instead.
+//
+// Unique keys are named after their postgresql counterparts so duplicate entry
+// errors translate to the same constraint names.
+var migrations = []migrate.Migration{
+	{
+		Version:     1,
+		Description: "create users table",
+		Up: `
+	CREATE TABLE IF NOT EXISTS users (
+		id CHAR(36) PRIMARY KEY,
+		email VARCHAR(255),
+		password TEXT,
+		api_key CHAR(36),
+		reset_password_token CHAR(36),
+		reset_password_expires DATETIME(6),
+		verification_expires DATETIME(6),
+		verification_token CHAR(36),
+		verified BOOLEAN DEFAULT FALSE,
+		created_at DATETIME(6),
+		updated_at DATETIME(6),
+		CONSTRAINT users_email_key UNIQUE (email)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
+	`,
+		Down: `DROP TABLE IF EXISTS users`,
+	},
+	{
+		//original_url is too long for a unique index of its own, so its sha256 sum is indexed instead.
+		Version:     2,
+		Description: "create urls table",
+		Up: `
+	CREATE TABLE IF NOT EXISTS urls(
+		id CHAR(36) PRIMARY KEY,
+		owner CHAR(36),
+		original_url TEXT,
+		original_url_hash CHAR(64) AS (SHA2(original_url, 256)) STORED,
+		short_url_param VARCHAR(255),
+		visit_count INTEGER,
+		created_at DATETIME(6),
+		updated_at DATETIME(6),
+		CONSTRAINT urls_original_url_key UNIQUE (original_url_hash),
+		CONSTRAINT urls_short_url_param_idx UNIQUE (short_url_param),
+		CONSTRAINT urls_owner_fkey FOREIGN KEY (owner) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
+	`,
+		Down: `DROP TABLE IF EXISTS urls`,
+	},
+	{
+		Version:     3,
+		Description: "create clicks table",
+		Up: `
+	CREATE TABLE IF NOT EXISTS clicks(
+		id CHAR(36) PRIMARY KEY,
+		url_id CHAR(36) NOT NULL,
+		referrer TEXT,
+		user_agent TEXT,
+		browser VARCHAR(255),
+		os VARCHAR(255),
+		device VARCHAR(32),
+		ip VARCHAR(45),
+		created_at DATETIME(6),
+		INDEX clicks_url_id_created_at_idx (url_id, created_at),
+		CONSTRAINT clicks_url_id_fkey FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
+	`,
+		Down: `DROP TABLE IF EXISTS clicks`,
+	},
+	{
+		//original_url used to be unique across all users, so one user's link was handed out to
+		//everybody shortening the same url. Links are now deduplicated per owner, and only when asked to.
+		//dedup_hash is NULL for the other links and NULLs never collide in a unique index.
+		//Reverting can not bring the global constraint back once owners share urls, so the
+		//original url index is restored without it.
+		Version:     4,
+		Description: "deduplicate urls per owner",
+		Up: `
+	ALTER TABLE urls
+		DROP INDEX urls_original_url_key,
+		DROP COLUMN original_url_hash,
+		ADD COLUMN dedup BOOLEAN NOT NULL DEFAULT TRUE;
+
+	ALTER TABLE urls
+		ADD COLUMN dedup_hash CHAR(64) AS (IF(dedup, SHA2(original_url, 256), NULL)) STORED,
+		ADD CONSTRAINT urls_owner_original_url_key UNIQUE (owner, dedup_hash),
+		ADD INDEX urls_owner_created_at_idx (owner, created_at);
+	`,
+		Down: `
+	ALTER TABLE urls
+		DROP INDEX urls_owner_created_at_idx,
+		DROP INDEX urls_owner_original_url_key,
+		DROP COLUMN dedup_hash,
+		DROP COLUMN dedup;
+
+	ALTER TABLE urls
+		ADD COLUMN original_url_hash CHAR(64) AS (SHA2(original_url, 256)) STORED,
+		ADD INDEX urls_original_url_key (original_url_hash);
+	`,
+	},
+	{
+		Version:     5,
+		Description: "add url expiry and click limits",
+		Up: `
+	ALTER TABLE urls
+		ADD COLUMN starts_at DATETIME(6),
+		ADD COLUMN expires_at DATETIME(6),
+		ADD COLUMN max_clicks INTEGER,
+		ADD COLUMN fallback_url VARCHAR(2048) NOT NULL DEFAULT '',
+		ADD COLUMN expired_at DATETIME(6),
+		ADD INDEX urls_expiry_idx (expired_at, expires_at);
+	`,
+		Down: `
+	ALTER TABLE urls
+		DROP INDEX urls_expiry_idx,
+		DROP COLUMN starts_at,
+		DROP COLUMN expires_at,
+		DROP COLUMN max_clicks,
+		DROP COLUMN fallback_url,
+		DROP COLUMN expired_at;
+	`,
+	},
+	{
+		Version:     6,
+		Description: "add url passwords",
+		Up: `
+	ALTER TABLE urls ADD COLUMN password VARCHAR(255) NOT NULL DEFAULT '';
+	`,
+		Down: `
+	ALTER TABLE urls DROP COLUMN password;
+	`,
+	},
+	{
+		Version:     7,
+		Description: "soft delete urls",
+		Up: `
+	ALTER TABLE urls
+		DROP INDEX urls_owner_original_url_key,
+		DROP COLUMN dedup_hash,
+		ADD COLUMN deleted_at DATETIME(6);
+
+	ALTER TABLE urls
+		ADD COLUMN dedup_hash CHAR(64) AS (IF(dedup AND deleted_at IS NULL, SHA2(original_url, 256), NULL)) STORED,
+		ADD CONSTRAINT urls_owner_original_url_key UNIQUE (owner, dedup_hash);
+	`,
+		//deleted urls come back to life, the deleted dedup ones stop deduplicating so they do not collide.
+		Down: `
+	UPDATE urls SET dedup=FALSE WHERE deleted_at IS NOT NULL;
+
+	ALTER TABLE urls
+		DROP INDEX urls_owner_original_url_key,
+		DROP COLUMN dedup_hash,
+		DROP COLUMN deleted_at;
+
+	ALTER TABLE urls
+		ADD COLUMN dedup_hash CHAR(64) AS (IF(dedup, SHA2(original_url, 256), NULL)) STORED,
+		ADD CONSTRAINT urls_owner_original_url_key UNIQUE (owner, dedup_hash);
+	`,
+	},
+	{
+		Version:     8,
+		Description: "describe, tag and search urls",
+		Up: `
+	ALTER TABLE urls
+		ADD COLUMN title VARCHAR(255) NOT NULL DEFAULT '',
+		ADD COLUMN notes VARCHAR(2048) NOT NULL DEFAULT '',
+		ADD COLUMN tags JSON NOT NULL DEFAULT ('[]'),
+		ADD COLUMN domain VARCHAR(255) NOT NULL DEFAULT '',
+		ADD INDEX urls_owner_domain_idx (owner, domain);
+
+	UPDATE urls SET domain=LOWER(SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(
+		IF(LOCATE('://', original_url) > 0, SUBSTRING(original_url, LOCATE('://', original_url) + 3), original_url),
+		'/', 1), '?', 1), '#', 1), '@', -1), ':', 1));
+	`,
+		Down: `
+	ALTER TABLE urls
+		DROP INDEX urls_owner_domain_idx,
+		DROP COLUMN title,
+		DROP COLUMN notes,
+		DROP COLUMN tags,
+		DROP COLUMN domain;
+	`,
+	},
+	{
+		//The existing urls were deduplicated on their original url, which stays their canonical url.
+		Version:     9,
+		Description: "deduplicate urls on their canonical url",
+		Up: `
+	ALTER TABLE urls
+		DROP INDEX urls_owner_original_url_key,
+		DROP COLUMN dedup_hash,
+		ADD COLUMN canonical_url TEXT;
+
+	UPDATE urls SET canonical_url=original_url;
+
+	ALTER TABLE urls
+		ADD COLUMN dedup_hash CHAR(64) AS (IF(dedup AND deleted_at IS NULL, SHA2(canonical_url, 256), NULL)) STORED,
+		ADD CONSTRAINT urls_owner_canonical_url_key UNIQUE (owner, dedup_hash);
+	`,
+		//a link deduplicated on its canonical url may share its original url with another one, the newer ones
+		//stop deduplicating so they do not collide.
+		Down: `
+	UPDATE urls u JOIN urls o ON o.owner=u.owner AND o.original_url=u.original_url AND o.dedup AND o.deleted_at IS NULL
+		AND (o.created_at < u.created_at OR (o.created_at = u.created_at AND o.id < u.id))
+	SET u.dedup=FALSE WHERE u.dedup AND u.deleted_at IS NULL;
+
+	ALTER TABLE urls
+		DROP INDEX urls_owner_canonical_url_key,
+		DROP COLUMN dedup_hash,
+		DROP COLUMN canonical_url;
+
+	ALTER TABLE urls
+		ADD COLUMN dedup_hash CHAR(64) AS (IF(dedup AND deleted_at IS NULL, SHA2(original_url, 256), NULL)) STORED,
+		ADD CONSTRAINT urls_owner_original_url_key UNIQUE (owner, dedup_hash);
+	`,
+	},
+	{
+		//The utm parameters of the existing urls are left empty, they stay in their original url.
+		Version:     10,
+		Description: "tag urls with utm parameters and save utm presets",
+		Up: `
+	ALTER TABLE urls
+		ADD COLUMN utm_source VARCHAR(255) NOT NULL DEFAULT '',
+		ADD COLUMN utm_medium VARCHAR(255) NOT NULL DEFAULT '',
+		ADD COLUMN utm_campaign VARCHAR(255) NOT NULL DEFAULT '',
+		ADD COLUMN utm_term VARCHAR(255) NOT NULL DEFAULT '',
+		ADD COLUMN utm_content VARCHAR(255) NOT NULL DEFAULT '',
+		ADD INDEX urls_owner_utm_campaign_idx (owner, utm_campaign);
+
+	CREATE TABLE IF NOT EXISTS utm_presets(
+		owner CHAR(36) NOT NULL,
+		name VARCHAR(64) NOT NULL,
+		utm_source VARCHAR(255) NOT NULL DEFAULT '',
+		utm_medium VARCHAR(255) NOT NULL DEFAULT '',
+		utm_campaign VARCHAR(255) NOT NULL DEFAULT '',
+		utm_term VARCHAR(255) NOT NULL DEFAULT '',
+		utm_content VARCHAR(255) NOT NULL DEFAULT '',
+		created_at DATETIME(6),
+		updated_at DATETIME(6),
+		PRIMARY KEY (owner, name),
+		CONSTRAINT utm_presets_owner_fkey FOREIGN KEY (owner) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+	`,
+		Down: `
+	DROP TABLE IF EXISTS utm_presets;
+
+	ALTER TABLE urls
+		DROP INDEX urls_owner_utm_campaign_idx,
+		DROP COLUMN utm_source,
+		DROP COLUMN utm_medium,
+		DROP COLUMN utm_campaign,
+		DROP COLUMN utm_term,
+		DROP COLUMN utm_content;
+	`,
+	},
+	{
+		Version:     11,
+		Description: "route visitors of urls to other destinations",
+		Up: `
+	ALTER TABLE urls ADD COLUMN routes JSON NOT NULL DEFAULT ('{}');
+	`,
+		Down: `
+	ALTER TABLE urls DROP COLUMN routes;
+	`,
+	},
+	{
+		Version:     12,
+		Description: "split the visitors of urls across weighted variants",
+		Up: `
+	ALTER TABLE urls ADD COLUMN variants JSON NOT NULL DEFAULT ('[]');
+	ALTER TABLE clicks ADD COLUMN variant VARCHAR(64) NOT NULL DEFAULT '';
+	`,
+		Down: `
+	ALTER TABLE clicks DROP COLUMN variant;
+	ALTER TABLE urls DROP COLUMN variants;
+	`,
+	},
+	{
+		Version:     13,
+		Description: "open urls in their mobile apps",
+		Up: `
+	ALTER TABLE urls ADD COLUMN app_links JSON NOT NULL DEFAULT ('{}');
+	`,
+		Down: `
+	ALTER TABLE urls DROP COLUMN app_links;
+	`,
+	},
+	{
+		//Every existing url is on the default short domain, its param stays unique there. A host is
+		//only unique among verified domains, verified_host is null until then and mysql lets nulls repeat.
+		Version:     14,
+		Description: "shorten urls on custom domains",
+		Up: `
+	CREATE TABLE IF NOT EXISTS domains(
+		id CHAR(36) PRIMARY KEY,
+		owner CHAR(36) NOT NULL,
+		host VARCHAR(255) NOT NULL,
+		token CHAR(36) NOT NULL,
+		verified_at DATETIME(6),
+		root_url VARCHAR(2048) NOT NULL DEFAULT '',
+		not_found_url VARCHAR(2048) NOT NULL DEFAULT '',
+		created_at DATETIME(6),
+		updated_at DATETIME(6),
+		verified_host VARCHAR(255) AS (IF(verified_at IS NULL, NULL, host)) STORED,
+		CONSTRAINT domains_host_key UNIQUE (verified_host),
+		CONSTRAINT domains_owner_host_key UNIQUE (owner, host),
+		CONSTRAINT domains_owner_fkey FOREIGN KEY (owner) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+	ALTER TABLE urls
+		ADD COLUMN short_domain VARCHAR(255) NOT NULL DEFAULT '',
+		DROP INDEX urls_short_url_param_idx,
+		ADD CONSTRAINT urls_short_url_param_idx UNIQUE (short_domain, short_url_param);
+	`,
+		//a url on a custom domain sharing its param with another url gets the start of its id appended,
+		//so that the params are unique again.
+		Down: `
+	UPDATE urls u JOIN urls o ON o.short_url_param=u.short_url_param AND o.id <> u.id AND (o.short_domain = '' OR o.id < u.id)
+	SET u.short_url_param=CONCAT(u.short_url_param, '-', LEFT(u.id, 8)) WHERE u.short_domain <> '';
+
+	ALTER TABLE urls
+		DROP INDEX urls_short_url_param_idx,
+		ADD CONSTRAINT urls_short_url_param_idx UNIQUE (short_url_param),
+		DROP COLUMN short_domain;
+
+	DROP TABLE IF EXISTS domains;
+	`,
+	},
+}
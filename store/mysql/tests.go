@@ -0,0 +1,80 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ory/dockertest/v3"
+)
+
+func NewTestDatabase(t *testing.T) (*Store, func()) {
+
+	ctx := context.Background()
+
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testContainer := NewMySQLContainer(pool)
+
+	testContainer.Create(t)
+
+	purgeContainer := func() {
+		t.Logf("Purging test container...")
+		//purge the test container
+		if err := testContainer.resource.Close(); err != nil {
+			t.Fatalf("Could not purge resource: %s", err)
+		}
+	}
+	opts := &Config{
+		Host:     "localhost:3306",
+		User:     "testcontainer",
+		Password: "Aa123456.",
+		Name:     "testcontainer",
+	}
+
+	db, err := connect(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := statusCheck(ctx, db); err != nil {
+		t.Fatalf("status check database: %s", err)
+	}
+
+	migrator := newMigrator(db)
+
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	closedb := func() {
+		t.Log("Closing database connection...")
+		//close database connection
+		db.Close()
+	}
+
+	dropdb := func() {
+		t.Log("Dropping database...")
+		//drop the database
+		if _, err := migrator.Down(context.Background(), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//tear down a table.
+	teardown := func() {
+		t.Helper()
+		dropdb()
+		closedb()
+		purgeContainer()
+	}
+
+	return &Store{
+		&userStore{db: db},
+		&urlStore{db: db},
+		&clickStore{db: db},
+		&utmStore{db: db},
+		&domainStore{db: db},
+	}, teardown
+}
@@ -0,0 +1,360 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/nairobi-gophers/fupisha/encoding"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/pkg/errors"
+)
+
+// urlColumns lists the urls columns store.URL maps to, leaving out generated columns.
+const urlColumns = `id,owner,original_url,canonical_url,short_url_param,visit_count,dedup,starts_at,expires_at,max_clicks,fallback_url,expired_at,password,deleted_at,title,notes,tags,domain,utm_source,utm_medium,utm_campaign,utm_term,utm_content,routes,variants,app_links,short_domain,created_at,updated_at`
+
+type urlStore struct {
+	db *sqlx.DB
+}
+
+// NewURL creates a new url record.
+func (u *urlStore) NewURL(ctx context.Context, url store.URL) (store.URL, error) {
+	if url.ShortDomain == "" {
+		return insertURL(ctx, u.db, url)
+	}
+
+	//the short domain has to stay put until the url is committed.
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return store.URL{}, errors.Wrap(err, "beginning url transaction")
+	}
+	defer tx.Rollback()
+
+	created, err := insertURL(ctx, tx, url)
+	if err != nil {
+		return store.URL{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return store.URL{}, errors.Wrap(err, "committing url transaction")
+	}
+
+	return created, nil
+}
+
+// NewURLs creates the url records in a single transaction, all of them or none.
+func (u *urlStore) NewURLs(ctx context.Context, urls []store.URL) ([]store.URL, error) {
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "beginning urls transaction")
+	}
+	defer tx.Rollback()
+
+	created := make([]store.URL, 0, len(urls))
+
+	for i, url := range urls {
+		ur, err := insertURL(ctx, tx, url)
+		if err != nil {
+			return nil, &store.BatchError{Index: i, Err: err}
+		}
+		created = append(created, ur)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "committing urls transaction")
+	}
+
+	return created, nil
+}
+
+// insertURL creates a new url record through db, which is either the database or a transaction.
+func insertURL(ctx context.Context, db sqlx.ExtContext, url store.URL) (store.URL, error) {
+
+	now := time.Now().UTC().Round(time.Microsecond)
+
+	url.ID = encoding.GenUniqueID()
+	url.VisitCount = nil
+	url.ExpiredAt = nil
+	url.StartsAt = roundTime(url.StartsAt)
+	url.ExpiresAt = roundTime(url.ExpiresAt)
+	url.CreatedAt = now
+	url.UpdatedAt = now
+	url.Domain = store.Hostname(url.OriginalURL)
+	url.CanonicalURL = url.Canonical()
+
+	if err := url.HashPassword(); err != nil {
+		return store.URL{}, err
+	}
+
+	if err := checkShortDomain(ctx, db, url); err != nil {
+		return store.URL{}, err
+	}
+
+	const q = `INSERT INTO urls (id,owner,original_url,canonical_url,short_url_param,dedup,starts_at,expires_at,max_clicks,fallback_url,password,title,notes,tags,domain,utm_source,utm_medium,utm_campaign,utm_term,utm_content,routes,variants,app_links,short_domain,created_at,updated_at) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
+
+	if _, err := db.ExecContext(ctx, q, url.ID, url.Owner, url.OriginalURL, url.CanonicalURL, url.ShortenedURLParam, url.Dedup, url.StartsAt, url.ExpiresAt, url.MaxClicks, url.FallbackURL, url.Password, url.Title, url.Notes, url.Tags, url.Domain, url.UTM.Source, url.UTM.Medium, url.UTM.Campaign, url.UTM.Term, url.UTM.Content, url.Routes, url.Variants, url.AppLinks, url.ShortDomain, url.CreatedAt, url.UpdatedAt); err != nil {
+		return store.URL{}, errors.Wrap(translate(err), "inserting new url")
+	}
+
+	return url, nil
+}
+
+// checkShortDomain returns store.ErrUnverifiedDomain unless the short domain of the url is one of its owner's
+// verified domains. Called in a transaction it locks it until the url is committed so that DeleteDomain can not remove it under the url.
+func checkShortDomain(ctx context.Context, db sqlx.QueryerContext, url store.URL) error {
+	if url.ShortDomain == "" {
+		return nil
+	}
+
+	var verified bool
+
+	const q = `SELECT true FROM domains WHERE owner=? AND host=? AND verified_at IS NOT NULL LOCK IN SHARE MODE`
+
+	err := db.QueryRowxContext(ctx, q, url.Owner, url.ShortDomain).Scan(&verified)
+	if err == sql.ErrNoRows {
+		return errors.Wrap(store.ErrUnverifiedDomain, "inserting new url")
+	}
+	if err != nil {
+		return errors.Wrap(err, "checking short domain")
+	}
+
+	return nil
+}
+
+// GetURLByID retrieves the short url by its given id.
+func (u *urlStore) GetURLByID(ctx context.Context, id uuid.UUID) (store.URL, error) {
+	var url store.URL
+
+	const q = `SELECT ` + urlColumns + ` FROM urls WHERE id=?`
+
+	if err := u.db.GetContext(ctx, &url, q, id); err != nil {
+		return store.URL{}, errors.Wrap(err, "retrieving url by id")
+	}
+
+	return url, nil
+}
+
+// GetURLByParam retrieves the short url by its given param on the default short domain.
+func (u *urlStore) GetURLByParam(ctx context.Context, param string) (store.URL, error) {
+	return u.GetDomainURLByParam(ctx, "", param)
+}
+
+// GetDomainURLByParam retrieves the short url by its given param on the given short domain.
+func (u *urlStore) GetDomainURLByParam(ctx context.Context, domain, param string) (store.URL, error) {
+	var url store.URL
+
+	const q = `SELECT ` + urlColumns + ` FROM urls WHERE short_domain=? AND short_url_param=? AND deleted_at IS NULL`
+	if err := u.db.GetContext(ctx, &url, q, domain, param); err != nil {
+		return store.URL{}, errors.Wrap(err, "retrieving url by param")
+	}
+
+	return url, nil
+}
+
+// ParamTaken reports whether a url, deleted or not, goes by the param on the given short domain.
+func (u *urlStore) ParamTaken(ctx context.Context, domain, param string) (bool, error) {
+	var taken bool
+
+	const q = `SELECT EXISTS (SELECT 1 FROM urls WHERE short_domain=? AND short_url_param=?)`
+	if err := u.db.GetContext(ctx, &taken, q, domain, param); err != nil {
+		return false, errors.Wrap(err, "checking param")
+	}
+
+	return taken, nil
+}
+
+// GetURLByLongStr retrieves the owner's dedup short url of the given canonical url.
+func (u *urlStore) GetURLByLongStr(ctx context.Context, owner uuid.UUID, canonicalURL string) (store.URL, error) {
+	var url store.URL
+
+	const q = `SELECT ` + urlColumns + ` FROM urls WHERE owner=? AND dedup_hash=SHA2(?, 256)`
+	if err := u.db.GetContext(ctx, &url, q, owner, canonicalURL); err != nil {
+		return store.URL{}, errors.Wrap(err, "retrieving short url param by long url")
+	}
+
+	return url, nil
+}
+
+// GetURLsByOwner retrieves every url of the owner, newest first.
+func (u *urlStore) GetURLsByOwner(ctx context.Context, owner uuid.UUID) ([]store.URL, error) {
+	urls := []store.URL{}
+
+	const q = `SELECT ` + urlColumns + ` FROM urls WHERE owner=? ORDER BY created_at DESC, id DESC`
+	if err := u.db.SelectContext(ctx, &urls, q, owner); err != nil {
+		return nil, errors.Wrap(err, "retrieving urls by owner")
+	}
+
+	return urls, nil
+}
+
+// FindURLs retrieves a page of the owner's urls matching the filter, newest first.
+func (u *urlStore) FindURLs(ctx context.Context, filter store.URLFilter) ([]store.URL, error) {
+	urls := []store.URL{}
+
+	var (
+		conds []string
+		args  []interface{}
+	)
+
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "?"
+	}
+
+	conds = append(conds, "owner="+arg(filter.Owner))
+
+	if filter.Deleted {
+		conds = append(conds, "deleted_at IS NOT NULL")
+	} else {
+		conds = append(conds, "deleted_at IS NULL")
+	}
+
+	if filter.CreatedAfter != nil {
+		conds = append(conds, "created_at>="+arg(*roundTime(filter.CreatedAfter)))
+	}
+
+	if filter.CreatedBefore != nil {
+		conds = append(conds, "created_at<"+arg(*roundTime(filter.CreatedBefore)))
+	}
+
+	if filter.Domain != "" {
+		conds = append(conds, "(domain="+arg(filter.Domain)+" OR domain LIKE "+arg("%."+escapeLike(filter.Domain))+" ESCAPE '\\\\')")
+	}
+
+	if len(filter.Tags) > 0 {
+		conds = append(conds, "JSON_CONTAINS(tags, "+arg(store.Tags(filter.Tags))+")")
+	}
+
+	if filter.Campaign != "" {
+		conds = append(conds, "utm_campaign="+arg(filter.Campaign))
+	}
+
+	switch filter.State {
+	case store.URLActive:
+		now := time.Now().UTC().Round(time.Microsecond)
+		conds = append(conds, "(starts_at IS NULL OR starts_at<="+arg(now)+") AND expired_at IS NULL AND (expires_at IS NULL OR expires_at>"+arg(now)+") AND (max_clicks IS NULL OR COALESCE(visit_count,0)<max_clicks)")
+	case store.URLExpired:
+		conds = append(conds, "(expired_at IS NOT NULL OR expires_at<="+arg(time.Now().UTC().Round(time.Microsecond))+" OR COALESCE(visit_count,0)>=max_clicks)")
+	}
+
+	//there is no full-text index, every word of the search has to appear somewhere in the url or its description.
+	//words match by prefix like the postgresql search, search terms are made of letters and digits only.
+	for _, term := range store.SearchTerms(filter.Search) {
+		conds = append(conds, "LOWER(CONCAT_WS(' ', original_url, short_url_param, title, notes)) REGEXP "+arg("(^|[^[:alnum:]])"+term))
+	}
+
+	if filter.After != nil {
+		conds = append(conds, "(created_at,id)<("+arg(filter.After.CreatedAt.UTC().Round(time.Microsecond))+","+arg(filter.After.ID)+")")
+	}
+
+	q := `SELECT ` + urlColumns + ` FROM urls WHERE ` + strings.Join(conds, " AND ") + ` ORDER BY created_at DESC, id DESC`
+
+	if filter.Limit > 0 {
+		q += ` LIMIT ` + arg(filter.Limit)
+	}
+
+	if err := u.db.SelectContext(ctx, &urls, q, args...); err != nil {
+		return nil, errors.Wrap(err, "finding urls")
+	}
+
+	return urls, nil
+}
+
+// CampaignStats counts the owner's live urls per utm campaign and the clicks on them, most clicked first.
+func (u *urlStore) CampaignStats(ctx context.Context, owner uuid.UUID) ([]store.CampaignStats, error) {
+	stats := []store.CampaignStats{}
+
+	const q = `SELECT utm_campaign AS campaign, COUNT(*) AS links, COALESCE(SUM(visit_count),0) AS clicks FROM urls
+	WHERE owner=? AND deleted_at IS NULL AND utm_campaign<>'' GROUP BY utm_campaign ORDER BY clicks DESC, campaign`
+	if err := u.db.SelectContext(ctx, &stats, q, owner); err != nil {
+		return nil, errors.Wrap(err, "counting urls per campaign")
+	}
+
+	return stats, nil
+}
+
+// UpdateURL saves the original and canonical url, param, schedule, description, utm parameters, routes, variants and app links of the given url and clears its expired at.
+func (u *urlStore) UpdateURL(ctx context.Context, url store.URL) (store.URL, error) {
+	const q = `UPDATE urls SET original_url=?,canonical_url=?,short_url_param=?,starts_at=?,expires_at=?,max_clicks=?,fallback_url=?,title=?,notes=?,tags=?,domain=?,utm_source=?,utm_medium=?,utm_campaign=?,utm_term=?,utm_content=?,routes=?,variants=?,app_links=?,expired_at=NULL,updated_at=? WHERE id=?`
+
+	res, err := u.db.ExecContext(ctx, q, url.OriginalURL, url.Canonical(), url.ShortenedURLParam, roundTime(url.StartsAt), roundTime(url.ExpiresAt), url.MaxClicks, url.FallbackURL, url.Title, url.Notes, url.Tags, store.Hostname(url.OriginalURL), url.UTM.Source, url.UTM.Medium, url.UTM.Campaign, url.UTM.Term, url.UTM.Content, url.Routes, url.Variants, url.AppLinks, time.Now().UTC().Round(time.Microsecond), url.ID)
+	if err != nil {
+		return store.URL{}, errors.Wrap(translate(err), "updating url")
+	}
+
+	if err := affectedOne(res); err != nil {
+		return store.URL{}, errors.Wrap(err, "updating url")
+	}
+
+	return u.GetURLByID(ctx, url.ID)
+}
+
+// DeleteURL soft deletes the url, it stops redirecting but keeps its param until it is restored.
+func (u *urlStore) DeleteURL(ctx context.Context, id uuid.UUID) error {
+	const q = `UPDATE urls SET deleted_at=? WHERE id=? AND deleted_at IS NULL`
+
+	res, err := u.db.ExecContext(ctx, q, time.Now().UTC().Round(time.Microsecond), id)
+	if err != nil {
+		return errors.Wrap(err, "deleting url")
+	}
+
+	return errors.Wrap(affectedOne(res), "deleting url")
+}
+
+// RestoreURL brings back a deleted url.
+func (u *urlStore) RestoreURL(ctx context.Context, id uuid.UUID) error {
+	const q = `UPDATE urls SET deleted_at=NULL WHERE id=? AND deleted_at IS NOT NULL`
+
+	res, err := u.db.ExecContext(ctx, q, id)
+	if err != nil {
+		return errors.Wrap(translate(err), "restoring url")
+	}
+
+	return errors.Wrap(affectedOne(res), "restoring url")
+}
+
+// ExpireURLs marks the urls that expired or ran out of clicks by now and returns how many it marked.
+func (u *urlStore) ExpireURLs(ctx context.Context, now time.Time) (int64, error) {
+	const q = `UPDATE urls SET expired_at=? WHERE expired_at IS NULL AND (expires_at <= ? OR COALESCE(visit_count,0) >= max_clicks)`
+
+	now = now.UTC().Round(time.Microsecond)
+
+	res, err := u.db.ExecContext(ctx, q, now, now)
+	if err != nil {
+		return 0, errors.Wrap(err, "expiring urls")
+	}
+
+	return res.RowsAffected()
+}
+
+// roundTime returns a copy of t in UTC rounded to the microsecond, like every other stored time.
+func roundTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	rounded := t.UTC().Round(time.Microsecond)
+	return &rounded
+}
+
+// escapeLike escapes the LIKE wildcards in s so that it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// affectedOne returns sql.ErrNoRows when the statement changed no url.
+func affectedOne(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,697 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/nairobi-gophers/fupisha/encoding"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/pkg/errors"
+)
+
+func TestURL(t *testing.T) {
+	s, teardown := NewTestDatabase(t)
+	t.Cleanup(teardown)
+
+	ctx := context.Background()
+
+	u, err := s.NewUser(ctx, "test_user@test.com", "test_password")
+
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	originalURL := "http://highscalability.com/blog/2016/1/25/design-of-a-modern-cache.html"
+
+	param, err := encoding.GenUniqueParam("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890", 6)
+
+	if err != nil {
+		t.Fatalf("failed to generate url param: %s", err)
+	}
+
+	url, err := s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: originalURL, ShortenedURLParam: param, Dedup: true})
+	if err != nil {
+		t.Fatalf("failed to create url: %s", err)
+	}
+
+	want := store.URL{
+		ID:                url.ID,
+		Owner:             u.ID,
+		OriginalURL:       originalURL,
+		CanonicalURL:      originalURL,
+		ShortenedURLParam: param,
+		Domain:            "highscalability.com",
+		CreatedAt:         url.CreatedAt,
+		UpdatedAt:         url.UpdatedAt,
+		Dedup:             true,
+	}
+
+	got, err := s.GetURLByParam(ctx, param)
+	if err != nil {
+		t.Fatalf("failed to retrieve url param: %s", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v\n want %+v\n", got, want)
+	}
+
+	url2, err := s.GetURLByID(ctx, url.ID)
+	if err != nil {
+		t.Fatalf("failed to retrieve url by id: %s", err)
+	}
+
+	if !reflect.DeepEqual(url, url2) {
+		t.Fatalf("got %+v\n want %+v\n", url2, url)
+	}
+
+	url3, err := s.GetURLByLongStr(ctx, u.ID, originalURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if url3.OriginalURL != originalURL {
+		t.Fatalf("got %v want %v\n", url3.OriginalURL, originalURL)
+	}
+
+	if _, err := s.GetURLByParam(ctx, "missing"); errors.Cause(err) != sql.ErrNoRows {
+		t.Fatalf("got %v want %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestURLConstraints(t *testing.T) {
+	s, teardown := NewTestDatabase(t)
+	t.Cleanup(teardown)
+
+	ctx := context.Background()
+
+	u, err := s.NewUser(ctx, "test_user@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	if _, err := s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://fupisha.io/a", ShortenedURLParam: "abcdef", Dedup: true}); err != nil {
+		t.Fatalf("failed to create url: %s", err)
+	}
+
+	tests := []struct {
+		name           string
+		owner          store.User
+		originalURL    string
+		param          string
+		wantCode       pq.ErrorCode
+		wantConstraint string
+	}{
+		{
+			name:           "duplicate original url",
+			owner:          u,
+			originalURL:    "https://fupisha.io/a",
+			param:          "ghijkl",
+			wantCode:       "23505",
+			wantConstraint: store.UniqueURLLongStr,
+		},
+		{
+			name:           "duplicate short url param",
+			owner:          u,
+			originalURL:    "https://fupisha.io/b",
+			param:          "abcdef",
+			wantCode:       "23505",
+			wantConstraint: store.UniqueURLParam,
+		},
+		{
+			name:           "unknown owner",
+			owner:          store.User{ID: encoding.GenUniqueID()},
+			originalURL:    "https://fupisha.io/c",
+			param:          "mnopqr",
+			wantCode:       "23503",
+			wantConstraint: store.ForeignURLOwner,
+		},
+	}
+
+	for _, tc := range tests {
+		_, err := s.NewURL(ctx, store.URL{Owner: tc.owner.ID, OriginalURL: tc.originalURL, ShortenedURLParam: tc.param, Dedup: true})
+
+		pqErr, ok := errors.Cause(err).(*pq.Error)
+		if !ok {
+			t.Fatalf("%s: got %v want a *pq.Error", tc.name, err)
+		}
+
+		if pqErr.Code != tc.wantCode || pqErr.Constraint != tc.wantConstraint {
+			t.Fatalf("%s: got %s %q want %s %q", tc.name, pqErr.Code, pqErr.Constraint, tc.wantCode, tc.wantConstraint)
+		}
+	}
+}
+
+func TestURLOwnership(t *testing.T) {
+	s, teardown := NewTestDatabase(t)
+	t.Cleanup(teardown)
+
+	ctx := context.Background()
+
+	a, err := s.NewUser(ctx, "a@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	b, err := s.NewUser(ctx, "b@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	const originalURL = "https://fupisha.io/a"
+
+	urls := []store.URL{
+		{Owner: a.ID, OriginalURL: originalURL, ShortenedURLParam: "aaaaaa", Dedup: true},
+		//the same url shortened by another user is theirs alone.
+		{Owner: b.ID, OriginalURL: originalURL, ShortenedURLParam: "bbbbbb", Dedup: true},
+		//urls shortened without dedup never collide on their original url.
+		{Owner: a.ID, OriginalURL: originalURL, ShortenedURLParam: "cccccc"},
+		{Owner: a.ID, OriginalURL: originalURL, ShortenedURLParam: "dddddd"},
+	}
+
+	for i, url := range urls {
+		created, err := s.NewURL(ctx, url)
+		if err != nil {
+			t.Fatalf("failed to create url %s: %s", url.ShortenedURLParam, err)
+		}
+		urls[i] = created
+	}
+
+	for _, owner := range []store.User{a, b} {
+		got, err := s.GetURLByLongStr(ctx, owner.ID, originalURL)
+		if err != nil {
+			t.Fatalf("failed to retrieve url by long url: %s", err)
+		}
+
+		if got.Owner != owner.ID || !got.Dedup {
+			t.Fatalf("got %+v want the dedup url of %s", got, owner.Email)
+		}
+	}
+
+	owned, err := s.GetURLsByOwner(ctx, a.ID)
+	if err != nil {
+		t.Fatalf("failed to retrieve urls by owner: %s", err)
+	}
+
+	if len(owned) != 3 {
+		t.Fatalf("got %d urls want 3", len(owned))
+	}
+
+	for i := 1; i < len(owned); i++ {
+		if owned[i].CreatedAt.After(owned[i-1].CreatedAt) {
+			t.Fatalf("got urls out of order: %+v", owned)
+		}
+	}
+
+	if none, err := s.GetURLsByOwner(ctx, encoding.GenUniqueID()); err != nil || none == nil || len(none) != 0 {
+		t.Fatalf("got %v, %v want no urls for an owner without any", none, err)
+	}
+
+	if _, err := s.GetURLByLongStr(ctx, a.ID, "https://fupisha.io/missing"); err == nil {
+		t.Fatal("want an error for a url the owner never shortened")
+	}
+}
+
+func TestURLExpiry(t *testing.T) {
+	s, teardown := NewTestDatabase(t)
+	t.Cleanup(teardown)
+	ctx := context.Background()
+
+	u, err := s.NewUser(ctx, "test_user@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	now := time.Now().UTC().Round(time.Microsecond)
+	startsAt, expiresAt, maxClicks := now.Add(-time.Hour), now.Add(time.Hour), 2
+
+	capped, err := s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://fupisha.io/a", ShortenedURLParam: "aaaaaa", StartsAt: &startsAt, ExpiresAt: &expiresAt, MaxClicks: &maxClicks, FallbackURL: "https://fupisha.io/over"})
+	if err != nil {
+		t.Fatalf("failed to create url: %s", err)
+	}
+
+	got, err := s.GetURLByID(ctx, capped.ID)
+	if err != nil {
+		t.Fatalf("failed to retrieve url: %s", err)
+	}
+
+	if !got.StartsAt.Equal(startsAt) || !got.ExpiresAt.Equal(expiresAt) || *got.MaxClicks != maxClicks || got.FallbackURL != "https://fupisha.io/over" || got.ExpiredAt != nil {
+		t.Fatalf("got %+v want the expiry settings it was created with", got)
+	}
+
+	for i := 0; i < maxClicks; i++ {
+		if _, err := s.NewClick(ctx, store.Click{URLID: capped.ID}); err != nil {
+			t.Fatalf("failed to create click %d: %s", i, err)
+		}
+	}
+
+	if _, err := s.NewClick(ctx, store.Click{URLID: capped.ID}); errors.Cause(err) != store.ErrClickLimit {
+		t.Fatalf("got %v want %v", err, store.ErrClickLimit)
+	}
+
+	expiredAt := now.Add(-time.Minute)
+	if _, err := s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://fupisha.io/b", ShortenedURLParam: "bbbbbb", ExpiresAt: &expiredAt}); err != nil {
+		t.Fatalf("failed to create url: %s", err)
+	}
+
+	if _, err := s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://fupisha.io/c", ShortenedURLParam: "cccccc", ExpiresAt: &expiresAt}); err != nil {
+		t.Fatalf("failed to create url: %s", err)
+	}
+
+	for _, want := range []int64{2, 0} {
+		n, err := s.ExpireURLs(ctx, now)
+		if err != nil {
+			t.Fatalf("failed to expire urls: %s", err)
+		}
+
+		if n != want {
+			t.Fatalf("got %d expired urls want %d", n, want)
+		}
+	}
+
+	for param, want := range map[string]bool{"aaaaaa": true, "bbbbbb": true, "cccccc": false} {
+		url, err := s.GetURLByParam(ctx, param)
+		if err != nil {
+			t.Fatalf("failed to retrieve url: %s", err)
+		}
+
+		if (url.ExpiredAt != nil) != want {
+			t.Fatalf("%s: got expired at %v want expired %t", param, url.ExpiredAt, want)
+		}
+	}
+}
+
+func TestURLRoutes(t *testing.T) {
+	s, teardown := NewTestDatabase(t)
+	t.Cleanup(teardown)
+	ctx := context.Background()
+
+	u, err := s.NewUser(ctx, "test_user@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	routes := store.Routes{
+		Timezone: "Africa/Nairobi",
+		Rules: []store.Route{
+			{Destination: "https://fupisha.io/ke", Countries: []string{"KE", "TZ"}, Devices: []string{"mobile"}},
+			{Destination: "https://fupisha.io/night", Days: []string{"sat"}, StartTime: "22:00", EndTime: "06:00"},
+		},
+	}
+
+	url, err := s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://fupisha.io/a", ShortenedURLParam: "aaaaaa", Routes: routes})
+	if err != nil {
+		t.Fatalf("failed to create url: %s", err)
+	}
+
+	got, err := s.GetURLByParam(ctx, "aaaaaa")
+	if err != nil {
+		t.Fatalf("failed to retrieve url: %s", err)
+	}
+
+	if !reflect.DeepEqual(got.Routes, routes) {
+		t.Fatalf("got routes %+v want %+v", got.Routes, routes)
+	}
+
+	url.Routes = store.Routes{}
+	if _, err := s.UpdateURL(ctx, url); err != nil {
+		t.Fatalf("failed to update url: %s", err)
+	}
+
+	got, err = s.GetURLByParam(ctx, "aaaaaa")
+	if err != nil {
+		t.Fatalf("failed to retrieve url: %s", err)
+	}
+
+	if !got.Routes.IsZero() || got.Routes.Timezone != "" {
+		t.Fatalf("got routes %+v after removing them", got.Routes)
+	}
+}
+
+func TestURLAppLinks(t *testing.T) {
+	s, teardown := NewTestDatabase(t)
+	t.Cleanup(teardown)
+	ctx := context.Background()
+
+	u, err := s.NewUser(ctx, "test_user@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	links := store.AppLinks{IOS: "acme://product/7", Android: "https://acme.com/product/7", IOSStore: "https://apps.apple.com/app/id42"}
+
+	url, err := s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://fupisha.io/a", ShortenedURLParam: "aaaaaa", AppLinks: links})
+	if err != nil {
+		t.Fatalf("failed to create url: %s", err)
+	}
+
+	got, err := s.GetURLByParam(ctx, "aaaaaa")
+	if err != nil {
+		t.Fatalf("failed to retrieve url: %s", err)
+	}
+
+	if got.AppLinks != links {
+		t.Fatalf("got app links %+v want %+v", got.AppLinks, links)
+	}
+
+	url.AppLinks = store.AppLinks{}
+	if _, err := s.UpdateURL(ctx, url); err != nil {
+		t.Fatalf("failed to update url: %s", err)
+	}
+
+	got, err = s.GetURLByParam(ctx, "aaaaaa")
+	if err != nil {
+		t.Fatalf("failed to retrieve url: %s", err)
+	}
+
+	if !got.AppLinks.IsZero() {
+		t.Fatalf("got app links %+v after removing them", got.AppLinks)
+	}
+}
+
+func TestURLPassword(t *testing.T) {
+	s, teardown := NewTestDatabase(t)
+	t.Cleanup(teardown)
+	ctx := context.Background()
+
+	u, err := s.NewUser(ctx, "test_user@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	if _, err := s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://fupisha.io/a", ShortenedURLParam: "aaaaaa", Password: "open sesame"}); err != nil {
+		t.Fatalf("failed to create url: %s", err)
+	}
+
+	got, err := s.GetURLByParam(ctx, "aaaaaa")
+	if err != nil {
+		t.Fatalf("failed to retrieve url: %s", err)
+	}
+
+	if !got.Protected() || got.Password == "open sesame" {
+		t.Fatalf("got password %q want it hashed", got.Password)
+	}
+
+	if !got.ComparePassword("open sesame") || got.ComparePassword("open barley") {
+		t.Fatal("want only the url password to match")
+	}
+}
+
+func TestURLLifecycle(t *testing.T) {
+	s, teardown := NewTestDatabase(t)
+	t.Cleanup(teardown)
+	ctx := context.Background()
+
+	u, err := s.NewUser(ctx, "test_user@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	url, err := s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://fupisha.io/a", ShortenedURLParam: "aaaaaa", Dedup: true})
+	if err != nil {
+		t.Fatalf("failed to create url: %s", err)
+	}
+
+	if _, err := s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://fupisha.io/b", ShortenedURLParam: "bbbbbb", Dedup: true}); err != nil {
+		t.Fatalf("failed to create url: %s", err)
+	}
+
+	wantCode := func(err error, constraint string) {
+		t.Helper()
+		pqErr, ok := errors.Cause(err).(*pq.Error)
+		if !ok || pqErr.Code != "23505" || pqErr.Constraint != constraint {
+			t.Fatalf("got %v want a unique violation of %s", err, constraint)
+		}
+	}
+
+	//dedup urls are unique per canonical url, however their original url is spelled.
+	_, err = s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "HTTPS://Fupisha.io:443/b", CanonicalURL: "https://fupisha.io/b", ShortenedURLParam: "dddddd", Dedup: true})
+	wantCode(err, store.UniqueURLLongStr)
+
+	if got, err := s.GetURLByLongStr(ctx, u.ID, "https://fupisha.io/b"); err != nil || got.ShortenedURLParam != "bbbbbb" {
+		t.Fatalf("got %+v, %v want the url found by its canonical url", got, err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Round(time.Microsecond)
+
+	url.OriginalURL = "https://fupisha.io/c"
+	url.CanonicalURL = "https://fupisha.io/c"
+	url.ShortenedURLParam = "cccccc"
+	url.ExpiresAt = &expiresAt
+
+	updated, err := s.UpdateURL(ctx, url)
+	if err != nil {
+		t.Fatalf("failed to update url: %s", err)
+	}
+
+	if updated.OriginalURL != url.OriginalURL || updated.ShortenedURLParam != "cccccc" || !updated.ExpiresAt.Equal(expiresAt) || updated.UpdatedAt.Before(url.UpdatedAt) {
+		t.Fatalf("got %+v want the url updated", updated)
+	}
+
+	if _, err := s.GetURLByParam(ctx, "aaaaaa"); errors.Cause(err) != sql.ErrNoRows {
+		t.Fatalf("got %v want the old param released", err)
+	}
+
+	url.ShortenedURLParam = "bbbbbb"
+	_, err = s.UpdateURL(ctx, url)
+	wantCode(err, store.UniqueURLParam)
+
+	url.ShortenedURLParam = "cccccc"
+	url.OriginalURL = "https://fupisha.io/b"
+	url.CanonicalURL = "https://fupisha.io/b"
+	_, err = s.UpdateURL(ctx, url)
+	wantCode(err, store.UniqueURLLongStr)
+
+	if err := s.DeleteURL(ctx, url.ID); err != nil {
+		t.Fatalf("failed to delete url: %s", err)
+	}
+
+	if err := s.DeleteURL(ctx, url.ID); errors.Cause(err) != sql.ErrNoRows {
+		t.Fatalf("got %v want deleting a deleted url to fail", err)
+	}
+
+	if _, err := s.GetURLByParam(ctx, "cccccc"); errors.Cause(err) != sql.ErrNoRows {
+		t.Fatalf("got %v want deleted urls to stop redirecting", err)
+	}
+
+	if taken, err := s.ParamTaken(ctx, "", "cccccc"); err != nil || !taken {
+		t.Fatalf("got %t, %v want the param of a deleted url taken", taken, err)
+	}
+
+	if taken, err := s.ParamTaken(ctx, "go.acme.com", "cccccc"); err != nil || taken {
+		t.Fatalf("got %t, %v want the param free on another short domain", taken, err)
+	}
+
+	deleted, err := s.GetURLByID(ctx, url.ID)
+	if err != nil || deleted.DeletedAt == nil {
+		t.Fatalf("got %+v, %v want the deleted url kept", deleted, err)
+	}
+
+	//the deleted dedup url no longer holds on to its original url.
+	replacement, err := s.NewURL(ctx, store.URL{Owner: u.ID, OriginalURL: "https://fupisha.io/c", ShortenedURLParam: "dddddd", Dedup: true})
+	if err != nil {
+		t.Fatalf("failed to create url: %s", err)
+	}
+
+	wantCode(s.RestoreURL(ctx, url.ID), store.UniqueURLLongStr)
+
+	if err := s.DeleteURL(ctx, replacement.ID); err != nil {
+		t.Fatalf("failed to delete url: %s", err)
+	}
+
+	if err := s.RestoreURL(ctx, url.ID); err != nil {
+		t.Fatalf("failed to restore url: %s", err)
+	}
+
+	restored, err := s.GetURLByParam(ctx, "cccccc")
+	if err != nil || restored.ID != url.ID || restored.DeletedAt != nil {
+		t.Fatalf("got %+v, %v want the url restored", restored, err)
+	}
+
+	if _, err := s.UpdateURL(ctx, store.URL{ID: encoding.GenUniqueID(), OriginalURL: "https://fupisha.io/e", ShortenedURLParam: "eeeeee"}); errors.Cause(err) != sql.ErrNoRows {
+		t.Fatalf("got %v want updating a missing url to fail", err)
+	}
+}
+
+func TestFindURLs(t *testing.T) {
+	s, teardown := NewTestDatabase(t)
+	t.Cleanup(teardown)
+	ctx := context.Background()
+
+	a, err := s.NewUser(ctx, "a@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	b, err := s.NewUser(ctx, "b@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	now := time.Now().UTC().Round(time.Microsecond)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	for _, url := range []store.URL{
+		{Owner: a.ID, OriginalURL: "https://www.fupisha.io/blog/go-generics", ShortenedURLParam: "gener1", Title: "Go Generics", Tags: store.Tags{"go", "blog"}},
+		{Owner: a.ID, OriginalURL: "https://fupisha.io/docs", ShortenedURLParam: "docs01", Notes: "Internal documentation", Tags: store.Tags{"docs"}},
+		{Owner: a.ID, OriginalURL: "https://example.com/pricing", ShortenedURLParam: "price1", ExpiresAt: &past, Tags: store.Tags{"blog"}},
+		{Owner: a.ID, OriginalURL: "https://example.org/later", ShortenedURLParam: "later1", StartsAt: &future},
+		{Owner: a.ID, OriginalURL: "https://fupisha.io/old", ShortenedURLParam: "old001"},
+		{Owner: b.ID, OriginalURL: "https://fupisha.io/other", ShortenedURLParam: "other1", Tags: store.Tags{"blog"}},
+	} {
+		created, err := s.NewURL(ctx, url)
+		if err != nil {
+			t.Fatalf("failed to create url %s: %s", url.ShortenedURLParam, err)
+		}
+
+		if created.ShortenedURLParam == "old001" {
+			if err := s.DeleteURL(ctx, created.ID); err != nil {
+				t.Fatalf("failed to delete url: %s", err)
+			}
+		}
+	}
+
+	find := func(filter store.URLFilter) []store.URL {
+		t.Helper()
+		filter.Owner = a.ID
+		urls, err := s.FindURLs(ctx, filter)
+		if err != nil {
+			t.Fatalf("failed to find urls: %s", err)
+		}
+		return urls
+	}
+
+	params := func(urls []store.URL) []string {
+		got := []string{}
+		for _, url := range urls {
+			got = append(got, url.ShortenedURLParam)
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	tests := []struct {
+		name   string
+		filter store.URLFilter
+		want   []string
+	}{
+		{name: "every live url", filter: store.URLFilter{}, want: []string{"docs01", "gener1", "later1", "price1"}},
+		{name: "deleted urls", filter: store.URLFilter{Deleted: true}, want: []string{"old001"}},
+		{name: "domain and subdomains", filter: store.URLFilter{Domain: "fupisha.io"}, want: []string{"docs01", "gener1"}},
+		{name: "subdomain", filter: store.URLFilter{Domain: "www.fupisha.io"}, want: []string{"gener1"}},
+		{name: "tag", filter: store.URLFilter{Tags: []string{"blog"}}, want: []string{"gener1", "price1"}},
+		{name: "every tag", filter: store.URLFilter{Tags: []string{"blog", "go"}}, want: []string{"gener1"}},
+		{name: "active", filter: store.URLFilter{State: store.URLActive}, want: []string{"docs01", "gener1"}},
+		{name: "expired", filter: store.URLFilter{State: store.URLExpired}, want: []string{"price1"}},
+		{name: "search title", filter: store.URLFilter{Search: "GENERICS"}, want: []string{"gener1"}},
+		{name: "search notes", filter: store.URLFilter{Search: "documentation"}, want: []string{"docs01"}},
+		{name: "search every word", filter: store.URLFilter{Search: "fupisha.io docs"}, want: []string{"docs01"}},
+		{name: "search word prefix", filter: store.URLFilter{Search: "pric"}, want: []string{"price1"}},
+		{name: "search inside a word", filter: store.URLFilter{Search: "ample"}, want: []string{}},
+		{name: "created before", filter: store.URLFilter{CreatedBefore: &past}, want: []string{}},
+		{name: "created after", filter: store.URLFilter{CreatedAfter: &past}, want: []string{"docs01", "gener1", "later1", "price1"}},
+	}
+
+	for _, tc := range tests {
+		if got := params(find(tc.filter)); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%s: got %v want %v", tc.name, got, tc.want)
+		}
+	}
+
+	all := find(store.URLFilter{})
+
+	var paged []store.URL
+	filter := store.URLFilter{Limit: 3}
+	for {
+		page := find(filter)
+		paged = append(paged, page...)
+		if len(page) < filter.Limit {
+			break
+		}
+		last := page[len(page)-1]
+		filter.After = &store.URLCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	if !reflect.DeepEqual(paged, all) {
+		t.Fatalf("got pages %v want %v", params(paged), params(all))
+	}
+
+	for i := 1; i < len(all); i++ {
+		if all[i].CreatedAt.After(all[i-1].CreatedAt) {
+			t.Fatalf("got urls out of order: %+v", all)
+		}
+	}
+
+	url := find(store.URLFilter{Search: "generics"})[0]
+	if url.Domain != "www.fupisha.io" || !reflect.DeepEqual(url.Tags, store.Tags{"go", "blog"}) {
+		t.Fatalf("got domain %q tags %v want them stored", url.Domain, url.Tags)
+	}
+
+	url.OriginalURL = "https://golang.org/doc"
+	url.CanonicalURL = "https://golang.org/doc"
+	url.Title = "Go docs"
+	url.Tags = store.Tags{"go", "docs"}
+	if _, err := s.UpdateURL(ctx, url); err != nil {
+		t.Fatalf("failed to update url: %s", err)
+	}
+
+	if got := params(find(store.URLFilter{Domain: "golang.org", Tags: []string{"docs"}, Search: "go docs"})); !reflect.DeepEqual(got, []string{"gener1"}) {
+		t.Fatalf("got %v want the updated url found by its new domain, tags and title", got)
+	}
+}
+
+func TestNewURLs(t *testing.T) {
+	s, teardown := NewTestDatabase(t)
+	t.Cleanup(teardown)
+	ctx := context.Background()
+
+	u, err := s.NewUser(ctx, "test_user@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	created, err := s.NewURLs(ctx, []store.URL{
+		{Owner: u.ID, OriginalURL: "https://fupisha.io/a", ShortenedURLParam: "aaaaaa", Dedup: true},
+		{Owner: u.ID, OriginalURL: "https://fupisha.io/b", ShortenedURLParam: "bbbbbb", Password: "open sesame"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create urls: %s", err)
+	}
+
+	if len(created) != 2 || created[0].ShortenedURLParam != "aaaaaa" || created[1].ShortenedURLParam != "bbbbbb" {
+		t.Fatalf("got %+v want the urls created in order", created)
+	}
+
+	for _, url := range created {
+		got, err := s.GetURLByID(ctx, url.ID)
+		if err != nil {
+			t.Fatalf("failed to retrieve url: %s", err)
+		}
+
+		if got.ShortenedURLParam != url.ShortenedURLParam || got.Password == "open sesame" {
+			t.Fatalf("got %+v want %+v stored", got, url)
+		}
+	}
+
+	_, err = s.NewURLs(ctx, []store.URL{
+		{Owner: u.ID, OriginalURL: "https://fupisha.io/c", ShortenedURLParam: "cccccc"},
+		{Owner: u.ID, OriginalURL: "https://fupisha.io/d", ShortenedURLParam: "aaaaaa"},
+	})
+
+	var batchErr *store.BatchError
+	if !errors.As(err, &batchErr) || batchErr.Index != 1 {
+		t.Fatalf("got %v want the second url to fail the batch", err)
+	}
+
+	if pqErr, ok := errors.Cause(batchErr.Err).(*pq.Error); !ok || pqErr.Code != "23505" {
+		t.Fatalf("got %v want a unique violation", batchErr.Err)
+	}
+
+	if _, err := s.GetURLByParam(ctx, "cccccc"); errors.Cause(err) != sql.ErrNoRows {
+		t.Fatalf("got %v want the whole batch rolled back", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq" // The database driver in use.
 	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/nairobi-gophers/fupisha/store/migrate"
 	"github.com/pkg/errors"
 )
 
@@ -24,16 +25,33 @@ func NewStore(cfg *Config) (*Store, error) {
 	s := Store{
 		&userStore{db: db},
 		&urlStore{db: db},
+		&clickStore{db: db},
+		&utmStore{db: db},
+		&domainStore{db: db},
 	}
 
-	err = migrateState(db)
-	if err != nil {
+	//the schema is only ever changed by fupisha migrate, refuse to run against an outdated one.
+	if err := newMigrator(db).Check(context.Background()); err != nil {
 		return nil, err
 	}
 
 	return &s, nil
 }
 
+// NewMigrator connects to the database and returns a migrator for its schema.
+func NewMigrator(cfg *Config) (*migrate.Migrator, error) {
+	db, err := connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMigrator(db), nil
+}
+
+func newMigrator(db *sqlx.DB) *migrate.Migrator {
+	return migrate.New(db, migrate.Postgres, migrations)
+}
+
 // connects to a postgres store and returns an initialized postgres store object.
 // address: localhost:5432
 func connect(cfg *Config) (*sqlx.DB, error) {
@@ -90,6 +108,9 @@ type Config struct {
 type Store struct {
 	*userStore
 	*urlStore
+	*clickStore
+	*utmStore
+	*domainStore
 }
 
 func statusCheck(ctx context.Context, db *sqlx.DB) error {
@@ -110,34 +131,3 @@ func statusCheck(ctx context.Context, db *sqlx.DB) error {
 	var tmp bool
 	return db.QueryRowContext(ctx, q).Scan(&tmp)
 }
-
-// migrates the store database schema.
-func migrateState(db *sqlx.DB) error {
-	for _, q := range migrate {
-		_, err := db.Exec(q)
-		if err != nil {
-			return errors.Wrap(err, "migrating schema")
-		}
-	}
-	return nil
-}
-
-// drops the store database schema.
-func dropState(db *sqlx.DB) error {
-	for _, q := range drop {
-		_, err := db.Exec(q)
-		if err != nil {
-			return errors.Wrap(err, "dropping schema")
-		}
-	}
-	return nil
-}
-
-// resets the store database to its initial state.
-//func resetState(db *sqlx.DB) error {
-//	err := dropState(db)
-//	if err != nil {
-//		return err
-//	}
-//	return migrateState(db)
-//}
@@ -1,7 +1,14 @@
 package postgres
 
-var migrate = []string{
-	`
+import "github.com/nairobi-gophers/fupisha/store/migrate"
+
+// migrations is the ordered list of schema changes, released migrations must never be edited.
+// Append new ones with the next version instead.
+var migrations = []migrate.Migration{
+	{
+		Version:     1,
+		Description: "create users table",
+		Up: `
 	CREATE TABLE IF NOT EXISTS users (
 		id UUID PRIMARY KEY,
 		email TEXT UNIQUE,
@@ -15,11 +22,13 @@ var migrate = []string{
 		created_at TIMESTAMPTZ,
 		updated_at TIMESTAMPTZ
 	);
-
-	CREATE UNIQUE INDEX ON users(email);
-`,
-
-	`
+	`,
+		Down: `DROP TABLE IF EXISTS users CASCADE;`,
+	},
+	{
+		Version:     2,
+		Description: "create urls table",
+		Up: `
 	CREATE TABLE IF NOT EXISTS urls(
 		id UUID PRIMARY KEY,
 		owner UUID,
@@ -31,12 +40,300 @@ var migrate = []string{
 		FOREIGN KEY (owner)  REFERENCES users(id) ON DELETE CASCADE
 	);
 
-	CREATE UNIQUE INDEX ON urls(original_url);
-	CREATE UNIQUE INDEX ON urls(short_url_param);
+	CREATE UNIQUE INDEX IF NOT EXISTS urls_short_url_param_idx ON urls(short_url_param);
 	`,
-}
+		Down: `DROP TABLE IF EXISTS urls CASCADE;`,
+	},
+	{
+		//Before versioned migrations every start re-ran unnamed CREATE UNIQUE INDEX statements,
+		//leaving databases with users_email_idx, users_email_idx1, ... The unique column
+		//constraints and urls_short_url_param_idx are all we need.
+		Version:     3,
+		Description: "drop duplicate unique indexes",
+		Up: `
+	DO $$
+	DECLARE
+		idx RECORD;
+	BEGIN
+		FOR idx IN
+			SELECT indexname FROM pg_indexes
+			WHERE schemaname = current_schema()
+			AND (
+				(tablename = 'users' AND indexname ~ '^users_email_idx[0-9]*$') OR
+				(tablename = 'urls' AND indexname ~ '^urls_original_url_idx[0-9]*$') OR
+				(tablename = 'urls' AND indexname ~ '^urls_short_url_param_idx[0-9]+$')
+			)
+		LOOP
+			EXECUTE format('DROP INDEX IF EXISTS %I', idx.indexname);
+		END LOOP;
+	END $$;
+	`,
+	},
+	{
+		Version:     4,
+		Description: "create clicks table",
+		Up: `
+	CREATE TABLE IF NOT EXISTS clicks(
+		id UUID PRIMARY KEY,
+		url_id UUID NOT NULL,
+		referrer TEXT,
+		user_agent TEXT,
+		browser TEXT,
+		os TEXT,
+		device TEXT,
+		ip TEXT,
+		created_at TIMESTAMPTZ,
+		FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS clicks_url_id_created_at_idx ON clicks(url_id, created_at);
+	`,
+		Down: `DROP TABLE IF EXISTS clicks CASCADE;`,
+	},
+	{
+		//original_url used to be unique across all users, so one user's link was handed out to
+		//everybody shortening the same url. Links are now deduplicated per owner, and only when asked to.
+		//Reverting can not bring the global constraint back once owners share urls, so it is left out.
+		Version:     5,
+		Description: "deduplicate urls per owner",
+		Up: `
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS dedup BOOLEAN NOT NULL DEFAULT TRUE;
+	ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_original_url_key;
+
+	CREATE UNIQUE INDEX IF NOT EXISTS urls_owner_original_url_key ON urls(owner, original_url) WHERE dedup;
+	CREATE INDEX IF NOT EXISTS urls_owner_created_at_idx ON urls(owner, created_at);
+	`,
+		Down: `
+	DROP INDEX IF EXISTS urls_owner_created_at_idx;
+	DROP INDEX IF EXISTS urls_owner_original_url_key;
+
+	ALTER TABLE urls DROP COLUMN IF EXISTS dedup;
+	`,
+	},
+	{
+		Version:     6,
+		Description: "add url expiry and click limits",
+		Up: `
+	ALTER TABLE urls
+		ADD COLUMN IF NOT EXISTS starts_at TIMESTAMPTZ,
+		ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ,
+		ADD COLUMN IF NOT EXISTS max_clicks INTEGER,
+		ADD COLUMN IF NOT EXISTS fallback_url TEXT NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS expired_at TIMESTAMPTZ;
+
+	CREATE INDEX IF NOT EXISTS urls_expiry_idx ON urls(expires_at)
+		WHERE expired_at IS NULL AND (expires_at IS NOT NULL OR max_clicks IS NOT NULL);
+	`,
+		Down: `
+	DROP INDEX IF EXISTS urls_expiry_idx;
+
+	ALTER TABLE urls
+		DROP COLUMN IF EXISTS starts_at,
+		DROP COLUMN IF EXISTS expires_at,
+		DROP COLUMN IF EXISTS max_clicks,
+		DROP COLUMN IF EXISTS fallback_url,
+		DROP COLUMN IF EXISTS expired_at;
+	`,
+	},
+	{
+		Version:     7,
+		Description: "add url passwords",
+		Up: `
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS password TEXT NOT NULL DEFAULT '';
+	`,
+		Down: `
+	ALTER TABLE urls DROP COLUMN IF EXISTS password;
+	`,
+	},
+	{
+		Version:     8,
+		Description: "soft delete urls",
+		Up: `
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+	DROP INDEX IF EXISTS urls_owner_original_url_key;
+	CREATE UNIQUE INDEX urls_owner_original_url_key ON urls(owner, original_url) WHERE dedup AND deleted_at IS NULL;
+	`,
+		//deleted urls come back to life, the deleted dedup ones stop deduplicating so they do not collide.
+		Down: `
+	UPDATE urls SET dedup=FALSE WHERE deleted_at IS NOT NULL;
+
+	DROP INDEX IF EXISTS urls_owner_original_url_key;
+	CREATE UNIQUE INDEX urls_owner_original_url_key ON urls(owner, original_url) WHERE dedup;
+
+	ALTER TABLE urls DROP COLUMN IF EXISTS deleted_at;
+	`,
+	},
+	{
+		Version:     9,
+		Description: "describe, tag and search urls",
+		//urls_search_idx indexes the words of the url, param, title and notes. FindURLs has to search
+		//the very same expression for the index to be used.
+		Up: `
+	ALTER TABLE urls
+		ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS notes TEXT NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS tags JSONB NOT NULL DEFAULT '[]',
+		ADD COLUMN IF NOT EXISTS domain TEXT NOT NULL DEFAULT '';
+
+	UPDATE urls SET domain=lower(COALESCE(substring(original_url FROM '^(?:[A-Za-z][A-Za-z0-9+.-]*://)?(?:[^/?#@]*@)?([^/?#:]*)'), ''));
+
+	CREATE INDEX IF NOT EXISTS urls_owner_domain_idx ON urls(owner, domain);
+	CREATE INDEX IF NOT EXISTS urls_tags_idx ON urls USING GIN (tags jsonb_path_ops);
+	CREATE INDEX IF NOT EXISTS urls_search_idx ON urls USING GIN (
+		to_tsvector('simple', regexp_replace(original_url || ' ' || short_url_param || ' ' || title || ' ' || notes, '[^[:alnum:]]+', ' ', 'g'))
+	);
+	`,
+		Down: `
+	DROP INDEX IF EXISTS urls_search_idx;
+	DROP INDEX IF EXISTS urls_tags_idx;
+	DROP INDEX IF EXISTS urls_owner_domain_idx;
+
+	ALTER TABLE urls
+		DROP COLUMN IF EXISTS title,
+		DROP COLUMN IF EXISTS notes,
+		DROP COLUMN IF EXISTS tags,
+		DROP COLUMN IF EXISTS domain;
+	`,
+	},
+	{
+		//The existing urls were deduplicated on their original url, which stays their canonical url.
+		Version:     10,
+		Description: "deduplicate urls on their canonical url",
+		Up: `
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS canonical_url TEXT NOT NULL DEFAULT '';
+
+	UPDATE urls SET canonical_url=original_url;
 
-var drop = []string{
-	`DROP TABLE IF EXISTS users CASCADE`,
-	`DROP TABLE IF EXISTS urls CASCADE`,
+	DROP INDEX IF EXISTS urls_owner_original_url_key;
+	CREATE UNIQUE INDEX urls_owner_canonical_url_key ON urls(owner, canonical_url) WHERE dedup AND deleted_at IS NULL;
+	`,
+		//a link deduplicated on its canonical url may share its original url with another one, the newer ones
+		//stop deduplicating so they do not collide.
+		Down: `
+	UPDATE urls SET dedup=FALSE WHERE dedup AND deleted_at IS NULL AND EXISTS (
+		SELECT 1 FROM urls o WHERE o.owner=urls.owner AND o.original_url=urls.original_url AND o.dedup AND o.deleted_at IS NULL
+		AND (o.created_at < urls.created_at OR (o.created_at = urls.created_at AND o.id < urls.id))
+	);
+
+	DROP INDEX IF EXISTS urls_owner_canonical_url_key;
+	CREATE UNIQUE INDEX urls_owner_original_url_key ON urls(owner, original_url) WHERE dedup AND deleted_at IS NULL;
+
+	ALTER TABLE urls DROP COLUMN IF EXISTS canonical_url;
+	`,
+	},
+	{
+		//The utm parameters of the existing urls are left empty, they stay in their original url.
+		Version:     11,
+		Description: "tag urls with utm parameters and save utm presets",
+		Up: `
+	ALTER TABLE urls
+		ADD COLUMN IF NOT EXISTS utm_source TEXT NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS utm_medium TEXT NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS utm_campaign TEXT NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS utm_term TEXT NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS utm_content TEXT NOT NULL DEFAULT '';
+
+	CREATE INDEX IF NOT EXISTS urls_owner_utm_campaign_idx ON urls(owner, utm_campaign);
+
+	CREATE TABLE IF NOT EXISTS utm_presets(
+		owner UUID NOT NULL,
+		name TEXT NOT NULL,
+		utm_source TEXT NOT NULL DEFAULT '',
+		utm_medium TEXT NOT NULL DEFAULT '',
+		utm_campaign TEXT NOT NULL DEFAULT '',
+		utm_term TEXT NOT NULL DEFAULT '',
+		utm_content TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ,
+		updated_at TIMESTAMPTZ,
+		PRIMARY KEY (owner, name),
+		FOREIGN KEY (owner) REFERENCES users(id) ON DELETE CASCADE
+	);
+	`,
+		Down: `
+	DROP TABLE IF EXISTS utm_presets;
+	DROP INDEX IF EXISTS urls_owner_utm_campaign_idx;
+
+	ALTER TABLE urls
+		DROP COLUMN IF EXISTS utm_source,
+		DROP COLUMN IF EXISTS utm_medium,
+		DROP COLUMN IF EXISTS utm_campaign,
+		DROP COLUMN IF EXISTS utm_term,
+		DROP COLUMN IF EXISTS utm_content;
+	`,
+	},
+	{
+		Version:     12,
+		Description: "route visitors of urls to other destinations",
+		Up: `
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS routes JSONB NOT NULL DEFAULT '{}';
+	`,
+		Down: `
+	ALTER TABLE urls DROP COLUMN IF EXISTS routes;
+	`,
+	},
+	{
+		Version:     13,
+		Description: "split the visitors of urls across weighted variants",
+		Up: `
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS variants JSONB NOT NULL DEFAULT '[]';
+	ALTER TABLE clicks ADD COLUMN IF NOT EXISTS variant TEXT NOT NULL DEFAULT '';
+	`,
+		Down: `
+	ALTER TABLE clicks DROP COLUMN IF EXISTS variant;
+	ALTER TABLE urls DROP COLUMN IF EXISTS variants;
+	`,
+	},
+	{
+		Version:     14,
+		Description: "open urls in their mobile apps",
+		Up: `
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS app_links JSONB NOT NULL DEFAULT '{}';
+	`,
+		Down: `
+	ALTER TABLE urls DROP COLUMN IF EXISTS app_links;
+	`,
+	},
+	{
+		//Every existing url is on the default short domain, its param stays unique there. A host is
+		//only unique among verified domains, anybody may claim it until its owner proves it theirs.
+		Version:     15,
+		Description: "shorten urls on custom domains",
+		Up: `
+	CREATE TABLE IF NOT EXISTS domains(
+		id UUID PRIMARY KEY,
+		owner UUID NOT NULL,
+		host TEXT NOT NULL,
+		token UUID NOT NULL,
+		verified_at TIMESTAMPTZ,
+		root_url TEXT NOT NULL DEFAULT '',
+		not_found_url TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ,
+		updated_at TIMESTAMPTZ,
+		CONSTRAINT domains_owner_host_key UNIQUE (owner, host),
+		CONSTRAINT domains_owner_fkey FOREIGN KEY (owner) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS domains_host_key ON domains(host) WHERE verified_at IS NOT NULL;
+
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS short_domain TEXT NOT NULL DEFAULT '';
+
+	DROP INDEX IF EXISTS urls_short_url_param_idx;
+	CREATE UNIQUE INDEX urls_short_url_param_idx ON urls(short_domain, short_url_param);
+	`,
+		//a url on a custom domain sharing its param with another url gets the start of its id appended,
+		//so that the params are unique again.
+		Down: `
+	UPDATE urls SET short_url_param=short_url_param || '-' || left(id::text, 8) WHERE short_domain <> '' AND EXISTS (
+		SELECT 1 FROM urls o WHERE o.short_url_param=urls.short_url_param AND o.id <> urls.id AND (o.short_domain = '' OR o.id < urls.id)
+	);
+
+	DROP INDEX IF EXISTS urls_short_url_param_idx;
+	CREATE UNIQUE INDEX urls_short_url_param_idx ON urls(short_url_param);
+
+	ALTER TABLE urls DROP COLUMN IF EXISTS short_domain;
+
+	DROP TABLE IF EXISTS domains;
+	`,
+	},
 }
@@ -45,8 +45,9 @@ func NewTestDatabase(t *testing.T) (*Store, func()) {
 		t.Fatalf("status check database: %s", err)
 	}
 
-	err = migrateState(db)
-	if err != nil {
+	migrator := newMigrator(db)
+
+	if _, err := migrator.Up(context.Background()); err != nil {
 		t.Fatal(err)
 	}
 
@@ -59,8 +60,7 @@ func NewTestDatabase(t *testing.T) (*Store, func()) {
 	dropdb := func() {
 		t.Log("Dropping database...")
 		//drop the database
-		err := dropState(db)
-		if err != nil {
+		if _, err := migrator.Down(context.Background(), 0); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -75,5 +75,8 @@ func NewTestDatabase(t *testing.T) (*Store, func()) {
 	return &Store{
 		&userStore{db: db},
 		&urlStore{db: db},
+		&clickStore{db: db},
+		&utmStore{db: db},
+		&domainStore{db: db},
 	}, teardown
 }
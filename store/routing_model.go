@@ -0,0 +1,88 @@
+package store
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Routes choose where a url sends each visitor. The first rule the visitor matches decides, the original
+// url is the fallback for visitors matching none.
+type Routes struct {
+	//Timezone names the IANA time zone the days, dates and times of the rules are read in, the configured one if empty.
+	Timezone string  `json:"timezone,omitempty"`
+	Rules    []Route `json:"rules"`
+}
+
+// Route sends the visitors matching every condition it sets to its destination, a condition listing
+// several values is met by any of them.
+type Route struct {
+	Destination string `json:"destination"`
+	//Countries are ISO 3166-1 alpha-2 codes e.g. KE, looked up from the visitor's ip address.
+	Countries []string `json:"countries,omitempty"`
+	//Devices are the device classes of the visitor's user agent e.g. mobile.
+	Devices []string `json:"devices,omitempty"`
+	//OS are the operating systems of the visitor's user agent e.g. iOS.
+	OS []string `json:"os,omitempty"`
+	//Languages are language tags e.g. sw or en-GB matched against the visitor's preferred language,
+	//a tag without a region matches every region.
+	Languages []string `json:"languages,omitempty"`
+	//Days are the days of the week e.g. sat.
+	Days []string `json:"days,omitempty"`
+	//StartDate and EndDate bound the dates the rule applies on, both included e.g. 2026-12-01.
+	StartDate string `json:"start_date,omitempty"`
+	EndDate   string `json:"end_date,omitempty"`
+	//StartTime and EndTime bound the time of day the rule applies at, the end excluded e.g. 09:00 to
+	//17:30. A window ending before it starts runs past midnight.
+	StartTime string `json:"start_time,omitempty"`
+	EndTime   string `json:"end_time,omitempty"`
+}
+
+// IsZero reports whether there are no rules.
+func (r Routes) IsZero() bool {
+	return len(r.Rules) == 0
+}
+
+// Value implements the driver.Valuer interface, routes without rules are stored as an empty object.
+func (r Routes) Value() (driver.Value, error) {
+	if r.IsZero() {
+		return "{}", nil
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (r *Routes) Scan(src interface{}) error {
+	var b []byte
+
+	switch v := src.(type) {
+	case nil:
+		*r = Routes{}
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("store: cannot scan %T into routes", src)
+	}
+
+	var routes Routes
+	if err := json.Unmarshal(b, &routes); err != nil {
+		return err
+	}
+
+	if routes.IsZero() {
+		routes = Routes{}
+	}
+
+	*r = routes
+
+	return nil
+}
@@ -0,0 +1,198 @@
+package sqlite
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/nairobi-gophers/fupisha/encoding"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/pkg/errors"
+)
+
+type clickStore struct {
+	db *sqlx.DB
+}
+
+// NewClick records a url visit and increments the url's visit count in the same transaction.
+func (c *clickStore) NewClick(ctx context.Context, click store.Click) (store.Click, error) {
+	click.ID = encoding.GenUniqueID()
+	if click.CreatedAt.IsZero() {
+		click.CreatedAt = time.Now()
+	}
+	click.CreatedAt = click.CreatedAt.UTC().Round(time.Microsecond)
+
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return store.Click{}, errors.Wrap(err, "beginning click transaction")
+	}
+	defer tx.Rollback()
+
+	const q = `INSERT INTO clicks (id,url_id,referrer,user_agent,browser,os,device,ip,variant,created_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)`
+
+	if _, err := tx.ExecContext(ctx, q, click.ID, click.URLID, click.Referrer, click.UserAgent, click.Browser, click.OS, click.Device, click.IP, click.Variant, click.CreatedAt); err != nil {
+		return store.Click{}, errors.Wrap(translate(err, "clicks"), "inserting new click")
+	}
+
+	//the count only goes up while the url has clicks left, which also holds under concurrent clicks.
+	const uq = `UPDATE urls SET visit_count=COALESCE(visit_count,0)+1 WHERE id=$1 AND (max_clicks IS NULL OR COALESCE(visit_count,0) < max_clicks)`
+
+	res, err := tx.ExecContext(ctx, uq, click.URLID)
+	if err != nil {
+		return store.Click{}, errors.Wrap(err, "incrementing url visit count")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return store.Click{}, errors.Wrap(err, "incrementing url visit count")
+	}
+
+	if n == 0 {
+		return store.Click{}, errors.Wrap(store.ErrClickLimit, "incrementing url visit count")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return store.Click{}, errors.Wrap(err, "committing click transaction")
+	}
+
+	return click, nil
+}
+
+// GetClicksByURL retrieves the clicks of the url with the given id, oldest first.
+func (c *clickStore) GetClicksByURL(ctx context.Context, urlID uuid.UUID) ([]store.Click, error) {
+	var clicks []store.Click
+
+	const q = `SELECT * FROM clicks WHERE url_id=$1 ORDER BY created_at`
+
+	if err := c.db.SelectContext(ctx, &clicks, q, urlID); err != nil {
+		return nil, errors.Wrap(err, "retrieving clicks by url")
+	}
+
+	return clicks, nil
+}
+
+// FindClicks retrieves a page of the url's clicks matching the filter, oldest first.
+func (c *clickStore) FindClicks(ctx context.Context, filter store.ClickFilter) ([]store.Click, error) {
+	clicks := []store.Click{}
+
+	var (
+		conds []string
+		args  []interface{}
+	)
+
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	conds = append(conds, "url_id="+arg(filter.URLID))
+
+	if filter.CreatedAfter != nil {
+		conds = append(conds, "created_at>="+arg(*roundTime(filter.CreatedAfter)))
+	}
+
+	if filter.CreatedBefore != nil {
+		conds = append(conds, "created_at<"+arg(*roundTime(filter.CreatedBefore)))
+	}
+
+	if filter.After != nil {
+		conds = append(conds, "(created_at,id)>("+arg(filter.After.CreatedAt.UTC().Round(time.Microsecond))+","+arg(filter.After.ID)+")")
+	}
+
+	q := `SELECT * FROM clicks WHERE ` + strings.Join(conds, " AND ") + ` ORDER BY created_at, id`
+
+	if filter.Limit > 0 {
+		q += ` LIMIT ` + arg(filter.Limit)
+	}
+
+	if err := c.db.SelectContext(ctx, &clicks, q, args...); err != nil {
+		return nil, errors.Wrap(err, "finding clicks")
+	}
+
+	return clicks, nil
+}
+
+// VariantStats counts the clicks on the url per variant served, most clicked first. Clicks served no variant are left out.
+func (c *clickStore) VariantStats(ctx context.Context, urlID uuid.UUID) ([]store.VariantStats, error) {
+	stats := []store.VariantStats{}
+
+	const q = `SELECT variant, COUNT(*) AS clicks FROM clicks WHERE url_id=$1 AND variant<>'' GROUP BY variant ORDER BY clicks DESC, variant`
+	if err := c.db.SelectContext(ctx, &stats, q, urlID); err != nil {
+		return nil, errors.Wrap(err, "counting clicks per variant")
+	}
+
+	return stats, nil
+}
+
+// clicksPerInsert keeps a multi-row insert well below sqlite's limit on bound parameters.
+const clicksPerInsert = 100
+
+// NewClicks records a batch of url visits with multi-row inserts and increments the visit counts of their urls
+// in the same transaction.
+func (c *clickStore) NewClicks(ctx context.Context, clicks []store.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning clicks transaction")
+	}
+	defer tx.Rollback()
+
+	visits := make(map[uuid.UUID]int)
+
+	for start := 0; start < len(clicks); start += clicksPerInsert {
+		end := start + clicksPerInsert
+		if end > len(clicks) {
+			end = len(clicks)
+		}
+
+		var q strings.Builder
+		q.WriteString(`INSERT INTO clicks (id,url_id,referrer,user_agent,browser,os,device,ip,variant,created_at) VALUES `)
+
+		args := make([]interface{}, 0, (end-start)*10)
+
+		for i, click := range clicks[start:end] {
+			if click.CreatedAt.IsZero() {
+				click.CreatedAt = time.Now()
+			}
+
+			if i > 0 {
+				q.WriteByte(',')
+			}
+			q.WriteByte('(')
+			for j := 1; j <= 10; j++ {
+				if j > 1 {
+					q.WriteByte(',')
+				}
+				q.WriteString("$" + strconv.Itoa(len(args)+j))
+			}
+			q.WriteByte(')')
+
+			args = append(args, encoding.GenUniqueID(), click.URLID, click.Referrer, click.UserAgent, click.Browser, click.OS, click.Device, click.IP, click.Variant, click.CreatedAt.UTC().Round(time.Microsecond))
+			visits[click.URLID]++
+		}
+
+		if _, err := tx.ExecContext(ctx, q.String(), args...); err != nil {
+			return errors.Wrap(translate(err, "clicks"), "inserting clicks")
+		}
+	}
+
+	const uq = `UPDATE urls SET visit_count=COALESCE(visit_count,0)+$1 WHERE id=$2`
+
+	for id, n := range visits {
+		if _, err := tx.ExecContext(ctx, uq, n, id); err != nil {
+			return errors.Wrap(err, "incrementing url visit count")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing clicks transaction")
+	}
+
+	return nil
+}
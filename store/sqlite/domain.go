@@ -0,0 +1,139 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/nairobi-gophers/fupisha/encoding"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/pkg/errors"
+)
+
+type domainStore struct {
+	db *sqlx.DB
+}
+
+// NewDomain adds the owner's domain unverified, generating its id, token and timestamps.
+func (d *domainStore) NewDomain(ctx context.Context, domain store.Domain) (store.Domain, error) {
+	now := time.Now().UTC().Round(time.Microsecond)
+
+	domain.ID = encoding.GenUniqueID()
+	domain.Token = encoding.GenUniqueID()
+	domain.VerifiedAt = nil
+	domain.CreatedAt = now
+	domain.UpdatedAt = now
+
+	const q = `INSERT INTO domains (id,owner,host,token,verified_at,root_url,not_found_url,created_at,updated_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`
+
+	if _, err := d.db.ExecContext(ctx, q, domain.ID, domain.Owner, domain.Host, domain.Token, domain.VerifiedAt, domain.RootURL, domain.NotFoundURL, domain.CreatedAt, domain.UpdatedAt); err != nil {
+		return store.Domain{}, errors.Wrap(translate(err, "domains"), "inserting new domain")
+	}
+
+	return domain, nil
+}
+
+// GetDomainByID retrieves the domain by its id.
+func (d *domainStore) GetDomainByID(ctx context.Context, id uuid.UUID) (store.Domain, error) {
+	var domain store.Domain
+
+	const q = `SELECT * FROM domains WHERE id=$1`
+	if err := d.db.GetContext(ctx, &domain, q, id); err != nil {
+		return store.Domain{}, errors.Wrap(err, "retrieving domain by id")
+	}
+
+	return domain, nil
+}
+
+// GetDomainByHost retrieves the verified domain of the given host.
+func (d *domainStore) GetDomainByHost(ctx context.Context, host string) (store.Domain, error) {
+	var domain store.Domain
+
+	const q = `SELECT * FROM domains WHERE host=$1 AND verified_at IS NOT NULL`
+	if err := d.db.GetContext(ctx, &domain, q, host); err != nil {
+		return store.Domain{}, errors.Wrap(err, "retrieving domain by host")
+	}
+
+	return domain, nil
+}
+
+// GetDomain retrieves the owner's domain of the given host, verified or not.
+func (d *domainStore) GetDomain(ctx context.Context, owner uuid.UUID, host string) (store.Domain, error) {
+	var domain store.Domain
+
+	const q = `SELECT * FROM domains WHERE owner=$1 AND host=$2`
+	if err := d.db.GetContext(ctx, &domain, q, owner, host); err != nil {
+		return store.Domain{}, errors.Wrap(err, "retrieving owner's domain")
+	}
+
+	return domain, nil
+}
+
+// GetDomainsByOwner retrieves every domain of the owner by host.
+func (d *domainStore) GetDomainsByOwner(ctx context.Context, owner uuid.UUID) ([]store.Domain, error) {
+	domains := []store.Domain{}
+
+	const q = `SELECT * FROM domains WHERE owner=$1 ORDER BY host`
+	if err := d.db.SelectContext(ctx, &domains, q, owner); err != nil {
+		return nil, errors.Wrap(err, "retrieving domains by owner")
+	}
+
+	return domains, nil
+}
+
+// UpdateDomain saves the verified at, root url and not found url of the given domain.
+func (d *domainStore) UpdateDomain(ctx context.Context, domain store.Domain) (store.Domain, error) {
+	const q = `UPDATE domains SET verified_at=$2,root_url=$3,not_found_url=$4,updated_at=$5 WHERE id=$1`
+
+	res, err := d.db.ExecContext(ctx, q, domain.ID, roundTime(domain.VerifiedAt), domain.RootURL, domain.NotFoundURL, time.Now().UTC().Round(time.Microsecond))
+	if err != nil {
+		return store.Domain{}, errors.Wrap(translate(err, "domains"), "updating domain")
+	}
+
+	if err := affectedOne(res); err != nil {
+		return store.Domain{}, errors.Wrap(err, "updating domain")
+	}
+
+	return d.GetDomainByID(ctx, domain.ID)
+}
+
+// DeleteDomain removes the domain unless urls of its owner, deleted ones included, are shortened on it. Transactions
+// take the write lock as they begin, a url being created on the domain is either committed before the check
+// or finds the domain gone.
+func (d *domainStore) DeleteDomain(ctx context.Context, id uuid.UUID) error {
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning domain transaction")
+	}
+	defer tx.Rollback()
+
+	var domain store.Domain
+
+	const lq = `SELECT owner, host FROM domains WHERE id=$1`
+	if err := tx.GetContext(ctx, &domain, lq, id); err != nil {
+		return errors.Wrap(err, "deleting domain")
+	}
+
+	var inUse bool
+
+	const uq = `SELECT EXISTS (SELECT 1 FROM urls WHERE owner=$1 AND short_domain=$2)`
+	if err := tx.GetContext(ctx, &inUse, uq, domain.Owner, domain.Host); err != nil {
+		return errors.Wrap(err, "checking domain urls")
+	}
+
+	if inUse {
+		return errors.Wrap(store.ErrDomainInUse, "deleting domain")
+	}
+
+	const q = `DELETE FROM domains WHERE id=$1`
+	if _, err := tx.ExecContext(ctx, q, id); err != nil {
+		return errors.Wrap(err, "deleting domain")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing domain transaction")
+	}
+
+	return nil
+}
@@ -0,0 +1,337 @@
+package sqlite
+
+import "github.com/nairobi-gophers/fupisha/store/migrate"
+
+// migrations is the ordered list of schema changes, released migrations must never be edited.
+// Append new ones with the next version instead.
+var migrations = []migrate.Migration{
+	{
+		Version:     1,
+		Description: "create users table",
+		Up: `
+	CREATE TABLE IF NOT EXISTS users (
+		id TEXT PRIMARY KEY,
+		email TEXT UNIQUE,
+		"password" TEXT,
+		api_key TEXT,
+		reset_password_token TEXT,
+		reset_password_expires TIMESTAMP,
+		verification_expires TIMESTAMP,
+		verification_token TEXT,
+		verified BOOLEAN DEFAULT FALSE,
+		created_at TIMESTAMP,
+		updated_at TIMESTAMP
+	);
+	`,
+		Down: `DROP TABLE IF EXISTS users;`,
+	},
+	{
+		Version:     2,
+		Description: "create urls table",
+		Up: `
+	CREATE TABLE IF NOT EXISTS urls(
+		id TEXT PRIMARY KEY,
+		owner TEXT,
+		original_url TEXT UNIQUE,
+		short_url_param TEXT,
+		visit_count INTEGER,
+		created_at TIMESTAMP,
+		updated_at TIMESTAMP,
+		FOREIGN KEY (owner)  REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS urls_short_url_param_idx ON urls(short_url_param);
+	`,
+		Down: `DROP TABLE IF EXISTS urls;`,
+	},
+	{
+		Version:     3,
+		Description: "create clicks table",
+		Up: `
+	CREATE TABLE IF NOT EXISTS clicks(
+		id TEXT PRIMARY KEY,
+		url_id TEXT NOT NULL,
+		referrer TEXT,
+		user_agent TEXT,
+		browser TEXT,
+		os TEXT,
+		device TEXT,
+		ip TEXT,
+		created_at TIMESTAMP,
+		FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS clicks_url_id_created_at_idx ON clicks(url_id, created_at);
+	`,
+		Down: `DROP TABLE IF EXISTS clicks;`,
+	},
+	{
+		//original_url used to be unique across all users, so one user's link was handed out to
+		//everybody shortening the same url. Links are now deduplicated per owner, and only when asked to.
+		//sqlite can not drop a column constraint, the table is rebuilt instead.
+		//Reverting can not bring the global constraint back once owners share urls, so it is left out.
+		Version:     4,
+		Description: "deduplicate urls per owner",
+		Up: `
+	CREATE TABLE urls_new(
+		id TEXT PRIMARY KEY,
+		owner TEXT,
+		original_url TEXT,
+		short_url_param TEXT,
+		visit_count INTEGER,
+		dedup BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at TIMESTAMP,
+		updated_at TIMESTAMP,
+		FOREIGN KEY (owner)  REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	INSERT INTO urls_new (id,owner,original_url,short_url_param,visit_count,created_at,updated_at)
+	SELECT id,owner,original_url,short_url_param,visit_count,created_at,updated_at FROM urls;
+
+	DROP TABLE urls;
+	ALTER TABLE urls_new RENAME TO urls;
+
+	CREATE UNIQUE INDEX urls_short_url_param_idx ON urls(short_url_param);
+	CREATE UNIQUE INDEX urls_owner_original_url_key ON urls(owner, original_url) WHERE dedup;
+	CREATE INDEX urls_owner_created_at_idx ON urls(owner, created_at);
+	`,
+		Down: `
+	CREATE TABLE urls_old(
+		id TEXT PRIMARY KEY,
+		owner TEXT,
+		original_url TEXT,
+		short_url_param TEXT,
+		visit_count INTEGER,
+		created_at TIMESTAMP,
+		updated_at TIMESTAMP,
+		FOREIGN KEY (owner)  REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	INSERT INTO urls_old (id,owner,original_url,short_url_param,visit_count,created_at,updated_at)
+	SELECT id,owner,original_url,short_url_param,visit_count,created_at,updated_at FROM urls;
+
+	DROP TABLE urls;
+	ALTER TABLE urls_old RENAME TO urls;
+
+	CREATE UNIQUE INDEX urls_short_url_param_idx ON urls(short_url_param);
+	`,
+	},
+	{
+		Version:     5,
+		Description: "add url expiry and click limits",
+		Up: `
+	ALTER TABLE urls ADD COLUMN starts_at TIMESTAMP;
+	ALTER TABLE urls ADD COLUMN expires_at TIMESTAMP;
+	ALTER TABLE urls ADD COLUMN max_clicks INTEGER;
+	ALTER TABLE urls ADD COLUMN fallback_url TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN expired_at TIMESTAMP;
+
+	CREATE INDEX urls_expiry_idx ON urls(expires_at)
+		WHERE expired_at IS NULL AND (expires_at IS NOT NULL OR max_clicks IS NOT NULL);
+	`,
+		Down: `
+	DROP INDEX IF EXISTS urls_expiry_idx;
+
+	ALTER TABLE urls DROP COLUMN starts_at;
+	ALTER TABLE urls DROP COLUMN expires_at;
+	ALTER TABLE urls DROP COLUMN max_clicks;
+	ALTER TABLE urls DROP COLUMN fallback_url;
+	ALTER TABLE urls DROP COLUMN expired_at;
+	`,
+	},
+	{
+		Version:     6,
+		Description: "add url passwords",
+		Up: `
+	ALTER TABLE urls ADD COLUMN password TEXT NOT NULL DEFAULT '';
+	`,
+		Down: `
+	ALTER TABLE urls DROP COLUMN password;
+	`,
+	},
+	{
+		Version:     7,
+		Description: "soft delete urls",
+		Up: `
+	ALTER TABLE urls ADD COLUMN deleted_at TIMESTAMP;
+
+	DROP INDEX IF EXISTS urls_owner_original_url_key;
+	CREATE UNIQUE INDEX urls_owner_original_url_key ON urls(owner, original_url) WHERE dedup AND deleted_at IS NULL;
+	`,
+		//deleted urls come back to life, the deleted dedup ones stop deduplicating so they do not collide.
+		Down: `
+	UPDATE urls SET dedup=FALSE WHERE deleted_at IS NOT NULL;
+
+	DROP INDEX IF EXISTS urls_owner_original_url_key;
+	CREATE UNIQUE INDEX urls_owner_original_url_key ON urls(owner, original_url) WHERE dedup;
+
+	ALTER TABLE urls DROP COLUMN deleted_at;
+	`,
+	},
+	{
+		Version:     8,
+		Description: "describe, tag and search urls",
+		//sqlite has no regular expressions, the domain of the existing urls is cut out of them one piece at a time.
+		Up: `
+	ALTER TABLE urls ADD COLUMN title TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN notes TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
+	ALTER TABLE urls ADD COLUMN domain TEXT NOT NULL DEFAULT '';
+
+	UPDATE urls SET domain=CASE WHEN instr(original_url, '://') > 0 THEN substr(original_url, instr(original_url, '://') + 3) ELSE original_url END;
+	UPDATE urls SET domain=substr(domain, 1, instr(domain, '/') - 1) WHERE instr(domain, '/') > 0;
+	UPDATE urls SET domain=substr(domain, 1, instr(domain, '?') - 1) WHERE instr(domain, '?') > 0;
+	UPDATE urls SET domain=substr(domain, 1, instr(domain, '#') - 1) WHERE instr(domain, '#') > 0;
+	UPDATE urls SET domain=substr(domain, instr(domain, '@') + 1) WHERE instr(domain, '@') > 0;
+	UPDATE urls SET domain=lower(substr(domain, 1, instr(domain || ':', ':') - 1));
+
+	CREATE INDEX urls_owner_domain_idx ON urls(owner, domain);
+	`,
+		Down: `
+	DROP INDEX IF EXISTS urls_owner_domain_idx;
+
+	ALTER TABLE urls DROP COLUMN title;
+	ALTER TABLE urls DROP COLUMN notes;
+	ALTER TABLE urls DROP COLUMN tags;
+	ALTER TABLE urls DROP COLUMN domain;
+	`,
+	},
+	{
+		//The existing urls were deduplicated on their original url, which stays their canonical url.
+		Version:     9,
+		Description: "deduplicate urls on their canonical url",
+		Up: `
+	ALTER TABLE urls ADD COLUMN canonical_url TEXT NOT NULL DEFAULT '';
+
+	UPDATE urls SET canonical_url=original_url;
+
+	DROP INDEX IF EXISTS urls_owner_original_url_key;
+	CREATE UNIQUE INDEX urls_owner_canonical_url_key ON urls(owner, canonical_url) WHERE dedup AND deleted_at IS NULL;
+	`,
+		//a link deduplicated on its canonical url may share its original url with another one, the newer ones
+		//stop deduplicating so they do not collide.
+		Down: `
+	UPDATE urls SET dedup=FALSE WHERE dedup AND deleted_at IS NULL AND EXISTS (
+		SELECT 1 FROM urls o WHERE o.owner=urls.owner AND o.original_url=urls.original_url AND o.dedup AND o.deleted_at IS NULL
+		AND (o.created_at < urls.created_at OR (o.created_at = urls.created_at AND o.id < urls.id))
+	);
+
+	DROP INDEX IF EXISTS urls_owner_canonical_url_key;
+	CREATE UNIQUE INDEX urls_owner_original_url_key ON urls(owner, original_url) WHERE dedup AND deleted_at IS NULL;
+
+	ALTER TABLE urls DROP COLUMN canonical_url;
+	`,
+	},
+	{
+		//The utm parameters of the existing urls are left empty, they stay in their original url.
+		Version:     10,
+		Description: "tag urls with utm parameters and save utm presets",
+		Up: `
+	ALTER TABLE urls ADD COLUMN utm_source TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN utm_medium TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN utm_campaign TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN utm_term TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN utm_content TEXT NOT NULL DEFAULT '';
+
+	CREATE INDEX urls_owner_utm_campaign_idx ON urls(owner, utm_campaign);
+
+	CREATE TABLE IF NOT EXISTS utm_presets(
+		owner TEXT NOT NULL,
+		name TEXT NOT NULL,
+		utm_source TEXT NOT NULL DEFAULT '',
+		utm_medium TEXT NOT NULL DEFAULT '',
+		utm_campaign TEXT NOT NULL DEFAULT '',
+		utm_term TEXT NOT NULL DEFAULT '',
+		utm_content TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP,
+		updated_at TIMESTAMP,
+		PRIMARY KEY (owner, name),
+		FOREIGN KEY (owner) REFERENCES users(id) ON DELETE CASCADE
+	);
+	`,
+		Down: `
+	DROP TABLE IF EXISTS utm_presets;
+	DROP INDEX IF EXISTS urls_owner_utm_campaign_idx;
+
+	ALTER TABLE urls DROP COLUMN utm_source;
+	ALTER TABLE urls DROP COLUMN utm_medium;
+	ALTER TABLE urls DROP COLUMN utm_campaign;
+	ALTER TABLE urls DROP COLUMN utm_term;
+	ALTER TABLE urls DROP COLUMN utm_content;
+	`,
+	},
+	{
+		Version:     11,
+		Description: "route visitors of urls to other destinations",
+		Up: `
+	ALTER TABLE urls ADD COLUMN routes TEXT NOT NULL DEFAULT '{}';
+	`,
+		Down: `
+	ALTER TABLE urls DROP COLUMN routes;
+	`,
+	},
+	{
+		Version:     12,
+		Description: "split the visitors of urls across weighted variants",
+		Up: `
+	ALTER TABLE urls ADD COLUMN variants TEXT NOT NULL DEFAULT '[]';
+	ALTER TABLE clicks ADD COLUMN variant TEXT NOT NULL DEFAULT '';
+	`,
+		Down: `
+	ALTER TABLE clicks DROP COLUMN variant;
+	ALTER TABLE urls DROP COLUMN variants;
+	`,
+	},
+	{
+		Version:     13,
+		Description: "open urls in their mobile apps",
+		Up: `
+	ALTER TABLE urls ADD COLUMN app_links TEXT NOT NULL DEFAULT '{}';
+	`,
+		Down: `
+	ALTER TABLE urls DROP COLUMN app_links;
+	`,
+	},
+	{
+		//Every existing url is on the default short domain, its param stays unique there. A host is
+		//only unique among verified domains, anybody may claim it until its owner proves it theirs.
+		Version:     14,
+		Description: "shorten urls on custom domains",
+		Up: `
+	CREATE TABLE IF NOT EXISTS domains(
+		id TEXT PRIMARY KEY,
+		owner TEXT NOT NULL,
+		host TEXT NOT NULL,
+		token TEXT NOT NULL,
+		verified_at TIMESTAMP,
+		root_url TEXT NOT NULL DEFAULT '',
+		not_found_url TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP,
+		updated_at TIMESTAMP,
+		UNIQUE (owner, host),
+		FOREIGN KEY (owner) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS domains_host_key ON domains(host) WHERE verified_at IS NOT NULL;
+
+	ALTER TABLE urls ADD COLUMN short_domain TEXT NOT NULL DEFAULT '';
+
+	DROP INDEX IF EXISTS urls_short_url_param_idx;
+	CREATE UNIQUE INDEX urls_short_url_param_idx ON urls(short_domain, short_url_param);
+	`,
+		//a url on a custom domain sharing its param with another url gets the start of its id appended,
+		//so that the params are unique again.
+		Down: `
+	UPDATE urls SET short_url_param=short_url_param || '-' || substr(id, 1, 8) WHERE short_domain <> '' AND EXISTS (
+		SELECT 1 FROM urls o WHERE o.short_url_param=urls.short_url_param AND o.id <> urls.id AND (o.short_domain = '' OR o.id < urls.id)
+	);
+
+	DROP INDEX IF EXISTS urls_short_url_param_idx;
+	CREATE UNIQUE INDEX urls_short_url_param_idx ON urls(short_url_param);
+
+	ALTER TABLE urls DROP COLUMN short_domain;
+
+	DROP TABLE IF EXISTS domains;
+	`,
+	},
+}
@@ -0,0 +1,78 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/nairobi-gophers/fupisha/encoding"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/nairobi-gophers/fupisha/store/migrate"
+)
+
+// Rebuilding the urls table must not cascade to the clicks referencing it.
+func TestMigrationsKeepData(t *testing.T) {
+	db, err := connect(&Config{Path: filepath.Join(t.TempDir(), "fupisha.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ctx := context.Background()
+
+	if _, err := migrate.New(db, migrate.SQLite, migrations[:3]).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	s := Store{&userStore{db: db}, &urlStore{db: db}, &clickStore{db: db}, &utmStore{db: db}, &domainStore{db: db}}
+
+	u, err := s.NewUser(ctx, "test_user@test.com", "test_password")
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	//written with the columns of the old schema, dedup does not exist yet.
+	url := store.URL{ID: u.ID, Owner: u.ID, OriginalURL: "https://me@Docs.Fupisha.io:8080/a?b=c", ShortenedURLParam: "abcdef", CreatedAt: u.CreatedAt, UpdatedAt: u.CreatedAt}
+	if _, err := db.ExecContext(ctx, `INSERT INTO urls (id,owner,original_url,short_url_param,visit_count,created_at,updated_at) VALUES ($1,$2,$3,$4,1,$5,$6)`, url.ID, url.Owner, url.OriginalURL, url.ShortenedURLParam, url.CreatedAt, url.UpdatedAt); err != nil {
+		t.Fatalf("failed to create url: %s", err)
+	}
+
+	if _, err := db.ExecContext(ctx, `INSERT INTO clicks (id,url_id,referrer,user_agent,browser,os,device,ip,created_at) VALUES ($1,$2,'','','','','','',$3)`, encoding.GenUniqueID(), url.ID, url.CreatedAt); err != nil {
+		t.Fatalf("failed to create click: %s", err)
+	}
+
+	if _, err := newMigrator(db).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.GetURLByLongStr(ctx, u.ID, url.OriginalURL)
+	if err != nil {
+		t.Fatalf("failed to retrieve url: %s", err)
+	}
+
+	if !got.Dedup || got.VisitCount == nil || *got.VisitCount != 1 {
+		t.Fatalf("got %+v want the existing url deduplicated with its visit count", got)
+	}
+
+	if got.Domain != store.Hostname(url.OriginalURL) {
+		t.Fatalf("got domain %q want %q", got.Domain, store.Hostname(url.OriginalURL))
+	}
+
+	clicks, err := s.GetClicksByURL(ctx, url.ID)
+	if err != nil {
+		t.Fatalf("failed to retrieve clicks: %s", err)
+	}
+
+	if len(clicks) != 1 {
+		t.Fatalf("got %d clicks want 1", len(clicks))
+	}
+
+	var fk bool
+	if err := db.GetContext(ctx, &fk, `PRAGMA foreign_keys`); err != nil {
+		t.Fatal(err)
+	}
+
+	if !fk {
+		t.Fatal("want foreign keys enforced again after migrating")
+	}
+}
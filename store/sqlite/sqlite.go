@@ -0,0 +1,182 @@
+// Package sqlite provides an embedded sqlite implementation of the fupisha store.
+// It uses a pure go sqlite driver so fupisha still builds with CGO_ENABLED=0.
+package sqlite
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/nairobi-gophers/fupisha/store/migrate"
+	"github.com/pkg/errors"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// compilation check for store.Store concrete implementation.
+var _ store.Store = (*Store)(nil)
+
+// defaultBusyTimeout is how long a connection waits on a locked database before giving up.
+const defaultBusyTimeout = 5 * time.Second
+
+// NewStore creates and returns an initialized sqlite store for use as our state backend.
+func NewStore(cfg *Config) (*Store, error) {
+	db, err := connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s := Store{
+		&userStore{db: db},
+		&urlStore{db: db},
+		&clickStore{db: db},
+		&utmStore{db: db},
+		&domainStore{db: db},
+	}
+
+	//the schema is only ever changed by fupisha migrate, refuse to run against an outdated one.
+	if err := newMigrator(db).Check(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// NewMigrator connects to the database and returns a migrator for its schema.
+func NewMigrator(cfg *Config) (*migrate.Migrator, error) {
+	db, err := connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMigrator(db), nil
+}
+
+func newMigrator(db *sqlx.DB) *migrate.Migrator {
+	return migrate.New(db, migrate.SQLite, migrations)
+}
+
+// opens the sqlite database file and returns an initialized sqlite store object.
+// path: /var/lib/fupisha/fupisha.db
+func connect(cfg *Config) (*sqlx.DB, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("connect: missing sqlite database path")
+	}
+
+	busyTimeout := cfg.BusyTimeout
+	if busyTimeout <= 0 {
+		busyTimeout = defaultBusyTimeout
+	}
+
+	q := make(url.Values)
+	//A locked database is retried for up to busy_timeout instead of failing with SQLITE_BUSY.
+	//It goes first, the pragmas after it need the lock too when a new connection opens mid write.
+	q.Add("_pragma", "busy_timeout("+strconv.FormatInt(busyTimeout.Milliseconds(), 10)+")")
+	//WAL lets readers carry on while the single writer holds the lock.
+	q.Add("_pragma", "journal_mode(WAL)")
+	q.Add("_pragma", "foreign_keys(ON)")
+	q.Add("_pragma", "synchronous(NORMAL)")
+	//Take the write lock when the transaction begins, upgrading a read lock mid transaction
+	//fails immediately with SQLITE_BUSY regardless of the busy timeout.
+	q.Set("_txlock", "immediate")
+
+	dsn := "file:" + cfg.Path + "?" + q.Encode()
+
+	db, err := sqlx.Open("sqlite", dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening database")
+	}
+
+	db.SetMaxIdleConns(cfg.MaxOpenConns)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), busyTimeout)
+	defer cancel()
+
+	if err := statusCheck(ctx, db); err != nil {
+		return nil, errors.Wrap(err, "connect: database never ready")
+	}
+
+	return db, nil
+}
+
+type Config struct {
+	//Path is the database file path e.g. /var/lib/fupisha/fupisha.db
+	Path string
+	//BusyTimeout is how long a write waits for a locked database, defaults to 5 seconds.
+	BusyTimeout time.Duration
+	//MaxOpenConns is the maximum number of open conns to the database.
+	MaxOpenConns int
+}
+
+// Store is a sqlite implementation of our store interface
+type Store struct {
+	*userStore
+	*urlStore
+	*clickStore
+	*utmStore
+	*domainStore
+}
+
+func statusCheck(ctx context.Context, db *sqlx.DB) error {
+	if err := db.PingContext(ctx); err != nil {
+		return err
+	}
+
+	const q = `SELECT true`
+	var tmp bool
+	return db.QueryRowContext(ctx, q).Scan(&tmp)
+}
+
+// constraints maps the columns sqlite names in its constraint errors to the
+// constraint names postgresql would have reported.
+var constraints = map[string]string{
+	"users.email":                             store.UniqueUserEmail,
+	"urls.owner, urls.canonical_url":          store.UniqueURLLongStr,
+	"urls.short_domain, urls.short_url_param": store.UniqueURLParam,
+	"domains.host":                            store.UniqueDomainHost,
+	"domains.owner, domains.host":             store.UniqueDomainOwnerHost,
+}
+
+// foreignKeys maps tables to the foreign key constraint postgresql would report for them,
+// sqlite does not name the violated constraint in its errors.
+var foreignKeys = map[string]string{
+	"urls":        store.ForeignURLOwner,
+	"clicks":      store.ForeignClickURL,
+	"utm_presets": store.ForeignUTMPresetOwner,
+	"domains":     store.ForeignDomainOwner,
+}
+
+// translate turns sqlite constraint violations raised writing to table into the errors the
+// postgresql store returns, any other error is returned untouched.
+func translate(err error, table string) error {
+	sqliteErr, ok := err.(*sqlite.Error)
+	if !ok {
+		return err
+	}
+
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		//e.g. UNIQUE constraint failed: users.email (2067), the columns are matched whole since
+		//domains.host is also part of domains.owner, domains.host.
+		msg := sqliteErr.Error()
+		columns := msg
+		if i := strings.LastIndex(columns, "failed: "); i >= 0 {
+			columns = columns[i+len("failed: "):]
+		}
+		if i := strings.LastIndex(columns, " ("); i >= 0 {
+			columns = columns[:i]
+		}
+		if constraint, ok := constraints[columns]; ok {
+			return store.UniqueViolation(constraint)
+		}
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		return store.ForeignKeyViolation(foreignKeys[table])
+	}
+
+	return err
+}
@@ -0,0 +1,46 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// NewTestDatabase creates a migrated sqlite store in a temporary directory that is
+// removed once the test completes.
+func NewTestDatabase(t *testing.T) (*Store, func()) {
+
+	opts := &Config{
+		Path: filepath.Join(t.TempDir(), "fupisha.db"),
+	}
+
+	db, err := connect(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrator := newMigrator(db)
+
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	//tear down the database.
+	teardown := func() {
+		t.Helper()
+		t.Log("Dropping database...")
+		if _, err := migrator.Down(context.Background(), 0); err != nil {
+			t.Fatal(err)
+		}
+		t.Log("Closing database connection...")
+		db.Close()
+	}
+
+	return &Store{
+		&userStore{db: db},
+		&urlStore{db: db},
+		&clickStore{db: db},
+		&utmStore{db: db},
+		&domainStore{db: db},
+	}, teardown
+}
@@ -0,0 +1,359 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/nairobi-gophers/fupisha/encoding"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/pkg/errors"
+)
+
+type urlStore struct {
+	db *sqlx.DB
+}
+
+// NewURL creates a new url record.
+func (u *urlStore) NewURL(ctx context.Context, url store.URL) (store.URL, error) {
+	if url.ShortDomain == "" {
+		return insertURL(ctx, u.db, url)
+	}
+
+	//the short domain has to stay put until the url is committed.
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return store.URL{}, errors.Wrap(err, "beginning url transaction")
+	}
+	defer tx.Rollback()
+
+	created, err := insertURL(ctx, tx, url)
+	if err != nil {
+		return store.URL{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return store.URL{}, errors.Wrap(err, "committing url transaction")
+	}
+
+	return created, nil
+}
+
+// NewURLs creates the url records in a single transaction, all of them or none.
+func (u *urlStore) NewURLs(ctx context.Context, urls []store.URL) ([]store.URL, error) {
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "beginning urls transaction")
+	}
+	defer tx.Rollback()
+
+	created := make([]store.URL, 0, len(urls))
+
+	for i, url := range urls {
+		ur, err := insertURL(ctx, tx, url)
+		if err != nil {
+			return nil, &store.BatchError{Index: i, Err: err}
+		}
+		created = append(created, ur)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "committing urls transaction")
+	}
+
+	return created, nil
+}
+
+// insertURL creates a new url record through db, which is either the database or a transaction.
+func insertURL(ctx context.Context, db sqlx.ExtContext, url store.URL) (store.URL, error) {
+
+	now := time.Now().UTC().Round(time.Microsecond)
+
+	url.ID = encoding.GenUniqueID()
+	url.VisitCount = nil
+	url.ExpiredAt = nil
+	url.StartsAt = roundTime(url.StartsAt)
+	url.ExpiresAt = roundTime(url.ExpiresAt)
+	url.CreatedAt = now
+	url.UpdatedAt = now
+	url.Domain = store.Hostname(url.OriginalURL)
+	url.CanonicalURL = url.Canonical()
+
+	if err := url.HashPassword(); err != nil {
+		return store.URL{}, err
+	}
+
+	if err := checkShortDomain(ctx, db, url); err != nil {
+		return store.URL{}, err
+	}
+
+	const q = `INSERT INTO urls (id,owner,original_url,canonical_url,short_url_param,dedup,starts_at,expires_at,max_clicks,fallback_url,password,title,notes,tags,domain,utm_source,utm_medium,utm_campaign,utm_term,utm_content,routes,variants,app_links,short_domain,created_at,updated_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23,$24,$25,$26)`
+
+	if _, err := db.ExecContext(ctx, q, url.ID, url.Owner, url.OriginalURL, url.CanonicalURL, url.ShortenedURLParam, url.Dedup, url.StartsAt, url.ExpiresAt, url.MaxClicks, url.FallbackURL, url.Password, url.Title, url.Notes, url.Tags, url.Domain, url.UTM.Source, url.UTM.Medium, url.UTM.Campaign, url.UTM.Term, url.UTM.Content, url.Routes, url.Variants, url.AppLinks, url.ShortDomain, url.CreatedAt, url.UpdatedAt); err != nil {
+		return store.URL{}, errors.Wrap(translate(err, "urls"), "inserting new url")
+	}
+
+	return url, nil
+}
+
+// checkShortDomain returns store.ErrUnverifiedDomain unless the short domain of the url is one of its owner's
+// verified domains. Called in a transaction it its transaction holds the write lock until the url is committed so that DeleteDomain can not remove it under the url.
+func checkShortDomain(ctx context.Context, db sqlx.QueryerContext, url store.URL) error {
+	if url.ShortDomain == "" {
+		return nil
+	}
+
+	var verified bool
+
+	const q = `SELECT true FROM domains WHERE owner=$1 AND host=$2 AND verified_at IS NOT NULL`
+
+	err := db.QueryRowxContext(ctx, q, url.Owner, url.ShortDomain).Scan(&verified)
+	if err == sql.ErrNoRows {
+		return errors.Wrap(store.ErrUnverifiedDomain, "inserting new url")
+	}
+	if err != nil {
+		return errors.Wrap(err, "checking short domain")
+	}
+
+	return nil
+}
+
+// GetURLByID retrieves the short url by its given id.
+func (u *urlStore) GetURLByID(ctx context.Context, id uuid.UUID) (store.URL, error) {
+	var url store.URL
+
+	const q = `SELECT * FROM urls WHERE id=$1`
+
+	if err := u.db.GetContext(ctx, &url, q, id); err != nil {
+		return store.URL{}, errors.Wrap(err, "retrieving url by id")
+	}
+
+	return url, nil
+}
+
+// GetURLByParam retrieves the short url by its given param on the default short domain.
+func (u *urlStore) GetURLByParam(ctx context.Context, param string) (store.URL, error) {
+	return u.GetDomainURLByParam(ctx, "", param)
+}
+
+// GetDomainURLByParam retrieves the short url by its given param on the given short domain.
+func (u *urlStore) GetDomainURLByParam(ctx context.Context, domain, param string) (store.URL, error) {
+	var url store.URL
+
+	const q = `SELECT * FROM urls WHERE short_domain=$1 AND short_url_param=$2 AND deleted_at IS NULL`
+	if err := u.db.GetContext(ctx, &url, q, domain, param); err != nil {
+		return store.URL{}, errors.Wrap(err, "retrieving url by param")
+	}
+
+	return url, nil
+}
+
+// ParamTaken reports whether a url, deleted or not, goes by the param on the given short domain.
+func (u *urlStore) ParamTaken(ctx context.Context, domain, param string) (bool, error) {
+	var taken bool
+
+	const q = `SELECT EXISTS (SELECT 1 FROM urls WHERE short_domain=$1 AND short_url_param=$2)`
+	if err := u.db.GetContext(ctx, &taken, q, domain, param); err != nil {
+		return false, errors.Wrap(err, "checking param")
+	}
+
+	return taken, nil
+}
+
+// GetURLByLongStr retrieves the owner's dedup short url of the given canonical url.
+func (u *urlStore) GetURLByLongStr(ctx context.Context, owner uuid.UUID, canonicalURL string) (store.URL, error) {
+	var url store.URL
+
+	const q = `SELECT * FROM urls WHERE owner=$1 AND canonical_url=$2 AND dedup AND deleted_at IS NULL`
+	if err := u.db.GetContext(ctx, &url, q, owner, canonicalURL); err != nil {
+		return store.URL{}, errors.Wrap(err, "retrieving short url param by long url")
+	}
+
+	return url, nil
+}
+
+// GetURLsByOwner retrieves every url of the owner, newest first.
+func (u *urlStore) GetURLsByOwner(ctx context.Context, owner uuid.UUID) ([]store.URL, error) {
+	urls := []store.URL{}
+
+	const q = `SELECT * FROM urls WHERE owner=$1 ORDER BY created_at DESC, id DESC`
+	if err := u.db.SelectContext(ctx, &urls, q, owner); err != nil {
+		return nil, errors.Wrap(err, "retrieving urls by owner")
+	}
+
+	return urls, nil
+}
+
+// FindURLs retrieves a page of the owner's urls matching the filter, newest first.
+func (u *urlStore) FindURLs(ctx context.Context, filter store.URLFilter) ([]store.URL, error) {
+	urls := []store.URL{}
+
+	var (
+		conds []string
+		args  []interface{}
+	)
+
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	conds = append(conds, "owner="+arg(filter.Owner))
+
+	if filter.Deleted {
+		conds = append(conds, "deleted_at IS NOT NULL")
+	} else {
+		conds = append(conds, "deleted_at IS NULL")
+	}
+
+	if filter.CreatedAfter != nil {
+		conds = append(conds, "created_at>="+arg(*roundTime(filter.CreatedAfter)))
+	}
+
+	if filter.CreatedBefore != nil {
+		conds = append(conds, "created_at<"+arg(*roundTime(filter.CreatedBefore)))
+	}
+
+	if filter.Domain != "" {
+		conds = append(conds, "(domain="+arg(filter.Domain)+" OR domain LIKE "+arg("%."+escapeLike(filter.Domain))+" ESCAPE '\\')")
+	}
+
+	if len(filter.Tags) > 0 {
+		for _, tag := range filter.Tags {
+			conds = append(conds, "EXISTS (SELECT 1 FROM json_each(urls.tags) WHERE value="+arg(tag)+")")
+		}
+	}
+
+	if filter.Campaign != "" {
+		conds = append(conds, "utm_campaign="+arg(filter.Campaign))
+	}
+
+	switch filter.State {
+	case store.URLActive:
+		now := arg(time.Now().UTC().Round(time.Microsecond))
+		conds = append(conds, "(starts_at IS NULL OR starts_at<="+now+") AND expired_at IS NULL AND (expires_at IS NULL OR expires_at>"+now+") AND (max_clicks IS NULL OR COALESCE(visit_count,0)<max_clicks)")
+	case store.URLExpired:
+		conds = append(conds, "(expired_at IS NOT NULL OR expires_at<="+arg(time.Now().UTC().Round(time.Microsecond))+" OR COALESCE(visit_count,0)>=max_clicks)")
+	}
+
+	//there is no full-text index, every word of the search has to appear somewhere in the url or its description.
+	//words match by prefix like the postgresql search, the space in front lets the document's first word match.
+	//Search terms are made of letters and digits only, none of them is special to GLOB.
+	for _, term := range store.SearchTerms(filter.Search) {
+		conds = append(conds, "lower(' ' || original_url || ' ' || short_url_param || ' ' || title || ' ' || notes) GLOB "+arg("*[^a-z0-9]"+term+"*"))
+	}
+
+	if filter.After != nil {
+		conds = append(conds, "(created_at,id)<("+arg(filter.After.CreatedAt.UTC().Round(time.Microsecond))+","+arg(filter.After.ID)+")")
+	}
+
+	q := `SELECT * FROM urls WHERE ` + strings.Join(conds, " AND ") + ` ORDER BY created_at DESC, id DESC`
+
+	if filter.Limit > 0 {
+		q += ` LIMIT ` + arg(filter.Limit)
+	}
+
+	if err := u.db.SelectContext(ctx, &urls, q, args...); err != nil {
+		return nil, errors.Wrap(err, "finding urls")
+	}
+
+	return urls, nil
+}
+
+// CampaignStats counts the owner's live urls per utm campaign and the clicks on them, most clicked first.
+func (u *urlStore) CampaignStats(ctx context.Context, owner uuid.UUID) ([]store.CampaignStats, error) {
+	stats := []store.CampaignStats{}
+
+	const q = `SELECT utm_campaign AS campaign, COUNT(*) AS links, COALESCE(SUM(visit_count),0) AS clicks FROM urls
+	WHERE owner=$1 AND deleted_at IS NULL AND utm_campaign<>'' GROUP BY utm_campaign ORDER BY clicks DESC, campaign`
+	if err := u.db.SelectContext(ctx, &stats, q, owner); err != nil {
+		return nil, errors.Wrap(err, "counting urls per campaign")
+	}
+
+	return stats, nil
+}
+
+// UpdateURL saves the original and canonical url, param, schedule, description, utm parameters, routes, variants and app links of the given url and clears its expired at.
+func (u *urlStore) UpdateURL(ctx context.Context, url store.URL) (store.URL, error) {
+	const q = `UPDATE urls SET original_url=$2,canonical_url=$3,short_url_param=$4,starts_at=$5,expires_at=$6,max_clicks=$7,fallback_url=$8,title=$9,notes=$10,tags=$11,domain=$12,utm_source=$13,utm_medium=$14,utm_campaign=$15,utm_term=$16,utm_content=$17,routes=$18,variants=$19,app_links=$20,expired_at=NULL,updated_at=$21 WHERE id=$1`
+
+	res, err := u.db.ExecContext(ctx, q, url.ID, url.OriginalURL, url.Canonical(), url.ShortenedURLParam, roundTime(url.StartsAt), roundTime(url.ExpiresAt), url.MaxClicks, url.FallbackURL, url.Title, url.Notes, url.Tags, store.Hostname(url.OriginalURL), url.UTM.Source, url.UTM.Medium, url.UTM.Campaign, url.UTM.Term, url.UTM.Content, url.Routes, url.Variants, url.AppLinks, time.Now().UTC().Round(time.Microsecond))
+	if err != nil {
+		return store.URL{}, errors.Wrap(translate(err, "urls"), "updating url")
+	}
+
+	if err := affectedOne(res); err != nil {
+		return store.URL{}, errors.Wrap(err, "updating url")
+	}
+
+	return u.GetURLByID(ctx, url.ID)
+}
+
+// DeleteURL soft deletes the url, it stops redirecting but keeps its param until it is restored.
+func (u *urlStore) DeleteURL(ctx context.Context, id uuid.UUID) error {
+	const q = `UPDATE urls SET deleted_at=$2 WHERE id=$1 AND deleted_at IS NULL`
+
+	res, err := u.db.ExecContext(ctx, q, id, time.Now().UTC().Round(time.Microsecond))
+	if err != nil {
+		return errors.Wrap(err, "deleting url")
+	}
+
+	return errors.Wrap(affectedOne(res), "deleting url")
+}
+
+// RestoreURL brings back a deleted url.
+func (u *urlStore) RestoreURL(ctx context.Context, id uuid.UUID) error {
+	const q = `UPDATE urls SET deleted_at=NULL WHERE id=$1 AND deleted_at IS NOT NULL`
+
+	res, err := u.db.ExecContext(ctx, q, id)
+	if err != nil {
+		return errors.Wrap(translate(err, "urls"), "restoring url")
+	}
+
+	return errors.Wrap(affectedOne(res), "restoring url")
+}
+
+// ExpireURLs marks the urls that expired or ran out of clicks by now and returns how many it marked.
+func (u *urlStore) ExpireURLs(ctx context.Context, now time.Time) (int64, error) {
+	const q = `UPDATE urls SET expired_at=$1 WHERE expired_at IS NULL AND (expires_at <= $1 OR COALESCE(visit_count,0) >= max_clicks)`
+
+	res, err := u.db.ExecContext(ctx, q, now.UTC().Round(time.Microsecond))
+	if err != nil {
+		return 0, errors.Wrap(err, "expiring urls")
+	}
+
+	return res.RowsAffected()
+}
+
+// roundTime returns a copy of t in UTC rounded to the microsecond, like every other stored time.
+func roundTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	rounded := t.UTC().Round(time.Microsecond)
+	return &rounded
+}
+
+// escapeLike escapes the LIKE wildcards in s so that it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// affectedOne returns sql.ErrNoRows when the statement changed no url.
+func affectedOne(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
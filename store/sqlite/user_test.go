@@ -0,0 +1,124 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/pkg/errors"
+)
+
+func TestUser(t *testing.T) {
+
+	s, teardown := NewTestDatabase(t)
+	t.Cleanup(teardown)
+
+	ctx := context.Background()
+
+	wantEmail := "test_user@test.com"
+	wantPassword := "test_password"
+
+	u, err := s.NewUser(ctx, wantEmail, wantPassword)
+
+	if err != nil {
+		t.Fatalf("failed to create test_user1: %s", err)
+	}
+
+	got, err := s.GetUserByEmail(ctx, wantEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sinceCreatedAt := time.Since(got.CreatedAt)
+
+	if sinceCreatedAt > 3*time.Second || sinceCreatedAt < 0 {
+		t.Fatalf("bad user.CreatedAt: %v", got.CreatedAt)
+	}
+
+	want := store.User{
+		ID:                  u.ID,
+		Email:               wantEmail,
+		VerificationExpires: u.VerificationExpires,
+		VerificationToken:   u.VerificationToken,
+		Password:            u.Password,
+		CreatedAt:           u.CreatedAt,
+		UpdatedAt:           u.UpdatedAt,
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v want %+v", got, want)
+	}
+
+	if _, err := got.Compare(got.Password, wantPassword); err != nil {
+		t.Fatalf("failed to compare password: %s", err)
+	}
+
+	u1, err := s.GetUserByVerificationToken(ctx, u.VerificationToken)
+	if err != nil {
+		t.Fatalf("bad user verification token: %v", u.VerificationToken)
+	}
+
+	if !reflect.DeepEqual(u1, want) {
+		t.Fatalf("got %+v want %+v", u1, want)
+	}
+
+	if err := s.SetUserVerified(ctx, u1.ID); err != nil {
+		t.Fatalf("failed to update the verified field: %s", err)
+	}
+
+	got1, err := s.GetUserByID(ctx, u1.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !got1.Verified {
+		t.Fatalf("got %t want %t", got1.Verified, true)
+	}
+
+	_, err = s.NewUser(ctx, wantEmail, wantPassword)
+	pqErr, ok := errors.Cause(err).(*pq.Error)
+	if !ok || pqErr.Code != pq.ErrorCode("23505") {
+		t.Fatalf("got %v want a unique violation", err)
+	}
+}
+
+func TestUserConcurrentSignup(t *testing.T) {
+	s, teardown := NewTestDatabase(t)
+	t.Cleanup(teardown)
+
+	ctx := context.Background()
+
+	const workers = 8
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			//half of the workers race for the same email.
+			_, err := s.NewUser(ctx, fmt.Sprintf("user%d@test.com", i%(workers/2)), "test_password")
+			errs <- err
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	var failed int
+	for err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+
+	if failed != workers/2 {
+		t.Fatalf("got %d failed signups want %d", failed, workers/2)
+	}
+}
@@ -0,0 +1,65 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/nairobi-gophers/fupisha/store"
+	"github.com/pkg/errors"
+)
+
+type utmStore struct {
+	db *sqlx.DB
+}
+
+// SaveUTMPreset creates the owner's preset, or replaces the parameters of the one of the same name.
+func (u *utmStore) SaveUTMPreset(ctx context.Context, preset store.UTMPreset) (store.UTMPreset, error) {
+	now := time.Now().UTC().Round(time.Microsecond)
+
+	const q = `INSERT INTO utm_presets (owner,name,utm_source,utm_medium,utm_campaign,utm_term,utm_content,created_at,updated_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$8)
+	ON CONFLICT (owner,name) DO UPDATE SET utm_source=excluded.utm_source,utm_medium=excluded.utm_medium,utm_campaign=excluded.utm_campaign,utm_term=excluded.utm_term,utm_content=excluded.utm_content,updated_at=excluded.updated_at`
+
+	if _, err := u.db.ExecContext(ctx, q, preset.Owner, preset.Name, preset.Source, preset.Medium, preset.Campaign, preset.Term, preset.Content, now); err != nil {
+		return store.UTMPreset{}, errors.Wrap(translate(err, "utm_presets"), "saving utm preset")
+	}
+
+	return u.GetUTMPreset(ctx, preset.Owner, preset.Name)
+}
+
+// GetUTMPreset retrieves the owner's preset of the given name.
+func (u *utmStore) GetUTMPreset(ctx context.Context, owner uuid.UUID, name string) (store.UTMPreset, error) {
+	var preset store.UTMPreset
+
+	const q = `SELECT * FROM utm_presets WHERE owner=$1 AND name=$2`
+	if err := u.db.GetContext(ctx, &preset, q, owner, name); err != nil {
+		return store.UTMPreset{}, errors.Wrap(err, "retrieving utm preset")
+	}
+
+	return preset, nil
+}
+
+// GetUTMPresets retrieves every preset of the owner by name.
+func (u *utmStore) GetUTMPresets(ctx context.Context, owner uuid.UUID) ([]store.UTMPreset, error) {
+	presets := []store.UTMPreset{}
+
+	const q = `SELECT * FROM utm_presets WHERE owner=$1 ORDER BY name`
+	if err := u.db.SelectContext(ctx, &presets, q, owner); err != nil {
+		return nil, errors.Wrap(err, "retrieving utm presets")
+	}
+
+	return presets, nil
+}
+
+// DeleteUTMPreset removes the owner's preset of the given name.
+func (u *utmStore) DeleteUTMPreset(ctx context.Context, owner uuid.UUID, name string) error {
+	const q = `DELETE FROM utm_presets WHERE owner=$1 AND name=$2`
+
+	res, err := u.db.ExecContext(ctx, q, owner, name)
+	if err != nil {
+		return errors.Wrap(err, "deleting utm preset")
+	}
+
+	return errors.Wrap(affectedOne(res), "deleting utm preset")
+}
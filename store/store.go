@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"time"
 
 	"github.com/gofrs/uuid"
 )
@@ -10,6 +11,9 @@ import (
 type Store interface {
 	UserStore
 	URLStore
+	ClickStore
+	UTMPresetStore
+	DomainStore
 }
 
 // UserStore is a user data store interface.
@@ -24,8 +28,82 @@ type UserStore interface {
 
 // URLStore is a url data store interface.
 type URLStore interface {
-	NewURL(ctx context.Context, userID uuid.UUID, originalURL, shortenedURL string) (URL, error)
+	//NewURL creates the given url, generating its id and timestamps.
+	NewURL(ctx context.Context, url URL) (URL, error)
+	//NewURLs creates the given urls in a single transaction, all of them or none. A url that can not
+	//be created rolls back the batch with a *BatchError naming it.
+	NewURLs(ctx context.Context, urls []URL) ([]URL, error)
+	//GetURLByID retrieves the url by its id, deleted urls included.
 	GetURLByID(ctx context.Context, id uuid.UUID) (URL, error)
+	//GetURLByParam retrieves the url a short url param redirects to on the default short domain, deleted urls redirect nowhere.
 	GetURLByParam(ctx context.Context, param string) (URL, error)
-	GetURLByLongStr(ctx context.Context, longURL string) (URL, error)
+	//GetDomainURLByParam retrieves the url a short url param redirects to on the given custom short domain,
+	//the default short domain when it is empty.
+	GetDomainURLByParam(ctx context.Context, domain, param string) (URL, error)
+	//ParamTaken reports whether a url, deleted or not, goes by the param on the given short domain, the
+	//default short domain when it is empty.
+	ParamTaken(ctx context.Context, domain, param string) (bool, error)
+	//GetURLByLongStr retrieves the owner's deduplicated short url of the given canonical url.
+	GetURLByLongStr(ctx context.Context, owner uuid.UUID, canonicalURL string) (URL, error)
+	//GetURLsByOwner retrieves every url of the owner, deleted urls included, newest first.
+	GetURLsByOwner(ctx context.Context, owner uuid.UUID) ([]URL, error)
+	//FindURLs retrieves a page of the owner's urls matching the filter, newest first.
+	FindURLs(ctx context.Context, filter URLFilter) ([]URL, error)
+	//UpdateURL saves the original and canonical url, param, schedule, description, utm parameters, routes, variants and app links of the given url and clears its expired at,
+	//the expiry sweep marks it again if it is still expired.
+	UpdateURL(ctx context.Context, url URL) (URL, error)
+	//DeleteURL soft deletes the url, it stops redirecting but keeps its param until it is restored.
+	DeleteURL(ctx context.Context, id uuid.UUID) error
+	//RestoreURL brings back a deleted url.
+	RestoreURL(ctx context.Context, id uuid.UUID) error
+	//CampaignStats counts the owner's live urls per utm campaign and the clicks on them, most clicked first.
+	CampaignStats(ctx context.Context, owner uuid.UUID) ([]CampaignStats, error)
+	//ExpireURLs marks the urls that expired or ran out of clicks by now and returns how many it marked.
+	ExpireURLs(ctx context.Context, now time.Time) (int64, error)
+}
+
+// ClickStore is a url visit data store interface.
+type ClickStore interface {
+	//NewClick records a click and increments the url's visit count, it returns ErrClickLimit
+	//instead once the url has used up its max clicks.
+	NewClick(ctx context.Context, click Click) (Click, error)
+	//NewClicks records a batch of clicks and increments the visit counts of their urls in one transaction.
+	//It does not enforce max clicks, clicks on capped urls have to go through NewClick.
+	NewClicks(ctx context.Context, clicks []Click) error
+	GetClicksByURL(ctx context.Context, urlID uuid.UUID) ([]Click, error)
+	//FindClicks retrieves a page of the url's clicks matching the filter, oldest first.
+	FindClicks(ctx context.Context, filter ClickFilter) ([]Click, error)
+	//VariantStats counts the clicks on the url per variant served, most clicked first. Clicks served no variant are left out.
+	VariantStats(ctx context.Context, urlID uuid.UUID) ([]VariantStats, error)
+}
+
+// UTMPresetStore is a saved utm preset data store interface.
+type UTMPresetStore interface {
+	//SaveUTMPreset creates the owner's preset, or replaces the one of the same name.
+	SaveUTMPreset(ctx context.Context, preset UTMPreset) (UTMPreset, error)
+	//GetUTMPreset retrieves the owner's preset of the given name.
+	GetUTMPreset(ctx context.Context, owner uuid.UUID, name string) (UTMPreset, error)
+	//GetUTMPresets retrieves every preset of the owner by name.
+	GetUTMPresets(ctx context.Context, owner uuid.UUID) ([]UTMPreset, error)
+	//DeleteUTMPreset removes the owner's preset of the given name.
+	DeleteUTMPreset(ctx context.Context, owner uuid.UUID, name string) error
+}
+
+// DomainStore is a custom short domain data store interface.
+type DomainStore interface {
+	//NewDomain adds the owner's domain unverified, generating its id, token and timestamps.
+	NewDomain(ctx context.Context, domain Domain) (Domain, error)
+	//GetDomainByID retrieves the domain by its id.
+	GetDomainByID(ctx context.Context, id uuid.UUID) (Domain, error)
+	//GetDomainByHost retrieves the verified domain of the given lowercase host.
+	GetDomainByHost(ctx context.Context, host string) (Domain, error)
+	//GetDomain retrieves the owner's domain of the given lowercase host, verified or not.
+	GetDomain(ctx context.Context, owner uuid.UUID, host string) (Domain, error)
+	//GetDomainsByOwner retrieves every domain of the owner by host.
+	GetDomainsByOwner(ctx context.Context, owner uuid.UUID) ([]Domain, error)
+	//UpdateDomain saves the verified at, root url and not found url of the given domain.
+	UpdateDomain(ctx context.Context, domain Domain) (Domain, error)
+	//DeleteDomain removes the domain, it returns ErrDomainInUse instead while urls of its owner, deleted ones
+	//included, are shortened on it.
+	DeleteDomain(ctx context.Context, id uuid.UUID) error
 }
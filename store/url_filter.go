@@ -0,0 +1,121 @@
+package store
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofrs/uuid"
+)
+
+// URLState narrows a url listing down to the urls in that state.
+type URLState string
+
+const (
+	//URLActive urls have started and are neither expired nor exhausted.
+	URLActive URLState = "active"
+	//URLExpired urls have expired, been exhausted or been marked by the expiry sweep.
+	URLExpired URLState = "expired"
+)
+
+// URLCursor is the position of the last url of a page, the next page starts after it.
+type URLCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// URLFilter selects the urls of an owner FindURLs returns, the zero value of a field does not filter.
+type URLFilter struct {
+	Owner uuid.UUID
+	//Deleted lists the deleted urls instead of the live ones.
+	Deleted bool
+	//CreatedAfter and CreatedBefore bound the creation time, inclusive and exclusive respectively.
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	//Domain matches urls to the lowercase host or any of its subdomains.
+	Domain string
+	//Tags the urls must all carry.
+	Tags []string
+	//State narrows the urls down to the active or the expired ones.
+	State URLState
+	//Campaign matches the urls tagged with the utm campaign.
+	Campaign string
+	//Search matches urls whose original url, param, title or notes have a word starting with every word of it.
+	Search string
+	//After continues the listing past the given url.
+	After *URLCursor
+	//Limit most urls returned, zero returns them all.
+	Limit int
+}
+
+// Tags are the labels an owner files a url under, they are stored as a JSON array.
+type Tags []string
+
+// Value implements the driver.Valuer interface.
+func (t Tags) Value() (driver.Value, error) {
+	if t == nil {
+		return "[]", nil
+	}
+
+	b, err := json.Marshal([]string(t))
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+// Scan implements the sql.Scanner interface, an empty array scans to nil.
+func (t *Tags) Scan(src interface{}) error {
+	var b []byte
+
+	switch v := src.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("store: cannot scan %T into tags", src)
+	}
+
+	var tags []string
+	if err := json.Unmarshal(b, &tags); err != nil {
+		return err
+	}
+
+	if len(tags) == 0 {
+		tags = nil
+	}
+
+	*t = tags
+
+	return nil
+}
+
+// Hostname returns the lowercase host of the url, urls without a scheme are read as http urls.
+func Hostname(rawURL string) string {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(u.Hostname())
+}
+
+// SearchTerms splits a search into the lowercase words it is made of, punctuation separates words.
+func SearchTerms(search string) []string {
+	return strings.FieldsFunc(strings.ToLower(search), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
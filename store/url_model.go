@@ -4,15 +4,104 @@ import (
 	"time"
 
 	"github.com/gofrs/uuid"
+	"golang.org/x/crypto/bcrypt"
 )
 
-//URL contains all the related info about the shortened url.
+// URL contains all the related info about the shortened url.
 type URL struct {
-	ID                uuid.UUID `db:"id"`
-	Owner             uuid.UUID `db:"owner"`
-	OriginalURL       string    `db:"original_url"`
-	ShortenedURLParam string    `db:"short_url_param"`
-	VisitCount        *int      `db:"visit_count,omitempty"`
-	CreatedAt         time.Time `db:"created_at"`
-	UpdatedAt         time.Time `db:"updated_at"`
+	ID          uuid.UUID `db:"id"`
+	Owner       uuid.UUID `db:"owner"`
+	OriginalURL string    `db:"original_url"`
+	//CanonicalURL is the canonical form of the original url, the stores fall back to the original url when it is empty.
+	CanonicalURL      string `db:"canonical_url"`
+	ShortenedURLParam string `db:"short_url_param"`
+	//ShortDomain is the host of the custom short domain the url is shortened on, empty for the default
+	//short domain. The param is unique per short domain.
+	ShortDomain string    `db:"short_domain"`
+	VisitCount  *int      `db:"visit_count,omitempty"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+	//Dedup urls are unique per owner and canonical url, shortening the same url again returns them.
+	Dedup bool `db:"dedup"`
+	//StartsAt the url redirects from, nil if it redirects right away.
+	StartsAt *time.Time `db:"starts_at"`
+	//ExpiresAt the url stops redirecting, nil if it never expires.
+	ExpiresAt *time.Time `db:"expires_at"`
+	//MaxClicks the url redirects before it is exhausted, nil if there is no limit.
+	MaxClicks *int `db:"max_clicks"`
+	//FallbackURL visitors are sent to instead while the url is not live, empty to answer with an error.
+	FallbackURL string `db:"fallback_url"`
+	//ExpiredAt is set by the expiry sweep once the url expired or was exhausted.
+	ExpiredAt *time.Time `db:"expired_at"`
+	//Password bcrypt hash visitors have to know the password of, empty if the url is public.
+	Password string `db:"password"`
+	//DeletedAt is set while the url is deleted, nil if it is live.
+	DeletedAt *time.Time `db:"deleted_at"`
+	//Title and Notes describe the url to its owner, they are searched along with the url and its param.
+	Title string `db:"title"`
+	Notes string `db:"notes"`
+	//Tags the owner filed the url under.
+	Tags Tags `db:"tags"`
+	//Domain is the lowercase host of the original url, the stores keep it in step with the url.
+	Domain string `db:"domain"`
+	//UTM are the campaign parameters the original url was tagged with when it was shortened.
+	UTM
+	//Routes send visitors to other destinations by where they are, their device, language and time.
+	Routes Routes `db:"routes"`
+	//Variants split the visitors no route matched across several destinations by weight.
+	Variants Variants `db:"variants"`
+	//AppLinks open the url in its mobile apps.
+	AppLinks AppLinks `db:"app_links"`
+}
+
+// HashPassword hashes the url password using bcrypt hash function, a url without one stays public.
+func (u *URL) HashPassword() error {
+	if u.Password == "" {
+		return nil
+	}
+
+	hash, err := hashPassword(u.Password)
+	if err != nil {
+		return err
+	}
+
+	u.Password = hash
+
+	return nil
+}
+
+// Canonical returns the canonical url the url is deduplicated on, its original url if it has none.
+func (u URL) Canonical() string {
+	if u.CanonicalURL == "" {
+		return u.OriginalURL
+	}
+	return u.CanonicalURL
+}
+
+// Protected reports whether visitors need a password to follow the url.
+func (u URL) Protected() bool {
+	return u.Password != ""
+}
+
+// ComparePassword reports whether the password matches the url password hash.
+func (u URL) ComparePassword(password string) bool {
+	return u.Protected() && bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) == nil
+}
+
+// Started reports whether the url has started redirecting by now.
+func (u URL) Started(now time.Time) bool {
+	return u.StartsAt == nil || !now.Before(*u.StartsAt)
+}
+
+// Expired reports whether the url has expired by now or has run out of clicks.
+func (u URL) Expired(now time.Time) bool {
+	if u.ExpiredAt != nil {
+		return true
+	}
+
+	if u.ExpiresAt != nil && !now.Before(*u.ExpiresAt) {
+		return true
+	}
+
+	return u.MaxClicks != nil && u.VisitCount != nil && *u.VisitCount >= *u.MaxClicks
 }
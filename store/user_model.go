@@ -25,19 +25,29 @@ type User struct {
 //HashPassword hashes the user password using bcrypt hash function
 func (u *User) HashPassword() error {
 
-	pwd := []byte(u.Password)
-
-	hash, err := bcrypt.GenerateFromPassword(pwd, bcrypt.DefaultCost)
+	hash, err := hashPassword(u.Password)
 
 	if err != nil {
 		return err
 	}
 
-	u.Password = string(hash)
+	u.Password = hash
 
 	return nil
 }
 
+//hashPassword returns the bcrypt hash of the password
+func hashPassword(password string) (string, error) {
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
 //Compare compares the password hash against the passed in password string
 func (u User) Compare(hash, password string) (bool, error) {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
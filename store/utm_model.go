@@ -0,0 +1,59 @@
+package store
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// UTM are the campaign parameters a url is tagged with, they are stored next to the url carrying them
+// in its query string.
+type UTM struct {
+	Source   string `db:"utm_source"`
+	Medium   string `db:"utm_medium"`
+	Campaign string `db:"utm_campaign"`
+	Term     string `db:"utm_term"`
+	Content  string `db:"utm_content"`
+}
+
+// IsZero reports whether none of the parameters is set.
+func (u UTM) IsZero() bool {
+	return u == UTM{}
+}
+
+// Merge returns the parameters with the ones set in other replacing them.
+func (u UTM) Merge(other UTM) UTM {
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&u.Source, other.Source},
+		{&u.Medium, other.Medium},
+		{&u.Campaign, other.Campaign},
+		{&u.Term, other.Term},
+		{&u.Content, other.Content},
+	} {
+		if f.src != "" {
+			*f.dst = f.src
+		}
+	}
+
+	return u
+}
+
+// UTMPreset is a set of utm parameters its owner saved under a name to tag links with.
+type UTMPreset struct {
+	Owner uuid.UUID `db:"owner"`
+	//Name is unique per owner.
+	Name string `db:"name"`
+	UTM
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// CampaignStats are the live urls of an owner tagged with a utm campaign and the clicks on them.
+type CampaignStats struct {
+	Campaign string `db:"campaign"`
+	Links    int    `db:"links"`
+	Clicks   int    `db:"clicks"`
+}
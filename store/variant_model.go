@@ -0,0 +1,80 @@
+package store
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Variant is one of the destinations a url splits its visitors across, each visitor is served a
+// variant with a chance of its weight over the weights of all variants.
+type Variant struct {
+	//Name identifies the variant in the clicks served it e.g. a or landing-b.
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// Variants are the destinations of a url running an a/b split, none if it sends every visitor to
+// its original url.
+type Variants []Variant
+
+// Value implements the driver.Valuer interface, no variants are stored as an empty array.
+func (v Variants) Value() (driver.Value, error) {
+	if len(v) == 0 {
+		return "[]", nil
+	}
+
+	b, err := json.Marshal([]Variant(v))
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (v *Variants) Scan(src interface{}) error {
+	var b []byte
+
+	switch s := src.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case []byte:
+		b = s
+	case string:
+		b = []byte(s)
+	default:
+		return fmt.Errorf("store: cannot scan %T into variants", src)
+	}
+
+	var variants []Variant
+	if err := json.Unmarshal(b, &variants); err != nil {
+		return err
+	}
+
+	if len(variants) == 0 {
+		variants = nil
+	}
+
+	*v = variants
+
+	return nil
+}
+
+// Find returns the variant of the given name.
+func (v Variants) Find(name string) (Variant, bool) {
+	for _, variant := range v {
+		if variant.Name == name {
+			return variant, true
+		}
+	}
+	return Variant{}, false
+}
+
+// VariantStats are the clicks on a url served one of its variants.
+type VariantStats struct {
+	Variant string `db:"variant"`
+	Clicks  int    `db:"clicks"`
+}